@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"myDvpn/base/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FailoverClient is a BaseNode client for a set of BaseNode cluster members.
+// Calls go to the member that last answered and move on to the next one when
+// it is unreachable; any member accepts writes since followers forward them.
+type FailoverClient struct {
+	addrs   []string
+	conns   []*grpc.ClientConn
+	clients []proto.BaseNodeClient
+	current int
+	logger  *logrus.Logger
+	mutex   sync.Mutex
+}
+
+// NewFailoverClient dials every BaseNode address
+func NewFailoverClient(addrs []string, creds *utils.TLSCredentials, logger *logrus.Logger) (*FailoverClient, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no BaseNode addresses configured")
+	}
+
+	fc := &FailoverClient{
+		addrs:  addrs,
+		logger: logger,
+	}
+
+	for _, addr := range addrs {
+		conn, err := grpc.Dial(addr, creds.DialOption())
+		if err != nil {
+			fc.Close()
+			return nil, fmt.Errorf("failed to dial BaseNode %s: %w", addr, err)
+		}
+		fc.conns = append(fc.conns, conn)
+		fc.clients = append(fc.clients, proto.NewBaseNodeClient(conn))
+	}
+
+	return fc, nil
+}
+
+// ParseAddrs splits a comma-separated address list
+func ParseAddrs(list string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// RegisterSuperNode registers a SuperNode with the first reachable BaseNode
+func (fc *FailoverClient) RegisterSuperNode(ctx context.Context, in *proto.RegisterSuperNodeRequest, opts ...grpc.CallOption) (*proto.RegisterSuperNodeResponse, error) {
+	var resp *proto.RegisterSuperNodeResponse
+	err := fc.call(func(client proto.BaseNodeClient) error {
+		var err error
+		resp, err = client.RegisterSuperNode(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// RequestExitRegion asks the first reachable BaseNode for exit candidates
+func (fc *FailoverClient) RequestExitRegion(ctx context.Context, in *proto.RequestExitRegionRequest, opts ...grpc.CallOption) (*proto.RequestExitRegionResponse, error) {
+	var resp *proto.RequestExitRegionResponse
+	err := fc.call(func(client proto.BaseNodeClient) error {
+		var err error
+		resp, err = client.RequestExitRegion(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// ListSuperNodes lists SuperNodes known to the first reachable BaseNode
+func (fc *FailoverClient) ListSuperNodes(ctx context.Context, in *proto.ListSuperNodesRequest, opts ...grpc.CallOption) (*proto.ListSuperNodesResponse, error) {
+	var resp *proto.ListSuperNodesResponse
+	err := fc.call(func(client proto.BaseNodeClient) error {
+		var err error
+		resp, err = client.ListSuperNodes(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// Current returns the address calls are currently sent to
+func (fc *FailoverClient) Current() string {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.addrs[fc.current]
+}
+
+// Close closes every connection
+func (fc *FailoverClient) Close() error {
+	for _, conn := range fc.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// call runs fn against each BaseNode in turn, starting with the current one,
+// until one answers with something other than Unavailable
+func (fc *FailoverClient) call(fn func(proto.BaseNodeClient) error) error {
+	fc.mutex.Lock()
+	start := fc.current
+	fc.mutex.Unlock()
+
+	var lastErr error
+	for i := 0; i < len(fc.clients); i++ {
+		index := (start + i) % len(fc.clients)
+
+		err := fn(fc.clients[index])
+		if status.Code(err) != codes.Unavailable {
+			if index != start {
+				fc.mutex.Lock()
+				fc.current = index
+				fc.mutex.Unlock()
+
+				fc.logger.WithFields(logrus.Fields{
+					"from": fc.addrs[start],
+					"to":   fc.addrs[index],
+				}).Warn("Failed over to another BaseNode")
+			}
+			return err
+		}
+
+		fc.logger.WithError(err).WithField("basenode", fc.addrs[index]).Debug("BaseNode unavailable")
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+// Ensure FailoverClient can stand in for a single-connection client
+var _ proto.BaseNodeClient = (*FailoverClient)(nil)
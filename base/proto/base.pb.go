@@ -21,6 +21,52 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type DirectoryCommand_Op int32
+
+const (
+	DirectoryCommand_PUT    DirectoryCommand_Op = 0
+	DirectoryCommand_DELETE DirectoryCommand_Op = 1
+)
+
+// Enum value maps for DirectoryCommand_Op.
+var (
+	DirectoryCommand_Op_name = map[int32]string{
+		0: "PUT",
+		1: "DELETE",
+	}
+	DirectoryCommand_Op_value = map[string]int32{
+		"PUT":    0,
+		"DELETE": 1,
+	}
+)
+
+func (x DirectoryCommand_Op) Enum() *DirectoryCommand_Op {
+	p := new(DirectoryCommand_Op)
+	*p = x
+	return p
+}
+
+func (x DirectoryCommand_Op) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DirectoryCommand_Op) Descriptor() protoreflect.EnumDescriptor {
+	return file_base_proto_base_proto_enumTypes[0].Descriptor()
+}
+
+func (DirectoryCommand_Op) Type() protoreflect.EnumType {
+	return &file_base_proto_base_proto_enumTypes[0]
+}
+
+func (x DirectoryCommand_Op) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DirectoryCommand_Op.Descriptor instead.
+func (DirectoryCommand_Op) EnumDescriptor() ([]byte, []int) {
+	return file_base_proto_base_proto_rawDescGZIP(), []int{8, 0}
+}
+
 type RegisterSuperNodeRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Region        string                 `protobuf:"bytes,1,opt,name=region,proto3" json:"region,omitempty"`
@@ -29,6 +75,7 @@ type RegisterSuperNodeRequest struct {
 	Port          int32                  `protobuf:"varint,4,opt,name=port,proto3" json:"port,omitempty"`
 	CurrentLoad   int32                  `protobuf:"varint,5,opt,name=current_load,json=currentLoad,proto3" json:"current_load,omitempty"` // Number of active peers
 	MaxCapacity   int32                  `protobuf:"varint,6,opt,name=max_capacity,json=maxCapacity,proto3" json:"max_capacity,omitempty"`
+	Load          *SuperNodeLoad         `protobuf:"bytes,7,opt,name=load,proto3" json:"load,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -105,6 +152,114 @@ func (x *RegisterSuperNodeRequest) GetMaxCapacity() int32 {
 	return 0
 }
 
+func (x *RegisterSuperNodeRequest) GetLoad() *SuperNodeLoad {
+	if x != nil {
+		return x.Load
+	}
+	return nil
+}
+
+// SuperNodeLoad breaks down what a SuperNode is serving, reported with every heartbeat
+type SuperNodeLoad struct {
+	state                     protoimpl.MessageState `protogen:"open.v1"`
+	Clients                   int32                  `protobuf:"varint,1,opt,name=clients,proto3" json:"clients,omitempty"`                               // Client streams
+	Exits                     int32                  `protobuf:"varint,2,opt,name=exits,proto3" json:"exits,omitempty"`                                   // Exit peer streams
+	Hybrids                   int32                  `protobuf:"varint,3,opt,name=hybrids,proto3" json:"hybrids,omitempty"`                               // Hybrid peer streams
+	ExitCapacity              int32                  `protobuf:"varint,4,opt,name=exit_capacity,json=exitCapacity,proto3" json:"exit_capacity,omitempty"` // Clients the SuperNode's exit and hybrid peers accept in total
+	ExitClients               int32                  `protobuf:"varint,5,opt,name=exit_clients,json=exitClients,proto3" json:"exit_clients,omitempty"`    // Clients currently set up on those exits
+	RelaySessions             int32                  `protobuf:"varint,6,opt,name=relay_sessions,json=relaySessions,proto3" json:"relay_sessions,omitempty"`
+	RelayBandwidthBps         int64                  `protobuf:"varint,7,opt,name=relay_bandwidth_bps,json=relayBandwidthBps,proto3" json:"relay_bandwidth_bps,omitempty"`                           // Recent throughput of the relay interface, bits per second
+	RelayBandwidthCapacityBps int64                  `protobuf:"varint,8,opt,name=relay_bandwidth_capacity_bps,json=relayBandwidthCapacityBps,proto3" json:"relay_bandwidth_capacity_bps,omitempty"` // 0 if not configured
+	unknownFields             protoimpl.UnknownFields
+	sizeCache                 protoimpl.SizeCache
+}
+
+func (x *SuperNodeLoad) Reset() {
+	*x = SuperNodeLoad{}
+	mi := &file_base_proto_base_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SuperNodeLoad) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SuperNodeLoad) ProtoMessage() {}
+
+func (x *SuperNodeLoad) ProtoReflect() protoreflect.Message {
+	mi := &file_base_proto_base_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SuperNodeLoad.ProtoReflect.Descriptor instead.
+func (*SuperNodeLoad) Descriptor() ([]byte, []int) {
+	return file_base_proto_base_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SuperNodeLoad) GetClients() int32 {
+	if x != nil {
+		return x.Clients
+	}
+	return 0
+}
+
+func (x *SuperNodeLoad) GetExits() int32 {
+	if x != nil {
+		return x.Exits
+	}
+	return 0
+}
+
+func (x *SuperNodeLoad) GetHybrids() int32 {
+	if x != nil {
+		return x.Hybrids
+	}
+	return 0
+}
+
+func (x *SuperNodeLoad) GetExitCapacity() int32 {
+	if x != nil {
+		return x.ExitCapacity
+	}
+	return 0
+}
+
+func (x *SuperNodeLoad) GetExitClients() int32 {
+	if x != nil {
+		return x.ExitClients
+	}
+	return 0
+}
+
+func (x *SuperNodeLoad) GetRelaySessions() int32 {
+	if x != nil {
+		return x.RelaySessions
+	}
+	return 0
+}
+
+func (x *SuperNodeLoad) GetRelayBandwidthBps() int64 {
+	if x != nil {
+		return x.RelayBandwidthBps
+	}
+	return 0
+}
+
+func (x *SuperNodeLoad) GetRelayBandwidthCapacityBps() int64 {
+	if x != nil {
+		return x.RelayBandwidthCapacityBps
+	}
+	return 0
+}
+
 type RegisterSuperNodeResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -115,7 +270,7 @@ type RegisterSuperNodeResponse struct {
 
 func (x *RegisterSuperNodeResponse) Reset() {
 	*x = RegisterSuperNodeResponse{}
-	mi := &file_base_proto_base_proto_msgTypes[1]
+	mi := &file_base_proto_base_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -127,7 +282,7 @@ func (x *RegisterSuperNodeResponse) String() string {
 func (*RegisterSuperNodeResponse) ProtoMessage() {}
 
 func (x *RegisterSuperNodeResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_base_proto_base_proto_msgTypes[1]
+	mi := &file_base_proto_base_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -140,7 +295,7 @@ func (x *RegisterSuperNodeResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RegisterSuperNodeResponse.ProtoReflect.Descriptor instead.
 func (*RegisterSuperNodeResponse) Descriptor() ([]byte, []int) {
-	return file_base_proto_base_proto_rawDescGZIP(), []int{1}
+	return file_base_proto_base_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *RegisterSuperNodeResponse) GetSuccess() bool {
@@ -167,7 +322,7 @@ type RequestExitRegionRequest struct {
 
 func (x *RequestExitRegionRequest) Reset() {
 	*x = RequestExitRegionRequest{}
-	mi := &file_base_proto_base_proto_msgTypes[2]
+	mi := &file_base_proto_base_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -179,7 +334,7 @@ func (x *RequestExitRegionRequest) String() string {
 func (*RequestExitRegionRequest) ProtoMessage() {}
 
 func (x *RequestExitRegionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_base_proto_base_proto_msgTypes[2]
+	mi := &file_base_proto_base_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -192,7 +347,7 @@ func (x *RequestExitRegionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RequestExitRegionRequest.ProtoReflect.Descriptor instead.
 func (*RequestExitRegionRequest) Descriptor() ([]byte, []int) {
-	return file_base_proto_base_proto_rawDescGZIP(), []int{2}
+	return file_base_proto_base_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *RequestExitRegionRequest) GetTargetRegion() string {
@@ -218,7 +373,7 @@ type RequestExitRegionResponse struct {
 
 func (x *RequestExitRegionResponse) Reset() {
 	*x = RequestExitRegionResponse{}
-	mi := &file_base_proto_base_proto_msgTypes[3]
+	mi := &file_base_proto_base_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -230,7 +385,7 @@ func (x *RequestExitRegionResponse) String() string {
 func (*RequestExitRegionResponse) ProtoMessage() {}
 
 func (x *RequestExitRegionResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_base_proto_base_proto_msgTypes[3]
+	mi := &file_base_proto_base_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -243,7 +398,7 @@ func (x *RequestExitRegionResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RequestExitRegionResponse.ProtoReflect.Descriptor instead.
 func (*RequestExitRegionResponse) Descriptor() ([]byte, []int) {
-	return file_base_proto_base_proto_rawDescGZIP(), []int{3}
+	return file_base_proto_base_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *RequestExitRegionResponse) GetCandidateSupernodes() []*SuperNodeInfo {
@@ -261,7 +416,7 @@ type ListSuperNodesRequest struct {
 
 func (x *ListSuperNodesRequest) Reset() {
 	*x = ListSuperNodesRequest{}
-	mi := &file_base_proto_base_proto_msgTypes[4]
+	mi := &file_base_proto_base_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -273,7 +428,7 @@ func (x *ListSuperNodesRequest) String() string {
 func (*ListSuperNodesRequest) ProtoMessage() {}
 
 func (x *ListSuperNodesRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_base_proto_base_proto_msgTypes[4]
+	mi := &file_base_proto_base_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -286,7 +441,7 @@ func (x *ListSuperNodesRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListSuperNodesRequest.ProtoReflect.Descriptor instead.
 func (*ListSuperNodesRequest) Descriptor() ([]byte, []int) {
-	return file_base_proto_base_proto_rawDescGZIP(), []int{4}
+	return file_base_proto_base_proto_rawDescGZIP(), []int{5}
 }
 
 type ListSuperNodesResponse struct {
@@ -298,7 +453,7 @@ type ListSuperNodesResponse struct {
 
 func (x *ListSuperNodesResponse) Reset() {
 	*x = ListSuperNodesResponse{}
-	mi := &file_base_proto_base_proto_msgTypes[5]
+	mi := &file_base_proto_base_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -310,7 +465,7 @@ func (x *ListSuperNodesResponse) String() string {
 func (*ListSuperNodesResponse) ProtoMessage() {}
 
 func (x *ListSuperNodesResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_base_proto_base_proto_msgTypes[5]
+	mi := &file_base_proto_base_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -323,7 +478,7 @@ func (x *ListSuperNodesResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListSuperNodesResponse.ProtoReflect.Descriptor instead.
 func (*ListSuperNodesResponse) Descriptor() ([]byte, []int) {
-	return file_base_proto_base_proto_rawDescGZIP(), []int{5}
+	return file_base_proto_base_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *ListSuperNodesResponse) GetSupernodes() []*SuperNodeInfo {
@@ -342,13 +497,15 @@ type SuperNodeInfo struct {
 	CurrentLoad   int32                  `protobuf:"varint,5,opt,name=current_load,json=currentLoad,proto3" json:"current_load,omitempty"`
 	MaxCapacity   int32                  `protobuf:"varint,6,opt,name=max_capacity,json=maxCapacity,proto3" json:"max_capacity,omitempty"`
 	LastHeartbeat int64                  `protobuf:"varint,7,opt,name=last_heartbeat,json=lastHeartbeat,proto3" json:"last_heartbeat,omitempty"` // Unix timestamp
+	Verified      bool                   `protobuf:"varint,8,opt,name=verified,proto3" json:"verified,omitempty"`                                // False for registrations restored from disk until the SuperNode heartbeats again
+	Load          *SuperNodeLoad         `protobuf:"bytes,9,opt,name=load,proto3" json:"load,omitempty"`                                         // Unset for SuperNodes that do not report it
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *SuperNodeInfo) Reset() {
 	*x = SuperNodeInfo{}
-	mi := &file_base_proto_base_proto_msgTypes[6]
+	mi := &file_base_proto_base_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -360,7 +517,7 @@ func (x *SuperNodeInfo) String() string {
 func (*SuperNodeInfo) ProtoMessage() {}
 
 func (x *SuperNodeInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_base_proto_base_proto_msgTypes[6]
+	mi := &file_base_proto_base_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -373,7 +530,7 @@ func (x *SuperNodeInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SuperNodeInfo.ProtoReflect.Descriptor instead.
 func (*SuperNodeInfo) Descriptor() ([]byte, []int) {
-	return file_base_proto_base_proto_rawDescGZIP(), []int{6}
+	return file_base_proto_base_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *SuperNodeInfo) GetSupernodeId() string {
@@ -425,11 +582,131 @@ func (x *SuperNodeInfo) GetLastHeartbeat() int64 {
 	return 0
 }
 
+func (x *SuperNodeInfo) GetVerified() bool {
+	if x != nil {
+		return x.Verified
+	}
+	return false
+}
+
+func (x *SuperNodeInfo) GetLoad() *SuperNodeLoad {
+	if x != nil {
+		return x.Load
+	}
+	return nil
+}
+
+// DirectoryCommand is a change to the SuperNode directory replicated through the BaseNode cluster
+type DirectoryCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Op            DirectoryCommand_Op    `protobuf:"varint,1,opt,name=op,proto3,enum=base.DirectoryCommand_Op" json:"op,omitempty"`
+	Info          *SuperNodeInfo         `protobuf:"bytes,2,opt,name=info,proto3" json:"info,omitempty"` // Set for PUT
+	SupernodeId   string                 `protobuf:"bytes,3,opt,name=supernode_id,json=supernodeId,proto3" json:"supernode_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DirectoryCommand) Reset() {
+	*x = DirectoryCommand{}
+	mi := &file_base_proto_base_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DirectoryCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DirectoryCommand) ProtoMessage() {}
+
+func (x *DirectoryCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_base_proto_base_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DirectoryCommand.ProtoReflect.Descriptor instead.
+func (*DirectoryCommand) Descriptor() ([]byte, []int) {
+	return file_base_proto_base_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DirectoryCommand) GetOp() DirectoryCommand_Op {
+	if x != nil {
+		return x.Op
+	}
+	return DirectoryCommand_PUT
+}
+
+func (x *DirectoryCommand) GetInfo() *SuperNodeInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *DirectoryCommand) GetSupernodeId() string {
+	if x != nil {
+		return x.SupernodeId
+	}
+	return ""
+}
+
+// DirectorySnapshot is the full SuperNode directory, used to compact the cluster log
+type DirectorySnapshot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Supernodes    []*SuperNodeInfo       `protobuf:"bytes,1,rep,name=supernodes,proto3" json:"supernodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DirectorySnapshot) Reset() {
+	*x = DirectorySnapshot{}
+	mi := &file_base_proto_base_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DirectorySnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DirectorySnapshot) ProtoMessage() {}
+
+func (x *DirectorySnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_base_proto_base_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DirectorySnapshot.ProtoReflect.Descriptor instead.
+func (*DirectorySnapshot) Descriptor() ([]byte, []int) {
+	return file_base_proto_base_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DirectorySnapshot) GetSupernodes() []*SuperNodeInfo {
+	if x != nil {
+		return x.Supernodes
+	}
+	return nil
+}
+
 var File_base_proto_base_proto protoreflect.FileDescriptor
 
 const file_base_proto_base_proto_rawDesc = "" +
 	"\n" +
-	"\x15base/proto/base.proto\x12\x04base\"\xce\x01\n" +
+	"\x15base/proto/base.proto\x12\x04base\"\xf7\x01\n" +
 	"\x18RegisterSuperNodeRequest\x12\x16\n" +
 	"\x06region\x18\x01 \x01(\tR\x06region\x12!\n" +
 	"\fsupernode_id\x18\x02 \x01(\tR\vsupernodeId\x12\x1d\n" +
@@ -437,7 +714,17 @@ const file_base_proto_base_proto_rawDesc = "" +
 	"ip_address\x18\x03 \x01(\tR\tipAddress\x12\x12\n" +
 	"\x04port\x18\x04 \x01(\x05R\x04port\x12!\n" +
 	"\fcurrent_load\x18\x05 \x01(\x05R\vcurrentLoad\x12!\n" +
-	"\fmax_capacity\x18\x06 \x01(\x05R\vmaxCapacity\"O\n" +
+	"\fmax_capacity\x18\x06 \x01(\x05R\vmaxCapacity\x12'\n" +
+	"\x04load\x18\a \x01(\v2\x13.base.SuperNodeLoadR\x04load\"\xb9\x02\n" +
+	"\rSuperNodeLoad\x12\x18\n" +
+	"\aclients\x18\x01 \x01(\x05R\aclients\x12\x14\n" +
+	"\x05exits\x18\x02 \x01(\x05R\x05exits\x12\x18\n" +
+	"\ahybrids\x18\x03 \x01(\x05R\ahybrids\x12#\n" +
+	"\rexit_capacity\x18\x04 \x01(\x05R\fexitCapacity\x12!\n" +
+	"\fexit_clients\x18\x05 \x01(\x05R\vexitClients\x12%\n" +
+	"\x0erelay_sessions\x18\x06 \x01(\x05R\rrelaySessions\x12.\n" +
+	"\x13relay_bandwidth_bps\x18\a \x01(\x03R\x11relayBandwidthBps\x12?\n" +
+	"\x1crelay_bandwidth_capacity_bps\x18\b \x01(\x03R\x19relayBandwidthCapacityBps\"O\n" +
 	"\x19RegisterSuperNodeResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\"w\n" +
@@ -450,7 +737,7 @@ const file_base_proto_base_proto_rawDesc = "" +
 	"\x16ListSuperNodesResponse\x123\n" +
 	"\n" +
 	"supernodes\x18\x01 \x03(\v2\x13.base.SuperNodeInfoR\n" +
-	"supernodes\"\xea\x01\n" +
+	"supernodes\"\xaf\x02\n" +
 	"\rSuperNodeInfo\x12!\n" +
 	"\fsupernode_id\x18\x01 \x01(\tR\vsupernodeId\x12\x16\n" +
 	"\x06region\x18\x02 \x01(\tR\x06region\x12\x1d\n" +
@@ -459,7 +746,21 @@ const file_base_proto_base_proto_rawDesc = "" +
 	"\x04port\x18\x04 \x01(\x05R\x04port\x12!\n" +
 	"\fcurrent_load\x18\x05 \x01(\x05R\vcurrentLoad\x12!\n" +
 	"\fmax_capacity\x18\x06 \x01(\x05R\vmaxCapacity\x12%\n" +
-	"\x0elast_heartbeat\x18\a \x01(\x03R\rlastHeartbeat2\x83\x02\n" +
+	"\x0elast_heartbeat\x18\a \x01(\x03R\rlastHeartbeat\x12\x1a\n" +
+	"\bverified\x18\b \x01(\bR\bverified\x12'\n" +
+	"\x04load\x18\t \x01(\v2\x13.base.SuperNodeLoadR\x04load\"\xa4\x01\n" +
+	"\x10DirectoryCommand\x12)\n" +
+	"\x02op\x18\x01 \x01(\x0e2\x19.base.DirectoryCommand.OpR\x02op\x12'\n" +
+	"\x04info\x18\x02 \x01(\v2\x13.base.SuperNodeInfoR\x04info\x12!\n" +
+	"\fsupernode_id\x18\x03 \x01(\tR\vsupernodeId\"\x19\n" +
+	"\x02Op\x12\a\n" +
+	"\x03PUT\x10\x00\x12\n" +
+	"\n" +
+	"\x06DELETE\x10\x01\"H\n" +
+	"\x11DirectorySnapshot\x123\n" +
+	"\n" +
+	"supernodes\x18\x01 \x03(\v2\x13.base.SuperNodeInfoR\n" +
+	"supernodes2\x83\x02\n" +
 	"\bBaseNode\x12T\n" +
 	"\x11RegisterSuperNode\x12\x1e.base.RegisterSuperNodeRequest\x1a\x1f.base.RegisterSuperNodeResponse\x12T\n" +
 	"\x11RequestExitRegion\x12\x1e.base.RequestExitRegionRequest\x1a\x1f.base.RequestExitRegionResponse\x12K\n" +
@@ -477,30 +778,40 @@ func file_base_proto_base_proto_rawDescGZIP() []byte {
 	return file_base_proto_base_proto_rawDescData
 }
 
-var file_base_proto_base_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_base_proto_base_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_base_proto_base_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_base_proto_base_proto_goTypes = []any{
-	(*RegisterSuperNodeRequest)(nil),  // 0: base.RegisterSuperNodeRequest
-	(*RegisterSuperNodeResponse)(nil), // 1: base.RegisterSuperNodeResponse
-	(*RequestExitRegionRequest)(nil),  // 2: base.RequestExitRegionRequest
-	(*RequestExitRegionResponse)(nil), // 3: base.RequestExitRegionResponse
-	(*ListSuperNodesRequest)(nil),     // 4: base.ListSuperNodesRequest
-	(*ListSuperNodesResponse)(nil),    // 5: base.ListSuperNodesResponse
-	(*SuperNodeInfo)(nil),             // 6: base.SuperNodeInfo
+	(DirectoryCommand_Op)(0),          // 0: base.DirectoryCommand.Op
+	(*RegisterSuperNodeRequest)(nil),  // 1: base.RegisterSuperNodeRequest
+	(*SuperNodeLoad)(nil),             // 2: base.SuperNodeLoad
+	(*RegisterSuperNodeResponse)(nil), // 3: base.RegisterSuperNodeResponse
+	(*RequestExitRegionRequest)(nil),  // 4: base.RequestExitRegionRequest
+	(*RequestExitRegionResponse)(nil), // 5: base.RequestExitRegionResponse
+	(*ListSuperNodesRequest)(nil),     // 6: base.ListSuperNodesRequest
+	(*ListSuperNodesResponse)(nil),    // 7: base.ListSuperNodesResponse
+	(*SuperNodeInfo)(nil),             // 8: base.SuperNodeInfo
+	(*DirectoryCommand)(nil),          // 9: base.DirectoryCommand
+	(*DirectorySnapshot)(nil),         // 10: base.DirectorySnapshot
 }
 var file_base_proto_base_proto_depIdxs = []int32{
-	6, // 0: base.RequestExitRegionResponse.candidate_supernodes:type_name -> base.SuperNodeInfo
-	6, // 1: base.ListSuperNodesResponse.supernodes:type_name -> base.SuperNodeInfo
-	0, // 2: base.BaseNode.RegisterSuperNode:input_type -> base.RegisterSuperNodeRequest
-	2, // 3: base.BaseNode.RequestExitRegion:input_type -> base.RequestExitRegionRequest
-	4, // 4: base.BaseNode.ListSuperNodes:input_type -> base.ListSuperNodesRequest
-	1, // 5: base.BaseNode.RegisterSuperNode:output_type -> base.RegisterSuperNodeResponse
-	3, // 6: base.BaseNode.RequestExitRegion:output_type -> base.RequestExitRegionResponse
-	5, // 7: base.BaseNode.ListSuperNodes:output_type -> base.ListSuperNodesResponse
-	5, // [5:8] is the sub-list for method output_type
-	2, // [2:5] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	2,  // 0: base.RegisterSuperNodeRequest.load:type_name -> base.SuperNodeLoad
+	8,  // 1: base.RequestExitRegionResponse.candidate_supernodes:type_name -> base.SuperNodeInfo
+	8,  // 2: base.ListSuperNodesResponse.supernodes:type_name -> base.SuperNodeInfo
+	2,  // 3: base.SuperNodeInfo.load:type_name -> base.SuperNodeLoad
+	0,  // 4: base.DirectoryCommand.op:type_name -> base.DirectoryCommand.Op
+	8,  // 5: base.DirectoryCommand.info:type_name -> base.SuperNodeInfo
+	8,  // 6: base.DirectorySnapshot.supernodes:type_name -> base.SuperNodeInfo
+	1,  // 7: base.BaseNode.RegisterSuperNode:input_type -> base.RegisterSuperNodeRequest
+	4,  // 8: base.BaseNode.RequestExitRegion:input_type -> base.RequestExitRegionRequest
+	6,  // 9: base.BaseNode.ListSuperNodes:input_type -> base.ListSuperNodesRequest
+	3,  // 10: base.BaseNode.RegisterSuperNode:output_type -> base.RegisterSuperNodeResponse
+	5,  // 11: base.BaseNode.RequestExitRegion:output_type -> base.RequestExitRegionResponse
+	7,  // 12: base.BaseNode.ListSuperNodes:output_type -> base.ListSuperNodesResponse
+	10, // [10:13] is the sub-list for method output_type
+	7,  // [7:10] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_base_proto_base_proto_init() }
@@ -513,13 +824,14 @@ func file_base_proto_base_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_base_proto_base_proto_rawDesc), len(file_base_proto_base_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   7,
+			NumEnums:      1,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_base_proto_base_proto_goTypes,
 		DependencyIndexes: file_base_proto_base_proto_depIdxs,
+		EnumInfos:         file_base_proto_base_proto_enumTypes,
 		MessageInfos:      file_base_proto_base_proto_msgTypes,
 	}.Build()
 	File_base_proto_base_proto = out.File
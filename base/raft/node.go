@@ -0,0 +1,1166 @@
+package raft
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"myDvpn/base/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Node roles
+const (
+	RoleFollower  = "follower"
+	RoleCandidate = "candidate"
+	RoleLeader    = "leader"
+)
+
+const (
+	// tickInterval is how often timers are checked
+	tickInterval = 10 * time.Millisecond
+
+	// maxEntriesPerAppend bounds the entries sent in one AppendEntries call
+	maxEntriesPerAppend = 256
+)
+
+var (
+	// ErrStopped is returned for proposals to a node that has been stopped
+	ErrStopped = errors.New("raft node stopped")
+
+	// ErrLeadershipLost is returned when a proposal was overwritten by a new leader
+	ErrLeadershipLost = errors.New("leadership lost before the entry committed")
+)
+
+// NotLeaderError is returned for proposals made to a node that is not the leader
+type NotLeaderError struct {
+	LeaderID   string // Empty while no leader is known
+	LeaderAddr string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.LeaderID == "" {
+		return "not the cluster leader and no leader is known"
+	}
+	return fmt.Sprintf("not the cluster leader (leader is %s at %s)", e.LeaderID, e.LeaderAddr)
+}
+
+// StateMachine is the replicated state the log is applied to. Once the node
+// has started its methods are called from a single goroutine, never while the
+// node holds its lock.
+type StateMachine interface {
+	// Apply applies a committed command
+	Apply(command []byte)
+
+	// Snapshot serializes the whole state
+	Snapshot() ([]byte, error)
+
+	// Restore replaces the whole state with a snapshot; on error the state
+	// must be left as it was, as the restore is retried
+	Restore(data []byte) error
+}
+
+// Config describes a cluster member
+type Config struct {
+	ID                string
+	Peers             map[string]string // Node ID -> address for every member, including this one
+	ElectionTimeout   time.Duration     // Minimum follower timeout; each timeout is randomized up to twice this
+	HeartbeatInterval time.Duration
+	SnapshotThreshold uint64 // Applied entries kept in the log before it is compacted into a snapshot
+}
+
+// DefaultConfig returns a configuration with default timings
+func DefaultConfig(id string, peers map[string]string) Config {
+	return Config{
+		ID:                id,
+		Peers:             peers,
+		ElectionTimeout:   1 * time.Second,
+		HeartbeatInterval: 100 * time.Millisecond,
+		SnapshotThreshold: 1024,
+	}
+}
+
+// ParsePeers parses a "id=host:port,id=host:port" cluster member list
+func ParsePeers(spec string) (map[string]string, error) {
+	peers := make(map[string]string)
+	for _, member := range strings.Split(spec, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		parts := strings.SplitN(member, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid cluster member %q (want id=host:port)", member)
+		}
+		if _, exists := peers[parts[0]]; exists {
+			return nil, fmt.Errorf("duplicate cluster member %s", parts[0])
+		}
+		peers[parts[0]] = parts[1]
+	}
+	return peers, nil
+}
+
+// proposal waits for a proposed entry to be applied
+type proposal struct {
+	term uint64
+	done chan error
+}
+
+// Node is one member of a Raft cluster. Commands proposed on the leader are
+// replicated to a majority of members and then applied, in log order, to the
+// state machine of every member.
+type Node struct {
+	proto.UnimplementedRaftServer
+
+	config  Config
+	fsm     StateMachine
+	storage Storage
+	logger  *logrus.Logger
+
+	peers map[string]proto.RaftClient // Other members, keyed by node ID
+	conns []*grpc.ClientConn
+
+	// Set when RPCs arrive over TLS: callers must then prove their member ID
+	// with a verified client certificate
+	requireCert bool
+
+	role     string
+	term     uint64
+	votedFor string
+	leaderID string
+
+	entries       []*proto.RaftEntry // Log entries following the snapshot
+	snapshotIndex uint64
+	snapshotTerm  uint64
+	snapshotData  []byte
+
+	commitIndex uint64
+	lastApplied uint64
+
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	inflight   map[string]bool
+	votes      int
+
+	electionDeadline  time.Time
+	lastBroadcast     time.Time
+	lastLeaderContact time.Time
+
+	proposals map[uint64]*proposal // Keyed by log index
+
+	applyCh chan struct{} // Wakes the applier once commitIndex advances
+	applier sync.WaitGroup
+
+	stopCh  chan struct{}
+	stopped bool
+	mutex   sync.Mutex
+}
+
+// NewNode creates a cluster member, restoring any state persisted in storage
+func NewNode(config Config, fsm StateMachine, storage Storage, creds *utils.TLSCredentials, logger *logrus.Logger) (*Node, error) {
+	if _, exists := config.Peers[config.ID]; !exists {
+		return nil, fmt.Errorf("node %s is not in the cluster member list", config.ID)
+	}
+	if config.HeartbeatInterval <= 0 || config.ElectionTimeout <= config.HeartbeatInterval {
+		return nil, fmt.Errorf("election timeout must be longer than the heartbeat interval")
+	}
+	if !creds.IsInsecure() && !creds.VerifiesClientCerts() {
+		return nil, fmt.Errorf("cluster members authenticate each other with client certificates; set -tls-client-auth to request or require")
+	}
+
+	n := &Node{
+		config:      config,
+		fsm:         fsm,
+		storage:     storage,
+		logger:      logger,
+		peers:       make(map[string]proto.RaftClient),
+		role:        RoleFollower,
+		nextIndex:   make(map[string]uint64),
+		matchIndex:  make(map[string]uint64),
+		inflight:    make(map[string]bool),
+		proposals:   make(map[uint64]*proposal),
+		applyCh:     make(chan struct{}, 1),
+		requireCert: !creds.IsInsecure(),
+		stopCh:      make(chan struct{}),
+	}
+
+	if creds.IsInsecure() {
+		logger.Warn("Cluster members are not authenticated without TLS; RPCs are only checked against the member list")
+	}
+
+	state, snapshot, entries, err := storage.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load raft state: %w", err)
+	}
+
+	n.term = state.Term
+	n.votedFor = state.VotedFor
+	n.entries = entries
+
+	if snapshot != nil {
+		if err := fsm.Restore(snapshot.Data); err != nil {
+			return nil, fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+		n.snapshotIndex = snapshot.Index
+		n.snapshotTerm = snapshot.Term
+		n.snapshotData = snapshot.Data
+		n.commitIndex = snapshot.Index
+		n.lastApplied = snapshot.Index
+	}
+
+	for id, addr := range config.Peers {
+		if id == config.ID {
+			continue
+		}
+
+		// Retry quickly so a member that starts late is reachable before the next election
+		conn, err := grpc.Dial(addr, creds.DialOption(), grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  config.HeartbeatInterval,
+				Multiplier: 1.6,
+				Jitter:     0.2,
+				MaxDelay:   config.ElectionTimeout,
+			},
+			MinConnectTimeout: config.ElectionTimeout,
+		}))
+		if err != nil {
+			n.closeConns()
+			return nil, fmt.Errorf("failed to dial cluster member %s: %w", id, err)
+		}
+		n.conns = append(n.conns, conn)
+		n.peers[id] = proto.NewRaftClient(conn)
+	}
+
+	return n, nil
+}
+
+// Register registers the Raft service on a gRPC server
+func (n *Node) Register(server *grpc.Server) {
+	proto.RegisterRaftServer(server, n)
+}
+
+// Start starts election and replication timers
+func (n *Node) Start() {
+	n.mutex.Lock()
+	n.resetElectionDeadline()
+	n.mutex.Unlock()
+
+	n.logger.WithFields(logrus.Fields{
+		"node_id": n.config.ID,
+		"members": len(n.config.Peers),
+		"term":    n.term,
+	}).Info("Starting cluster member")
+
+	n.applier.Add(1)
+	go n.applyLoop()
+	go n.run()
+}
+
+// Stop stops the node; pending proposals fail with ErrStopped
+func (n *Node) Stop() {
+	n.mutex.Lock()
+	if n.stopped {
+		n.mutex.Unlock()
+		return
+	}
+	n.stopped = true
+	close(n.stopCh)
+
+	for index, p := range n.proposals {
+		p.done <- ErrStopped
+		delete(n.proposals, index)
+	}
+	n.mutex.Unlock()
+
+	n.closeConns()
+
+	// Let an entry being applied finish before the storage goes away
+	n.applier.Wait()
+
+	if err := n.storage.Close(); err != nil {
+		n.logger.WithError(err).Warn("Failed to close raft storage")
+	}
+}
+
+// ID returns this node's ID
+func (n *Node) ID() string {
+	return n.config.ID
+}
+
+// IsLeader reports whether this node is the current leader
+func (n *Node) IsLeader() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.role == RoleLeader
+}
+
+// Leader returns the ID and address of the current leader, if one is known
+func (n *Node) Leader() (string, string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.leaderID == "" {
+		return "", ""
+	}
+	return n.leaderID, n.config.Peers[n.leaderID]
+}
+
+// Propose replicates a command and waits until it has been applied on this node
+func (n *Node) Propose(ctx context.Context, command []byte) error {
+	n.mutex.Lock()
+
+	if n.stopped {
+		n.mutex.Unlock()
+		return ErrStopped
+	}
+	if n.role != RoleLeader {
+		err := &NotLeaderError{LeaderID: n.leaderID, LeaderAddr: n.config.Peers[n.leaderID]}
+		n.mutex.Unlock()
+		return err
+	}
+
+	entry := &proto.RaftEntry{
+		Term:    n.term,
+		Index:   n.lastIndex() + 1,
+		Command: command,
+	}
+	if err := n.appendEntries(entry); err != nil {
+		n.mutex.Unlock()
+		return err
+	}
+
+	p := &proposal{term: entry.Term, done: make(chan error, 1)}
+	n.proposals[entry.Index] = p
+
+	n.advanceCommit()
+	n.broadcast()
+	n.mutex.Unlock()
+
+	select {
+	case err := <-p.done:
+		return err
+	case <-ctx.Done():
+		n.mutex.Lock()
+		delete(n.proposals, entry.Index)
+		n.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// GetStats returns node statistics
+func (n *Node) GetStats() map[string]interface{} {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return map[string]interface{}{
+		"node_id":        n.config.ID,
+		"role":           n.role,
+		"term":           n.term,
+		"leader_id":      n.leaderID,
+		"members":        len(n.config.Peers),
+		"commit_index":   n.commitIndex,
+		"last_applied":   n.lastApplied,
+		"snapshot_index": n.snapshotIndex,
+		"log_entries":    len(n.entries),
+	}
+}
+
+// run drives elections and heartbeats until the node stops
+func (n *Node) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case now := <-ticker.C:
+			n.mutex.Lock()
+			switch {
+			case n.role == RoleLeader:
+				if now.Sub(n.lastBroadcast) >= n.config.HeartbeatInterval {
+					n.broadcast()
+				}
+			case now.After(n.electionDeadline):
+				n.startElection()
+			}
+			n.mutex.Unlock()
+		}
+	}
+}
+
+// startElection becomes a candidate and asks every member for a vote; the caller must hold mutex
+func (n *Node) startElection() {
+	n.resetElectionDeadline()
+
+	// Votes may only be asked for once the new term and our own vote are durable
+	if err := n.setTerm(n.term+1, n.config.ID); err != nil {
+		n.logger.WithError(err).Error("Failed to persist new term, not starting an election")
+		return
+	}
+
+	n.role = RoleCandidate
+	n.leaderID = ""
+	n.votes = 1
+
+	n.logger.WithFields(logrus.Fields{
+		"node_id": n.config.ID,
+		"term":    n.term,
+	}).Info("Starting leader election")
+
+	if n.votes >= n.quorum() {
+		n.becomeLeader()
+		return
+	}
+
+	req := &proto.RequestVoteRequest{
+		Term:         n.term,
+		CandidateId:  n.config.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+
+	for id, client := range n.peers {
+		go n.requestVote(id, client, req)
+	}
+}
+
+// requestVote asks one member for its vote
+func (n *Node) requestVote(id string, client proto.RaftClient, req *proto.RequestVoteRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+	defer cancel()
+
+	resp, err := client.RequestVote(ctx, req)
+	if err != nil {
+		n.logger.WithError(err).WithField("peer_id", id).Debug("RequestVote failed")
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if resp.Term > n.term {
+		n.stepDown(resp.Term)
+		return
+	}
+
+	if n.role != RoleCandidate || n.term != req.Term || !resp.VoteGranted {
+		return
+	}
+
+	n.votes++
+	if n.votes >= n.quorum() {
+		n.becomeLeader()
+	}
+}
+
+// becomeLeader takes over as leader for the current term; the caller must hold mutex
+func (n *Node) becomeLeader() {
+	n.role = RoleLeader
+	n.leaderID = n.config.ID
+
+	for id := range n.peers {
+		n.nextIndex[id] = n.lastIndex() + 1
+		n.matchIndex[id] = 0
+	}
+
+	n.logger.WithFields(logrus.Fields{
+		"node_id": n.config.ID,
+		"term":    n.term,
+	}).Info("Became cluster leader")
+
+	// Entries from earlier terms only commit once an entry of this term does
+	noop := &proto.RaftEntry{Term: n.term, Index: n.lastIndex() + 1}
+	if err := n.appendEntries(noop); err != nil {
+		n.logger.WithError(err).Error("Failed to append leader no-op entry")
+	}
+
+	n.advanceCommit()
+	n.broadcast()
+}
+
+// becomeFollower follows the leader of term, moving to it if it is newer. If
+// the newer term cannot be persisted the node still stops leading but stays in
+// its old term, and the error is returned. The caller must hold mutex.
+func (n *Node) becomeFollower(term uint64) error {
+	if n.role == RoleLeader {
+		n.logger.WithFields(logrus.Fields{
+			"node_id": n.config.ID,
+			"term":    term,
+		}).Info("Stepping down as cluster leader")
+	}
+
+	n.role = RoleFollower
+	n.resetElectionDeadline()
+
+	if term > n.term {
+		n.leaderID = ""
+		if err := n.setTerm(term, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stepDown follows a newer term learned from a reply; the caller must hold mutex
+func (n *Node) stepDown(term uint64) {
+	if err := n.becomeFollower(term); err != nil {
+		n.logger.WithError(err).WithField("term", term).Error("Failed to persist newer term")
+	}
+}
+
+// broadcast sends AppendEntries (or a snapshot) to every member; the caller must hold mutex
+func (n *Node) broadcast() {
+	n.lastBroadcast = time.Now()
+	for id := range n.peers {
+		n.replicate(id)
+	}
+}
+
+// replicate sends the next batch of entries to one member unless a call is already in flight;
+// the caller must hold mutex
+func (n *Node) replicate(id string) {
+	if n.inflight[id] || n.stopped {
+		return
+	}
+
+	client := n.peers[id]
+	next := n.nextIndex[id]
+
+	if next <= n.snapshotIndex {
+		req := &proto.InstallSnapshotRequest{
+			Term:              n.term,
+			LeaderId:          n.config.ID,
+			LastIncludedIndex: n.snapshotIndex,
+			LastIncludedTerm:  n.snapshotTerm,
+			Data:              n.snapshotData,
+		}
+		n.inflight[id] = true
+		go n.sendSnapshot(id, client, req)
+		return
+	}
+
+	prevIndex := next - 1
+	prevTerm, _ := n.termAt(prevIndex)
+
+	var entries []*proto.RaftEntry
+	for index := next; index <= n.lastIndex() && len(entries) < maxEntriesPerAppend; index++ {
+		entries = append(entries, n.entryAt(index))
+	}
+
+	req := &proto.AppendEntriesRequest{
+		Term:         n.term,
+		LeaderId:     n.config.ID,
+		PrevLogIndex: prevIndex,
+		PrevLogTerm:  prevTerm,
+		Entries:      entries,
+		LeaderCommit: n.commitIndex,
+	}
+	n.inflight[id] = true
+	go n.sendAppend(id, client, req)
+}
+
+// sendAppend delivers one AppendEntries call and processes the reply
+func (n *Node) sendAppend(id string, client proto.RaftClient, req *proto.AppendEntriesRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.ElectionTimeout)
+	resp, err := client.AppendEntries(ctx, req)
+	cancel()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.inflight[id] = false
+
+	if err != nil {
+		n.logger.WithError(err).WithField("peer_id", id).Debug("AppendEntries failed")
+		return
+	}
+
+	if resp.Term > n.term {
+		n.stepDown(resp.Term)
+		return
+	}
+	if n.role != RoleLeader || n.term != req.Term {
+		return
+	}
+
+	if resp.Success {
+		if resp.MatchIndex > n.matchIndex[id] {
+			n.matchIndex[id] = resp.MatchIndex
+		}
+		n.nextIndex[id] = n.matchIndex[id] + 1
+		n.advanceCommit()
+	} else if resp.ConflictIndex > 0 {
+		n.nextIndex[id] = resp.ConflictIndex
+	} else if n.nextIndex[id] > 1 {
+		n.nextIndex[id]--
+	}
+
+	// Keep going while the member is behind
+	if n.nextIndex[id] <= n.lastIndex() {
+		n.replicate(id)
+	}
+}
+
+// sendSnapshot delivers the current snapshot to a member that is too far behind
+func (n *Node) sendSnapshot(id string, client proto.RaftClient, req *proto.InstallSnapshotRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 4*n.config.ElectionTimeout)
+	resp, err := client.InstallSnapshot(ctx, req)
+	cancel()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.inflight[id] = false
+
+	if err != nil {
+		n.logger.WithError(err).WithField("peer_id", id).Debug("InstallSnapshot failed")
+		return
+	}
+
+	if resp.Term > n.term {
+		n.stepDown(resp.Term)
+		return
+	}
+	if n.role != RoleLeader || n.term != req.Term {
+		return
+	}
+
+	if req.LastIncludedIndex > n.matchIndex[id] {
+		n.matchIndex[id] = req.LastIncludedIndex
+	}
+	n.nextIndex[id] = n.matchIndex[id] + 1
+
+	n.logger.WithFields(logrus.Fields{
+		"peer_id": id,
+		"index":   req.LastIncludedIndex,
+	}).Info("Sent snapshot to lagging cluster member")
+
+	if n.nextIndex[id] <= n.lastIndex() {
+		n.replicate(id)
+	}
+}
+
+// advanceCommit commits the highest current-term entry stored on a majority; the caller must hold mutex
+func (n *Node) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		term, _ := n.termAt(index)
+		if term != n.term {
+			break // Earlier terms commit indirectly
+		}
+
+		replicas := 1
+		for id := range n.peers {
+			if n.matchIndex[id] >= index {
+				replicas++
+			}
+		}
+
+		if replicas >= n.quorum() {
+			n.commitIndex = index
+			n.signalApply()
+			return
+		}
+	}
+}
+
+// signalApply wakes the applier; the caller must hold mutex
+func (n *Node) signalApply() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+// applyLoop applies committed entries until the node stops. Only the applier
+// touches the state machine once the node has started, and it does so without
+// holding mutex, so a slow Apply never holds up elections or replication.
+func (n *Node) applyLoop() {
+	defer n.applier.Done()
+
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-n.applyCh:
+			n.applyCommitted()
+			n.maybeSnapshot()
+		}
+	}
+}
+
+// applyCommitted brings the state machine up to commitIndex, first restoring
+// a snapshot installed by the leader if the state machine is behind it
+func (n *Node) applyCommitted() {
+	n.mutex.Lock()
+	if n.stopped {
+		n.mutex.Unlock()
+		return
+	}
+
+	var snapshot *Snapshot
+	if n.lastApplied < n.snapshotIndex {
+		snapshot = &Snapshot{Index: n.snapshotIndex, Term: n.snapshotTerm, Data: n.snapshotData}
+	}
+
+	next := n.lastApplied + 1
+	if snapshot != nil {
+		next = snapshot.Index + 1
+	}
+	var pending []*proto.RaftEntry
+	for index := next; index <= n.commitIndex; index++ {
+		pending = append(pending, n.entryAt(index))
+	}
+	n.mutex.Unlock()
+
+	if snapshot != nil {
+		if err := n.fsm.Restore(snapshot.Data); err != nil {
+			// Retried the next time an entry commits
+			n.logger.WithError(err).WithField("index", snapshot.Index).Error("Failed to restore snapshot from cluster leader")
+			return
+		}
+
+		n.mutex.Lock()
+		n.setApplied(snapshot.Index)
+		n.mutex.Unlock()
+
+		n.logger.WithFields(logrus.Fields{
+			"node_id": n.config.ID,
+			"index":   snapshot.Index,
+		}).Info("Restored snapshot from cluster leader")
+	}
+
+	for _, entry := range pending {
+		if len(entry.Command) > 0 {
+			n.fsm.Apply(entry.Command)
+		}
+
+		n.mutex.Lock()
+		n.setApplied(entry.Index)
+		if p, exists := n.proposals[entry.Index]; exists {
+			if p.term == entry.Term {
+				p.done <- nil
+			} else {
+				p.done <- ErrLeadershipLost
+			}
+			delete(n.proposals, entry.Index)
+		}
+		n.mutex.Unlock()
+	}
+}
+
+// setApplied records that the state machine reflects the log up to index; the caller must hold mutex
+func (n *Node) setApplied(index uint64) {
+	if index > n.lastApplied {
+		n.lastApplied = index
+	}
+}
+
+// maybeSnapshot folds applied entries into a snapshot once enough have
+// accumulated. It runs on the applier, so the state machine stays at
+// lastApplied while it is serialized.
+func (n *Node) maybeSnapshot() {
+	n.mutex.Lock()
+	index := n.lastApplied
+	due := !n.stopped && index > n.snapshotIndex && index-n.snapshotIndex >= n.config.SnapshotThreshold
+	n.mutex.Unlock()
+
+	if !due {
+		return
+	}
+
+	data, err := n.fsm.Snapshot()
+	if err != nil {
+		n.logger.WithError(err).Error("Failed to snapshot state machine")
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// A snapshot installed by the leader meanwhile already covers index
+	term, ok := n.termAt(index)
+	if !ok || index <= n.snapshotIndex {
+		return
+	}
+	remaining := n.entries[index-n.snapshotIndex:]
+
+	snapshot := &Snapshot{Index: index, Term: term, Data: data}
+	if err := n.storage.SaveSnapshot(snapshot, remaining); err != nil {
+		n.logger.WithError(err).Error("Failed to save snapshot")
+		return
+	}
+
+	n.entries = append([]*proto.RaftEntry(nil), remaining...)
+	n.snapshotIndex = index
+	n.snapshotTerm = term
+	n.snapshotData = data
+
+	n.logger.WithFields(logrus.Fields{
+		"node_id": n.config.ID,
+		"index":   index,
+	}).Debug("Compacted cluster log into snapshot")
+}
+
+// authorize checks that an RPC comes from the cluster member it claims to be
+// from. The member must be configured, and over TLS the caller's verified
+// client certificate must belong to it.
+func (n *Node) authorize(ctx context.Context, memberID string) error {
+	if _, exists := n.config.Peers[memberID]; !exists || memberID == n.config.ID {
+		n.logger.WithField("member_id", memberID).Warn("Rejected cluster RPC from unknown member")
+		return status.Errorf(codes.PermissionDenied, "%q is not a cluster member", memberID)
+	}
+
+	if !n.requireCert {
+		return nil
+	}
+
+	var chains [][]*x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			chains = tlsInfo.State.VerifiedChains
+		}
+	}
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		n.logger.WithField("member_id", memberID).Warn("Rejected cluster RPC without a verified client certificate")
+		return status.Errorf(codes.Unauthenticated, "cluster RPCs require a verified client certificate")
+	}
+
+	if !n.certificateBelongsTo(chains[0][0], memberID) {
+		n.logger.WithField("member_id", memberID).Warn("Rejected cluster RPC with another peer's client certificate")
+		return status.Errorf(codes.PermissionDenied, "client certificate does not belong to cluster member %s", memberID)
+	}
+	return nil
+}
+
+// certificateBelongsTo reports whether a certificate was issued to a member:
+// it names the member ID as its common name or a DNS name, or names the host
+// the member is configured at when no other member shares that host
+func (n *Node) certificateBelongsTo(cert *x509.Certificate, memberID string) bool {
+	names := map[string]bool{cert.Subject.CommonName: true}
+	for _, name := range cert.DNSNames {
+		names[name] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		names[ip.String()] = true
+	}
+
+	if names[memberID] {
+		return true
+	}
+
+	host := memberHost(n.config.Peers[memberID])
+	if !names[host] {
+		return false
+	}
+	for id, addr := range n.config.Peers {
+		if id != memberID && memberHost(addr) == host {
+			return false
+		}
+	}
+	return true
+}
+
+// memberHost returns the host of a member address in the form certificates name it
+func memberHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// RequestVote handles a vote request from a candidate
+func (n *Node) RequestVote(ctx context.Context, req *proto.RequestVoteRequest) (*proto.RequestVoteResponse, error) {
+	if err := n.authorize(ctx, req.CandidateId); err != nil {
+		return nil, err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// Ignore members that cannot hear a leader we are still in contact with,
+	// so a partitioned member cannot force needless elections when it returns
+	if n.role == RoleLeader || time.Since(n.lastLeaderContact) < n.config.ElectionTimeout {
+		return &proto.RequestVoteResponse{Term: n.term}, nil
+	}
+
+	if req.Term > n.term {
+		if err := n.becomeFollower(req.Term); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &proto.RequestVoteResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp, nil
+	}
+
+	// Only vote for candidates whose log is at least as up to date as ours
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		(req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex())
+
+	if (n.votedFor == "" || n.votedFor == req.CandidateId) && upToDate {
+		// A vote that is not durable could be cast twice after a restart
+		if err := n.setTerm(n.term, req.CandidateId); err != nil {
+			n.logger.WithError(err).WithField("candidate_id", req.CandidateId).Error("Failed to persist vote, withholding it")
+			return resp, nil
+		}
+		n.resetElectionDeadline()
+		resp.VoteGranted = true
+	}
+
+	return resp, nil
+}
+
+// AppendEntries handles log replication and heartbeats from the leader
+func (n *Node) AppendEntries(ctx context.Context, req *proto.AppendEntriesRequest) (*proto.AppendEntriesResponse, error) {
+	if err := n.authorize(ctx, req.LeaderId); err != nil {
+		return nil, err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	resp := &proto.AppendEntriesResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp, nil
+	}
+
+	if req.Term > n.term || n.role != RoleFollower {
+		if err := n.becomeFollower(req.Term); err != nil {
+			return nil, err
+		}
+	}
+	n.leaderID = req.LeaderId
+	n.lastLeaderContact = time.Now()
+	n.resetElectionDeadline()
+	resp.Term = n.term
+
+	// Entries covered by our snapshot are already committed and match
+	prevIndex, prevTerm, entries := req.PrevLogIndex, req.PrevLogTerm, req.Entries
+	if prevIndex < n.snapshotIndex {
+		skip := n.snapshotIndex - prevIndex
+		if uint64(len(entries)) <= skip {
+			entries = nil
+		} else {
+			entries = entries[skip:]
+		}
+		prevIndex, prevTerm = n.snapshotIndex, n.snapshotTerm
+	}
+
+	if prevIndex > n.lastIndex() {
+		resp.ConflictIndex = n.lastIndex() + 1
+		return resp, nil
+	}
+
+	if term, _ := n.termAt(prevIndex); term != prevTerm {
+		// Skip back over the whole conflicting term
+		conflict := prevIndex
+		for conflict > n.snapshotIndex+1 {
+			if t, _ := n.termAt(conflict - 1); t != term {
+				break
+			}
+			conflict--
+		}
+		resp.ConflictIndex = conflict
+		return resp, nil
+	}
+
+	for i, entry := range entries {
+		if entry.Index <= n.lastIndex() {
+			if term, _ := n.termAt(entry.Index); term == entry.Term {
+				continue
+			}
+			if err := n.truncateAfter(entry.Index - 1); err != nil {
+				return nil, err
+			}
+		}
+		if err := n.appendEntries(entries[i:]...); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	lastNew := prevIndex + uint64(len(entries))
+	if req.LeaderCommit > n.commitIndex {
+		n.commitIndex = req.LeaderCommit
+		if lastNew < n.commitIndex {
+			n.commitIndex = lastNew
+		}
+		n.signalApply()
+	}
+
+	resp.Success = true
+	resp.MatchIndex = lastNew
+	return resp, nil
+}
+
+// InstallSnapshot replaces a lagging follower's state with the leader's snapshot
+func (n *Node) InstallSnapshot(ctx context.Context, req *proto.InstallSnapshotRequest) (*proto.InstallSnapshotResponse, error) {
+	if err := n.authorize(ctx, req.LeaderId); err != nil {
+		return nil, err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if req.Term < n.term {
+		return &proto.InstallSnapshotResponse{Term: n.term}, nil
+	}
+
+	if req.Term > n.term || n.role != RoleFollower {
+		if err := n.becomeFollower(req.Term); err != nil {
+			return nil, err
+		}
+	}
+	n.leaderID = req.LeaderId
+	n.lastLeaderContact = time.Now()
+	n.resetElectionDeadline()
+
+	resp := &proto.InstallSnapshotResponse{Term: n.term}
+	if req.LastIncludedIndex <= n.snapshotIndex {
+		return resp, nil
+	}
+
+	// Keep entries following the snapshot if our log agrees with it
+	var remaining []*proto.RaftEntry
+	if term, ok := n.termAt(req.LastIncludedIndex); ok && term == req.LastIncludedTerm && req.LastIncludedIndex <= n.lastIndex() {
+		remaining = append(remaining, n.entries[req.LastIncludedIndex-n.snapshotIndex:]...)
+	}
+
+	snapshot := &Snapshot{Index: req.LastIncludedIndex, Term: req.LastIncludedTerm, Data: req.Data}
+	if err := n.storage.SaveSnapshot(snapshot, remaining); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	if n.commitIndex < req.LastIncludedIndex {
+		n.commitIndex = req.LastIncludedIndex
+	}
+
+	n.entries = remaining
+	n.snapshotIndex = req.LastIncludedIndex
+	n.snapshotTerm = req.LastIncludedTerm
+	n.snapshotData = req.Data
+
+	// The applier restores the state machine from the snapshot if it is behind it
+	n.signalApply()
+
+	// Proposals folded into someone else's snapshot have an unknown outcome
+	for index, p := range n.proposals {
+		if index <= req.LastIncludedIndex {
+			p.done <- ErrLeadershipLost
+			delete(n.proposals, index)
+		}
+	}
+
+	n.logger.WithFields(logrus.Fields{
+		"node_id": n.config.ID,
+		"index":   req.LastIncludedIndex,
+	}).Info("Installed snapshot from cluster leader")
+
+	return resp, nil
+}
+
+// appendEntries adds entries to the log and persists them; the caller must hold mutex
+func (n *Node) appendEntries(entries ...*proto.RaftEntry) error {
+	if err := n.storage.Append(entries); err != nil {
+		return fmt.Errorf("failed to persist raft entries: %w", err)
+	}
+	n.entries = append(n.entries, entries...)
+	return nil
+}
+
+// truncateAfter drops conflicting entries past index; the caller must hold mutex
+func (n *Node) truncateAfter(index uint64) error {
+	if err := n.storage.TruncateAfter(index); err != nil {
+		return fmt.Errorf("failed to truncate raft log: %w", err)
+	}
+	n.entries = n.entries[:index-n.snapshotIndex]
+
+	// Proposals for dropped entries can never commit
+	for i, p := range n.proposals {
+		if i > index {
+			p.done <- ErrLeadershipLost
+			delete(n.proposals, i)
+		}
+	}
+	return nil
+}
+
+// setTerm persists a term and vote and then adopts them. On error the node
+// keeps its previous term and vote. The caller must hold mutex.
+func (n *Node) setTerm(term uint64, votedFor string) error {
+	if err := n.storage.SaveHardState(HardState{Term: term, VotedFor: votedFor}); err != nil {
+		return fmt.Errorf("failed to persist raft term and vote: %w", err)
+	}
+	n.term = term
+	n.votedFor = votedFor
+	return nil
+}
+
+// resetElectionDeadline picks a new randomized election timeout; the caller must hold mutex
+func (n *Node) resetElectionDeadline() {
+	timeout := n.config.ElectionTimeout + time.Duration(rand.Int63n(int64(n.config.ElectionTimeout)))
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// quorum returns the number of members forming a majority
+func (n *Node) quorum() int {
+	return len(n.config.Peers)/2 + 1
+}
+
+// lastIndex returns the index of the last log entry; the caller must hold mutex
+func (n *Node) lastIndex() uint64 {
+	return n.snapshotIndex + uint64(len(n.entries))
+}
+
+// lastTerm returns the term of the last log entry; the caller must hold mutex
+func (n *Node) lastTerm() uint64 {
+	if len(n.entries) == 0 {
+		return n.snapshotTerm
+	}
+	return n.entries[len(n.entries)-1].Term
+}
+
+// entryAt returns the entry at index, which must follow the snapshot; the caller must hold mutex
+func (n *Node) entryAt(index uint64) *proto.RaftEntry {
+	return n.entries[index-n.snapshotIndex-1]
+}
+
+// termAt returns the term of the entry at index, if it is known; the caller must hold mutex
+func (n *Node) termAt(index uint64) (uint64, bool) {
+	switch {
+	case index == n.snapshotIndex:
+		return n.snapshotTerm, true
+	case index < n.snapshotIndex || index > n.lastIndex():
+		return 0, false
+	default:
+		return n.entryAt(index).Term, true
+	}
+}
+
+// closeConns closes connections to the other members
+func (n *Node) closeConns() {
+	for _, conn := range n.conns {
+		conn.Close()
+	}
+}
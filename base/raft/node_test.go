@@ -0,0 +1,515 @@
+package raft
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"myDvpn/base/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testFSM records the commands applied to it
+type testFSM struct {
+	commands []string
+	mutex    sync.Mutex
+}
+
+func (f *testFSM) Apply(command []byte) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.commands = append(f.commands, string(command))
+}
+
+func (f *testFSM) Snapshot() ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return json.Marshal(f.commands)
+}
+
+func (f *testFSM) Restore(data []byte) error {
+	var commands []string
+	if err := json.Unmarshal(data, &commands); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.commands = commands
+	return nil
+}
+
+func (f *testFSM) applied() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// testCluster is an in-process cluster whose members talk gRPC over loopback
+type testCluster struct {
+	t        *testing.T
+	peers    map[string]string
+	nodes    map[string]*Node
+	servers  map[string]*grpc.Server
+	fsms     map[string]*testFSM
+	storages map[string]*MemoryStorage
+	logger   *logrus.Logger
+
+	snapshotThreshold uint64
+}
+
+func newTestCluster(t *testing.T, size int, snapshotThreshold uint64) *testCluster {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	c := &testCluster{
+		t:                 t,
+		peers:             make(map[string]string),
+		nodes:             make(map[string]*Node),
+		servers:           make(map[string]*grpc.Server),
+		fsms:              make(map[string]*testFSM),
+		storages:          make(map[string]*MemoryStorage),
+		logger:            logger,
+		snapshotThreshold: snapshotThreshold,
+	}
+
+	listeners := make(map[string]net.Listener)
+	for i := 1; i <= size; i++ {
+		id := fmt.Sprintf("n%d", i)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		listeners[id] = listener
+		c.peers[id] = listener.Addr().String()
+	}
+
+	for id, listener := range listeners {
+		c.storages[id] = NewMemoryStorage()
+		c.start(id, listener)
+	}
+
+	t.Cleanup(func() {
+		for id := range c.nodes {
+			c.stop(id)
+		}
+	})
+	return c
+}
+
+// start runs a member on a listener with its current storage and a fresh state machine
+func (c *testCluster) start(id string, listener net.Listener) {
+	c.t.Helper()
+
+	config := DefaultConfig(id, c.peers)
+	config.ElectionTimeout = 200 * time.Millisecond
+	config.HeartbeatInterval = 40 * time.Millisecond
+	config.SnapshotThreshold = c.snapshotThreshold
+
+	fsm := &testFSM{}
+	node, err := NewNode(config, fsm, c.storages[id], utils.InsecureCredentials(), c.logger)
+	if err != nil {
+		c.t.Fatalf("NewNode(%s): %v", id, err)
+	}
+
+	server := grpc.NewServer()
+	node.Register(server)
+	go server.Serve(listener)
+	node.Start()
+
+	c.nodes[id] = node
+	c.servers[id] = server
+	c.fsms[id] = fsm
+}
+
+// stop stops a member and its server
+func (c *testCluster) stop(id string) {
+	c.nodes[id].Stop()
+	c.servers[id].Stop()
+	delete(c.nodes, id)
+	delete(c.servers, id)
+}
+
+// restart brings a stopped member back on its address; a fresh member starts
+// with empty storage, as if its disk was lost
+func (c *testCluster) restart(id string, fresh bool) {
+	c.t.Helper()
+
+	listener, err := net.Listen("tcp", c.peers[id])
+	if err != nil {
+		c.t.Fatalf("listen on %s: %v", c.peers[id], err)
+	}
+	if fresh {
+		c.storages[id] = NewMemoryStorage()
+	}
+	c.start(id, listener)
+}
+
+// leader waits until exactly one running member leads and every running
+// member knows it, and returns its ID
+func (c *testCluster) leader() string {
+	c.t.Helper()
+
+	var leaderID string
+	waitFor(c.t, 5*time.Second, "a leader known to every member", func() bool {
+		leaderID = ""
+		for id, node := range c.nodes {
+			if node.IsLeader() {
+				if leaderID != "" {
+					return false
+				}
+				leaderID = id
+			}
+		}
+		if leaderID == "" {
+			return false
+		}
+		for _, node := range c.nodes {
+			if known, _ := node.Leader(); known != leaderID {
+				return false
+			}
+		}
+		return true
+	})
+	return leaderID
+}
+
+// follower returns the ID of a running member other than the leader
+func (c *testCluster) follower(leaderID string) string {
+	for id := range c.nodes {
+		if id != leaderID {
+			return id
+		}
+	}
+	c.t.Fatal("no follower running")
+	return ""
+}
+
+// propose proposes commands on a member one at a time
+func (c *testCluster) propose(id string, commands ...string) {
+	c.t.Helper()
+
+	for _, command := range commands {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := c.nodes[id].Propose(ctx, []byte(command))
+		cancel()
+		if err != nil {
+			c.t.Fatalf("Propose(%s) on %s: %v", command, id, err)
+		}
+	}
+}
+
+// waitApplied waits until every running member has applied exactly want
+func (c *testCluster) waitApplied(want []string) {
+	c.t.Helper()
+
+	waitFor(c.t, 5*time.Second, fmt.Sprintf("every member to apply %v", want), func() bool {
+		for id := range c.nodes {
+			if !equalCommands(c.fsms[id].applied(), want) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func equalCommands(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func commandRange(prefix string, count int) []string {
+	commands := make([]string, count)
+	for i := range commands {
+		commands[i] = fmt.Sprintf("%s-%d", prefix, i)
+	}
+	return commands
+}
+
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterElectsOneLeader(t *testing.T) {
+	c := newTestCluster(t, 3, 1024)
+	leaderID := c.leader()
+
+	leaderTerm := c.nodes[leaderID].GetStats()["term"].(uint64)
+	for id, node := range c.nodes {
+		if term := node.GetStats()["term"].(uint64); term != leaderTerm {
+			t.Fatalf("%s is in term %d, leader %s in term %d", id, term, leaderID, leaderTerm)
+		}
+	}
+}
+
+func TestClusterReplicatesProposals(t *testing.T) {
+	c := newTestCluster(t, 3, 1024)
+	leaderID := c.leader()
+
+	want := commandRange("put", 10)
+	c.propose(leaderID, want...)
+	c.waitApplied(want)
+}
+
+func TestFollowerRejectsProposalWithLeaderHint(t *testing.T) {
+	c := newTestCluster(t, 3, 1024)
+	leaderID := c.leader()
+	followerID := c.follower(leaderID)
+
+	err := c.nodes[followerID].Propose(context.Background(), []byte("put"))
+
+	var notLeader *NotLeaderError
+	if !errors.As(err, &notLeader) {
+		t.Fatalf("Propose on follower: %v, want NotLeaderError", err)
+	}
+	if notLeader.LeaderID != leaderID || notLeader.LeaderAddr != c.peers[leaderID] {
+		t.Fatalf("leader hint %s at %s, want %s at %s", notLeader.LeaderID, notLeader.LeaderAddr, leaderID, c.peers[leaderID])
+	}
+}
+
+func TestLaggingFollowerInstallsSnapshot(t *testing.T) {
+	c := newTestCluster(t, 3, 5)
+	leaderID := c.leader()
+	laggingID := c.follower(leaderID)
+
+	before := commandRange("before", 3)
+	c.propose(leaderID, before...)
+	c.waitApplied(before)
+
+	// The rest of the cluster compacts the entries the lagging member misses
+	c.stop(laggingID)
+	missed := commandRange("missed", 20)
+	c.propose(leaderID, missed...)
+
+	want := append(before, missed...)
+	c.waitApplied(want)
+	if index := c.nodes[leaderID].GetStats()["snapshot_index"].(uint64); index == 0 {
+		t.Fatal("leader did not compact its log")
+	}
+
+	// Back with an empty disk, the member can only catch up from the snapshot
+	c.restart(laggingID, true)
+	c.waitApplied(want)
+
+	if index := c.nodes[laggingID].GetStats()["snapshot_index"].(uint64); index == 0 {
+		t.Fatal("lagging member caught up without installing a snapshot")
+	}
+
+	after := commandRange("after", 3)
+	c.propose(c.leader(), after...)
+	c.waitApplied(append(want, after...))
+}
+
+func TestClusterFailsOverToNewLeader(t *testing.T) {
+	c := newTestCluster(t, 3, 1024)
+	oldLeaderID := c.leader()
+
+	before := commandRange("before", 5)
+	c.propose(oldLeaderID, before...)
+	c.waitApplied(before)
+
+	c.stop(oldLeaderID)
+	newLeaderID := c.leader()
+	if newLeaderID == oldLeaderID {
+		t.Fatalf("stopped member %s is still leader", oldLeaderID)
+	}
+
+	after := commandRange("after", 5)
+	c.propose(newLeaderID, after...)
+	want := append(before, after...)
+	c.waitApplied(want)
+
+	// The old leader rejoins as a follower and catches up from its own log
+	c.restart(oldLeaderID, false)
+	c.waitApplied(want)
+	c.leader()
+}
+
+// failingStorage fails to persist the term and vote
+type failingStorage struct {
+	*MemoryStorage
+}
+
+func (fs *failingStorage) SaveHardState(HardState) error {
+	return errors.New("disk full")
+}
+
+func TestVoteWithheldWhenTermCannotBePersisted(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	peers := map[string]string{"n1": "127.0.0.1:1", "n2": "127.0.0.1:2", "n3": "127.0.0.1:3"}
+	node, err := NewNode(DefaultConfig("n1", peers), &testFSM{}, &failingStorage{NewMemoryStorage()}, utils.InsecureCredentials(), logger)
+	if err != nil {
+		t.Fatalf("NewNode: %v", err)
+	}
+	defer node.Stop()
+
+	resp, err := node.RequestVote(context.Background(), &proto.RequestVoteRequest{Term: 5, CandidateId: "n2"})
+	if err == nil && resp.VoteGranted {
+		t.Fatal("vote granted without persisting it")
+	}
+	if term := node.GetStats()["term"].(uint64); term != 0 {
+		t.Fatalf("node moved to term %d without persisting it", term)
+	}
+
+	// Nor does the node start an election it cannot persist
+	node.mutex.Lock()
+	node.startElection()
+	role, term := node.role, node.term
+	node.mutex.Unlock()
+	if role != RoleFollower || term != 0 {
+		t.Fatalf("node is %s in term %d after a failed election start, want follower in term 0", role, term)
+	}
+}
+
+// newUnstartedNode creates member n1 of a three-member cluster without starting it
+func newUnstartedNode(t *testing.T) *Node {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	peers := map[string]string{
+		"n1": "127.0.0.1:1",
+		"n2": "10.0.0.2:50051",
+		"n3": "bn3.example.net:50051",
+		"n4": "10.0.0.4:50051",
+		"n5": "10.0.0.4:50052",
+	}
+	node, err := NewNode(DefaultConfig("n1", peers), &testFSM{}, NewMemoryStorage(), utils.InsecureCredentials(), logger)
+	if err != nil {
+		t.Fatalf("NewNode: %v", err)
+	}
+	t.Cleanup(node.Stop)
+	return node
+}
+
+// tlsContext is the context of an RPC whose caller presented a verified certificate
+func tlsContext(cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000},
+		AuthInfo: credentials.TLSInfo{State: state},
+	})
+}
+
+func TestRejectsRPCsFromNonMembers(t *testing.T) {
+	node := newUnstartedNode(t)
+	ctx := context.Background()
+
+	if _, err := node.RequestVote(ctx, &proto.RequestVoteRequest{Term: 5, CandidateId: "intruder"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("RequestVote from non-member: %v, want PermissionDenied", err)
+	}
+	if _, err := node.AppendEntries(ctx, &proto.AppendEntriesRequest{Term: 5, LeaderId: "intruder"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("AppendEntries from non-member: %v, want PermissionDenied", err)
+	}
+	if _, err := node.InstallSnapshot(ctx, &proto.InstallSnapshotRequest{Term: 5, LeaderId: "n1"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("InstallSnapshot claiming our own ID: %v, want PermissionDenied", err)
+	}
+
+	if stats := node.GetStats(); stats["term"].(uint64) != 0 || stats["leader_id"] != "" {
+		t.Fatalf("rejected RPCs changed term or leader: %v", stats)
+	}
+
+	if _, err := node.AppendEntries(ctx, &proto.AppendEntriesRequest{Term: 5, LeaderId: "n2"}); err != nil {
+		t.Fatalf("AppendEntries from member: %v", err)
+	}
+}
+
+func TestRequiresCertificateOfClaimedMember(t *testing.T) {
+	node := newUnstartedNode(t)
+	node.requireCert = true
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		memberID string
+		want     codes.Code
+	}{
+		{
+			name:     "no certificate",
+			ctx:      context.Background(),
+			memberID: "n2",
+			want:     codes.Unauthenticated,
+		},
+		{
+			name:     "certificate of another member",
+			ctx:      tlsContext(&x509.Certificate{Subject: pkix.Name{CommonName: "n3"}}),
+			memberID: "n2",
+			want:     codes.PermissionDenied,
+		},
+		{
+			name:     "certificate of a SuperNode",
+			ctx:      tlsContext(&x509.Certificate{DNSNames: []string{"sn1.example.net"}}),
+			memberID: "n3",
+			want:     codes.PermissionDenied,
+		},
+		{
+			name:     "common name is the member ID",
+			ctx:      tlsContext(&x509.Certificate{Subject: pkix.Name{CommonName: "n2"}}),
+			memberID: "n2",
+			want:     codes.OK,
+		},
+		{
+			name:     "IP address of the member",
+			ctx:      tlsContext(&x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.2")}}),
+			memberID: "n2",
+			want:     codes.OK,
+		},
+		{
+			name:     "host shared with another member",
+			ctx:      tlsContext(&x509.Certificate{Subject: pkix.Name{CommonName: "n5"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.4")}}),
+			memberID: "n4",
+			want:     codes.PermissionDenied,
+		},
+		{
+			name:     "DNS name of the member",
+			ctx:      tlsContext(&x509.Certificate{DNSNames: []string{"bn3.example.net"}}),
+			memberID: "n3",
+			want:     codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := node.RequestVote(tt.ctx, &proto.RequestVoteRequest{CandidateId: tt.memberID})
+			if code := status.Code(err); code != tt.want {
+				t.Fatalf("RequestVote: %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"myDvpn/base/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	hardStateFileName = "raft-state.json"
+	snapshotFileName  = "raft-snapshot.json"
+	logFileName       = "raft-log.wal"
+)
+
+// HardState is the part of a node's state that must survive restarts for elections to be safe
+type HardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for,omitempty"`
+}
+
+// Snapshot is a compacted prefix of the log
+type Snapshot struct {
+	Index uint64 `json:"index"` // Last log index folded into the snapshot
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data"` // State machine snapshot
+}
+
+// Storage persists a node's hard state, log and latest snapshot
+type Storage interface {
+	// Load returns everything previously persisted; entries follow the snapshot
+	Load() (HardState, *Snapshot, []*proto.RaftEntry, error)
+
+	// SaveHardState records the current term and vote
+	SaveHardState(state HardState) error
+
+	// Append adds entries after the last stored entry
+	Append(entries []*proto.RaftEntry) error
+
+	// TruncateAfter drops every entry with an index greater than index
+	TruncateAfter(index uint64) error
+
+	// SaveSnapshot installs a snapshot and replaces the log with the entries following it
+	SaveSnapshot(snapshot *Snapshot, remaining []*proto.RaftEntry) error
+
+	// Close releases the storage
+	Close() error
+}
+
+// MemoryStorage keeps state in memory only. A node restarted with the same
+// MemoryStorage recovers it, which is enough for in-process clusters; state is
+// lost when the process exits.
+type MemoryStorage struct {
+	state    HardState
+	snapshot *Snapshot
+	entries  []*proto.RaftEntry
+	mutex    sync.Mutex
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+// Load returns the stored state
+func (ms *MemoryStorage) Load() (HardState, *Snapshot, []*proto.RaftEntry, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	entries := make([]*proto.RaftEntry, len(ms.entries))
+	copy(entries, ms.entries)
+	return ms.state, ms.snapshot, entries, nil
+}
+
+// SaveHardState records the term and vote
+func (ms *MemoryStorage) SaveHardState(state HardState) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.state = state
+	return nil
+}
+
+// Append adds entries
+func (ms *MemoryStorage) Append(entries []*proto.RaftEntry) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.entries = append(ms.entries, entries...)
+	return nil
+}
+
+// TruncateAfter drops entries past index
+func (ms *MemoryStorage) TruncateAfter(index uint64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.entries = truncateEntries(ms.entries, index)
+	return nil
+}
+
+// SaveSnapshot installs a snapshot
+func (ms *MemoryStorage) SaveSnapshot(snapshot *Snapshot, remaining []*proto.RaftEntry) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.snapshot = snapshot
+	ms.entries = append([]*proto.RaftEntry(nil), remaining...)
+	return nil
+}
+
+// Close is a no-op
+func (ms *MemoryStorage) Close() error {
+	return nil
+}
+
+// logRecord is one line of the on-disk log
+type logRecord struct {
+	Op    string          `json:"op"` // "append" or "truncate"
+	Index uint64          `json:"index,omitempty"`
+	Entry json.RawMessage `json:"entry,omitempty"` // protojson RaftEntry for appends
+}
+
+// FileStorage persists state in a directory: the hard state and snapshot as
+// files replaced atomically, and the log as an append-only file that is
+// rewritten whenever a snapshot compacts it. Every write is synced.
+type FileStorage struct {
+	dir   string
+	log   *os.File
+	mutex sync.Mutex
+}
+
+// NewFileStorage opens (or creates) a file storage in dir
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create raft directory: %w", err)
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open raft log: %w", err)
+	}
+
+	return &FileStorage{
+		dir: dir,
+		log: log,
+	}, nil
+}
+
+// Load reads the hard state, snapshot and log from disk
+func (fs *FileStorage) Load() (HardState, *Snapshot, []*proto.RaftEntry, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	var state HardState
+	if err := readJSONFile(filepath.Join(fs.dir, hardStateFileName), &state); err != nil {
+		return HardState{}, nil, nil, err
+	}
+
+	var snapshot *Snapshot
+	var loaded Snapshot
+	if err := readJSONFile(filepath.Join(fs.dir, snapshotFileName), &loaded); err != nil {
+		return HardState{}, nil, nil, err
+	}
+	if loaded.Index > 0 {
+		snapshot = &loaded
+	}
+
+	entries, err := fs.replayLog()
+	if err != nil {
+		return HardState{}, nil, nil, err
+	}
+
+	// Entries already folded into the snapshot are not needed
+	if snapshot != nil {
+		for len(entries) > 0 && entries[0].Index <= snapshot.Index {
+			entries = entries[1:]
+		}
+	}
+
+	return state, snapshot, entries, nil
+}
+
+// SaveHardState records the term and vote
+func (fs *FileStorage) SaveHardState(state HardState) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return writeJSONFile(filepath.Join(fs.dir, hardStateFileName), state)
+}
+
+// Append adds entries to the log
+func (fs *FileStorage) Append(entries []*proto.RaftEntry) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		encoded, err := protojson.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode raft entry: %w", err)
+		}
+		line, err := json.Marshal(logRecord{Op: "append", Entry: encoded})
+		if err != nil {
+			return fmt.Errorf("failed to encode raft log record: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	return fs.writeLog(buf.Bytes())
+}
+
+// TruncateAfter records that entries past index were dropped
+func (fs *FileStorage) TruncateAfter(index uint64) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	line, err := json.Marshal(logRecord{Op: "truncate", Index: index})
+	if err != nil {
+		return fmt.Errorf("failed to encode raft log record: %w", err)
+	}
+	return fs.writeLog(append(line, '\n'))
+}
+
+// SaveSnapshot writes the snapshot and rewrites the log with the remaining entries
+func (fs *FileStorage) SaveSnapshot(snapshot *Snapshot, remaining []*proto.RaftEntry) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if err := writeJSONFile(filepath.Join(fs.dir, snapshotFileName), snapshot); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range remaining {
+		encoded, err := protojson.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode raft entry: %w", err)
+		}
+		line, err := json.Marshal(logRecord{Op: "append", Entry: encoded})
+		if err != nil {
+			return fmt.Errorf("failed to encode raft log record: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	logPath := filepath.Join(fs.dir, logFileName)
+	if err := writeFileSync(logPath+".tmp", buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write compacted raft log: %w", err)
+	}
+
+	if err := fs.log.Close(); err != nil {
+		return fmt.Errorf("failed to close raft log: %w", err)
+	}
+	if err := os.Rename(logPath+".tmp", logPath); err != nil {
+		return fmt.Errorf("failed to install compacted raft log: %w", err)
+	}
+
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to reopen raft log: %w", err)
+	}
+	fs.log = log
+	return nil
+}
+
+// Close closes the log file
+func (fs *FileStorage) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.log.Close()
+}
+
+// writeLog appends data to the log file and syncs it; the caller must hold mutex
+func (fs *FileStorage) writeLog(data []byte) error {
+	if _, err := fs.log.Write(data); err != nil {
+		return fmt.Errorf("failed to append to raft log: %w", err)
+	}
+	if err := fs.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync raft log: %w", err)
+	}
+	return nil
+}
+
+// replayLog reads the log file, dropping a torn final record left by a crash; the caller must hold mutex
+func (fs *FileStorage) replayLog() ([]*proto.RaftEntry, error) {
+	path := filepath.Join(fs.dir, logFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raft log: %w", err)
+	}
+
+	var entries []*proto.RaftEntry
+	valid := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		end := valid + len(line) + 1
+
+		var record logRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			if end >= len(data) {
+				break // Torn final record
+			}
+			return nil, fmt.Errorf("corrupt raft log record at offset %d: %w", valid, err)
+		}
+
+		switch record.Op {
+		case "append":
+			entry := &proto.RaftEntry{}
+			if err := protojson.Unmarshal(record.Entry, entry); err != nil {
+				return nil, fmt.Errorf("corrupt raft entry at offset %d: %w", valid, err)
+			}
+			entries = append(truncateEntries(entries, entry.Index-1), entry)
+		case "truncate":
+			entries = truncateEntries(entries, record.Index)
+		default:
+			return nil, fmt.Errorf("unknown raft log op %q at offset %d", record.Op, valid)
+		}
+
+		valid = end
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan raft log: %w", err)
+	}
+
+	if valid < len(data) {
+		if err := os.Truncate(path, int64(valid)); err != nil {
+			return nil, fmt.Errorf("failed to trim torn raft log record: %w", err)
+		}
+	}
+
+	return entries, nil
+}
+
+// truncateEntries drops entries with an index greater than index
+func truncateEntries(entries []*proto.RaftEntry, index uint64) []*proto.RaftEntry {
+	for i, entry := range entries {
+		if entry.Index > index {
+			return entries[:i]
+		}
+	}
+	return entries
+}
+
+// readJSONFile decodes path into v, leaving v untouched if the file does not exist
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile atomically replaces path with the JSON encoding of v
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to install %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeFileSync writes data to path and syncs it to disk
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Ensure both storages satisfy the storage interface
+var (
+	_ Storage = (*MemoryStorage)(nil)
+	_ Storage = (*FileStorage)(nil)
+)
@@ -4,14 +4,20 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
 	"myDvpn/base/proto"
+	"myDvpn/base/raft"
+	"myDvpn/base/store"
+	"myDvpn/utils"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	gproto "google.golang.org/protobuf/proto"
 )
 
 // BaseNode represents the base node server
@@ -23,14 +29,25 @@ type BaseNode struct {
 	supernodesMux sync.RWMutex
 	logger       *logrus.Logger
 	server       *grpc.Server
+	creds        *utils.TLSCredentials
+	store        store.SuperNodeStore
+	startedAt    time.Time
+
+	// Set when running as a member of a replicated cluster
+	cluster        *raft.Node
+	leaderConns    map[string]*grpc.ClientConn
+	leaderConnsMux sync.Mutex
 }
 
 // NewBaseNode creates a new BaseNode
-func NewBaseNode(listenAddr string, logger *logrus.Logger) *BaseNode {
+func NewBaseNode(listenAddr string, supernodeStore store.SuperNodeStore, creds *utils.TLSCredentials, logger *logrus.Logger) *BaseNode {
 	return &BaseNode{
 		listenAddr: listenAddr,
 		supernodes: make(map[string]*proto.SuperNodeInfo),
 		logger:     logger,
+		creds:      creds,
+		store:      supernodeStore,
+		startedAt:  time.Now(),
 	}
 }
 
@@ -41,10 +58,35 @@ func (bn *BaseNode) Start() error {
 		return fmt.Errorf("failed to listen on %s: %w", bn.listenAddr, err)
 	}
 
-	bn.server = grpc.NewServer()
+	return bn.Serve(listener)
+}
+
+// Serve runs the BaseNode server on an existing listener
+func (bn *BaseNode) Serve(listener net.Listener) error {
+	serverCreds, err := bn.creds.ServerOption()
+	if err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to configure server credentials: %w", err)
+	}
+
+	// Cluster members rebuild the directory from the replicated log instead;
+	// registrations replayed from it are unverified like restored ones
+	if bn.cluster == nil {
+		if err := bn.restoreSupernodes(); err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to restore SuperNodes: %w", err)
+		}
+	}
+
+	bn.server = grpc.NewServer(serverCreds)
 	proto.RegisterBaseNodeServer(bn.server, bn)
 
-	bn.logger.WithField("addr", bn.listenAddr).Info("Starting BaseNode server")
+	if bn.cluster != nil {
+		bn.cluster.Register(bn.server)
+		bn.cluster.Start()
+	}
+
+	bn.logger.WithField("addr", listener.Addr().String()).Info("Starting BaseNode server")
 
 	// Start background cleanup task
 	go bn.cleanupStaleSupernodes()
@@ -54,16 +96,49 @@ func (bn *BaseNode) Start() error {
 
 // Stop stops the BaseNode server
 func (bn *BaseNode) Stop() {
+	if bn.cluster != nil {
+		bn.cluster.Stop()
+
+		bn.leaderConnsMux.Lock()
+		for _, conn := range bn.leaderConns {
+			conn.Close()
+		}
+		bn.leaderConnsMux.Unlock()
+	}
+
 	if bn.server != nil {
 		bn.server.GracefulStop()
 	}
+
+	if err := bn.store.Close(); err != nil {
+		bn.logger.WithError(err).Warn("Failed to close SuperNode store")
+	}
 }
 
-// RegisterSuperNode registers a SuperNode
-func (bn *BaseNode) RegisterSuperNode(ctx context.Context, req *proto.RegisterSuperNodeRequest) (*proto.RegisterSuperNodeResponse, error) {
+// restoreSupernodes loads persisted registrations. They stay unverified until
+// the SuperNode's next heartbeat confirms it is still alive.
+func (bn *BaseNode) restoreSupernodes() error {
+	infos, err := bn.store.LoadAll()
+	if err != nil {
+		return err
+	}
+
 	bn.supernodesMux.Lock()
 	defer bn.supernodesMux.Unlock()
 
+	for _, info := range infos {
+		info.Verified = false
+		bn.supernodes[info.SupernodeId] = info
+	}
+
+	if len(infos) > 0 {
+		bn.logger.WithField("supernodes", len(infos)).Info("Restored SuperNodes from store (unverified until next heartbeat)")
+	}
+	return nil
+}
+
+// RegisterSuperNode registers a SuperNode
+func (bn *BaseNode) RegisterSuperNode(ctx context.Context, req *proto.RegisterSuperNodeRequest) (*proto.RegisterSuperNodeResponse, error) {
 	// Validate request
 	if req.SupernodeId == "" {
 		return &proto.RegisterSuperNodeResponse{
@@ -79,26 +154,55 @@ func (bn *BaseNode) RegisterSuperNode(ctx context.Context, req *proto.RegisterSu
 		}, status.Errorf(codes.InvalidArgument, "Region is required")
 	}
 
+	// SuperNodes listening on a wildcard address are reachable at their observed address
+	ipAddress := req.IpAddress
+	if ip := net.ParseIP(ipAddress); ipAddress == "" || (ip != nil && ip.IsUnspecified()) {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+				ipAddress = host
+			}
+		}
+	}
+
+	// Writes are committed by the cluster leader
+	if bn.isFollower() {
+		forwarded := gproto.Clone(req).(*proto.RegisterSuperNodeRequest)
+		forwarded.IpAddress = ipAddress
+		return bn.forwardRegistration(ctx, forwarded)
+	}
+
 	// Update or create SuperNode info
 	supernodeInfo := &proto.SuperNodeInfo{
 		SupernodeId:   req.SupernodeId,
 		Region:        req.Region,
-		IpAddress:     req.IpAddress,
+		IpAddress:     ipAddress,
 		Port:          req.Port,
 		CurrentLoad:   req.CurrentLoad,
 		MaxCapacity:   req.MaxCapacity,
+		Load:          req.Load,
 		LastHeartbeat: time.Now().Unix(),
+		Verified:      true,
 	}
 
-	bn.supernodes[req.SupernodeId] = supernodeInfo
+	err := bn.commit(ctx, &proto.DirectoryCommand{
+		Op:          proto.DirectoryCommand_PUT,
+		Info:        supernodeInfo,
+		SupernodeId: req.SupernodeId,
+	})
+	if err != nil {
+		bn.logger.WithError(err).WithField("supernode_id", req.SupernodeId).Warn("Failed to commit SuperNode registration")
+		return nil, commitError(err)
+	}
 
 	bn.logger.WithFields(logrus.Fields{
-		"supernode_id": req.SupernodeId,
-		"region":       req.Region,
-		"ip_address":   req.IpAddress,
-		"port":         req.Port,
-		"current_load": req.CurrentLoad,
-		"max_capacity": req.MaxCapacity,
+		"supernode_id":  req.SupernodeId,
+		"region":        req.Region,
+		"ip_address":    ipAddress,
+		"port":          req.Port,
+		"current_load":  req.CurrentLoad,
+		"max_capacity":  req.MaxCapacity,
+		"exit_capacity": req.Load.GetExitCapacity(),
+		"exit_clients":  req.Load.GetExitClients(),
 	}).Info("SuperNode registered/updated")
 
 	return &proto.RegisterSuperNodeResponse{
@@ -131,17 +235,18 @@ func (bn *BaseNode) RequestExitRegion(ctx context.Context, req *proto.RequestExi
 		}
 	}
 
-	// Sort candidates by load (simple selection - choose least loaded)
-	if len(candidates) > 1 {
-		// Simple bubble sort by current load
-		for i := 0; i < len(candidates); i++ {
-			for j := i + 1; j < len(candidates); j++ {
-				if candidates[i].CurrentLoad > candidates[j].CurrentLoad {
-					candidates[i], candidates[j] = candidates[j], candidates[i]
-				}
-			}
+	// Verified SuperNodes first, then those with the most room on their exits,
+	// then least loaded
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Verified != candidates[j].Verified {
+			return candidates[i].Verified
 		}
-	}
+		spareI, spareJ := availableExitCapacity(candidates[i]), availableExitCapacity(candidates[j])
+		if spareI != spareJ {
+			return spareI > spareJ
+		}
+		return candidates[i].CurrentLoad < candidates[j].CurrentLoad
+	})
 
 	bn.logger.WithFields(logrus.Fields{
 		"target_region":        req.TargetRegion,
@@ -154,6 +259,15 @@ func (bn *BaseNode) RequestExitRegion(ctx context.Context, req *proto.RequestExi
 	}, nil
 }
 
+// availableExitCapacity returns how many more clients a SuperNode's exits
+// accept. SuperNodes that do not report their load rank as having none.
+func availableExitCapacity(info *proto.SuperNodeInfo) int32 {
+	if info.Load == nil || info.Load.ExitClients >= info.Load.ExitCapacity {
+		return 0
+	}
+	return info.Load.ExitCapacity - info.Load.ExitClients
+}
+
 // ListSuperNodes returns all registered SuperNodes
 func (bn *BaseNode) ListSuperNodes(ctx context.Context, req *proto.ListSuperNodesRequest) (*proto.ListSuperNodesResponse, error) {
 	bn.supernodesMux.RLock()
@@ -177,30 +291,44 @@ func (bn *BaseNode) cleanupStaleSupernodes() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		bn.supernodesMux.Lock()
+		// Only the cluster leader expires registrations; followers see the deletes replicated
+		if bn.isFollower() {
+			continue
+		}
+
+		bn.supernodesMux.RLock()
 
-		var staleSupernodes []string
+		var staleSupernodes []*proto.SuperNodeInfo
 		now := time.Now().Unix()
 
-		for id, supernode := range bn.supernodes {
+		for _, supernode := range bn.supernodes {
 			// Remove SuperNodes that haven't sent heartbeat in 5 minutes
 			if now-supernode.LastHeartbeat > 300 {
-				staleSupernodes = append(staleSupernodes, id)
+				staleSupernodes = append(staleSupernodes, supernode)
 			}
 		}
 
-		for _, id := range staleSupernodes {
-			supernode := bn.supernodes[id]
-			delete(bn.supernodes, id)
+		bn.supernodesMux.RUnlock()
+
+		for _, supernode := range staleSupernodes {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := bn.commit(ctx, &proto.DirectoryCommand{
+				Op:          proto.DirectoryCommand_DELETE,
+				SupernodeId: supernode.SupernodeId,
+			})
+			cancel()
+
+			if err != nil {
+				bn.logger.WithError(err).WithField("supernode_id", supernode.SupernodeId).Warn("Failed to remove stale SuperNode")
+				continue
+			}
 
 			bn.logger.WithFields(logrus.Fields{
-				"supernode_id":   id,
+				"supernode_id":   supernode.SupernodeId,
 				"region":         supernode.Region,
 				"last_heartbeat": supernode.LastHeartbeat,
 			}).Warn("Removed stale SuperNode")
 		}
-
-		bn.supernodesMux.Unlock()
 	}
 }
 
@@ -219,11 +347,17 @@ func (bn *BaseNode) GetMetrics() map[string]interface{} {
 		totalCapacity += int64(supernode.MaxCapacity)
 	}
 
-	return map[string]interface{}{
+	metrics := map[string]interface{}{
 		"total_supernodes":   len(bn.supernodes),
 		"regions":           regionCount,
 		"total_load":        totalLoad,
 		"total_capacity":    totalCapacity,
 		"utilization_pct":   float64(totalLoad) / float64(totalCapacity) * 100,
 	}
+
+	if bn.cluster != nil {
+		metrics["cluster"] = bn.cluster.GetStats()
+	}
+
+	return metrics
 }
\ No newline at end of file
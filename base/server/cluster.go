@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"myDvpn/base/proto"
+	"myDvpn/base/raft"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// forwardedHeader marks a request a follower already forwarded, so it is never forwarded twice
+const forwardedHeader = "x-mydvpn-forwarded"
+
+// EnableCluster makes this BaseNode a member of a replicated cluster. Directory
+// changes are then committed through the cluster log; followers forward writes
+// to the leader and serve reads from their local replica. The cluster log and
+// its snapshots in storage are the member's durable state: the SuperNode store
+// is neither read nor written. Call before Start.
+func (bn *BaseNode) EnableCluster(config raft.Config, storage raft.Storage) error {
+	node, err := raft.NewNode(config, &directoryStateMachine{bn: bn}, storage, bn.creds, bn.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create cluster member: %w", err)
+	}
+
+	bn.cluster = node
+	bn.leaderConns = make(map[string]*grpc.ClientConn)
+	return nil
+}
+
+// commit applies a directory change, replicating it first when clustering is enabled
+func (bn *BaseNode) commit(ctx context.Context, cmd *proto.DirectoryCommand) error {
+	if bn.cluster == nil {
+		bn.applyCommand(cmd)
+		return nil
+	}
+
+	data, err := gproto.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to encode directory command: %w", err)
+	}
+	return bn.cluster.Propose(ctx, data)
+}
+
+// applyCommand applies a committed directory change to the local replica
+func (bn *BaseNode) applyCommand(cmd *proto.DirectoryCommand) {
+	bn.supernodesMux.Lock()
+	defer bn.supernodesMux.Unlock()
+
+	switch cmd.Op {
+	case proto.DirectoryCommand_PUT:
+		bn.supernodes[cmd.Info.SupernodeId] = cmd.Info
+
+		if bn.cluster != nil {
+			bn.markReplayed(cmd.Info)
+			return
+		}
+
+		// The in-memory directory stays authoritative; the heartbeat will persist it next time
+		if err := bn.store.Put(cmd.Info); err != nil {
+			bn.logger.WithError(err).WithField("supernode_id", cmd.Info.SupernodeId).Error("Failed to persist SuperNode registration")
+		}
+	case proto.DirectoryCommand_DELETE:
+		delete(bn.supernodes, cmd.SupernodeId)
+
+		if bn.cluster != nil {
+			return
+		}
+
+		if err := bn.store.Delete(cmd.SupernodeId); err != nil {
+			bn.logger.WithError(err).WithField("supernode_id", cmd.SupernodeId).Warn("Failed to delete SuperNode from store")
+		}
+	}
+}
+
+// markReplayed marks a registration unverified if its heartbeat predates this
+// member, as for a registration replayed from the cluster log after a restart.
+// It is verified again once the SuperNode's next heartbeat commits.
+func (bn *BaseNode) markReplayed(info *proto.SuperNodeInfo) {
+	if info.LastHeartbeat < bn.startedAt.Unix() {
+		info.Verified = false
+	}
+}
+
+// isFollower reports whether writes must go to another cluster member
+func (bn *BaseNode) isFollower() bool {
+	return bn.cluster != nil && !bn.cluster.IsLeader()
+}
+
+// forwardRegistration sends a registration to the cluster leader
+func (bn *BaseNode) forwardRegistration(ctx context.Context, req *proto.RegisterSuperNodeRequest) (*proto.RegisterSuperNodeResponse, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(forwardedHeader)) > 0 {
+		return nil, status.Errorf(codes.Unavailable, "cluster leadership is changing, retry")
+	}
+
+	leaderID, leaderAddr := bn.cluster.Leader()
+	if leaderID == "" {
+		return nil, status.Errorf(codes.Unavailable, "no cluster leader elected")
+	}
+
+	client, err := bn.leaderClient(leaderAddr)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to reach cluster leader %s: %v", leaderID, err)
+	}
+
+	bn.logger.WithFields(logrus.Fields{
+		"supernode_id": req.SupernodeId,
+		"leader_id":    leaderID,
+	}).Debug("Forwarding SuperNode registration to cluster leader")
+
+	ctx = metadata.AppendToOutgoingContext(ctx, forwardedHeader, bn.cluster.ID())
+	return client.RegisterSuperNode(ctx, req)
+}
+
+// leaderClient returns a BaseNode client for a cluster member, dialing it on first use
+func (bn *BaseNode) leaderClient(addr string) (proto.BaseNodeClient, error) {
+	bn.leaderConnsMux.Lock()
+	defer bn.leaderConnsMux.Unlock()
+
+	if conn, exists := bn.leaderConns[addr]; exists {
+		return proto.NewBaseNodeClient(conn), nil
+	}
+
+	conn, err := grpc.Dial(addr, bn.creds.DialOption())
+	if err != nil {
+		return nil, err
+	}
+	bn.leaderConns[addr] = conn
+	return proto.NewBaseNodeClient(conn), nil
+}
+
+// commitError maps a failed commit to a status the SuperNode client retries elsewhere
+func commitError(err error) error {
+	var notLeader *raft.NotLeaderError
+	if errors.As(err, &notLeader) || errors.Is(err, raft.ErrLeadershipLost) || errors.Is(err, raft.ErrStopped) {
+		return status.Errorf(codes.Unavailable, "%v", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.Errorf(codes.Unavailable, "cluster did not commit in time: %v", err)
+	}
+	return status.Errorf(codes.Internal, "%v", err)
+}
+
+// directoryStateMachine applies replicated directory commands to a BaseNode
+type directoryStateMachine struct {
+	bn *BaseNode
+}
+
+// Apply applies a committed directory command
+func (dsm *directoryStateMachine) Apply(command []byte) {
+	cmd := &proto.DirectoryCommand{}
+	if err := gproto.Unmarshal(command, cmd); err != nil {
+		dsm.bn.logger.WithError(err).Error("Failed to decode replicated directory command")
+		return
+	}
+	dsm.bn.applyCommand(cmd)
+}
+
+// Snapshot serializes the SuperNode directory
+func (dsm *directoryStateMachine) Snapshot() ([]byte, error) {
+	dsm.bn.supernodesMux.RLock()
+	defer dsm.bn.supernodesMux.RUnlock()
+
+	snapshot := &proto.DirectorySnapshot{}
+	for _, info := range dsm.bn.supernodes {
+		snapshot.Supernodes = append(snapshot.Supernodes, info)
+	}
+	sort.Slice(snapshot.Supernodes, func(i, j int) bool {
+		return snapshot.Supernodes[i].SupernodeId < snapshot.Supernodes[j].SupernodeId
+	})
+
+	return gproto.Marshal(snapshot)
+}
+
+// Restore replaces the SuperNode directory with a snapshot
+func (dsm *directoryStateMachine) Restore(data []byte) error {
+	snapshot := &proto.DirectorySnapshot{}
+	if err := gproto.Unmarshal(data, snapshot); err != nil {
+		return fmt.Errorf("failed to decode directory snapshot: %w", err)
+	}
+
+	bn := dsm.bn
+	bn.supernodesMux.Lock()
+	defer bn.supernodesMux.Unlock()
+
+	bn.supernodes = make(map[string]*proto.SuperNodeInfo)
+	for _, info := range snapshot.Supernodes {
+		bn.markReplayed(info)
+		bn.supernodes[info.SupernodeId] = info
+	}
+
+	bn.logger.WithField("supernodes", len(snapshot.Supernodes)).Info("Restored SuperNode directory from cluster snapshot")
+	return nil
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"myDvpn/base/proto"
+	"myDvpn/base/raft"
+	"myDvpn/base/store"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// newTestCluster starts a three-member cluster of BaseNodes serving on loopback
+func newTestCluster(t *testing.T) map[string]*BaseNode {
+	t.Helper()
+
+	peers := make(map[string]string)
+	listeners := make(map[string]net.Listener)
+	for _, id := range []string{"bn1", "bn2", "bn3"} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		listeners[id] = listener
+		peers[id] = listener.Addr().String()
+	}
+
+	members := make(map[string]*BaseNode)
+	for id, listener := range listeners {
+		config := raft.DefaultConfig(id, peers)
+		config.ElectionTimeout = 200 * time.Millisecond
+		config.HeartbeatInterval = 40 * time.Millisecond
+
+		bn := NewBaseNode(listener.Addr().String(), store.NewMemoryStore(), utils.InsecureCredentials(), testLogger())
+		if err := bn.EnableCluster(config, raft.NewMemoryStorage()); err != nil {
+			t.Fatalf("EnableCluster(%s): %v", id, err)
+		}
+		go bn.Serve(listener)
+		members[id] = bn
+	}
+
+	t.Cleanup(func() {
+		for _, bn := range members {
+			bn.Stop()
+		}
+	})
+	return members
+}
+
+// waitFor polls cond until it holds or the timeout passes
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// dialBaseNode returns a client for a BaseNode's gRPC service
+func dialBaseNode(t *testing.T, bn *BaseNode) proto.BaseNodeClient {
+	t.Helper()
+
+	conn, err := grpc.Dial(bn.listenAddr, utils.InsecureCredentials().DialOption())
+	if err != nil {
+		t.Fatalf("dial %s: %v", bn.listenAddr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return proto.NewBaseNodeClient(conn)
+}
+
+func TestFollowerForwardsRegistrationToLeader(t *testing.T) {
+	members := newTestCluster(t)
+
+	var follower *BaseNode
+	waitFor(t, 5*time.Second, "a cluster leader known to every member", func() bool {
+		leaders := 0
+		for _, bn := range members {
+			if bn.cluster.IsLeader() {
+				leaders++
+			}
+			if leaderID, _ := bn.cluster.Leader(); leaderID == "" {
+				return false
+			}
+		}
+		return leaders == 1
+	})
+	for _, bn := range members {
+		if !bn.cluster.IsLeader() {
+			follower = bn
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := dialBaseNode(t, follower).RegisterSuperNode(ctx, &proto.RegisterSuperNodeRequest{
+		SupernodeId: "sn1",
+		Region:      "r1",
+		IpAddress:   "10.0.0.1",
+		Port:        50052,
+		MaxCapacity: 100,
+	})
+	if err != nil || !resp.Success {
+		t.Fatalf("RegisterSuperNode on follower %s: %v %v", follower.cluster.ID(), resp, err)
+	}
+
+	// The registration is committed through the leader and replicated everywhere
+	for id, bn := range members {
+		waitFor(t, 5*time.Second, "registration on "+id, func() bool {
+			list, err := dialBaseNode(t, bn).ListSuperNodes(ctx, &proto.ListSuperNodesRequest{})
+			if err != nil || len(list.Supernodes) != 1 {
+				return false
+			}
+			info := list.Supernodes[0]
+			return info.SupernodeId == "sn1" && info.IpAddress == "10.0.0.1" && info.Verified
+		})
+	}
+}
+
+func TestReplayedRegistrationsAreUnverified(t *testing.T) {
+	supernodeStore := store.NewMemoryStore()
+	bn := NewBaseNode("127.0.0.1:0", supernodeStore, utils.InsecureCredentials(), testLogger())
+	peers := map[string]string{"bn1": "127.0.0.1:1"}
+	if err := bn.EnableCluster(raft.DefaultConfig("bn1", peers), raft.NewMemoryStorage()); err != nil {
+		t.Fatalf("EnableCluster: %v", err)
+	}
+	defer bn.cluster.Stop()
+
+	dsm := &directoryStateMachine{bn: bn}
+	before := bn.startedAt.Add(-time.Minute).Unix()
+	after := bn.startedAt.Add(time.Second).Unix()
+
+	put := func(id string, lastHeartbeat int64) []byte {
+		data, err := gproto.Marshal(&proto.DirectoryCommand{
+			Op:          proto.DirectoryCommand_PUT,
+			SupernodeId: id,
+			Info:        &proto.SuperNodeInfo{SupernodeId: id, Region: "r1", LastHeartbeat: lastHeartbeat, Verified: true},
+		})
+		if err != nil {
+			t.Fatalf("encode command: %v", err)
+		}
+		return data
+	}
+
+	verified := func(id string) bool {
+		bn.supernodesMux.RLock()
+		defer bn.supernodesMux.RUnlock()
+		info, exists := bn.supernodes[id]
+		if !exists {
+			t.Fatalf("%s is not in the directory", id)
+		}
+		return info.Verified
+	}
+
+	// Entries replayed from the log after a restart predate this member
+	dsm.Apply(put("replayed", before))
+	dsm.Apply(put("fresh", after))
+	if verified("replayed") {
+		t.Fatal("registration replayed from the log is verified")
+	}
+	if !verified("fresh") {
+		t.Fatal("registration committed since the member started is unverified")
+	}
+
+	snapshot, err := gproto.Marshal(&proto.DirectorySnapshot{Supernodes: []*proto.SuperNodeInfo{
+		{SupernodeId: "restored", LastHeartbeat: before, Verified: true},
+		{SupernodeId: "current", LastHeartbeat: after, Verified: true},
+	}})
+	if err != nil {
+		t.Fatalf("encode snapshot: %v", err)
+	}
+	if err := dsm.Restore(snapshot); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if verified("restored") {
+		t.Fatal("registration restored from a snapshot is verified")
+	}
+	if !verified("current") {
+		t.Fatal("registration heartbeating since the member started is unverified")
+	}
+
+	// The cluster log is the durable state; the store is left alone
+	if infos, _ := supernodeStore.LoadAll(); len(infos) != 0 {
+		t.Fatalf("%d registrations written to the SuperNode store, want 0", len(infos))
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"strconv"
+
+	"myDvpn/base/raft"
+	"myDvpn/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// baseNodeCollector reports the SuperNode directory and cluster state to Prometheus
+type baseNodeCollector struct {
+	bn *BaseNode
+
+	supernodes   *prometheus.Desc
+	load         *prometheus.Desc
+	capacity     *prometheus.Desc
+	exitCapacity *prometheus.Desc
+	exitClients  *prometheus.Desc
+	clusterRole  *prometheus.Desc
+	clusterTerm  *prometheus.Desc
+	commitIndex  *prometheus.Desc
+	appliedIndex *prometheus.Desc
+}
+
+// newBaseNodeCollector creates the collector for a BaseNode
+func newBaseNodeCollector(bn *BaseNode) *baseNodeCollector {
+	return &baseNodeCollector{
+		bn: bn,
+		supernodes: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "supernodes"),
+			"Registered SuperNodes by region and whether they heartbeated since the last restart",
+			[]string{"region", "verified"}, nil,
+		),
+		load: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "region_load"),
+			"Sum of reported SuperNode load by region",
+			[]string{"region"}, nil,
+		),
+		capacity: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "region_capacity"),
+			"Sum of reported SuperNode capacity by region",
+			[]string{"region"}, nil,
+		),
+		exitCapacity: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "region_exit_capacity"),
+			"Sum of clients the exits of each region's SuperNodes accept",
+			[]string{"region"}, nil,
+		),
+		exitClients: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "region_exit_clients"),
+			"Sum of clients set up on the exits of each region's SuperNodes",
+			[]string{"region"}, nil,
+		),
+		clusterRole: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "cluster_leader"),
+			"Whether this BaseNode is the cluster leader (1) or not (0)",
+			nil, nil,
+		),
+		clusterTerm: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "cluster_term"),
+			"Current cluster election term",
+			nil, nil,
+		),
+		commitIndex: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "cluster_commit_index"),
+			"Highest cluster log index known to be committed",
+			nil, nil,
+		),
+		appliedIndex: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "basenode", "cluster_applied_index"),
+			"Highest cluster log index applied to the directory",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *baseNodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.supernodes
+	ch <- c.load
+	ch <- c.capacity
+	ch <- c.exitCapacity
+	ch <- c.exitClients
+	ch <- c.clusterRole
+	ch <- c.clusterTerm
+	ch <- c.commitIndex
+	ch <- c.appliedIndex
+}
+
+// Collect implements prometheus.Collector
+func (c *baseNodeCollector) Collect(ch chan<- prometheus.Metric) {
+	type supernodeKey struct {
+		region   string
+		verified bool
+	}
+	counts := make(map[supernodeKey]int)
+	load := make(map[string]int64)
+	capacity := make(map[string]int64)
+	exitCapacity := make(map[string]int64)
+	exitClients := make(map[string]int64)
+
+	c.bn.supernodesMux.RLock()
+	for _, supernode := range c.bn.supernodes {
+		counts[supernodeKey{region: supernode.Region, verified: supernode.Verified}]++
+		load[supernode.Region] += int64(supernode.CurrentLoad)
+		capacity[supernode.Region] += int64(supernode.MaxCapacity)
+		exitCapacity[supernode.Region] += int64(supernode.Load.GetExitCapacity())
+		exitClients[supernode.Region] += int64(supernode.Load.GetExitClients())
+	}
+	c.bn.supernodesMux.RUnlock()
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.supernodes, prometheus.GaugeValue, float64(count), key.region, strconv.FormatBool(key.verified))
+	}
+	for region, value := range load {
+		ch <- prometheus.MustNewConstMetric(c.load, prometheus.GaugeValue, float64(value), region)
+	}
+	for region, value := range capacity {
+		ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(value), region)
+	}
+	for region, value := range exitCapacity {
+		ch <- prometheus.MustNewConstMetric(c.exitCapacity, prometheus.GaugeValue, float64(value), region)
+	}
+	for region, value := range exitClients {
+		ch <- prometheus.MustNewConstMetric(c.exitClients, prometheus.GaugeValue, float64(value), region)
+	}
+
+	if c.bn.cluster == nil {
+		return
+	}
+
+	stats := c.bn.cluster.GetStats()
+	leader := 0.0
+	if stats["role"] == raft.RoleLeader {
+		leader = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.clusterRole, prometheus.GaugeValue, leader)
+	ch <- prometheus.MustNewConstMetric(c.clusterTerm, prometheus.GaugeValue, float64(stats["term"].(uint64)))
+	ch <- prometheus.MustNewConstMetric(c.commitIndex, prometheus.GaugeValue, float64(stats["commit_index"].(uint64)))
+	ch <- prometheus.MustNewConstMetric(c.appliedIndex, prometheus.GaugeValue, float64(stats["last_applied"].(uint64)))
+}
+
+// RegisterMetrics registers the BaseNode's metrics with a Prometheus registry
+func (bn *BaseNode) RegisterMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(newBaseNodeCollector(bn))
+}
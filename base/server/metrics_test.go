@@ -0,0 +1,46 @@
+package server
+
+import (
+	"testing"
+
+	"myDvpn/base/proto"
+	"myDvpn/base/store"
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+)
+
+func TestBaseNodeRegisterMetrics(t *testing.T) {
+	bn := NewBaseNode("127.0.0.1:0", store.NewMemoryStore(), utils.InsecureCredentials(), testLogger())
+	bn.supernodes["sn1"] = &proto.SuperNodeInfo{SupernodeId: "sn1", Region: "r1", CurrentLoad: 2, MaxCapacity: 10}
+
+	registry := utils.NewMetricsRegistry()
+	if err := bn.RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics: %v", err)
+	}
+	testutil.ExpectMetrics(t, registry,
+		"mydvpn_basenode_supernodes",
+		"mydvpn_basenode_region_load",
+		"mydvpn_basenode_region_capacity",
+		"mydvpn_basenode_region_exit_capacity",
+		"mydvpn_basenode_region_exit_clients",
+	)
+
+	if err := bn.RegisterMetrics(registry); err == nil {
+		t.Fatal("registering the BaseNode metrics twice succeeded")
+	}
+}
+
+func TestClusteredBaseNodeRegisterMetrics(t *testing.T) {
+	members := newTestCluster(t)
+
+	registry := utils.NewMetricsRegistry()
+	if err := members["bn1"].RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics: %v", err)
+	}
+	testutil.ExpectMetrics(t, registry,
+		"mydvpn_basenode_cluster_leader",
+		"mydvpn_basenode_cluster_term",
+		"mydvpn_basenode_cluster_commit_index",
+		"mydvpn_basenode_cluster_applied_index",
+	)
+}
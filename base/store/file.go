@@ -0,0 +1,329 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"myDvpn/base/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+const (
+	snapshotFileName = "supernodes.snapshot.json"
+	walFileName      = "supernodes.wal"
+
+	// defaultCompactThreshold is the number of WAL entries after which a snapshot is written
+	defaultCompactThreshold = 1000
+)
+
+// walEntry is one line of the write-ahead log
+type walEntry struct {
+	Op          string          `json:"op"` // "put" or "delete"
+	SupernodeID string          `json:"supernode_id"`
+	Info        json.RawMessage `json:"info,omitempty"` // protojson SuperNodeInfo for puts
+}
+
+// snapshotFile is the compacted state
+type snapshotFile struct {
+	Supernodes []json.RawMessage `json:"supernodes"`
+}
+
+// FileStore persists registrations in a directory as a snapshot plus an
+// append-only write-ahead log. Every change is appended and synced before it
+// is acknowledged; the log is folded into a new snapshot once it grows large.
+type FileStore struct {
+	dir              string
+	supernodes       map[string]*proto.SuperNodeInfo
+	wal              *os.File
+	walEntries       int
+	compactThreshold int
+	mutex            sync.Mutex
+}
+
+// NewFileStore opens (or creates) a file store in dir and replays its contents
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	fs := &FileStore{
+		dir:              dir,
+		supernodes:       make(map[string]*proto.SuperNodeInfo),
+		compactThreshold: defaultCompactThreshold,
+	}
+
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := fs.replayWAL(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+	fs.wal = wal
+
+	return fs, nil
+}
+
+// Put records a registration
+func (fs *FileStore) Put(info *proto.SuperNodeInfo) error {
+	encoded, err := protojson.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to encode SuperNode %s: %w", info.SupernodeId, err)
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if err := fs.append(&walEntry{Op: "put", SupernodeID: info.SupernodeId, Info: encoded}); err != nil {
+		return err
+	}
+
+	fs.supernodes[info.SupernodeId] = gproto.Clone(info).(*proto.SuperNodeInfo)
+	return fs.maybeCompact()
+}
+
+// Delete forgets a registration
+func (fs *FileStore) Delete(supernodeID string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, exists := fs.supernodes[supernodeID]; !exists {
+		return nil
+	}
+
+	if err := fs.append(&walEntry{Op: "delete", SupernodeID: supernodeID}); err != nil {
+		return err
+	}
+
+	delete(fs.supernodes, supernodeID)
+	return fs.maybeCompact()
+}
+
+// LoadAll returns copies of every registration
+func (fs *FileStore) LoadAll() ([]*proto.SuperNodeInfo, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	var infos []*proto.SuperNodeInfo
+	for _, info := range fs.supernodes {
+		infos = append(infos, gproto.Clone(info).(*proto.SuperNodeInfo))
+	}
+	return infos, nil
+}
+
+// Compact writes a snapshot of the current state and truncates the WAL
+func (fs *FileStore) Compact() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.compact()
+}
+
+// Close compacts the store and closes the WAL
+func (fs *FileStore) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if fs.wal == nil {
+		return nil
+	}
+
+	err := fs.compact()
+	if closeErr := fs.wal.Close(); err == nil {
+		err = closeErr
+	}
+	fs.wal = nil
+	return err
+}
+
+// append writes and syncs one WAL entry
+func (fs *FileStore) append(entry *walEntry) error {
+	if fs.wal == nil {
+		return fmt.Errorf("store is closed")
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode WAL entry: %w", err)
+	}
+
+	if _, err := fs.wal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to WAL: %w", err)
+	}
+	if err := fs.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+
+	fs.walEntries++
+	return nil
+}
+
+// maybeCompact compacts once the WAL reaches the threshold
+func (fs *FileStore) maybeCompact() error {
+	if fs.walEntries < fs.compactThreshold {
+		return nil
+	}
+	return fs.compact()
+}
+
+// compact replaces the snapshot with the current state, then empties the WAL.
+// A crash between the two steps is harmless: replaying the old WAL over the
+// new snapshot yields the same state because every entry carries full state.
+func (fs *FileStore) compact() error {
+	ids := make([]string, 0, len(fs.supernodes))
+	for id := range fs.supernodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	snapshot := snapshotFile{Supernodes: []json.RawMessage{}}
+	for _, id := range ids {
+		encoded, err := protojson.Marshal(fs.supernodes[id])
+		if err != nil {
+			return fmt.Errorf("failed to encode SuperNode %s: %w", id, err)
+		}
+		snapshot.Supernodes = append(snapshot.Supernodes, encoded)
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	path := filepath.Join(fs.dir, snapshotFileName)
+	tmp, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to install snapshot: %w", err)
+	}
+	// The rename is only durable once the directory entry is synced; the WAL
+	// must not be emptied before that
+	if err := syncDir(fs.dir); err != nil {
+		return fmt.Errorf("failed to sync store directory: %w", err)
+	}
+
+	if fs.wal != nil {
+		if err := fs.wal.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate WAL: %w", err)
+		}
+	}
+	fs.walEntries = 0
+	return nil
+}
+
+// syncDir flushes a directory's entries to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// loadSnapshot reads the snapshot if one exists
+func (fs *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(fs.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	for _, raw := range snapshot.Supernodes {
+		info := &proto.SuperNodeInfo{}
+		if err := protojson.Unmarshal(raw, info); err != nil {
+			return fmt.Errorf("failed to parse snapshot entry: %w", err)
+		}
+		fs.supernodes[info.SupernodeId] = info
+	}
+	return nil
+}
+
+// replayWAL applies the WAL on top of the snapshot. A torn final line from a
+// crash mid-write is discarded; corruption anywhere else is an error.
+func (fs *FileStore) replayWAL() error {
+	data, err := os.ReadFile(filepath.Join(fs.dir, walFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read WAL: %w", err)
+	}
+
+	// Drop a torn final line left by a crash mid-write so new entries start on a fresh line
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+		if err := os.Truncate(filepath.Join(fs.dir, walFileName), int64(len(data))); err != nil {
+			return fmt.Errorf("failed to trim torn WAL entry: %w", err)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry walEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("corrupt WAL entry at line %d: %w", lineNo, err)
+		}
+
+		switch entry.Op {
+		case "put":
+			info := &proto.SuperNodeInfo{}
+			if err := protojson.Unmarshal(entry.Info, info); err != nil {
+				return fmt.Errorf("corrupt WAL entry at line %d: %w", lineNo, err)
+			}
+			fs.supernodes[info.SupernodeId] = info
+		case "delete":
+			delete(fs.supernodes, entry.SupernodeID)
+		default:
+			return fmt.Errorf("unknown WAL op %q at line %d", entry.Op, lineNo)
+		}
+		fs.walEntries++
+	}
+
+	return scanner.Err()
+}
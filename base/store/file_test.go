@@ -0,0 +1,197 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"myDvpn/base/proto"
+)
+
+// crash closes the WAL without compacting, as a killed process would leave it
+func crash(t *testing.T, fs *FileStore) {
+	t.Helper()
+	if err := fs.wal.Close(); err != nil {
+		t.Fatalf("closing WAL: %v", err)
+	}
+	fs.wal = nil
+}
+
+func openStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return fs
+}
+
+// loadRegions returns the region of every stored SuperNode by ID
+func loadRegions(t *testing.T, fs *FileStore) map[string]string {
+	t.Helper()
+	infos, err := fs.LoadAll()
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	regions := make(map[string]string)
+	for _, info := range infos {
+		regions[info.SupernodeId] = info.Region
+	}
+	return regions
+}
+
+func assertRegions(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("stored SuperNodes %v, want %v", got, want)
+	}
+	for id, region := range want {
+		if got[id] != region {
+			t.Fatalf("stored SuperNodes %v, want %v", got, want)
+		}
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	return info.Size()
+}
+
+func TestFileStoreReplaysWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	fs := openStore(t, dir)
+	for _, info := range []*proto.SuperNodeInfo{
+		{SupernodeId: "sn1", Region: "r1"},
+		{SupernodeId: "sn2", Region: "r2"},
+		{SupernodeId: "sn1", Region: "r3"},
+	} {
+		if err := fs.Put(info); err != nil {
+			t.Fatalf("Put(%s): %v", info.SupernodeId, err)
+		}
+	}
+	if err := fs.Delete("sn2"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	crash(t, fs)
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); !os.IsNotExist(err) {
+		t.Fatalf("snapshot written before compaction: %v", err)
+	}
+
+	fs = openStore(t, dir)
+	defer fs.Close()
+
+	assertRegions(t, loadRegions(t, fs), map[string]string{"sn1": "r3"})
+	if fs.walEntries != 4 {
+		t.Fatalf("%d WAL entries replayed, want 4", fs.walEntries)
+	}
+}
+
+func TestFileStoreTrimsTornWALEntry(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, walFileName)
+
+	fs := openStore(t, dir)
+	if err := fs.Put(&proto.SuperNodeInfo{SupernodeId: "sn1", Region: "r1"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	crash(t, fs)
+	intact := fileSize(t, walPath)
+
+	// A crash mid-append leaves half an entry without its newline
+	wal, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("opening WAL: %v", err)
+	}
+	if _, err := wal.WriteString(`{"op":"put","supernode_id":"sn2","info":{"supern`); err != nil {
+		t.Fatalf("writing torn entry: %v", err)
+	}
+	wal.Close()
+
+	fs = openStore(t, dir)
+	assertRegions(t, loadRegions(t, fs), map[string]string{"sn1": "r1"})
+	if size := fileSize(t, walPath); size != intact {
+		t.Fatalf("WAL is %d bytes after replay, want the torn entry trimmed to %d", size, intact)
+	}
+
+	// New entries start on a fresh line and survive the next replay
+	if err := fs.Put(&proto.SuperNodeInfo{SupernodeId: "sn2", Region: "r2"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	crash(t, fs)
+
+	fs = openStore(t, dir)
+	defer fs.Close()
+	assertRegions(t, loadRegions(t, fs), map[string]string{"sn1": "r1", "sn2": "r2"})
+}
+
+func TestFileStoreRejectsCorruptWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	data := "not json\n" + `{"op":"delete","supernode_id":"sn1"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, walFileName), []byte(data), 0600); err != nil {
+		t.Fatalf("writing WAL: %v", err)
+	}
+
+	if _, err := NewFileStore(dir); err == nil {
+		t.Fatal("NewFileStore accepted a corrupt WAL entry before the last line")
+	}
+}
+
+func TestFileStoreCompacts(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, walFileName)
+
+	fs := openStore(t, dir)
+	fs.compactThreshold = 3
+
+	if err := fs.Put(&proto.SuperNodeInfo{SupernodeId: "sn1", Region: "r1"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := fs.Put(&proto.SuperNodeInfo{SupernodeId: "sn2", Region: "r2"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if fs.walEntries != 2 || fileSize(t, walPath) == 0 {
+		t.Fatalf("compacted before reaching the threshold")
+	}
+
+	// The third entry reaches the threshold: the snapshot takes over the WAL
+	if err := fs.Delete("sn1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if fs.walEntries != 0 {
+		t.Fatalf("%d WAL entries after compaction, want 0", fs.walEntries)
+	}
+	if size := fileSize(t, walPath); size != 0 {
+		t.Fatalf("WAL is %d bytes after compaction, want 0", size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName+".tmp")); !os.IsNotExist(err) {
+		t.Fatalf("temporary snapshot left behind: %v", err)
+	}
+
+	// Entries after the snapshot are replayed on top of it
+	if err := fs.Put(&proto.SuperNodeInfo{SupernodeId: "sn3", Region: "r3"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	crash(t, fs)
+
+	fs = openStore(t, dir)
+	assertRegions(t, loadRegions(t, fs), map[string]string{"sn2": "r2", "sn3": "r3"})
+
+	// Close compacts everything into the snapshot
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if size := fileSize(t, walPath); size != 0 {
+		t.Fatalf("WAL is %d bytes after Close, want 0", size)
+	}
+
+	fs = openStore(t, dir)
+	defer fs.Close()
+	assertRegions(t, loadRegions(t, fs), map[string]string{"sn2": "r2", "sn3": "r3"})
+}
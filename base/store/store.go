@@ -0,0 +1,78 @@
+package store
+
+import (
+	"sync"
+
+	"myDvpn/base/proto"
+
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// SuperNodeStore persists SuperNode registrations across BaseNode restarts
+type SuperNodeStore interface {
+	// Put records or replaces a SuperNode registration
+	Put(info *proto.SuperNodeInfo) error
+
+	// Delete forgets a SuperNode
+	Delete(supernodeID string) error
+
+	// LoadAll returns every stored registration
+	LoadAll() ([]*proto.SuperNodeInfo, error)
+
+	// Close releases the store
+	Close() error
+}
+
+// MemoryStore keeps registrations in memory only; nothing survives a restart
+type MemoryStore struct {
+	supernodes map[string]*proto.SuperNodeInfo
+	mutex      sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		supernodes: make(map[string]*proto.SuperNodeInfo),
+	}
+}
+
+// Put records a registration
+func (ms *MemoryStore) Put(info *proto.SuperNodeInfo) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.supernodes[info.SupernodeId] = gproto.Clone(info).(*proto.SuperNodeInfo)
+	return nil
+}
+
+// Delete forgets a registration
+func (ms *MemoryStore) Delete(supernodeID string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	delete(ms.supernodes, supernodeID)
+	return nil
+}
+
+// LoadAll returns copies of every registration
+func (ms *MemoryStore) LoadAll() ([]*proto.SuperNodeInfo, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	var infos []*proto.SuperNodeInfo
+	for _, info := range ms.supernodes {
+		infos = append(infos, gproto.Clone(info).(*proto.SuperNodeInfo))
+	}
+	return infos, nil
+}
+
+// Close is a no-op
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// Ensure both stores satisfy the store interface
+var (
+	_ SuperNodeStore = (*MemoryStore)(nil)
+	_ SuperNodeStore = (*FileStore)(nil)
+)
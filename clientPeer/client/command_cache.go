@@ -0,0 +1,58 @@
+package client
+
+import (
+	"sync"
+
+	"myDvpn/clientPeer/proto"
+)
+
+// defaultCommandCacheSize is how many executed commands a peer remembers
+const defaultCommandCacheSize = 256
+
+// commandCache remembers the responses of recently executed commands so a
+// command redelivered by the SuperNode is answered without running it again.
+// Entries are evicted oldest first once the cache is full.
+type commandCache struct {
+	capacity  int
+	responses map[string]*proto.CommandResponse
+	order     []string
+	mutex     sync.Mutex
+}
+
+// newCommandCache creates a command cache holding up to capacity responses
+func newCommandCache(capacity int) *commandCache {
+	return &commandCache{
+		capacity:  capacity,
+		responses: make(map[string]*proto.CommandResponse, capacity),
+		order:     make([]string, 0, capacity),
+	}
+}
+
+// get returns the cached response for a command_id
+func (cc *commandCache) get(commandID string) (*proto.CommandResponse, bool) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	resp, exists := cc.responses[commandID]
+	return resp, exists
+}
+
+// put records the response for a command_id, evicting the oldest entry when full
+func (cc *commandCache) put(commandID string, resp *proto.CommandResponse) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if _, exists := cc.responses[commandID]; exists {
+		cc.responses[commandID] = resp
+		return
+	}
+
+	if len(cc.order) >= cc.capacity {
+		oldest := cc.order[0]
+		cc.order = cc.order[1:]
+		delete(cc.responses, oldest)
+	}
+
+	cc.order = append(cc.order, commandID)
+	cc.responses[commandID] = resp
+}
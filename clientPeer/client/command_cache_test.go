@@ -0,0 +1,93 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+
+	"google.golang.org/grpc"
+)
+
+// recordingControlStream is a control stream that records what the peer sends
+type recordingControlStream struct {
+	grpc.ClientStream
+	sent []*proto.ControlMessage
+}
+
+func (s *recordingControlStream) Send(msg *proto.ControlMessage) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func (s *recordingControlStream) Recv() (*proto.ControlMessage, error) {
+	return nil, io.EOF
+}
+
+func TestCommandCacheEvictsOldest(t *testing.T) {
+	cache := newCommandCache(2)
+	for _, id := range []string{"cmd-1", "cmd-2"} {
+		cache.put(id, &proto.CommandResponse{CommandId: id})
+	}
+
+	// Updating a cached command does not make room
+	cache.put("cmd-1", &proto.CommandResponse{CommandId: "cmd-1", Message: "updated"})
+	if resp, exists := cache.get("cmd-1"); !exists || resp.Message != "updated" {
+		t.Fatalf("cmd-1 cached as %v, want the updated response", resp)
+	}
+	if _, exists := cache.get("cmd-2"); !exists {
+		t.Fatal("cmd-2 was evicted by an update")
+	}
+
+	cache.put("cmd-3", &proto.CommandResponse{CommandId: "cmd-3"})
+	if _, exists := cache.get("cmd-1"); exists {
+		t.Fatal("oldest command was not evicted")
+	}
+	for _, id := range []string{"cmd-2", "cmd-3"} {
+		if _, exists := cache.get(id); !exists {
+			t.Fatalf("%s was evicted", id)
+		}
+	}
+}
+
+func TestHandleCommandReplaysDuplicates(t *testing.T) {
+	psm, err := NewPersistentStreamManager("exit-1", "exit", "r1", "127.0.0.1:1", testutil.Keystore(t).Identity, utils.InsecureCredentials(), testutil.Logger())
+	if err != nil {
+		t.Fatalf("NewPersistentStreamManager: %v", err)
+	}
+	stream := &recordingControlStream{}
+	psm.stream = stream
+
+	runs := 0
+	psm.RegisterCommandHandler(proto.CommandType_SETUP_EXIT, func(cmd *proto.Command) *proto.CommandResponse {
+		runs++
+		return &proto.CommandResponse{CommandId: cmd.CommandId, Success: true, Message: fmt.Sprintf("run %d", runs)}
+	})
+
+	setup := &proto.Command{CommandId: "cmd-1", Type: proto.CommandType_SETUP_EXIT}
+	psm.handleCommand(setup)
+	psm.handleCommand(setup)
+	if runs != 1 {
+		t.Fatalf("handler ran %d times for a redelivered command, want 1", runs)
+	}
+
+	if len(stream.sent) != 2 {
+		t.Fatalf("%d responses sent, want 2", len(stream.sent))
+	}
+	for i, msg := range stream.sent {
+		if resp := msg.GetCommandResponse(); resp == nil || resp.CommandId != "cmd-1" || resp.Message != "run 1" {
+			t.Fatalf("response %d is %v, want the first run's response", i, resp)
+		}
+	}
+
+	// Another command_id runs again, and commands without one are never cached
+	psm.handleCommand(&proto.Command{CommandId: "cmd-2", Type: proto.CommandType_SETUP_EXIT})
+	psm.handleCommand(&proto.Command{Type: proto.CommandType_SETUP_EXIT})
+	psm.handleCommand(&proto.Command{Type: proto.CommandType_SETUP_EXIT})
+	if runs != 4 {
+		t.Fatalf("handler ran %d times, want 4", runs)
+	}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// exitHandshakeTimeout bounds how long a rotating client waits for the new exit to answer
+	exitHandshakeTimeout = 10 * time.Second
+
+	// rotationKeepalive makes the new exit handshake before any traffic is routed to it
+	rotationKeepalive = 5 * time.Second
+)
+
+// exitConfigFromRotation parses the new exit assignment carried by ROTATE_PEER
+func exitConfigFromRotation(payload map[string]string) (*ExitConfig, error) {
+	config := &ExitConfig{
+		ExitPeerID:   payload["exit_peer_id"],
+		PublicKey:    payload["public_key"],
+		Endpoint:     payload["endpoint"],
+		AllowedIPs:   utils.FullTunnelAllowedIPs(),
+		AllocatedIP:  payload["allocated_ip"],
+		AllocatedIP6: payload["allocated_ip6"],
+		SessionID:    payload["session_id"],
+	}
+	if allowedIPs := payload["allowed_ips"]; allowedIPs != "" {
+		config.AllowedIPs = strings.Split(allowedIPs, ",")
+	}
+
+	if config.PublicKey == "" || config.Endpoint == "" || config.AllocatedIP == "" || config.SessionID == "" {
+		return nil, fmt.Errorf("ROTATE_PEER carries no complete exit assignment")
+	}
+	return config, nil
+}
+
+// switchExit moves an interface from its current exit peer to next without a
+// gap in service. The new peer is added with no routes and a keepalive so it
+// handshakes on its own; its tunnel address and routes are only switched over
+// once it has answered, and the old peer is removed last. If the new exit does
+// not answer, it is removed again and the old exit stays in place.
+func switchExit(wgManager utils.WireGuardBackend, interfaceName, oldPubKey string, oldAddrs []string, next *ExitConfig, logger *logrus.Logger) error {
+	if next.PublicKey == oldPubKey {
+		return fmt.Errorf("new exit %s is the current exit", next.ExitPeerID)
+	}
+
+	peerConfig := utils.PeerConfig{
+		PublicKey:           next.PublicKey,
+		Endpoint:            next.Endpoint,
+		PersistentKeepalive: rotationKeepalive,
+	}
+	if err := wgManager.AddPeer(interfaceName, peerConfig); err != nil {
+		return fmt.Errorf("failed to add new exit peer: %w", err)
+	}
+
+	if err := waitForHandshake(wgManager, interfaceName, next.PublicKey, exitHandshakeTimeout); err != nil {
+		wgManager.RemovePeer(interfaceName, next.PublicKey)
+		return err
+	}
+
+	// Exits allocate from their own pools, so the new addresses may equal the old ones
+	nextAddrs := utils.TunnelAddresses(next.AllocatedIP, next.AllocatedIP6)
+	var added, stale []string
+	for _, addr := range nextAddrs {
+		if !containsAddr(oldAddrs, addr) {
+			added = append(added, addr)
+		}
+	}
+	for _, addr := range oldAddrs {
+		if !containsAddr(nextAddrs, addr) {
+			stale = append(stale, addr)
+		}
+	}
+
+	if err := setTunnelAddresses(wgManager, interfaceName, added); err != nil {
+		wgManager.RemovePeer(interfaceName, next.PublicKey)
+		return fmt.Errorf("failed to set new tunnel IP: %w", err)
+	}
+
+	// Allowed IPs belong to one peer at a time, so this moves the routes off the old exit
+	peerConfig.AllowedIPs = next.AllowedIPs
+	if err := wgManager.AddPeer(interfaceName, peerConfig); err != nil {
+		removeTunnelAddresses(wgManager, interfaceName, added, logger)
+		wgManager.RemovePeer(interfaceName, next.PublicKey)
+		return fmt.Errorf("failed to route traffic to new exit peer: %w", err)
+	}
+
+	if oldPubKey != "" {
+		if err := wgManager.RemovePeer(interfaceName, oldPubKey); err != nil {
+			logger.WithError(err).Warn("Failed to remove previous exit peer after rotation")
+		}
+	}
+	removeTunnelAddresses(wgManager, interfaceName, stale, logger)
+
+	return nil
+}
+
+// setTunnelAddresses adds tunnel addresses to an interface, removing the ones
+// already added if any fails
+func setTunnelAddresses(wgManager utils.WireGuardBackend, interfaceName string, addrs []string) error {
+	for i, addr := range addrs {
+		if err := wgManager.SetInterfaceIP(interfaceName, addr); err != nil {
+			for _, added := range addrs[:i] {
+				wgManager.RemoveInterfaceIP(interfaceName, added)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTunnelAddresses removes tunnel addresses from an interface, logging failures
+func removeTunnelAddresses(wgManager utils.WireGuardBackend, interfaceName string, addrs []string, logger *logrus.Logger) {
+	for _, addr := range addrs {
+		if err := wgManager.RemoveInterfaceIP(interfaceName, addr); err != nil {
+			logger.WithError(err).WithField("address", addr).Warn("Failed to remove tunnel IP")
+		}
+	}
+}
+
+// waitForHandshake polls until a peer reports a handshake or timeout passes
+func waitForHandshake(wgManager utils.WireGuardBackend, interfaceName, publicKey string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		device, err := wgManager.GetDevice(interfaceName)
+		if err != nil {
+			return fmt.Errorf("failed to read WireGuard device: %w", err)
+		}
+		for _, peer := range device.Peers {
+			if peer.PublicKey.String() == publicKey && !peer.LastHandshakeTime.IsZero() {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("new exit peer did not handshake within %s", timeout)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"testing"
+
+	"myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+)
+
+// newTestConnectedPeer creates a client peer on the memory backend that is
+// connected to an exit, without connecting to a SuperNode
+func newTestConnectedPeer(t *testing.T) (*Peer, *utils.MemoryWireGuardBackend, *ExitConfig) {
+	t.Helper()
+
+	wg := utils.NewMemoryWireGuardBackend()
+	p, err := NewPeer("c1", "r1", "127.0.0.1:1", wg, testutil.Keystore(t), utils.InsecureCredentials(), testutil.Logger())
+	if err != nil {
+		t.Fatalf("NewPeer: %v", err)
+	}
+	if err := p.initializeWireGuard(); err != nil {
+		t.Fatalf("initializeWireGuard: %v", err)
+	}
+
+	current := &ExitConfig{
+		ExitPeerID:   "exit-1",
+		PublicKey:    testutil.PublicKey(t),
+		Endpoint:     "198.51.100.1:51820",
+		AllowedIPs:   utils.FullTunnelAllowedIPs(),
+		AllocatedIP:  "10.8.0.2",
+		AllocatedIP6: "fd00:8::2",
+		SessionID:    "s1",
+	}
+	if err := p.ConnectToExit(current); err != nil {
+		t.Fatalf("ConnectToExit: %v", err)
+	}
+	return p, wg, current
+}
+
+// rotatePeerCommand builds the ROTATE_PEER a SuperNode sends to move the client to exitPubKey
+func rotatePeerCommand(exitPubKey, allocatedIP, sessionID string) *proto.Command {
+	return &proto.Command{
+		CommandId: "cmd-rotate",
+		Type:      proto.CommandType_ROTATE_PEER,
+		Payload: map[string]string{
+			"exit_peer_id":   "exit-2",
+			"public_key":     exitPubKey,
+			"endpoint":       "198.51.100.2:51820",
+			"allocated_ip":   allocatedIP,
+			"allocated_ip6":  "fd00:9::2",
+			"session_id":     sessionID,
+			"old_session_id": "s1",
+		},
+	}
+}
+
+// expectExitPeer fails the test unless publicKey is the only peer on the
+// interface and the interface holds exactly addrs
+func expectExitPeer(t *testing.T, wg *utils.MemoryWireGuardBackend, iface, publicKey string, addrs ...string) {
+	t.Helper()
+
+	device, err := wg.GetDevice(iface)
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	if len(device.Peers) != 1 || device.Peers[0].PublicKey.String() != publicKey {
+		t.Fatalf("peers on %s %v, want only %s", iface, device.Peers, publicKey)
+	}
+	if len(device.Peers[0].AllowedIPs) == 0 {
+		t.Fatalf("exit peer %s has no allowed IPs", publicKey)
+	}
+
+	got := wg.InterfaceIPs(iface)
+	if len(got) != len(addrs) {
+		t.Fatalf("addresses on %s %v, want %v", iface, got, addrs)
+	}
+	for _, addr := range addrs {
+		if !containsAddr(got, addr) {
+			t.Fatalf("addresses on %s %v, want %v", iface, got, addrs)
+		}
+	}
+}
+
+func TestRotatePeerSwitchesExit(t *testing.T) {
+	p, wg, _ := newTestConnectedPeer(t)
+	nextPubKey := testutil.PublicKey(t)
+
+	resp := p.handleRotatePeerCommand(rotatePeerCommand(nextPubKey, "10.9.0.2", "s2"))
+	if !resp.Success {
+		t.Fatalf("ROTATE_PEER failed: %s", resp.Message)
+	}
+	if resp.Result["old_session_id"] != "s1" || resp.Result["new_session_id"] != "s2" {
+		t.Fatalf("rotation result %v, want s1 replaced by s2", resp.Result)
+	}
+
+	expectExitPeer(t, wg, p.interfaceName, nextPubKey, "10.9.0.2/32", "fd00:9::2/128")
+	if current := p.GetCurrentExit(); current.ExitPeerID != "exit-2" || current.SessionID != "s2" {
+		t.Fatalf("current exit %+v, want s2 on exit-2", current)
+	}
+}
+
+func TestRotatePeerKeepsExitOnFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  func(current *ExitConfig) *proto.Command
+	}{
+		{
+			name: "incomplete assignment",
+			cmd: func(current *ExitConfig) *proto.Command {
+				return rotatePeerCommand(testutil.PublicKey(t), "10.9.0.2", "")
+			},
+		},
+		{
+			name: "rotation to the current exit",
+			cmd: func(current *ExitConfig) *proto.Command {
+				return rotatePeerCommand(current.PublicKey, "10.9.0.2", "s2")
+			},
+		},
+		{
+			name: "tunnel address that cannot be set",
+			cmd: func(current *ExitConfig) *proto.Command {
+				return rotatePeerCommand(testutil.PublicKey(t), "not-an-ip", "s2")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, wg, current := newTestConnectedPeer(t)
+
+			resp := p.handleRotatePeerCommand(tt.cmd(current))
+			if resp.Success {
+				t.Fatal("ROTATE_PEER succeeded")
+			}
+
+			expectExitPeer(t, wg, p.interfaceName, current.PublicKey, "10.8.0.2/32", "fd00:8::2/128")
+			if p.GetCurrentExit() != current {
+				t.Fatalf("current exit %+v, want the old exit kept", p.GetCurrentExit())
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"myDvpn/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Command outcomes recorded by peers
+const (
+	commandOutcomeSuccess   = "success"
+	commandOutcomeFailure   = "failure"
+	commandOutcomeUnhandled = "unhandled"
+	commandOutcomeDuplicate = "duplicate"
+)
+
+// streamMetrics are the control stream metrics of a peer
+type streamMetrics struct {
+	heartbeatRTT    prometheus.Histogram
+	reconnects      prometheus.Counter
+	failovers       prometheus.Counter
+	commandDuration *prometheus.HistogramVec
+	connected       prometheus.GaugeFunc
+}
+
+// newStreamMetrics creates the metrics for a peer's control stream
+func newStreamMetrics(psm *PersistentStreamManager) *streamMetrics {
+	constLabels := prometheus.Labels{"peer_id": psm.peerID, "role": psm.role}
+
+	return &streamMetrics{
+		heartbeatRTT: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   utils.MetricsNamespace,
+			Subsystem:   "peer",
+			Name:        "heartbeat_rtt_seconds",
+			Help:        "Round trip time of control stream heartbeats to the SuperNode",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.001, 2, 14),
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   utils.MetricsNamespace,
+			Subsystem:   "peer",
+			Name:        "reconnects_total",
+			Help:        "Successful reconnections of the control stream",
+			ConstLabels: constLabels,
+		}),
+		failovers: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   utils.MetricsNamespace,
+			Subsystem:   "peer",
+			Name:        "supernode_failovers_total",
+			Help:        "Switches of the control stream to another SuperNode, including fail backs",
+			ConstLabels: constLabels,
+		}),
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   utils.MetricsNamespace,
+			Subsystem:   "peer",
+			Name:        "command_duration_seconds",
+			Help:        "Time spent executing SuperNode commands, by command type and outcome",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"type", "outcome"}),
+		connected: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   utils.MetricsNamespace,
+			Subsystem:   "peer",
+			Name:        "connected",
+			Help:        "Whether the control stream to the SuperNode is up (1) or not (0)",
+			ConstLabels: constLabels,
+		}, func() float64 {
+			if psm.IsConnected() {
+				return 1
+			}
+			return 0
+		}),
+	}
+}
+
+// Collectors returns the control stream's Prometheus collectors
+func (psm *PersistentStreamManager) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		psm.metrics.heartbeatRTT,
+		psm.metrics.reconnects,
+		psm.metrics.failovers,
+		psm.metrics.commandDuration,
+		psm.metrics.connected,
+	}
+}
+
+// RegisterMetrics registers the client peer's metrics with a Prometheus registry
+func (p *Peer) RegisterMetrics(registerer prometheus.Registerer) error {
+	collectors := append(p.streamManager.Collectors(),
+		utils.NewWireGuardCollector(p.wgManager, func() []string {
+			return []string{p.interfaceName}
+		}),
+	)
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterMetrics registers the unified peer's metrics with a Prometheus registry
+func (up *UnifiedPeer) RegisterMetrics(registerer prometheus.Registerer) error {
+	exitClients := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   utils.MetricsNamespace,
+		Subsystem:   "exit",
+		Name:        "active_clients",
+		Help:        "Clients currently served by this exit",
+		ConstLabels: prometheus.Labels{"exit_id": up.id},
+	}, func() float64 {
+		up.clientsMux.RLock()
+		defer up.clientsMux.RUnlock()
+		return float64(len(up.activeClients))
+	})
+
+	collectors := append(up.streamManager.Collectors(),
+		exitClients,
+		utils.NewWireGuardCollector(up.wgManager, func() []string {
+			return []string{up.clientInterface, up.exitInterface}
+		}),
+	)
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"testing"
+
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+)
+
+// streamMetricNames are reported by every peer before it ever connects
+var streamMetricNames = []string{
+	"mydvpn_peer_heartbeat_rtt_seconds",
+	"mydvpn_peer_reconnects_total",
+	"mydvpn_peer_supernode_failovers_total",
+	"mydvpn_peer_connected",
+}
+
+func TestPeerRegisterMetrics(t *testing.T) {
+	wg := utils.NewMemoryWireGuardBackend()
+	p, err := NewPeer("c1", "r1", "127.0.0.1:1", wg, testutil.Keystore(t), utils.InsecureCredentials(), testutil.Logger())
+	if err != nil {
+		t.Fatalf("NewPeer: %v", err)
+	}
+	if err := wg.CreateInterface(p.interfaceName); err != nil {
+		t.Fatalf("CreateInterface: %v", err)
+	}
+
+	registry := utils.NewMetricsRegistry()
+	if err := p.RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics: %v", err)
+	}
+	testutil.ExpectMetrics(t, registry, append(streamMetricNames, "mydvpn_wireguard_peers")...)
+
+	if err := p.RegisterMetrics(registry); err == nil {
+		t.Fatal("registering the peer metrics twice succeeded")
+	}
+}
+
+func TestUnifiedPeerRegisterMetrics(t *testing.T) {
+	up, _ := newTestExitModePeer(t)
+
+	registry := utils.NewMetricsRegistry()
+	if err := up.RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics: %v", err)
+	}
+	testutil.ExpectMetrics(t, registry, append(streamMetricNames, "mydvpn_exit_active_clients", "mydvpn_wireguard_peers")...)
+
+	if err := up.RegisterMetrics(registry); err == nil {
+		t.Fatal("registering the unified peer metrics twice succeeded")
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"sync"
 
+	"myDvpn/clientPeer/proto"
 	"myDvpn/utils"
 	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // Peer represents a client peer
@@ -16,11 +18,11 @@ type Peer struct {
 	logger          *logrus.Logger
 	
 	streamManager   *PersistentStreamManager
-	wgManager       *utils.WireGuardManager
+	wgManager       utils.WireGuardBackend
 	
 	// WireGuard configuration
 	interfaceName   string
-	privateKey      string
+	privateKey      wgtypes.Key
 	currentExit     *ExitConfig
 	
 	mutex           sync.RWMutex
@@ -32,24 +34,31 @@ type ExitConfig struct {
 	PublicKey     string
 	Endpoint      string
 	AllowedIPs    []string
+	AllocatedIP   string
+	AllocatedIP6  string // Empty when the exit has no IPv6
 	SessionID     string
+	Region        string // Region the exit was requested in, empty for the SuperNode's own
+}
+
+// tunnelAddresses returns the addresses the exit assigned to our interface
+func (c *ExitConfig) tunnelAddresses() []string {
+	return utils.TunnelAddresses(c.AllocatedIP, c.AllocatedIP6)
 }
 
 // NewPeer creates a new client peer
-func NewPeer(id, region, supernodeAddr string, logger *logrus.Logger) (*Peer, error) {
+func NewPeer(id, region, supernodeAddr string, wgManager utils.WireGuardBackend, keystore *utils.Keystore, creds *utils.TLSCredentials, logger *logrus.Logger) (*Peer, error) {
 	// Create persistent stream manager
-	streamManager, err := NewPersistentStreamManager(id, "client", region, supernodeAddr, logger)
+	streamManager, err := NewPersistentStreamManager(id, "client", region, supernodeAddr, keystore.Identity, creds, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream manager: %w", err)
 	}
 
-	// Create WireGuard manager
-	wgManager, err := utils.NewWireGuardManager()
+	privateKey, err := keystore.WireGuardKey(utils.WireGuardKeyClient)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create WireGuard manager: %w", err)
+		return nil, err
 	}
 
-	return &Peer{
+	p := &Peer{
 		id:            id,
 		region:        region,
 		supernodeAddr: supernodeAddr,
@@ -57,7 +66,18 @@ func NewPeer(id, region, supernodeAddr string, logger *logrus.Logger) (*Peer, er
 		streamManager: streamManager,
 		wgManager:     wgManager,
 		interfaceName: fmt.Sprintf("wg-client-%s", id),
-	}, nil
+		privateKey:    privateKey,
+	}
+
+	streamManager.RegisterCommandHandler(proto.CommandType_ROTATE_PEER, p.handleRotatePeerCommand)
+	streamManager.SetExitLostHandler(p.handleExitLost)
+
+	return p, nil
+}
+
+// SetBaseNodes lets the peer fail over to SuperNodes of its region listed on these BaseNodes
+func (p *Peer) SetBaseNodes(addrs []string) {
+	p.streamManager.SetBaseNodes(addrs)
 }
 
 // Start starts the client peer
@@ -101,12 +121,7 @@ func (p *Peer) Stop() error {
 
 // initializeWireGuard initializes the WireGuard interface
 func (p *Peer) initializeWireGuard() error {
-	// Generate private key
-	privateKey, err := utils.GenerateKey()
-	if err != nil {
-		return fmt.Errorf("failed to generate private key: %w", err)
-	}
-	p.privateKey = privateKey.String()
+	privateKey := p.privateKey
 
 	// Create interface
 	if err := p.wgManager.CreateInterface(p.interfaceName); err != nil {
@@ -133,33 +148,36 @@ func (p *Peer) cleanupWireGuard() error {
 
 // RequestExit requests an exit peer from the SuperNode
 func (p *Peer) RequestExit(targetRegion string) (*ExitConfig, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-
-	// TODO: Implement exit request logic
-	// This would involve sending a request to the SuperNode for an exit peer
-	// For now, this is a placeholder
+	publicKey, err := p.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
 
 	p.logger.WithFields(logrus.Fields{
 		"peer_id":       p.id,
 		"target_region": targetRegion,
 	}).Info("Requesting exit peer")
 
-	// Placeholder exit config
-	exitConfig := &ExitConfig{
-		ExitPeerID: "exit-placeholder",
-		PublicKey:  "placeholder-key",
-		Endpoint:   "127.0.0.1:51820",
-		AllowedIPs: []string{"0.0.0.0/0"},
-		SessionID:  "session-placeholder",
+	assignment, err := p.streamManager.RequestExit(targetRegion, publicKey, exitRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request exit peer: %w", err)
 	}
 
-	p.currentExit = exitConfig
-	return exitConfig, nil
+	return &ExitConfig{
+		ExitPeerID:  assignment.ExitPeer.PeerId,
+		PublicKey:   assignment.ExitPeer.PublicKey,
+		Endpoint:    assignment.ExitPeer.Endpoint,
+		AllowedIPs:  assignment.ExitPeer.AllowedIps,
+		AllocatedIP:  assignment.AllocatedIp,
+		AllocatedIP6: assignment.AllocatedIp6,
+		SessionID:    assignment.SessionId,
+		Region:       targetRegion,
+	}, nil
 }
 
-// ConnectToExit connects to an exit peer using WireGuard
-func (p *Peer) ConnectToExit(config *ExitConfig) error {
+// ConnectToExit connects to an exit peer using WireGuard and confirms the
+// assignment to the SuperNode, which releases the exit if this fails
+func (p *Peer) ConnectToExit(config *ExitConfig) (err error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -167,11 +185,23 @@ func (p *Peer) ConnectToExit(config *ExitConfig) error {
 		return fmt.Errorf("exit config is nil")
 	}
 
+	defer func() {
+		if confirmErr := p.streamManager.ConfirmExit(config.SessionID, err); confirmErr != nil {
+			p.logger.WithError(confirmErr).Warn("Failed to confirm exit assignment")
+		}
+	}()
+
+	if config.AllocatedIP == "" {
+		return fmt.Errorf("exit config has no allocated IP")
+	}
+
 	// Remove existing peer if any
 	if p.currentExit != nil {
 		if err := p.wgManager.RemovePeer(p.interfaceName, p.currentExit.PublicKey); err != nil {
 			p.logger.WithError(err).Warn("Failed to remove existing peer")
 		}
+		removeTunnelAddresses(p.wgManager, p.interfaceName, p.currentExit.tunnelAddresses(), p.logger)
+		p.currentExit = nil
 	}
 
 	// Add new peer
@@ -185,9 +215,9 @@ func (p *Peer) ConnectToExit(config *ExitConfig) error {
 		return fmt.Errorf("failed to add peer: %w", err)
 	}
 
-	// Set interface IP (typically allocated by the exit peer)
-	// For now, use a default IP
-	if err := p.wgManager.SetInterfaceIP(p.interfaceName, "10.8.0.2/24"); err != nil {
+	// Set interface IPs allocated by the exit peer
+	if err := setTunnelAddresses(p.wgManager, p.interfaceName, config.tunnelAddresses()); err != nil {
+		p.wgManager.RemovePeer(p.interfaceName, config.PublicKey)
 		return fmt.Errorf("failed to set interface IP: %w", err)
 	}
 
@@ -217,16 +247,102 @@ func (p *Peer) DisconnectFromExit() error {
 		return fmt.Errorf("failed to remove peer: %w", err)
 	}
 
+	removeTunnelAddresses(p.wgManager, p.interfaceName, p.currentExit.tunnelAddresses(), p.logger)
+
 	p.logger.WithFields(logrus.Fields{
 		"peer_id":    p.id,
 		"exit_peer":  p.currentExit.ExitPeerID,
 		"session_id": p.currentExit.SessionID,
 	}).Info("Disconnected from exit peer")
 
+	// Let the SuperNode release the session on the exit
+	if err := p.streamManager.ConfirmExit(p.currentExit.SessionID, errExitDisconnected); err != nil {
+		p.logger.WithError(err).WithField("session_id", p.currentExit.SessionID).Warn("Failed to report exit disconnect")
+	}
+
 	p.currentExit = nil
 	return nil
 }
 
+// handleRotatePeerCommand switches to the exit carried by ROTATE_PEER
+func (p *Peer) handleRotatePeerCommand(cmd *proto.Command) *proto.CommandResponse {
+	next, err := exitConfigFromRotation(cmd.Payload)
+	if err != nil {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   err.Error(),
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var oldPubKey, oldSessionID string
+	var oldAddrs []string
+	if p.currentExit != nil {
+		oldPubKey = p.currentExit.PublicKey
+		oldAddrs = p.currentExit.tunnelAddresses()
+		oldSessionID = p.currentExit.SessionID
+		next.Region = p.currentExit.Region
+	}
+
+	result := map[string]string{
+		"old_session_id": oldSessionID,
+		"new_session_id": next.SessionID,
+	}
+
+	if err := switchExit(p.wgManager, p.interfaceName, oldPubKey, oldAddrs, next, p.logger); err != nil {
+		p.logger.WithError(err).WithField("exit_peer", next.ExitPeerID).Warn("Exit rotation failed, keeping current exit")
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   fmt.Sprintf("Rotation failed: %v", err),
+			Result:    result,
+		}
+	}
+
+	p.currentExit = next
+
+	p.logger.WithFields(logrus.Fields{
+		"peer_id":        p.id,
+		"exit_peer":      next.ExitPeerID,
+		"old_session_id": oldSessionID,
+		"new_session_id": next.SessionID,
+	}).Info("Rotated to new exit peer")
+
+	return &proto.CommandResponse{
+		CommandId: cmd.CommandId,
+		Success:   true,
+		Message:   "Rotated to new exit peer",
+		Result:    result,
+	}
+}
+
+// handleExitLost replaces the current exit when its session could not be
+// handed over to the SuperNode we failed over to
+func (p *Peer) handleExitLost(sessionID string) {
+	current := p.GetCurrentExit()
+	if current == nil || current.SessionID != sessionID {
+		return
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"peer_id":    p.id,
+		"exit_peer":  current.ExitPeerID,
+		"session_id": sessionID,
+	}).Warn("Exit session was lost on failover, requesting a new exit")
+
+	config, err := p.RequestExit(current.Region)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to replace exit lost on failover")
+		return
+	}
+	if err := p.ConnectToExit(config); err != nil {
+		p.logger.WithError(err).Error("Failed to connect to exit replacing the one lost on failover")
+	}
+}
+
 // GetCurrentExit returns the current exit configuration
 func (p *Peer) GetCurrentExit() *ExitConfig {
 	p.mutex.RLock()
@@ -236,17 +352,11 @@ func (p *Peer) GetCurrentExit() *ExitConfig {
 
 // GetPublicKey returns the public key of this peer
 func (p *Peer) GetPublicKey() (string, error) {
-	if p.privateKey == "" {
+	if p.privateKey == (wgtypes.Key{}) {
 		return "", fmt.Errorf("private key not initialized")
 	}
 
-	// Parse private key to get public key
-	privateKey, err := utils.GenerateKey() // This is a placeholder
-	if err != nil {
-		return "", fmt.Errorf("failed to get public key: %w", err)
-	}
-
-	return privateKey.PublicKey().String(), nil
+	return p.privateKey.PublicKey().String(), nil
 }
 
 // IsConnected returns the connection status
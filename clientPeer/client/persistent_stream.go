@@ -2,10 +2,11 @@ package client
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"myDvpn/clientPeer/proto"
@@ -14,47 +15,89 @@ import (
 	"google.golang.org/grpc"
 )
 
+// exitRequestTimeout bounds how long a client waits for an ExitAssignment
+const exitRequestTimeout = 30 * time.Second
+
+// exitResumeTimeout bounds how long a client that failed over waits for the
+// new SuperNode to claim its exit session
+const exitResumeTimeout = 20 * time.Second
+
 // PersistentStreamManager manages the persistent control stream to SuperNode
 type PersistentStreamManager struct {
 	peerID       string
 	role         string
 	region       string
-	supernodeAddr string
+	supernodes   *superNodeList
+	baseNodeAddrs []string // BaseNodes to look up more SuperNodes on, optional
 	keyPair      *utils.KeyPair
+	creds        *utils.TLSCredentials
 	logger       *logrus.Logger
 	
 	conn         *grpc.ClientConn
 	client       proto.ControlStreamClient
 	stream       proto.ControlStream_PersistentControlStreamClient
 	sessionID    string
+	sendMux      sync.Mutex
+	maxClients   int
+	
+	// Outstanding exit requests, keyed by request_id
+	pendingExits    map[string]chan *proto.ExitAssignment
+	pendingExitsMux sync.Mutex
+
+	// Outstanding role updates, keyed by request_id
+	pendingRoles    map[string]chan *proto.RoleUpdateAck
+	pendingRolesMux sync.Mutex
+
+	// Outstanding exit resumes, keyed by request_id
+	pendingResumes    map[string]chan *proto.ExitResumeAck
+	pendingResumesMux sync.Mutex
+
+	// Exit session in use and the SuperNode tracking it, resumed after failing over
+	exitSession    string
+	exitHome       string
+	exitSessionMux sync.Mutex
+	onExitLost     func(sessionID string)
 	
 	// Command handling
 	commandHandlers map[proto.CommandType]func(*proto.Command) *proto.CommandResponse
+	executed        *commandCache
 	
 	// State
-	isConnected     bool
+	isConnected     atomic.Bool
 	lastHeartbeat   time.Time
 	reconnectDelay  time.Duration
+	stopped         chan struct{}
+	stopOnce        sync.Once
+
+	metrics *streamMetrics
 }
 
-// NewPersistentStreamManager creates a new persistent stream manager
-func NewPersistentStreamManager(peerID, role, region, supernodeAddr string, logger *logrus.Logger) (*PersistentStreamManager, error) {
-	keyPair, err := utils.GenerateKeyPair()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate key pair: %w", err)
+// NewPersistentStreamManager creates a new persistent stream manager.
+// supernodeAddr may list several SuperNodes, comma-separated, in order of preference.
+func NewPersistentStreamManager(peerID, role, region, supernodeAddr string, keyPair *utils.KeyPair, creds *utils.TLSCredentials, logger *logrus.Logger) (*PersistentStreamManager, error) {
+	if keyPair == nil {
+		return nil, fmt.Errorf("identity key pair is required")
 	}
 
 	psm := &PersistentStreamManager{
 		peerID:          peerID,
 		role:            role,
 		region:          region,
-		supernodeAddr:   supernodeAddr,
+		supernodes:      newSuperNodeList(supernodeAddr),
 		keyPair:         keyPair,
+		creds:           creds,
 		logger:          logger,
 		reconnectDelay:  5 * time.Second,
+		pendingExits:    make(map[string]chan *proto.ExitAssignment),
+		pendingRoles:    make(map[string]chan *proto.RoleUpdateAck),
+		pendingResumes:  make(map[string]chan *proto.ExitResumeAck),
 		commandHandlers: make(map[proto.CommandType]func(*proto.Command) *proto.CommandResponse),
+		executed:        newCommandCache(defaultCommandCacheSize),
+		stopped:         make(chan struct{}),
 	}
 
+	psm.metrics = newStreamMetrics(psm)
+
 	// Register default command handlers
 	psm.registerCommandHandlers()
 
@@ -63,7 +106,23 @@ func NewPersistentStreamManager(peerID, role, region, supernodeAddr string, logg
 
 // Start starts the persistent stream connection
 func (psm *PersistentStreamManager) Start() error {
-	if err := psm.connect(); err != nil {
+	if err := psm.refreshSuperNodes(); err != nil {
+		psm.logger.WithError(err).Warn("Failed to look up SuperNodes on BaseNode")
+	}
+	if psm.supernodes.Len() == 0 {
+		return fmt.Errorf("no SuperNode addresses configured")
+	}
+
+	// Try each SuperNode once before giving up
+	var err error
+	for i := 0; i < psm.supernodes.Len(); i++ {
+		if err = psm.connect(); err == nil {
+			break
+		}
+		psm.logger.WithError(err).WithField("supernode", psm.supernodes.Current()).Warn("SuperNode unreachable, trying next")
+		psm.supernodes.Next()
+	}
+	if err != nil {
 		return fmt.Errorf("failed to establish initial connection: %w", err)
 	}
 
@@ -71,37 +130,47 @@ func (psm *PersistentStreamManager) Start() error {
 	go psm.messageHandler()
 	go psm.heartbeatLoop()
 	go psm.reconnectLoop()
+	go psm.failbackLoop()
 
 	psm.logger.WithFields(logrus.Fields{
-		"peer_id": psm.peerID,
-		"role":    psm.role,
-		"region":  psm.region,
+		"peer_id":   psm.peerID,
+		"role":      psm.role,
+		"region":    psm.region,
+		"supernode": psm.supernodes.Current(),
 	}).Info("Persistent stream manager started")
 
 	return nil
 }
 
-// Stop stops the persistent stream connection
+// Stop stops the persistent stream connection; the manager does not reconnect afterwards
 func (psm *PersistentStreamManager) Stop() {
-	psm.isConnected = false
-	
+	psm.stopOnce.Do(func() { close(psm.stopped) })
+	psm.closeConnection()
+
+	psm.logger.WithField("peer_id", psm.peerID).Info("Persistent stream manager stopped")
+}
+
+// closeConnection drops the stream so the reconnect loop dials the current SuperNode again
+func (psm *PersistentStreamManager) closeConnection() {
+	psm.isConnected.Store(false)
+
 	if psm.stream != nil {
 		psm.stream.CloseSend()
 	}
-	
+
 	if psm.conn != nil {
 		psm.conn.Close()
 	}
-
-	psm.logger.WithField("peer_id", psm.peerID).Info("Persistent stream manager stopped")
 }
 
-// connect establishes connection and authenticates
+// connect establishes connection to the current SuperNode and authenticates
 func (psm *PersistentStreamManager) connect() error {
+	addr := psm.supernodes.Current()
+
 	// Establish gRPC connection
-	conn, err := grpc.Dial(psm.supernodeAddr, grpc.WithInsecure())
+	conn, err := grpc.Dial(addr, psm.creds.DialOption())
 	if err != nil {
-		return fmt.Errorf("failed to connect to SuperNode: %w", err)
+		return fmt.Errorf("failed to connect to SuperNode %s: %w", addr, err)
 	}
 
 	psm.conn = conn
@@ -110,17 +179,19 @@ func (psm *PersistentStreamManager) connect() error {
 	// Open persistent stream
 	stream, err := psm.client.PersistentControlStream(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to open persistent stream: %w", err)
+		conn.Close()
+		return fmt.Errorf("failed to open persistent stream to %s: %w", addr, err)
 	}
 
 	psm.stream = stream
 
 	// Authenticate
 	if err := psm.authenticate(); err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
+		conn.Close()
+		return fmt.Errorf("authentication with %s failed: %w", addr, err)
 	}
 
-	psm.isConnected = true
+	psm.isConnected.Store(true)
 	psm.lastHeartbeat = time.Now()
 
 	return nil
@@ -128,16 +199,28 @@ func (psm *PersistentStreamManager) connect() error {
 
 // authenticate sends authentication request
 func (psm *PersistentStreamManager) authenticate() error {
-	// Generate nonce
-	nonce := make([]byte, 16)
-	if _, err := rand.Read(nonce); err != nil {
-		return fmt.Errorf("failed to generate nonce: %w", err)
+	// Wait for the SuperNode's challenge
+	msg, err := psm.stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive auth challenge: %w", err)
+	}
+
+	challenge, ok := msg.Payload.(*proto.ControlMessage_AuthChallenge)
+	if !ok {
+		return fmt.Errorf("unexpected message type for auth challenge")
+	}
+	nonce := challenge.AuthChallenge.Nonce
+
+	// Bind the signature to this TLS connection
+	binding, err := utils.ChannelBinding(psm.stream.Context())
+	if err != nil {
+		return err
 	}
-	nonceB64 := base64.StdEncoding.EncodeToString(nonce)
 
 	// Create signature
-	message := fmt.Sprintf("%s||%s||%s||%s", psm.peerID, psm.role, psm.region, nonceB64)
-	signature := psm.keyPair.Sign([]byte(message))
+	timestamp := time.Now().Unix()
+	message := utils.AuthSignaturePayload(psm.peerID, psm.role, psm.region, nonce, timestamp, binding)
+	signature := psm.keyPair.Sign(message)
 	signatureB64 := utils.SignatureToBase64(signature)
 
 	// Send auth request
@@ -151,7 +234,9 @@ func (psm *PersistentStreamManager) authenticate() error {
 				PubkeyB64:  utils.PublicKeyToBase64(psm.keyPair.PublicKey),
 				Region:     psm.region,
 				Signature:  signatureB64,
-				Nonce:      nonceB64,
+				Nonce:      nonce,
+				Timestamp:  timestamp,
+				MaxClients: int32(psm.maxClients),
 			},
 		},
 	}
@@ -161,7 +246,7 @@ func (psm *PersistentStreamManager) authenticate() error {
 	}
 
 	// Wait for auth response
-	msg, err := psm.stream.Recv()
+	msg, err = psm.stream.Recv()
 	if err != nil {
 		return fmt.Errorf("failed to receive auth response: %w", err)
 	}
@@ -187,7 +272,7 @@ func (psm *PersistentStreamManager) authenticate() error {
 
 // messageHandler handles incoming messages
 func (psm *PersistentStreamManager) messageHandler() {
-	for psm.isConnected {
+	for psm.isConnected.Load() {
 		if psm.stream == nil {
 			time.Sleep(1 * time.Second)
 			continue
@@ -196,12 +281,12 @@ func (psm *PersistentStreamManager) messageHandler() {
 		msg, err := psm.stream.Recv()
 		if err == io.EOF {
 			psm.logger.Info("Stream closed by server")
-			psm.isConnected = false
+			psm.isConnected.Store(false)
 			break
 		}
 		if err != nil {
 			psm.logger.WithError(err).Error("Error receiving message")
-			psm.isConnected = false
+			psm.isConnected.Store(false)
 			break
 		}
 
@@ -221,6 +306,15 @@ func (psm *PersistentStreamManager) handleMessage(msg *proto.ControlMessage) {
 	case *proto.ControlMessage_InfoResponse:
 		psm.handleInfoResponse(payload.InfoResponse)
 		
+	case *proto.ControlMessage_ExitAssignment:
+		psm.handleExitAssignment(payload.ExitAssignment)
+
+	case *proto.ControlMessage_RoleUpdateAck:
+		psm.handleRoleUpdateAck(payload.RoleUpdateAck)
+
+	case *proto.ControlMessage_ExitResumeAck:
+		psm.handleExitResumeAck(payload.ExitResumeAck)
+		
 	default:
 		psm.logger.WithField("message_type", fmt.Sprintf("%T", payload)).Warn("Unknown message type received")
 	}
@@ -230,6 +324,7 @@ func (psm *PersistentStreamManager) handleMessage(msg *proto.ControlMessage) {
 func (psm *PersistentStreamManager) handlePongResponse(pong *proto.PongResponse) {
 	latency := time.Now().UnixMilli() - pong.OriginalTimestamp
 	psm.lastHeartbeat = time.Now()
+	psm.metrics.heartbeatRTT.Observe(float64(latency) / 1000)
 
 	psm.logger.WithFields(logrus.Fields{
 		"peer_id":   psm.peerID,
@@ -237,16 +332,44 @@ func (psm *PersistentStreamManager) handlePongResponse(pong *proto.PongResponse)
 	}).Debug("Received pong response")
 }
 
-// handleCommand handles commands from SuperNode
+// handleCommand handles commands from SuperNode. A command_id that was
+// already executed is answered with the cached response instead of running
+// the handler again, so SuperNode retries are safe.
 func (psm *PersistentStreamManager) handleCommand(cmd *proto.Command) {
 	handler, exists := psm.commandHandlers[cmd.Type]
 	if !exists {
 		psm.logger.WithField("command_type", cmd.Type).Warn("No handler for command type")
+		psm.metrics.commandDuration.WithLabelValues(cmd.Type.String(), commandOutcomeUnhandled).Observe(0)
 		return
 	}
 
-	// Execute command
-	response := handler(cmd)
+	response, duplicate := psm.executed.get(cmd.CommandId)
+	if duplicate {
+		psm.logger.WithFields(logrus.Fields{
+			"command_id":   cmd.CommandId,
+			"command_type": cmd.Type,
+		}).Info("Replaying response for duplicate command")
+		psm.metrics.commandDuration.WithLabelValues(cmd.Type.String(), commandOutcomeDuplicate).Observe(0)
+	} else {
+		// Execute command
+		started := time.Now()
+		response = handler(cmd)
+
+		outcome := commandOutcomeSuccess
+		if !response.Success {
+			outcome = commandOutcomeFailure
+		}
+		psm.metrics.commandDuration.WithLabelValues(cmd.Type.String(), outcome).Observe(time.Since(started).Seconds())
+
+		if cmd.CommandId != "" {
+			psm.executed.put(cmd.CommandId, response)
+		}
+
+		// The SuperNode that rotated us tracks the new session
+		if cmd.Type == proto.CommandType_ROTATE_PEER && response.Success {
+			psm.trackExitSession(response.Result["new_session_id"])
+		}
+	}
 
 	// Send response
 	respMsg := &proto.ControlMessage{
@@ -257,7 +380,7 @@ func (psm *PersistentStreamManager) handleCommand(cmd *proto.Command) {
 		},
 	}
 
-	if err := psm.stream.Send(respMsg); err != nil {
+	if err := psm.send(respMsg); err != nil {
 		psm.logger.WithError(err).Error("Failed to send command response")
 	}
 }
@@ -270,6 +393,337 @@ func (psm *PersistentStreamManager) handleInfoResponse(info *proto.InfoResponse)
 	}).Info("Received info response")
 }
 
+// handleExitAssignment delivers an exit assignment to the waiting RequestExit call
+func (psm *PersistentStreamManager) handleExitAssignment(assignment *proto.ExitAssignment) {
+	psm.pendingExitsMux.Lock()
+	respChan, exists := psm.pendingExits[assignment.RequestId]
+	psm.pendingExitsMux.Unlock()
+
+	if !exists {
+		psm.logger.WithField("request_id", assignment.RequestId).Warn("Received exit assignment for unknown request")
+
+		// Nobody will use this exit, so let the SuperNode release it now
+		if assignment.Success {
+			if err := psm.ConfirmExit(assignment.SessionId, fmt.Errorf("exit request %s is no longer pending", assignment.RequestId)); err != nil {
+				psm.logger.WithError(err).Warn("Failed to reject stale exit assignment")
+			}
+		}
+		return
+	}
+
+	select {
+	case respChan <- assignment:
+	default:
+	}
+}
+
+// RequestExit asks the SuperNode for an exit peer and waits for the assignment
+func (psm *PersistentStreamManager) RequestExit(targetRegion, wgPublicKey string, timeout time.Duration) (*proto.ExitAssignment, error) {
+	if !psm.isConnected.Load() {
+		return nil, fmt.Errorf("not connected to SuperNode")
+	}
+
+	requestID := fmt.Sprintf("exit-req-%s-%d", psm.peerID, time.Now().UnixNano())
+	respChan := make(chan *proto.ExitAssignment, 1)
+
+	psm.pendingExitsMux.Lock()
+	psm.pendingExits[requestID] = respChan
+	psm.pendingExitsMux.Unlock()
+
+	defer func() {
+		psm.pendingExitsMux.Lock()
+		delete(psm.pendingExits, requestID)
+		psm.pendingExitsMux.Unlock()
+	}()
+
+	msg := &proto.ControlMessage{
+		MessageId: requestID,
+		Timestamp: time.Now().Unix(),
+		Payload: &proto.ControlMessage_ExitRequest{
+			ExitRequest: &proto.ExitRequest{
+				RequestId:    requestID,
+				PeerId:       psm.peerID,
+				TargetRegion: targetRegion,
+				WgPublicKey:  wgPublicKey,
+			},
+		},
+	}
+
+	if err := psm.send(msg); err != nil {
+		return nil, fmt.Errorf("failed to send exit request: %w", err)
+	}
+
+	select {
+	case assignment := <-respChan:
+		if !assignment.Success {
+			return nil, fmt.Errorf("exit request rejected: %s", assignment.Message)
+		}
+		if assignment.ExitPeer == nil {
+			err := fmt.Errorf("exit assignment missing exit peer info")
+			psm.ConfirmExit(assignment.SessionId, err)
+			return nil, err
+		}
+		return assignment, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out waiting for exit assignment")
+	}
+}
+
+// errExitDisconnected is confirmed for an active session when the client
+// disconnects from its exit, so that the SuperNode releases the session
+var errExitDisconnected = errors.New("disconnected from exit")
+
+// ConfirmExit tells the SuperNode whether an exit assignment was applied.
+// Pass the error that prevented it, or nil once the tunnel is configured.
+// The SuperNode releases assignments that are rejected or never confirmed,
+// and active sessions that are confirmed with an error. A confirmed session
+// is resumed on whichever SuperNode the manager fails over to.
+func (psm *PersistentStreamManager) ConfirmExit(sessionID string, applyErr error) error {
+	confirm := &proto.ExitConfirm{
+		SessionId: sessionID,
+		Success:   applyErr == nil,
+	}
+	if applyErr != nil {
+		confirm.Message = applyErr.Error()
+	}
+
+	msg := &proto.ControlMessage{
+		MessageId: fmt.Sprintf("exit-confirm-%d", time.Now().UnixNano()),
+		Timestamp: time.Now().Unix(),
+		Payload: &proto.ControlMessage_ExitConfirm{
+			ExitConfirm: confirm,
+		},
+	}
+
+	if err := psm.send(msg); err != nil {
+		return fmt.Errorf("failed to send exit confirmation: %w", err)
+	}
+
+	if applyErr == nil {
+		psm.trackExitSession(sessionID)
+	} else {
+		psm.forgetExitSession(sessionID)
+	}
+	return nil
+}
+
+// SetExitLostHandler sets the function called with the exit session that
+// could not be resumed after failing over to another SuperNode. The session
+// is no longer tracked by any SuperNode, so the handler should request a new exit.
+func (psm *PersistentStreamManager) SetExitLostHandler(handler func(sessionID string)) {
+	psm.onExitLost = handler
+}
+
+// trackExitSession records the exit session in use, tracked by the current SuperNode
+func (psm *PersistentStreamManager) trackExitSession(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+
+	psm.exitSessionMux.Lock()
+	defer psm.exitSessionMux.Unlock()
+
+	psm.exitSession = sessionID
+	psm.exitHome = psm.supernodes.Current()
+}
+
+// forgetExitSession stops resuming an exit session that was released
+func (psm *PersistentStreamManager) forgetExitSession(sessionID string) {
+	psm.exitSessionMux.Lock()
+	defer psm.exitSessionMux.Unlock()
+
+	if psm.exitSession == sessionID {
+		psm.exitSession = ""
+		psm.exitHome = ""
+	}
+}
+
+// trackedExitSession returns the exit session in use and the SuperNode tracking it
+func (psm *PersistentStreamManager) trackedExitSession() (string, string) {
+	psm.exitSessionMux.Lock()
+	defer psm.exitSessionMux.Unlock()
+	return psm.exitSession, psm.exitHome
+}
+
+// resumeExitSession runs after reconnecting. If the exit session in use is
+// tracked by another SuperNode than the one we are connected to now, the new
+// SuperNode claims it, or the SuperNode we left would release it once our
+// reconnect grace runs out. A session that cannot be claimed is reported to
+// the exit-lost handler.
+func (psm *PersistentStreamManager) resumeExitSession() {
+	sessionID, home := psm.trackedExitSession()
+	current := psm.supernodes.Current()
+	if sessionID == "" || home == current {
+		return
+	}
+
+	logger := psm.logger.WithFields(logrus.Fields{
+		"session_id":     sessionID,
+		"home_supernode": home,
+		"supernode":      current,
+	})
+
+	err := psm.sendExitResume(sessionID, home, exitResumeTimeout)
+	if err == nil {
+		psm.exitSessionMux.Lock()
+		if psm.exitSession == sessionID {
+			psm.exitHome = current
+		}
+		psm.exitSessionMux.Unlock()
+
+		logger.Info("Exit session resumed on new SuperNode")
+		return
+	}
+
+	logger.WithError(err).Warn("Could not resume exit session on new SuperNode")
+	psm.forgetExitSession(sessionID)
+	if psm.onExitLost != nil {
+		psm.onExitLost(sessionID)
+	}
+}
+
+// sendExitResume asks the SuperNode to claim an exit session from home and
+// waits for the acknowledgement
+func (psm *PersistentStreamManager) sendExitResume(sessionID, home string, timeout time.Duration) error {
+	requestID := fmt.Sprintf("exit-resume-%s-%d", psm.peerID, time.Now().UnixNano())
+	ackChan := make(chan *proto.ExitResumeAck, 1)
+
+	psm.pendingResumesMux.Lock()
+	psm.pendingResumes[requestID] = ackChan
+	psm.pendingResumesMux.Unlock()
+
+	defer func() {
+		psm.pendingResumesMux.Lock()
+		delete(psm.pendingResumes, requestID)
+		psm.pendingResumesMux.Unlock()
+	}()
+
+	msg := &proto.ControlMessage{
+		MessageId: requestID,
+		Timestamp: time.Now().Unix(),
+		Payload: &proto.ControlMessage_ExitResume{
+			ExitResume: &proto.ExitResume{
+				RequestId:     requestID,
+				SessionId:     sessionID,
+				HomeSupernode: home,
+			},
+		},
+	}
+
+	if err := psm.send(msg); err != nil {
+		return fmt.Errorf("failed to send exit resume: %w", err)
+	}
+
+	select {
+	case ack := <-ackChan:
+		if !ack.Success {
+			return fmt.Errorf("exit resume rejected: %s", ack.Message)
+		}
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out waiting for exit resume acknowledgement")
+	}
+}
+
+// handleExitResumeAck delivers an exit resume acknowledgement to the waiting sendExitResume call
+func (psm *PersistentStreamManager) handleExitResumeAck(ack *proto.ExitResumeAck) {
+	psm.pendingResumesMux.Lock()
+	ackChan, exists := psm.pendingResumes[ack.RequestId]
+	psm.pendingResumesMux.Unlock()
+
+	if !exists {
+		psm.logger.WithField("request_id", ack.RequestId).Warn("Received acknowledgement for unknown exit resume")
+		return
+	}
+
+	select {
+	case ackChan <- ack:
+	default:
+	}
+}
+
+// UpdateRole changes the peer's role on the open stream and waits for the
+// SuperNode to acknowledge it. When leaving the exit role, the SuperNode moves
+// the peer's exit clients away before it answers. If the stream is down, the
+// new role is used when it is re-established.
+func (psm *PersistentStreamManager) UpdateRole(role string, timeout time.Duration) (*proto.RoleUpdateAck, error) {
+	if !psm.isConnected.Load() {
+		psm.role = role
+		psm.logger.WithField("role", role).Warn("Not connected to SuperNode; role applies on reconnect")
+		return &proto.RoleUpdateAck{Success: true, Role: role, Message: "applied on reconnect"}, nil
+	}
+
+	requestID := fmt.Sprintf("role-update-%s-%d", psm.peerID, time.Now().UnixNano())
+	ackChan := make(chan *proto.RoleUpdateAck, 1)
+
+	psm.pendingRolesMux.Lock()
+	psm.pendingRoles[requestID] = ackChan
+	psm.pendingRolesMux.Unlock()
+
+	defer func() {
+		psm.pendingRolesMux.Lock()
+		delete(psm.pendingRoles, requestID)
+		psm.pendingRolesMux.Unlock()
+	}()
+
+	msg := &proto.ControlMessage{
+		MessageId: requestID,
+		Timestamp: time.Now().Unix(),
+		Payload: &proto.ControlMessage_RoleUpdate{
+			RoleUpdate: &proto.RoleUpdate{
+				RequestId:  requestID,
+				Role:       role,
+				MaxClients: int32(psm.maxClients),
+			},
+		},
+	}
+
+	if err := psm.send(msg); err != nil {
+		return nil, fmt.Errorf("failed to send role update: %w", err)
+	}
+
+	select {
+	case ack := <-ackChan:
+		if !ack.Success {
+			return ack, fmt.Errorf("role update rejected: %s", ack.Message)
+		}
+		// Re-authentication after a reconnect uses the new role
+		psm.role = role
+		return ack, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out waiting for role update acknowledgement")
+	}
+}
+
+// handleRoleUpdateAck delivers a role update acknowledgement to the waiting UpdateRole call
+func (psm *PersistentStreamManager) handleRoleUpdateAck(ack *proto.RoleUpdateAck) {
+	psm.pendingRolesMux.Lock()
+	ackChan, exists := psm.pendingRoles[ack.RequestId]
+	psm.pendingRolesMux.Unlock()
+
+	if !exists {
+		psm.logger.WithField("request_id", ack.RequestId).Warn("Received acknowledgement for unknown role update")
+		return
+	}
+
+	select {
+	case ackChan <- ack:
+	default:
+	}
+}
+
+// send serializes writes to the control stream
+func (psm *PersistentStreamManager) send(msg *proto.ControlMessage) error {
+	psm.sendMux.Lock()
+	defer psm.sendMux.Unlock()
+
+	if psm.stream == nil {
+		return fmt.Errorf("stream not available")
+	}
+
+	return psm.stream.Send(msg)
+}
+
 // sendHeartbeat sends a ping request
 func (psm *PersistentStreamManager) sendHeartbeat() error {
 	if psm.stream == nil {
@@ -287,7 +741,7 @@ func (psm *PersistentStreamManager) sendHeartbeat() error {
 		},
 	}
 
-	return psm.stream.Send(ping)
+	return psm.send(ping)
 }
 
 // heartbeatLoop sends periodic heartbeats
@@ -295,40 +749,79 @@ func (psm *PersistentStreamManager) heartbeatLoop() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for psm.isConnected {
+	for psm.isConnected.Load() {
 		select {
 		case <-ticker.C:
 			if err := psm.sendHeartbeat(); err != nil {
 				psm.logger.WithError(err).Error("Failed to send heartbeat")
-				psm.isConnected = false
+				psm.isConnected.Store(false)
 			}
 		}
 	}
 }
 
-// reconnectLoop handles reconnection logic
+// reconnectLoop handles reconnection logic until the manager is stopped
 func (psm *PersistentStreamManager) reconnectLoop() {
 	for {
-		if !psm.isConnected {
+		if psm.isStopped() {
+			return
+		}
+
+		if !psm.isConnected.Load() {
 			psm.logger.Info("Attempting to reconnect...")
 			
 			if err := psm.connect(); err != nil {
 				psm.logger.WithError(err).Error("Reconnection failed, retrying...")
-				time.Sleep(psm.reconnectDelay)
-				
-				// Exponential backoff
-				if psm.reconnectDelay < 60*time.Second {
-					psm.reconnectDelay *= 2
+				if psm.recordConnectFailure() {
+					// A different SuperNode gets a fresh backoff
+					psm.reconnectDelay = 5 * time.Second
+				} else {
+					if !psm.sleep(psm.reconnectDelay) {
+						return
+					}
+
+					// Exponential backoff
+					if psm.reconnectDelay < 60*time.Second {
+						psm.reconnectDelay *= 2
+					}
 				}
 			} else {
-				psm.logger.Info("Reconnection successful")
+				psm.logger.WithField("supernode", psm.supernodes.Current()).Info("Reconnection successful")
+				psm.supernodes.Succeeded()
+				psm.metrics.reconnects.Inc()
 				psm.reconnectDelay = 5 * time.Second // Reset delay
 				go psm.messageHandler()
 				go psm.heartbeatLoop()
+				go psm.resumeExitSession()
 			}
 		}
 		
-		time.Sleep(5 * time.Second)
+		if !psm.sleep(5 * time.Second) {
+			return
+		}
+	}
+}
+
+// isStopped reports whether Stop was called
+func (psm *PersistentStreamManager) isStopped() bool {
+	select {
+	case <-psm.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d and reports false if the manager was stopped meanwhile
+func (psm *PersistentStreamManager) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-psm.stopped:
+		return false
 	}
 }
 
@@ -354,14 +847,15 @@ func (psm *PersistentStreamManager) handleSetupExitCommand(cmd *proto.Command) *
 	}
 }
 
+// handleRotatePeerCommand rejects ROTATE_PEER on peers without a client tunnel;
+// client peers register their own handler
 func (psm *PersistentStreamManager) handleRotatePeerCommand(cmd *proto.Command) *proto.CommandResponse {
-	psm.logger.WithField("command_id", cmd.CommandId).Info("Handling ROTATE_PEER command")
-	
+	psm.logger.WithField("command_id", cmd.CommandId).Warn("Received ROTATE_PEER but this peer has no client tunnel")
+
 	return &proto.CommandResponse{
 		CommandId: cmd.CommandId,
-		Success:   true,
-		Message:   "Rotate peer command received",
-		Result:    make(map[string]string),
+		Success:   false,
+		Message:   "ROTATE_PEER is not supported by this peer",
 	}
 }
 
@@ -376,6 +870,8 @@ func (psm *PersistentStreamManager) handleRelaySetupCommand(cmd *proto.Command)
 	}
 }
 
+// handleDisconnectCommand stops the manager for good: a peer kicked by the
+// operator must not come straight back through the reconnect loop
 func (psm *PersistentStreamManager) handleDisconnectCommand(cmd *proto.Command) *proto.CommandResponse {
 	psm.logger.WithField("command_id", cmd.CommandId).Info("Handling DISCONNECT command")
 	
@@ -395,7 +891,7 @@ func (psm *PersistentStreamManager) handleDisconnectCommand(cmd *proto.Command)
 
 // IsConnected returns connection status
 func (psm *PersistentStreamManager) IsConnected() bool {
-	return psm.isConnected
+	return psm.isConnected.Load()
 }
 
 // RegisterCommandHandler registers a custom command handler
@@ -403,6 +899,12 @@ func (psm *PersistentStreamManager) RegisterCommandHandler(cmdType proto.Command
 	psm.commandHandlers[cmdType] = handler
 }
 
+// SetMaxClients sets the client capacity advertised to the SuperNode when
+// authenticating; 0 leaves it to the SuperNode
+func (psm *PersistentStreamManager) SetMaxClients(maxClients int) {
+	psm.maxClients = maxClients
+}
+
 // GetSessionID returns the current session ID
 func (psm *PersistentStreamManager) GetSessionID() string {
 	return psm.sessionID
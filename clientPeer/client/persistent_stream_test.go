@@ -0,0 +1,137 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+)
+
+func TestDisconnectCommandStopsReconnecting(t *testing.T) {
+	psm, err := NewPersistentStreamManager("c1", "client", "r1", "127.0.0.1:1", testutil.Keystore(t).Identity, utils.InsecureCredentials(), testutil.Logger())
+	if err != nil {
+		t.Fatalf("NewPersistentStreamManager: %v", err)
+	}
+	psm.isConnected.Store(true)
+
+	reconnectDone := make(chan struct{})
+	failbackDone := make(chan struct{})
+	go func() {
+		psm.reconnectLoop()
+		close(reconnectDone)
+	}()
+	go func() {
+		psm.failbackLoop()
+		close(failbackDone)
+	}()
+
+	resp := psm.handleDisconnectCommand(&proto.Command{CommandId: "kick-1", Type: proto.CommandType_DISCONNECT})
+	if !resp.Success {
+		t.Fatalf("DISCONNECT failed: %s", resp.Message)
+	}
+
+	for name, done := range map[string]chan struct{}{"reconnect": reconnectDone, "failback": failbackDone} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s loop still running after DISCONNECT", name)
+		}
+	}
+	if psm.IsConnected() {
+		t.Fatal("stream manager still reports a connection")
+	}
+}
+
+// resumingControlStream is a control stream that records what the peer sends
+// and answers ExitResume the way the SuperNode would
+type resumingControlStream struct {
+	recordingControlStream
+	psm     *PersistentStreamManager
+	success bool
+}
+
+func (s *resumingControlStream) Send(msg *proto.ControlMessage) error {
+	s.sent = append(s.sent, msg)
+	if resume := msg.GetExitResume(); resume != nil {
+		s.psm.handleMessage(&proto.ControlMessage{
+			Payload: &proto.ControlMessage_ExitResumeAck{
+				ExitResumeAck: &proto.ExitResumeAck{RequestId: resume.RequestId, Success: s.success},
+			},
+		})
+	}
+	return nil
+}
+
+// exitResumes returns the ExitResume messages sent on the stream
+func (s *resumingControlStream) exitResumes() []*proto.ExitResume {
+	var resumes []*proto.ExitResume
+	for _, msg := range s.sent {
+		if resume := msg.GetExitResume(); resume != nil {
+			resumes = append(resumes, resume)
+		}
+	}
+	return resumes
+}
+
+func TestExitSessionIsResumedAfterFailover(t *testing.T) {
+	psm, err := NewPersistentStreamManager("c1", "client", "r1", "sn-a:7000,sn-b:7000", testutil.Keystore(t).Identity, utils.InsecureCredentials(), testutil.Logger())
+	if err != nil {
+		t.Fatalf("NewPersistentStreamManager: %v", err)
+	}
+	stream := &resumingControlStream{psm: psm, success: true}
+	psm.stream = stream
+
+	var lost []string
+	psm.SetExitLostHandler(func(sessionID string) { lost = append(lost, sessionID) })
+
+	expectTracked := func(sessionID, home string) {
+		t.Helper()
+		if gotSession, gotHome := psm.trackedExitSession(); gotSession != sessionID || gotHome != home {
+			t.Fatalf("tracking session %q on %q, want %q on %q", gotSession, gotHome, sessionID, home)
+		}
+	}
+
+	// A confirmed session is tracked by the SuperNode it was confirmed on
+	if err := psm.ConfirmExit("s1", nil); err != nil {
+		t.Fatalf("ConfirmExit: %v", err)
+	}
+	expectTracked("s1", "sn-a:7000")
+
+	// Reconnecting to the same SuperNode needs no resume
+	psm.resumeExitSession()
+	if resumes := stream.exitResumes(); len(resumes) != 0 {
+		t.Fatalf("sent %d ExitResume to the SuperNode tracking the session, want 0", len(resumes))
+	}
+
+	// After failing over, the new SuperNode claims it and tracks it from then on
+	psm.supernodes.Next()
+	psm.resumeExitSession()
+	resumes := stream.exitResumes()
+	if len(resumes) != 1 || resumes[0].SessionId != "s1" || resumes[0].HomeSupernode != "sn-a:7000" {
+		t.Fatalf("sent ExitResume %v, want s1 claimed from sn-a", resumes)
+	}
+	expectTracked("s1", "sn-b:7000")
+
+	// A rotation hands us a session tracked by the SuperNode that rotated us
+	psm.RegisterCommandHandler(proto.CommandType_ROTATE_PEER, func(cmd *proto.Command) *proto.CommandResponse {
+		return &proto.CommandResponse{CommandId: cmd.CommandId, Success: true, Result: map[string]string{"new_session_id": "s2"}}
+	})
+	psm.handleCommand(&proto.Command{CommandId: "rotate-1", Type: proto.CommandType_ROTATE_PEER})
+	expectTracked("s2", "sn-b:7000")
+
+	// A session that cannot be claimed is reported lost and no longer tracked
+	stream.success = false
+	psm.supernodes.Next()
+	psm.resumeExitSession()
+	if len(lost) != 1 || lost[0] != "s2" {
+		t.Fatalf("lost sessions %v, want [s2]", lost)
+	}
+	expectTracked("", "")
+
+	// Sessions released by the client are not tracked
+	psm.ConfirmExit("s3", nil)
+	psm.ConfirmExit("s3", errExitDisconnected)
+	expectTracked("", "")
+}
@@ -0,0 +1,308 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	baseclient "myDvpn/base/client"
+	baseProto "myDvpn/base/proto"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	// superNodeFailoverAttempts is how many reconnects to one SuperNode may
+	// fail before the next SuperNode in the list is tried
+	superNodeFailoverAttempts = 3
+
+	// superNodeFailbackInterval is how often a peer that failed over checks
+	// whether its preferred SuperNode is reachable again
+	superNodeFailbackInterval = 60 * time.Second
+
+	// superNodeProbeTimeout bounds a reachability check or BaseNode lookup
+	superNodeProbeTimeout = 5 * time.Second
+)
+
+// superNodeList is the ordered list of SuperNodes a peer connects to. The
+// first entry is the preferred SuperNode; the others are used in order while
+// it is unreachable.
+type superNodeList struct {
+	configured []string // From the command line, always tried first
+	addrs      []string
+	current    int
+	failures   int
+	mutex      sync.Mutex
+}
+
+// newSuperNodeList creates a list from a comma-separated address list
+func newSuperNodeList(list string) *superNodeList {
+	addrs := baseclient.ParseAddrs(list)
+	return &superNodeList{
+		configured: addrs,
+		addrs:      append([]string(nil), addrs...),
+	}
+}
+
+// Current returns the SuperNode to connect to
+func (sl *superNodeList) Current() string {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	if len(sl.addrs) == 0 {
+		return ""
+	}
+	return sl.addrs[sl.current]
+}
+
+// Preferred returns the first SuperNode in the list
+func (sl *superNodeList) Preferred() string {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	if len(sl.addrs) == 0 {
+		return ""
+	}
+	return sl.addrs[0]
+}
+
+// OnPreferred reports whether the current SuperNode is the preferred one
+func (sl *superNodeList) OnPreferred() bool {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	return sl.current == 0
+}
+
+// Len returns the number of SuperNodes in the list
+func (sl *superNodeList) Len() int {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	return len(sl.addrs)
+}
+
+// Succeeded resets the failure count of the current SuperNode
+func (sl *superNodeList) Succeeded() {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	sl.failures = 0
+}
+
+// Failed records a failed connection attempt. After superNodeFailoverAttempts
+// failures it moves to the next SuperNode and returns true, along with whether
+// the list wrapped around to the preferred SuperNode again.
+func (sl *superNodeList) Failed() (rotated, wrapped bool) {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	sl.failures++
+	if sl.failures < superNodeFailoverAttempts || len(sl.addrs) < 2 {
+		return false, false
+	}
+
+	sl.failures = 0
+	sl.current = (sl.current + 1) % len(sl.addrs)
+	return true, sl.current == 0
+}
+
+// Next moves to the next SuperNode straight away and returns it
+func (sl *superNodeList) Next() string {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	sl.failures = 0
+	if len(sl.addrs) == 0 {
+		return ""
+	}
+	sl.current = (sl.current + 1) % len(sl.addrs)
+	return sl.addrs[sl.current]
+}
+
+// Reset moves back to the preferred SuperNode
+func (sl *superNodeList) Reset() {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	sl.current = 0
+	sl.failures = 0
+}
+
+// Merge appends SuperNodes learned from the BaseNode after the configured
+// ones, keeping the current SuperNode selected if it is still listed
+func (sl *superNodeList) Merge(discovered []string) {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	current := ""
+	if len(sl.addrs) > 0 {
+		current = sl.addrs[sl.current]
+	}
+
+	addrs := append([]string(nil), sl.configured...)
+	for _, addr := range discovered {
+		if !containsAddr(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	sl.addrs = addrs
+	sl.current = 0
+	for i, addr := range addrs {
+		if addr == current {
+			sl.current = i
+			break
+		}
+	}
+}
+
+// containsAddr reports whether addrs contains addr
+func containsAddr(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBaseNodes makes the peer look up the SuperNodes of its region on these
+// BaseNodes. They are tried after any SuperNodes given on the command line,
+// least loaded first, and looked up again whenever the list is exhausted.
+func (psm *PersistentStreamManager) SetBaseNodes(addrs []string) {
+	psm.baseNodeAddrs = addrs
+}
+
+// refreshSuperNodes merges the SuperNodes the BaseNode knows for our region into the list
+func (psm *PersistentStreamManager) refreshSuperNodes() error {
+	if len(psm.baseNodeAddrs) == 0 {
+		return nil
+	}
+
+	baseClient, err := baseclient.NewFailoverClient(psm.baseNodeAddrs, psm.creds, psm.logger)
+	if err != nil {
+		return err
+	}
+	defer baseClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), superNodeProbeTimeout)
+	defer cancel()
+
+	resp, err := baseClient.ListSuperNodes(ctx, &baseProto.ListSuperNodesRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list SuperNodes: %w", err)
+	}
+
+	var supernodes []*baseProto.SuperNodeInfo
+	for _, info := range resp.Supernodes {
+		if info.Region == psm.region && info.Verified && info.CurrentLoad < info.MaxCapacity {
+			supernodes = append(supernodes, info)
+		}
+	}
+	sort.SliceStable(supernodes, func(i, j int) bool {
+		return loadRatio(supernodes[i]) < loadRatio(supernodes[j])
+	})
+
+	var discovered []string
+	for _, info := range supernodes {
+		discovered = append(discovered, fmt.Sprintf("%s:%d", info.IpAddress, info.Port))
+	}
+	psm.supernodes.Merge(discovered)
+
+	psm.logger.WithFields(logrus.Fields{
+		"region":     psm.region,
+		"discovered": len(discovered),
+		"supernodes": psm.supernodes.Len(),
+	}).Info("Refreshed SuperNode list from BaseNode")
+
+	return nil
+}
+
+// loadRatio returns the share of a SuperNode's capacity in use
+func loadRatio(info *baseProto.SuperNodeInfo) float64 {
+	if info.MaxCapacity <= 0 {
+		return 1
+	}
+	return float64(info.CurrentLoad) / float64(info.MaxCapacity)
+}
+
+// recordConnectFailure counts a failed reconnect and fails over to the next
+// SuperNode once the current one has failed too often, reporting whether it did
+func (psm *PersistentStreamManager) recordConnectFailure() bool {
+	from := psm.supernodes.Current()
+	rotated, wrapped := psm.supernodes.Failed()
+	if !rotated {
+		return false
+	}
+
+	if wrapped {
+		if err := psm.refreshSuperNodes(); err != nil {
+			psm.logger.WithError(err).Warn("Failed to refresh SuperNode list")
+		}
+	}
+
+	psm.metrics.failovers.Inc()
+	psm.logger.WithFields(logrus.Fields{
+		"from": from,
+		"to":   psm.supernodes.Current(),
+	}).Warn("Failing over to another SuperNode")
+	return true
+}
+
+// failbackLoop returns to the preferred SuperNode once it is reachable again
+func (psm *PersistentStreamManager) failbackLoop() {
+	ticker := time.NewTicker(superNodeFailbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-psm.stopped:
+			return
+		}
+
+		if !psm.isConnected.Load() || psm.supernodes.OnPreferred() {
+			continue
+		}
+
+		preferred := psm.supernodes.Preferred()
+		if err := psm.probeSuperNode(preferred); err != nil {
+			psm.logger.WithError(err).WithField("supernode", preferred).Debug("Preferred SuperNode still unreachable")
+			continue
+		}
+
+		psm.logger.WithFields(logrus.Fields{
+			"from": psm.supernodes.Current(),
+			"to":   preferred,
+		}).Info("Preferred SuperNode is reachable again, failing back")
+
+		psm.supernodes.Reset()
+		psm.metrics.failovers.Inc()
+		psm.closeConnection()
+	}
+}
+
+// probeSuperNode checks that a SuperNode accepts connections
+func (psm *PersistentStreamManager) probeSuperNode(addr string) error {
+	conn, err := grpc.NewClient(addr, psm.creds.DialOption())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), superNodeProbeTimeout)
+	defer cancel()
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("SuperNode %s not reachable: %s", addr, state)
+		}
+	}
+}
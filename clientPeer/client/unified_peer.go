@@ -2,11 +2,14 @@ package client
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"myDvpn/clientPeer/proto"
 	"myDvpn/utils"
+	"myDvpn/utils/ipam"
 	"github.com/sirupsen/logrus"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -29,11 +32,13 @@ type UnifiedPeer struct {
 	
 	// Connection management
 	streamManager   *PersistentStreamManager
-	wgManager       *utils.WireGuardManager
+	wgManager       utils.WireGuardBackend
+	firewall        utils.Firewall
 	
 	// Mode management
 	currentMode     PeerMode
 	modeMutex       sync.RWMutex
+	toggleMutex     sync.Mutex // Serializes mode switches, which wait on the SuperNode
 	
 	// Client mode components
 	clientInterface string
@@ -46,7 +51,10 @@ type UnifiedPeer struct {
 	exitListenPort  int
 	activeClients   map[string]*ClientInfo
 	clientsMux      sync.RWMutex
-	ipAllocator     *IPAllocator
+	ipPool          *ipam.Pool
+	ip6Pool         *ipam.Pool
+	ipv6            bool // Offer IPv6 to exit clients if the host can forward it
+	exitIPv6        bool // Whether the running exit interface serves IPv6
 	
 	// UI callbacks
 	onModeChanged   func(PeerMode)
@@ -62,73 +70,57 @@ type UnifiedExitConfig struct {
 	PublicKey     string
 	Endpoint      string
 	AllowedIPs    []string
+	AllocatedIP   string
+	AllocatedIP6  string // Empty when the exit has no IPv6
 	SessionID     string
+	Region        string // Region the exit was requested in, empty for the SuperNode's own
 	ConnectedAt   time.Time
 }
 
+// tunnelAddresses returns the addresses the exit assigned to the client interface
+func (c *UnifiedExitConfig) tunnelAddresses() []string {
+	return utils.TunnelAddresses(c.AllocatedIP, c.AllocatedIP6)
+}
+
 // ClientInfo represents a client connected to this exit peer
 type ClientInfo struct {
 	ClientID      string
 	PublicKey     string
 	AllocatedIP   string
+	AllocatedIP6  string // Empty when this exit has no IPv6
 	AllowedIPs    []string
 	SessionID     string
 	ConnectedAt   time.Time
+	Activated     bool // Set once the SuperNode confirms the client applied the session
 }
 
-// IPAllocator manages IP allocation for exit mode
-type IPAllocator struct {
-	cidr      string
-	usedIPs   map[string]bool
-	mutex     sync.Mutex
-}
+// roleUpdateTimeout bounds a role change, including moving exit clients away
+const roleUpdateTimeout = 90 * time.Second
 
-// NewIPAllocator creates a new IP allocator
-func NewIPAllocator(cidr string) *IPAllocator {
-	return &IPAllocator{
-		cidr:    cidr,
-		usedIPs: make(map[string]bool),
-	}
-}
-
-// AllocateIP allocates an IP address for a client
-func (ia *IPAllocator) AllocateIP() (string, error) {
-	ia.mutex.Lock()
-	defer ia.mutex.Unlock()
+// unconfirmedClientTTL is how long a client set up by SETUP_EXIT is kept
+// without ACTIVATE_EXIT before the exit releases it on its own
+const unconfirmedClientTTL = 3 * time.Minute
 
-	ip, err := utils.AllocateClientIP(ia.cidr, ia.usedIPs)
+// NewUnifiedPeer creates a new unified peer
+func NewUnifiedPeer(id, region, supernodeAddr string, exitPort int, wgManager utils.WireGuardBackend, firewall utils.Firewall, keystore *utils.Keystore, creds *utils.TLSCredentials, logger *logrus.Logger) (*UnifiedPeer, error) {
+	// Keys for both modes come from the keystore
+	clientPrivateKey, err := keystore.WireGuardKey(utils.WireGuardKeyClient)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	ia.usedIPs[ip] = true
-	return ip, nil
-}
-
-// ReleaseIP releases an IP address
-func (ia *IPAllocator) ReleaseIP(ip string) {
-	ia.mutex.Lock()
-	defer ia.mutex.Unlock()
-	delete(ia.usedIPs, ip)
-}
-
-// NewUnifiedPeer creates a new unified peer
-func NewUnifiedPeer(id, region, supernodeAddr string, exitPort int, logger *logrus.Logger) (*UnifiedPeer, error) {
-	// Create WireGuard manager
-	wgManager, err := utils.NewWireGuardManager()
+	exitPrivateKey, err := keystore.WireGuardKey(utils.WireGuardKeyExit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create WireGuard manager: %w", err)
+		return nil, err
 	}
 
-	// Generate keys for both modes
-	clientPrivateKey, err := utils.GenerateKey()
+	ipPool, err := ipam.NewPool(utils.HybridExitPoolIPv4)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate client private key: %w", err)
+		return nil, err
 	}
-
-	exitPrivateKey, err := utils.GenerateKey()
+	ip6Pool, err := ipam.NewPool(utils.HybridExitPoolIPv6)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate exit private key: %w", err)
+		return nil, err
 	}
 
 	peer := &UnifiedPeer{
@@ -137,6 +129,7 @@ func NewUnifiedPeer(id, region, supernodeAddr string, exitPort int, logger *logr
 		supernodeAddr:   supernodeAddr,
 		logger:          logger,
 		wgManager:       wgManager,
+		firewall:        firewall,
 		currentMode:     ModeClient, // Start in client mode
 		
 		// Client mode setup
@@ -148,11 +141,13 @@ func NewUnifiedPeer(id, region, supernodeAddr string, exitPort int, logger *logr
 		exitPrivateKey:  exitPrivateKey,
 		exitListenPort:  exitPort,
 		activeClients:   make(map[string]*ClientInfo),
-		ipAllocator:     NewIPAllocator("10.9.0.0/24"),
+		ipPool:          ipPool,
+		ip6Pool:         ip6Pool,
+		ipv6:            true,
 	}
 
 	// Create stream manager with dynamic role reporting
-	streamManager, err := NewPersistentStreamManager(id, peer.getCurrentRole(), region, supernodeAddr, logger)
+	streamManager, err := NewPersistentStreamManager(id, peer.getCurrentRole(), region, supernodeAddr, keystore.Identity, creds, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream manager: %w", err)
 	}
@@ -168,17 +163,28 @@ func NewUnifiedPeer(id, region, supernodeAddr string, exitPort int, logger *logr
 func (up *UnifiedPeer) getCurrentRole() string {
 	up.modeMutex.RLock()
 	defer up.modeMutex.RUnlock()
-	
-	switch up.currentMode {
-	case ModeClient:
-		return "client"
-	case ModeExit:
-		return "exit"
-	case ModeHybrid:
-		return "hybrid"
-	default:
-		return "client"
+
+	return up.currentMode.role()
+}
+
+// SetIPv6 turns IPv6 for exit clients on or off. Without it, or if the host
+// cannot forward IPv6, exit clients' IPv6 traffic is dropped.
+func (up *UnifiedPeer) SetIPv6(enabled bool) {
+	up.ipv6 = enabled
+}
+
+// SetLeaseDir keeps the exit clients' address leases in dir so that they get
+// the same addresses after a restart
+func (up *UnifiedPeer) SetLeaseDir(dir string) error {
+	if err := up.ipPool.Load(filepath.Join(dir, "ipv4.json")); err != nil {
+		return err
 	}
+	return up.ip6Pool.Load(filepath.Join(dir, "ipv6.json"))
+}
+
+// SetBaseNodes lets the peer fail over to SuperNodes of its region listed on these BaseNodes
+func (up *UnifiedPeer) SetBaseNodes(addrs []string) {
+	up.streamManager.SetBaseNodes(addrs)
 }
 
 // Start starts the unified peer
@@ -193,6 +199,8 @@ func (up *UnifiedPeer) Start() error {
 		return fmt.Errorf("failed to initialize client mode: %w", err)
 	}
 
+	go up.unconfirmedClientCollector()
+
 	up.logger.WithFields(logrus.Fields{
 		"peer_id": up.id,
 		"region":  up.region,
@@ -207,9 +215,10 @@ func (up *UnifiedPeer) Stop() error {
 	// Stop stream manager
 	up.streamManager.Stop()
 
-	// Cleanup both modes
-	up.cleanupClientMode()
-	up.cleanupExitMode()
+	// Cleanup whatever the current mode runs
+	up.modeMutex.Lock()
+	up.teardownMode(up.currentMode, "")
+	up.modeMutex.Unlock()
 
 	// Close WireGuard manager
 	if err := up.wgManager.Close(); err != nil {
@@ -220,114 +229,231 @@ func (up *UnifiedPeer) Stop() error {
 	return nil
 }
 
-// ToggleExitMode toggles the peer between client and exit modes
+// ToggleExitMode toggles the peer between client and exit modes. The change
+// only takes effect once the SuperNode has acknowledged the new role.
 func (up *UnifiedPeer) ToggleExitMode(enabled bool) error {
-	up.modeMutex.Lock()
-	defer up.modeMutex.Unlock()
+	if enabled {
+		return up.SetMode(ModeExit)
+	}
+	return up.SetMode(ModeClient)
+}
 
+// SetHybridMode turns hybrid mode on or off. A hybrid peer serves exit clients
+// while keeping its own tunnel to another exit; turning it off returns to client mode.
+func (up *UnifiedPeer) SetHybridMode(enabled bool) error {
 	if enabled {
-		return up.switchToExitMode()
-	} else {
-		return up.switchToClientMode()
+		return up.SetMode(ModeHybrid)
 	}
+	return up.SetMode(ModeClient)
 }
 
-// switchToExitMode switches the peer to exit mode
-func (up *UnifiedPeer) switchToExitMode() error {
-	if up.currentMode == ModeExit || up.currentMode == ModeHybrid {
-		return nil // Already in exit mode
+// SetMode switches the peer to a mode once the SuperNode has acknowledged the
+// matching role. While switching the peer runs as a hybrid, so neither its own
+// tunnel nor its exit clients are dropped before the SuperNode has moved them.
+func (up *UnifiedPeer) SetMode(mode PeerMode) error {
+	if mode != ModeClient && mode != ModeExit && mode != ModeHybrid {
+		return fmt.Errorf("unknown mode %q", mode)
 	}
 
-	up.logger.Info("Switching to exit mode...")
+	up.toggleMutex.Lock()
+	defer up.toggleMutex.Unlock()
 
-	// Initialize exit mode interface
-	if err := up.initializeExitMode(); err != nil {
-		return fmt.Errorf("failed to initialize exit mode: %w", err)
+	up.modeMutex.Lock()
+	oldMode := up.currentMode
+	if oldMode == mode {
+		up.modeMutex.Unlock()
+		return nil
 	}
 
-	// Update mode
-	oldMode := up.currentMode
-	up.currentMode = ModeExit
+	up.logger.WithFields(logrus.Fields{
+		"old_mode": oldMode,
+		"new_mode": mode,
+	}).Info("Switching mode...")
+
+	// Bring up whatever the new mode adds
+	if mode.usesExit() && !oldMode.usesExit() {
+		if err := up.initializeClientMode(); err != nil {
+			up.modeMutex.Unlock()
+			return fmt.Errorf("failed to initialize client mode: %w", err)
+		}
+	}
+	if mode.servesExits() && !oldMode.servesExits() {
+		if err := up.initializeExitMode(); err != nil {
+			if !oldMode.usesExit() {
+				up.cleanupClientMode()
+			}
+			up.modeMutex.Unlock()
+			return fmt.Errorf("failed to initialize exit mode: %w", err)
+		}
+	}
 
-	// Notify SuperNode of role change
-	go up.updateSupernodeRole()
+	// Run both sides until the SuperNode acknowledges the new role, so SETUP_EXIT
+	// is accepted as soon as it knows the role and our own tunnel stays up meanwhile
+	up.currentMode = ModeHybrid
+	up.modeMutex.Unlock()
+
+	if err := up.updateSupernodeRole(mode.role()); err != nil {
+		up.modeMutex.Lock()
+		up.teardownMode(mode, oldMode)
+		up.currentMode = oldMode
+		up.modeMutex.Unlock()
+		return err
+	}
+
+	// The SuperNode has moved exit clients and released our own exit session
+	up.modeMutex.Lock()
+	up.teardownMode(oldMode, mode)
+	up.currentMode = mode
+	up.modeMutex.Unlock()
 
 	// Notify UI
 	if up.onModeChanged != nil {
-		up.onModeChanged(up.currentMode)
+		up.onModeChanged(mode)
 	}
 
 	up.logger.WithFields(logrus.Fields{
 		"old_mode": oldMode,
-		"new_mode": up.currentMode,
-	}).Info("Switched to exit mode")
+		"new_mode": mode,
+	}).Info("Switched mode")
 
 	return nil
 }
 
-// switchToClientMode switches the peer to client mode
-func (up *UnifiedPeer) switchToClientMode() error {
-	if up.currentMode == ModeClient {
-		return nil // Already in client mode
+// teardownMode removes the interfaces used in one mode but not in another.
+// Callers hold modeMutex.
+func (up *UnifiedPeer) teardownMode(from, to PeerMode) {
+	if from.servesExits() && !to.servesExits() {
+		up.cleanupExitMode()
+	}
+	if from.usesExit() && !to.usesExit() {
+		up.cleanupClientMode()
 	}
+}
 
-	up.logger.Info("Switching to client mode...")
+// servesExits reports whether a peer in this mode takes exit clients
+func (m PeerMode) servesExits() bool {
+	return m == ModeExit || m == ModeHybrid
+}
 
-	// Cleanup exit mode
-	up.cleanupExitMode()
+// usesExit reports whether a peer in this mode tunnels its own traffic through an exit
+func (m PeerMode) usesExit() bool {
+	return m == ModeClient || m == ModeHybrid
+}
 
-	// Update mode
-	oldMode := up.currentMode
-	up.currentMode = ModeClient
+// role returns the role reported to the SuperNode for this mode
+func (m PeerMode) role() string {
+	switch m {
+	case ModeExit:
+		return "exit"
+	case ModeHybrid:
+		return "hybrid"
+	default:
+		return "client"
+	}
+}
 
-	// Notify SuperNode of role change
-	go up.updateSupernodeRole()
+// ConnectToExit connects to an exit peer (client mode)
+func (up *UnifiedPeer) ConnectToExit(targetRegion string) (*UnifiedExitConfig, error) {
+	up.modeMutex.RLock()
+	mode := up.currentMode
+	up.modeMutex.RUnlock()
 
-	// Notify UI
-	if up.onModeChanged != nil {
-		up.onModeChanged(up.currentMode)
+	if !mode.usesExit() {
+		return nil, fmt.Errorf("peer is not in client mode")
 	}
 
 	up.logger.WithFields(logrus.Fields{
-		"old_mode": oldMode,
-		"new_mode": up.currentMode,
-	}).Info("Switched to client mode")
+		"peer_id":       up.id,
+		"target_region": targetRegion,
+	}).Info("Requesting exit peer connection")
 
-	return nil
-}
+	// Ask the SuperNode for an exit over the persistent stream. The request
+	// can take up to exitRequestTimeout, so it must not hold up a mode switch.
+	assignment, err := up.streamManager.RequestExit(targetRegion, up.clientPrivateKey.PublicKey().String(), exitRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request exit peer: %w", err)
+	}
 
-// ConnectToExit connects to an exit peer (client mode)
-func (up *UnifiedPeer) ConnectToExit(targetRegion string) (*UnifiedExitConfig, error) {
 	up.modeMutex.RLock()
 	defer up.modeMutex.RUnlock()
 
-	if up.currentMode != ModeClient && up.currentMode != ModeHybrid {
-		return nil, fmt.Errorf("peer is not in client mode")
+	// A mode switch meanwhile may have removed the client interface
+	if up.currentMode != mode {
+		err := fmt.Errorf("peer switched from %s to %s mode while requesting an exit", mode, up.currentMode)
+		up.confirmExit(assignment.SessionId, err)
+		return nil, err
+	}
+
+	if up.isOwnExit(assignment.ExitPeer.PeerId, assignment.ExitPeer.PublicKey) {
+		err := fmt.Errorf("SuperNode assigned this peer as its own exit")
+		up.confirmExit(assignment.SessionId, err)
+		return nil, err
 	}
 
 	up.mutex.Lock()
 	defer up.mutex.Unlock()
 
-	// TODO: Implement exit request to SuperNode
-	// This would involve sending a request message to the SuperNode
-	// For now, this is a placeholder that demonstrates the interface
+	reserved, err := up.reserveOwnAddresses(assignment.AllocatedIp, assignment.AllocatedIp6)
+	if err != nil {
+		err = fmt.Errorf("assigned tunnel address is in use by an exit client: %w", err)
+		up.confirmExit(assignment.SessionId, err)
+		return nil, err
+	}
 
-	up.logger.WithFields(logrus.Fields{
-		"peer_id":       up.id,
-		"target_region": targetRegion,
-	}).Info("Requesting exit peer connection")
+	// Drop the previous exit before programming the new one
+	if up.currentExit != nil {
+		if err := up.wgManager.RemovePeer(up.clientInterface, up.currentExit.PublicKey); err != nil {
+			up.logger.WithError(err).Warn("Failed to remove previous exit peer from WireGuard")
+		}
+		removeTunnelAddresses(up.wgManager, up.clientInterface, up.currentExit.tunnelAddresses(), up.logger)
+		up.unreserveOwnAddresses(up.currentExit, assignment.AllocatedIp, assignment.AllocatedIp6)
+	}
 
-	// Placeholder exit config
 	exitConfig := &UnifiedExitConfig{
-		ExitPeerID:  "exit-placeholder",
-		PublicKey:   "placeholder-key",
-		Endpoint:    "127.0.0.1:51820",
-		AllowedIPs:  []string{"0.0.0.0/0"},
-		SessionID:   "session-placeholder",
-		ConnectedAt: time.Now(),
+		ExitPeerID:  assignment.ExitPeer.PeerId,
+		PublicKey:   assignment.ExitPeer.PublicKey,
+		Endpoint:    assignment.ExitPeer.Endpoint,
+		AllowedIPs:  assignment.ExitPeer.AllowedIps,
+		AllocatedIP:  assignment.AllocatedIp,
+		AllocatedIP6: assignment.AllocatedIp6,
+		SessionID:    assignment.SessionId,
+		Region:       targetRegion,
+		ConnectedAt:  time.Now(),
+	}
+
+	peerConfig := utils.PeerConfig{
+		PublicKey:  exitConfig.PublicKey,
+		Endpoint:   exitConfig.Endpoint,
+		AllowedIPs: exitConfig.AllowedIPs,
+	}
+
+	if err := up.wgManager.AddPeer(up.clientInterface, peerConfig); err != nil {
+		up.currentExit = nil
+		up.releaseReservations(reserved)
+		err = fmt.Errorf("failed to add exit peer to WireGuard: %w", err)
+		up.confirmExit(exitConfig.SessionID, err)
+		return nil, err
+	}
+
+	if err := setTunnelAddresses(up.wgManager, up.clientInterface, exitConfig.tunnelAddresses()); err != nil {
+		up.wgManager.RemovePeer(up.clientInterface, exitConfig.PublicKey)
+		up.currentExit = nil
+		up.releaseReservations(reserved)
+		err = fmt.Errorf("failed to set client interface IP: %w", err)
+		up.confirmExit(exitConfig.SessionID, err)
+		return nil, err
 	}
 
 	up.currentExit = exitConfig
+	up.confirmExit(exitConfig.SessionID, nil)
+
+	up.logger.WithFields(logrus.Fields{
+		"peer_id":      up.id,
+		"exit_peer":    exitConfig.ExitPeerID,
+		"endpoint":     exitConfig.Endpoint,
+		"allocated_ip": exitConfig.AllocatedIP,
+		"session_id":   exitConfig.SessionID,
+	}).Info("Connected to exit peer")
 
 	// Notify UI
 	if up.onClientConnected != nil {
@@ -337,6 +463,64 @@ func (up *UnifiedPeer) ConnectToExit(targetRegion string) (*UnifiedExitConfig, e
 	return exitConfig, nil
 }
 
+// isOwnExit reports whether an exit is this peer's own exit interface, which
+// would route the peer's traffic into itself
+func (up *UnifiedPeer) isOwnExit(peerID, publicKey string) bool {
+	return peerID == up.id || publicKey == up.exitPrivateKey.PublicKey().String()
+}
+
+// reserveOwnAddresses keeps the addresses an exit assigned to the client
+// interface out of the exit pools, so that no exit client is ever given the
+// peer's own tunnel address. It returns the addresses it newly reserved, and
+// fails if an address is already leased to an exit client.
+func (up *UnifiedPeer) reserveOwnAddresses(ips ...string) ([]string, error) {
+	var reserved []string
+	for _, ip := range ips {
+		if ip == "" {
+			continue
+		}
+		for _, pool := range []*ipam.Pool{up.ipPool, up.ip6Pool} {
+			newly, err := pool.Reserve(ip)
+			if err != nil {
+				up.releaseReservations(reserved)
+				return nil, err
+			}
+			if newly {
+				reserved = append(reserved, ip)
+			}
+		}
+	}
+	return reserved, nil
+}
+
+// releaseReservations returns reserved addresses to the exit pools
+func (up *UnifiedPeer) releaseReservations(ips []string) {
+	for _, ip := range ips {
+		for _, pool := range []*ipam.Pool{up.ipPool, up.ip6Pool} {
+			pool.Unreserve(ip)
+		}
+	}
+}
+
+// unreserveOwnAddresses returns the tunnel addresses of a previous exit to
+// the exit pools, except those the exit in use now kept
+func (up *UnifiedPeer) unreserveOwnAddresses(previous *UnifiedExitConfig, keep ...string) {
+	var released []string
+	for _, ip := range []string{previous.AllocatedIP, previous.AllocatedIP6} {
+		if ip != "" && !slices.Contains(keep, ip) {
+			released = append(released, ip)
+		}
+	}
+	up.releaseReservations(released)
+}
+
+// confirmExit reports the outcome of applying an exit assignment to the SuperNode
+func (up *UnifiedPeer) confirmExit(sessionID string, applyErr error) {
+	if err := up.streamManager.ConfirmExit(sessionID, applyErr); err != nil {
+		up.logger.WithError(err).WithField("session_id", sessionID).Warn("Failed to confirm exit assignment")
+	}
+}
+
 // DisconnectFromExit disconnects from the current exit peer
 func (up *UnifiedPeer) DisconnectFromExit() error {
 	up.mutex.Lock()
@@ -351,12 +535,18 @@ func (up *UnifiedPeer) DisconnectFromExit() error {
 		up.logger.WithError(err).Warn("Failed to remove exit peer from WireGuard")
 	}
 
+	removeTunnelAddresses(up.wgManager, up.clientInterface, up.currentExit.tunnelAddresses(), up.logger)
+	up.unreserveOwnAddresses(up.currentExit)
+
 	up.logger.WithFields(logrus.Fields{
 		"peer_id":    up.id,
 		"exit_peer":  up.currentExit.ExitPeerID,
 		"session_id": up.currentExit.SessionID,
 	}).Info("Disconnected from exit peer")
 
+	// Let the SuperNode release the session on the exit
+	up.confirmExit(up.currentExit.SessionID, errExitDisconnected)
+
 	up.currentExit = nil
 	return nil
 }
@@ -399,16 +589,35 @@ func (up *UnifiedPeer) initializeExitMode() error {
 	}
 
 	// Set interface IP
-	if err := up.wgManager.SetInterfaceIP(up.exitInterface, "10.9.0.1/24"); err != nil {
+	gateway, err := utils.PoolGateway(utils.HybridExitPoolIPv4)
+	if err != nil {
+		return err
+	}
+	if err := up.wgManager.SetInterfaceIP(up.exitInterface, gateway); err != nil {
 		return fmt.Errorf("failed to set exit interface IP: %w", err)
 	}
 
 	// Enable IP forwarding and NAT
-	if err := utils.EnableIPForwarding(); err != nil {
+	if err := up.firewall.EnableForwarding(); err != nil {
 		return fmt.Errorf("failed to enable IP forwarding: %w", err)
 	}
 
-	if err := utils.AddNATRule(up.exitInterface, "eth0"); err != nil {
+	up.exitIPv6 = false
+	clientCIDR6 := ""
+	if up.ipv6 {
+		if err := up.enableExitIPv6(); err != nil {
+			up.logger.WithError(err).Warn("IPv6 unavailable, blocking exit clients' IPv6 traffic")
+		} else {
+			up.exitIPv6 = true
+			clientCIDR6 = utils.HybridExitPoolIPv6
+		}
+	}
+
+	// Exit clients' traffic must leave through eth0 even while our own
+	// traffic is routed into the client tunnel
+	ruleSet := utils.ExitNATRuleSet(up.exitRuleSetID(), up.exitInterface, utils.HybridExitPoolIPv4, clientCIDR6, "eth0")
+	ruleSet.Routing = utils.ExitRoutingRules(ruleSet, up.exitInterface)
+	if err := up.firewall.Apply(ruleSet); err != nil {
 		return fmt.Errorf("failed to add NAT rule: %w", err)
 	}
 
@@ -416,13 +625,37 @@ func (up *UnifiedPeer) initializeExitMode() error {
 		"interface":   up.exitInterface,
 		"listen_port": up.exitListenPort,
 		"public_key":  up.exitPrivateKey.PublicKey().String(),
+		"ipv6":        up.exitIPv6,
 	}).Info("Exit mode interface initialized")
 
 	return nil
 }
 
-// cleanupClientMode cleans up client mode interface
+// enableExitIPv6 turns on IPv6 forwarding and gives the exit interface its IPv6 gateway address
+func (up *UnifiedPeer) enableExitIPv6() error {
+	if err := up.firewall.EnableIPv6Forwarding(); err != nil {
+		return err
+	}
+
+	gateway, err := utils.PoolGateway(utils.HybridExitPoolIPv6)
+	if err != nil {
+		return err
+	}
+	if err := up.wgManager.SetInterfaceIP(up.exitInterface, gateway); err != nil {
+		return fmt.Errorf("failed to set exit interface IPv6 address: %w", err)
+	}
+	return nil
+}
+
+// cleanupClientMode tears down the client tunnel and its interface
 func (up *UnifiedPeer) cleanupClientMode() {
+	up.mutex.Lock()
+	if up.currentExit != nil {
+		up.unreserveOwnAddresses(up.currentExit)
+	}
+	up.currentExit = nil
+	up.mutex.Unlock()
+
 	if err := up.wgManager.DeleteInterface(up.clientInterface); err != nil {
 		up.logger.WithError(err).Warn("Failed to delete client interface")
 	}
@@ -437,18 +670,32 @@ func (up *UnifiedPeer) cleanupExitMode() {
 	}
 	up.clientsMux.Unlock()
 
+	// Remove NAT rules
+	if err := up.firewall.Remove(up.exitRuleSetID()); err != nil {
+		up.logger.WithError(err).Warn("Failed to remove exit NAT rules")
+	}
+
 	// Delete interface
 	if err := up.wgManager.DeleteInterface(up.exitInterface); err != nil {
 		up.logger.WithError(err).Warn("Failed to delete exit interface")
 	}
 }
 
-// registerCommandHandlers registers command handlers for both modes
+// exitRuleSetID names the firewall rule set for the exit interface
+func (up *UnifiedPeer) exitRuleSetID() string {
+	return "exit-" + up.exitInterface
+}
+
+// registerCommandHandlers registers command handlers for both modes, and
+// the handler replacing an exit lost on failover
 func (up *UnifiedPeer) registerCommandHandlers() {
 	up.streamManager.RegisterCommandHandler(proto.CommandType_SETUP_EXIT, up.handleSetupExitCommand)
+	up.streamManager.RegisterCommandHandler(proto.CommandType_ACTIVATE_EXIT, up.handleActivateExitCommand)
+	up.streamManager.RegisterCommandHandler(proto.CommandType_TEARDOWN_EXIT, up.handleTeardownExitCommand)
 	up.streamManager.RegisterCommandHandler(proto.CommandType_ROTATE_PEER, up.handleRotatePeerCommand)
 	up.streamManager.RegisterCommandHandler(proto.CommandType_RELAY_SETUP, up.handleRelaySetupCommand)
 	up.streamManager.RegisterCommandHandler(proto.CommandType_DISCONNECT, up.handleDisconnectCommand)
+	up.streamManager.SetExitLostHandler(up.handleExitLost)
 }
 
 // handleSetupExitCommand handles SETUP_EXIT commands (exit mode)
@@ -456,7 +703,7 @@ func (up *UnifiedPeer) handleSetupExitCommand(cmd *proto.Command) *proto.Command
 	up.modeMutex.RLock()
 	defer up.modeMutex.RUnlock()
 
-	if up.currentMode != ModeExit && up.currentMode != ModeHybrid {
+	if !up.currentMode.servesExits() {
 		return &proto.CommandResponse{
 			CommandId: cmd.CommandId,
 			Success:   false,
@@ -476,6 +723,15 @@ func (up *UnifiedPeer) handleSetupExitCommand(cmd *proto.Command) *proto.Command
 		}
 	}
 
+	// A hybrid peer never carries its own client tunnel
+	if clientID == up.id || clientPubKey == up.clientPrivateKey.PublicKey().String() {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   "Peer cannot be its own exit",
+		}
+	}
+
 	if err := up.addClient(clientID, clientPubKey, sessionID); err != nil {
 		up.logger.WithError(err).Error("Failed to add client")
 		return &proto.CommandResponse{
@@ -485,10 +741,119 @@ func (up *UnifiedPeer) handleSetupExitCommand(cmd *proto.Command) *proto.Command
 		}
 	}
 
+	// Get client info for response
+	up.clientsMux.RLock()
+	clientInfo := up.activeClients[clientID]
+	up.clientsMux.RUnlock()
+
+	result := make(map[string]string)
+	if clientInfo != nil {
+		result["allocated_ip"] = clientInfo.AllocatedIP
+		if clientInfo.AllocatedIP6 != "" {
+			result["allocated_ip6"] = clientInfo.AllocatedIP6
+		}
+		result["endpoint"] = fmt.Sprintf("0.0.0.0:%d", up.exitListenPort) // SuperNode fills in the observed host
+		result["public_key"] = up.exitPrivateKey.PublicKey().String()
+	}
+
 	return &proto.CommandResponse{
 		CommandId: cmd.CommandId,
 		Success:   true,
 		Message:   "Client added successfully",
+		Result:    result,
+	}
+}
+
+// handleActivateExitCommand marks a client's session as confirmed so it is kept
+func (up *UnifiedPeer) handleActivateExitCommand(cmd *proto.Command) *proto.CommandResponse {
+	clientID := cmd.Payload["client_id"]
+	sessionID := cmd.Payload["session_id"]
+
+	up.clientsMux.Lock()
+	defer up.clientsMux.Unlock()
+
+	clientInfo, exists := up.activeClients[clientID]
+	if !exists || clientInfo.SessionID != sessionID {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   fmt.Sprintf("session %s is not set up", sessionID),
+		}
+	}
+
+	clientInfo.Activated = true
+
+	up.logger.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"session_id": sessionID,
+	}).Info("Activated client session")
+
+	return &proto.CommandResponse{
+		CommandId: cmd.CommandId,
+		Success:   true,
+		Message:   "Session activated",
+	}
+}
+
+// handleTeardownExitCommand undoes SETUP_EXIT for a session. Tearing down a
+// session that is already gone succeeds, so the SuperNode can retry it freely.
+func (up *UnifiedPeer) handleTeardownExitCommand(cmd *proto.Command) *proto.CommandResponse {
+	clientID := cmd.Payload["client_id"]
+	sessionID := cmd.Payload["session_id"]
+
+	up.clientsMux.Lock()
+	defer up.clientsMux.Unlock()
+
+	clientInfo, exists := up.activeClients[clientID]
+	if !exists || clientInfo.SessionID != sessionID {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   true,
+			Message:   "Session already torn down",
+		}
+	}
+
+	if err := up.removeClientUnsafe(clientID); err != nil {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   fmt.Sprintf("Failed to remove client: %v", err),
+		}
+	}
+
+	up.logger.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"session_id": sessionID,
+		"reason":     cmd.Payload["reason"],
+	}).Info("Tore down client session")
+
+	return &proto.CommandResponse{
+		CommandId: cmd.CommandId,
+		Success:   true,
+		Message:   "Session torn down",
+	}
+}
+
+// unconfirmedClientCollector releases exit clients whose sessions were never activated
+func (up *UnifiedPeer) unconfirmedClientCollector() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		up.clientsMux.Lock()
+		for clientID, clientInfo := range up.activeClients {
+			if clientInfo.Activated || time.Since(clientInfo.ConnectedAt) < unconfirmedClientTTL {
+				continue
+			}
+			up.logger.WithFields(logrus.Fields{
+				"client_id":  clientID,
+				"session_id": clientInfo.SessionID,
+			}).Warn("Releasing client whose session was never confirmed")
+			if err := up.removeClientUnsafe(clientID); err != nil {
+				up.logger.WithError(err).WithField("client_id", clientID).Warn("Failed to release unconfirmed client")
+			}
+		}
+		up.clientsMux.Unlock()
 	}
 }
 
@@ -497,36 +862,59 @@ func (up *UnifiedPeer) addClient(clientID, clientPubKey, sessionID string) error
 	up.clientsMux.Lock()
 	defer up.clientsMux.Unlock()
 
-	// Check if client already exists
-	if _, exists := up.activeClients[clientID]; exists {
-		return fmt.Errorf("client %s already exists", clientID)
+	// A retried SETUP_EXIT for the same session keeps the existing allocation;
+	// a new session from the same client replaces the old one
+	if existing, exists := up.activeClients[clientID]; exists {
+		if existing.SessionID == sessionID {
+			if existing.PublicKey != clientPubKey {
+				return fmt.Errorf("session %s is already set up with a different public key", sessionID)
+			}
+			up.logger.WithFields(logrus.Fields{
+				"client_id":  clientID,
+				"session_id": sessionID,
+			}).Info("Client already set up for session")
+			return nil
+		}
+		if err := up.removeClientUnsafe(clientID); err != nil {
+			return fmt.Errorf("failed to replace previous session %s: %w", existing.SessionID, err)
+		}
 	}
 
-	// Allocate IP for client
-	allocatedIP, err := up.ipAllocator.AllocateIP()
+	// Lease IPs for client; a returning client gets its previous addresses
+	allocatedIP, err := up.ipPool.Allocate(clientID)
 	if err != nil {
 		return fmt.Errorf("failed to allocate IP: %w", err)
 	}
 
+	var allocatedIP6 string
+	if up.exitIPv6 {
+		allocatedIP6, err = up.ip6Pool.Allocate(clientID)
+		if err != nil {
+			up.releaseIPs(clientID)
+			return fmt.Errorf("failed to allocate IPv6 address: %w", err)
+		}
+	}
+
 	// Add peer to WireGuard
 	peerConfig := utils.PeerConfig{
 		PublicKey:  clientPubKey,
-		AllowedIPs: []string{fmt.Sprintf("%s/32", allocatedIP)},
+		AllowedIPs: utils.TunnelAddresses(allocatedIP, allocatedIP6),
 	}
 
 	if err := up.wgManager.AddPeer(up.exitInterface, peerConfig); err != nil {
-		up.ipAllocator.ReleaseIP(allocatedIP)
+		up.releaseIPs(clientID)
 		return fmt.Errorf("failed to add peer to WireGuard: %w", err)
 	}
 
 	// Store client info
 	clientInfo := &ClientInfo{
-		ClientID:    clientID,
-		PublicKey:   clientPubKey,
-		AllocatedIP: allocatedIP,
-		AllowedIPs:  []string{"0.0.0.0/0"},
-		SessionID:   sessionID,
-		ConnectedAt: time.Now(),
+		ClientID:     clientID,
+		PublicKey:    clientPubKey,
+		AllocatedIP:  allocatedIP,
+		AllocatedIP6: allocatedIP6,
+		AllowedIPs:   utils.FullTunnelAllowedIPs(),
+		SessionID:    sessionID,
+		ConnectedAt:  time.Now(),
 	}
 
 	up.activeClients[clientID] = clientInfo
@@ -537,9 +925,10 @@ func (up *UnifiedPeer) addClient(clientID, clientPubKey, sessionID string) error
 	}
 
 	up.logger.WithFields(logrus.Fields{
-		"client_id":    clientID,
-		"allocated_ip": allocatedIP,
-		"session_id":   sessionID,
+		"client_id":     clientID,
+		"allocated_ip":  allocatedIP,
+		"allocated_ip6": allocatedIP6,
+		"session_id":    sessionID,
 	}).Info("Added client in exit mode")
 
 	return nil
@@ -558,7 +947,7 @@ func (up *UnifiedPeer) removeClientUnsafe(clientID string) error {
 	}
 
 	// Release IP
-	up.ipAllocator.ReleaseIP(clientInfo.AllocatedIP)
+	up.releaseIPs(clientID)
 
 	// Remove from active clients
 	delete(up.activeClients, clientID)
@@ -571,22 +960,136 @@ func (up *UnifiedPeer) removeClientUnsafe(clientID string) error {
 	return nil
 }
 
-// updateSupernodeRole notifies SuperNode of role change
-func (up *UnifiedPeer) updateSupernodeRole() {
-	// TODO: Implement role update to SuperNode
-	// This would involve re-authenticating with the new role
-	up.logger.WithField("new_role", up.getCurrentRole()).Info("Updated SuperNode role")
+// releaseIPs ends a client's leases; its addresses stay reserved for it for a while
+func (up *UnifiedPeer) releaseIPs(clientID string) {
+	for _, pool := range []*ipam.Pool{up.ipPool, up.ip6Pool} {
+		if err := pool.Release(clientID); err != nil {
+			up.logger.WithError(err).WithField("client_id", clientID).Warn("Failed to save released lease")
+		}
+	}
 }
 
-// Placeholder handlers for other commands
+// updateSupernodeRole changes the peer's role on the SuperNode and waits for the acknowledgement
+func (up *UnifiedPeer) updateSupernodeRole(role string) error {
+	ack, err := up.streamManager.UpdateRole(role, roleUpdateTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to update SuperNode role: %w", err)
+	}
+
+	up.logger.WithFields(logrus.Fields{
+		"new_role":         ack.Role,
+		"migrated_clients": ack.MigratedClients,
+		"released_clients": ack.ReleasedClients,
+	}).Info("Updated SuperNode role")
+	return nil
+}
+
+// handleRotatePeerCommand switches the client tunnel to the exit carried by ROTATE_PEER
 func (up *UnifiedPeer) handleRotatePeerCommand(cmd *proto.Command) *proto.CommandResponse {
+	up.modeMutex.RLock()
+	defer up.modeMutex.RUnlock()
+
+	if !up.currentMode.usesExit() {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   "Peer is not in client mode",
+		}
+	}
+
+	next, err := exitConfigFromRotation(cmd.Payload)
+	if err != nil {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   err.Error(),
+		}
+	}
+
+	if up.isOwnExit(next.ExitPeerID, next.PublicKey) {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   "Cannot rotate to this peer's own exit",
+		}
+	}
+
+	up.mutex.Lock()
+	defer up.mutex.Unlock()
+
+	var oldPubKey, oldSessionID, region string
+	var oldAddrs []string
+	if up.currentExit != nil {
+		oldPubKey = up.currentExit.PublicKey
+		oldAddrs = up.currentExit.tunnelAddresses()
+		oldSessionID = up.currentExit.SessionID
+		region = up.currentExit.Region
+	}
+
+	result := map[string]string{
+		"old_session_id": oldSessionID,
+		"new_session_id": next.SessionID,
+	}
+
+	reserved, err := up.reserveOwnAddresses(next.AllocatedIP, next.AllocatedIP6)
+	if err != nil {
+		up.logger.WithError(err).WithField("exit_peer", next.ExitPeerID).Warn("Exit rotation rejected, keeping current exit")
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   fmt.Sprintf("Assigned tunnel address is in use by an exit client: %v", err),
+			Result:    result,
+		}
+	}
+
+	if err := switchExit(up.wgManager, up.clientInterface, oldPubKey, oldAddrs, next, up.logger); err != nil {
+		up.releaseReservations(reserved)
+		up.logger.WithError(err).WithField("exit_peer", next.ExitPeerID).Warn("Exit rotation failed, keeping current exit")
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   fmt.Sprintf("Rotation failed: %v", err),
+			Result:    result,
+		}
+	}
+
+	if up.currentExit != nil {
+		up.unreserveOwnAddresses(up.currentExit, next.AllocatedIP, next.AllocatedIP6)
+	}
+	up.currentExit = &UnifiedExitConfig{
+		ExitPeerID:  next.ExitPeerID,
+		PublicKey:   next.PublicKey,
+		Endpoint:    next.Endpoint,
+		AllowedIPs:  next.AllowedIPs,
+		AllocatedIP:  next.AllocatedIP,
+		AllocatedIP6: next.AllocatedIP6,
+		SessionID:    next.SessionID,
+		Region:       region,
+		ConnectedAt:  time.Now(),
+	}
+
+	up.logger.WithFields(logrus.Fields{
+		"peer_id":        up.id,
+		"exit_peer":      next.ExitPeerID,
+		"old_session_id": oldSessionID,
+		"new_session_id": next.SessionID,
+	}).Info("Rotated to new exit peer")
+
+	// Notify UI
+	if up.onClientConnected != nil {
+		up.onClientConnected(up.currentExit)
+	}
+
 	return &proto.CommandResponse{
 		CommandId: cmd.CommandId,
 		Success:   true,
-		Message:   "Rotate peer command handled",
+		Message:   "Rotated to new exit peer",
+		Result:    result,
 	}
 }
 
+// Placeholder handlers for other commands
+
 func (up *UnifiedPeer) handleRelaySetupCommand(cmd *proto.Command) *proto.CommandResponse {
 	return &proto.CommandResponse{
 		CommandId: cmd.CommandId,
@@ -622,6 +1125,25 @@ func (up *UnifiedPeer) SetExitClientAddedCallback(callback func(*ClientInfo)) {
 	up.onExitClientAdded = callback
 }
 
+// handleExitLost replaces the current exit when its session could not be
+// handed over to the SuperNode we failed over to
+func (up *UnifiedPeer) handleExitLost(sessionID string) {
+	current := up.GetCurrentExit()
+	if current == nil || current.SessionID != sessionID {
+		return
+	}
+
+	up.logger.WithFields(logrus.Fields{
+		"peer_id":    up.id,
+		"exit_peer":  current.ExitPeerID,
+		"session_id": sessionID,
+	}).Warn("Exit session was lost on failover, requesting a new exit")
+
+	if _, err := up.ConnectToExit(current.Region); err != nil {
+		up.logger.WithError(err).Error("Failed to replace exit lost on failover")
+	}
+}
+
 // Getters
 func (up *UnifiedPeer) GetCurrentMode() PeerMode {
 	up.modeMutex.RLock()
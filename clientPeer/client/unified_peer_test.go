@@ -0,0 +1,265 @@
+package client
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+)
+
+// newTestExitModePeer creates a unified peer on the memory backend with its
+// exit side set up, without connecting to a SuperNode
+func newTestExitModePeer(t *testing.T) (*UnifiedPeer, *utils.MemoryWireGuardBackend) {
+	t.Helper()
+
+	wg := utils.NewMemoryWireGuardBackend()
+	up, err := NewUnifiedPeer("u1", "r1", "127.0.0.1:1", 51821, wg, utils.NewMemoryFirewall(), testutil.Keystore(t), utils.InsecureCredentials(), testutil.Logger())
+	if err != nil {
+		t.Fatalf("NewUnifiedPeer: %v", err)
+	}
+
+	// SetMode waits for the SuperNode to acknowledge the role, so bring up
+	// exit mode directly
+	if err := up.initializeExitMode(); err != nil {
+		t.Fatalf("initializeExitMode: %v", err)
+	}
+	up.currentMode = ModeExit
+	return up, wg
+}
+
+func TestUnifiedPeerSetupExitAddsClientPeer(t *testing.T) {
+	up, wg := newTestExitModePeer(t)
+	clientPubKey := testutil.PublicKey(t)
+
+	resp := up.handleSetupExitCommand(testutil.SetupExitCommand("cmd-1", "c1", clientPubKey, "s1"))
+	if !resp.Success {
+		t.Fatalf("SETUP_EXIT failed: %s", resp.Message)
+	}
+
+	ip, ip6 := resp.Result["allocated_ip"], resp.Result["allocated_ip6"]
+	if ip == "" || ip6 == "" {
+		t.Fatalf("allocated addresses %q and %q, want both", ip, ip6)
+	}
+	if want := up.exitPrivateKey.PublicKey().String(); resp.Result["public_key"] != want {
+		t.Fatalf("exit public key %q, want %q", resp.Result["public_key"], want)
+	}
+	testutil.ExpectClientPeer(t, wg, up.exitInterface, clientPubKey, ip, ip6)
+
+	teardown := up.handleTeardownExitCommand(testutil.TeardownExitCommand("cmd-2", "c1", "s1"))
+	if !teardown.Success {
+		t.Fatalf("TEARDOWN_EXIT failed: %s", teardown.Message)
+	}
+	testutil.ExpectNoPeers(t, wg, up.exitInterface)
+}
+
+func TestUnifiedPeerSetupExitRequiresExitMode(t *testing.T) {
+	up, _ := newTestExitModePeer(t)
+	up.currentMode = ModeClient
+
+	resp := up.handleSetupExitCommand(testutil.SetupExitCommand("cmd-1", "c1", testutil.PublicKey(t), "s1"))
+	if resp.Success {
+		t.Fatal("SETUP_EXIT succeeded in client mode")
+	}
+}
+
+// exitRequestStream is a control stream that records what the peer sends and
+// passes on the exit requests, so the test can answer them as the SuperNode
+type exitRequestStream struct {
+	recordingControlStream
+	requests chan *proto.ExitRequest
+}
+
+func (s *exitRequestStream) Send(msg *proto.ControlMessage) error {
+	s.sent = append(s.sent, msg)
+	if req := msg.GetExitRequest(); req != nil {
+		s.requests <- req
+	}
+	return nil
+}
+
+func TestUnifiedPeerConnectToExitLetsModeChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		switchTo PeerMode
+	}{
+		{name: "mode unchanged", switchTo: ModeClient},
+		{name: "switched to exit mode", switchTo: ModeExit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, err := NewUnifiedPeer("u1", "r1", "127.0.0.1:1", 51821, utils.NewMemoryWireGuardBackend(), utils.NewMemoryFirewall(), testutil.Keystore(t), utils.InsecureCredentials(), testutil.Logger())
+			if err != nil {
+				t.Fatalf("NewUnifiedPeer: %v", err)
+			}
+			if err := up.initializeClientMode(); err != nil {
+				t.Fatalf("initializeClientMode: %v", err)
+			}
+			up.currentMode = ModeClient
+
+			stream := &exitRequestStream{requests: make(chan *proto.ExitRequest, 1)}
+			up.streamManager.stream = stream
+			up.streamManager.isConnected.Store(true)
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := up.ConnectToExit("r2")
+				done <- err
+			}()
+
+			var req *proto.ExitRequest
+			select {
+			case req = <-stream.requests:
+			case <-time.After(5 * time.Second):
+				t.Fatal("no exit request was sent")
+			}
+
+			// The mode can be switched while the SuperNode picks an exit
+			switched := make(chan struct{})
+			go func() {
+				up.modeMutex.Lock()
+				up.currentMode = tt.switchTo
+				up.modeMutex.Unlock()
+				close(switched)
+			}()
+			select {
+			case <-switched:
+			case <-time.After(5 * time.Second):
+				t.Fatal("mode switch blocked by a pending exit request")
+			}
+
+			up.streamManager.handleMessage(&proto.ControlMessage{
+				Payload: &proto.ControlMessage_ExitAssignment{
+					ExitAssignment: &proto.ExitAssignment{
+						RequestId: req.RequestId,
+						Success:   true,
+						SessionId: "s1",
+						ExitPeer: &proto.ExitPeerInfo{
+							PeerId:     "exit-1",
+							PublicKey:  testutil.PublicKey(t),
+							Endpoint:   "198.51.100.1:51820",
+							AllowedIps: utils.FullTunnelAllowedIPs(),
+						},
+						AllocatedIp: "10.8.0.2",
+					},
+				},
+			})
+
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("ConnectToExit did not return after the assignment")
+			}
+
+			var confirm *proto.ExitConfirm
+			for _, msg := range stream.sent {
+				if c := msg.GetExitConfirm(); c != nil {
+					confirm = c
+				}
+			}
+			changed := tt.switchTo != ModeClient
+			if changed != (err != nil) {
+				t.Fatalf("ConnectToExit returned %v, want an error: %v", err, changed)
+			}
+			if confirm == nil || confirm.SessionId != "s1" || confirm.Success == changed {
+				t.Fatalf("confirmed %v, want s1 confirmed with success %v", confirm, !changed)
+			}
+		})
+	}
+}
+
+func TestUnifiedPeerSetupExitRejectsItself(t *testing.T) {
+	up, _ := newTestExitModePeer(t)
+
+	resp := up.handleSetupExitCommand(testutil.SetupExitCommand("cmd-1", "u1", up.clientPrivateKey.PublicKey().String(), "s1"))
+	if resp.Success {
+		t.Fatal("peer was set up as its own exit")
+	}
+}
+
+func TestUnifiedPeerServesExitClientsFromHybridPool(t *testing.T) {
+	up, _ := newTestExitModePeer(t)
+
+	resp := up.handleSetupExitCommand(testutil.SetupExitCommand("cmd-1", "c1", testutil.PublicKey(t), "s1"))
+	if !resp.Success {
+		t.Fatalf("SETUP_EXIT failed: %s", resp.Message)
+	}
+
+	pools := map[string]string{
+		resp.Result["allocated_ip"]:  utils.HybridExitPoolIPv4,
+		resp.Result["allocated_ip6"]: utils.HybridExitPoolIPv6,
+	}
+	for ip, cidr := range pools {
+		if !netip.MustParsePrefix(cidr).Contains(netip.MustParseAddr(ip)) {
+			t.Fatalf("exit client address %s is outside %s", ip, cidr)
+		}
+	}
+}
+
+func TestUnifiedPeerNeverLeasesOwnTunnelAddress(t *testing.T) {
+	up, _ := newTestExitModePeer(t)
+	up.currentMode = ModeHybrid
+
+	// Our own tunnel runs through another unified peer, whose exit clients
+	// are numbered from the same hybrid pool
+	if _, err := up.reserveOwnAddresses("10.10.0.2", "fd4d:7976:706e:a::2"); err != nil {
+		t.Fatalf("reserveOwnAddresses: %v", err)
+	}
+
+	var leased []string
+	for i, clientID := range []string{"c1", "c2"} {
+		resp := up.handleSetupExitCommand(testutil.SetupExitCommand(fmt.Sprintf("cmd-%d", i+1), clientID, testutil.PublicKey(t), "s-"+clientID))
+		if !resp.Success {
+			t.Fatalf("SETUP_EXIT failed: %s", resp.Message)
+		}
+		if ip, ip6 := resp.Result["allocated_ip"], resp.Result["allocated_ip6"]; ip == "10.10.0.2" || ip6 == "fd4d:7976:706e:a::2" {
+			t.Fatalf("exit client %s was given our own tunnel address", clientID)
+		}
+		leased = append(leased, resp.Result["allocated_ip"])
+	}
+
+	// An exit that assigns us the address of one of our exit clients is refused
+	rotate := up.handleRotatePeerCommand(&proto.Command{
+		CommandId: "cmd-3",
+		Type:      proto.CommandType_ROTATE_PEER,
+		Payload: map[string]string{
+			"exit_peer_id": "u2",
+			"public_key":   testutil.PublicKey(t),
+			"endpoint":     "127.0.0.1:51822",
+			"allocated_ip": leased[0],
+			"session_id":   "s2",
+		},
+	})
+	if rotate.Success {
+		t.Fatal("rotated to a tunnel address leased to an exit client")
+	}
+	if !strings.Contains(rotate.Message, "in use by an exit client") {
+		t.Fatalf("rotation refused with %q, want the leased address named", rotate.Message)
+	}
+}
+
+func TestUnifiedPeerRoutesExitClientsForBothFamilies(t *testing.T) {
+	up, _ := newTestExitModePeer(t)
+
+	fw := up.firewall.(*utils.MemoryFirewall)
+	ruleSet, ok := fw.RuleSet(up.exitRuleSetID())
+	if !ok {
+		t.Fatal("exit rule set was not applied")
+	}
+
+	families := map[utils.AddressFamily]bool{}
+	for _, rule := range ruleSet.Routing {
+		if rule.InInterface != up.exitInterface || rule.Table != "main" {
+			t.Fatalf("routing rule %+v, want exit interface %s looked up in main", rule, up.exitInterface)
+		}
+		families[rule.Family] = true
+	}
+	if !families[utils.FamilyIPv4] || !families[utils.FamilyIPv6] {
+		t.Fatalf("routing rules %+v, want one for IPv4 and one for IPv6", ruleSet.Routing)
+	}
+}
@@ -24,10 +24,12 @@ const (
 type CommandType int32
 
 const (
-	CommandType_SETUP_EXIT  CommandType = 0
-	CommandType_ROTATE_PEER CommandType = 1
-	CommandType_RELAY_SETUP CommandType = 2
-	CommandType_DISCONNECT  CommandType = 3
+	CommandType_SETUP_EXIT    CommandType = 0
+	CommandType_ROTATE_PEER   CommandType = 1
+	CommandType_RELAY_SETUP   CommandType = 2
+	CommandType_DISCONNECT    CommandType = 3
+	CommandType_ACTIVATE_EXIT CommandType = 4 // Client confirmed the session; the exit keeps it
+	CommandType_TEARDOWN_EXIT CommandType = 5 // Undo SETUP_EXIT for a session
 )
 
 // Enum value maps for CommandType.
@@ -37,12 +39,16 @@ var (
 		1: "ROTATE_PEER",
 		2: "RELAY_SETUP",
 		3: "DISCONNECT",
+		4: "ACTIVATE_EXIT",
+		5: "TEARDOWN_EXIT",
 	}
 	CommandType_value = map[string]int32{
-		"SETUP_EXIT":  0,
-		"ROTATE_PEER": 1,
-		"RELAY_SETUP": 2,
-		"DISCONNECT":  3,
+		"SETUP_EXIT":    0,
+		"ROTATE_PEER":   1,
+		"RELAY_SETUP":   2,
+		"DISCONNECT":    3,
+		"ACTIVATE_EXIT": 4,
+		"TEARDOWN_EXIT": 5,
 	}
 )
 
@@ -87,6 +93,14 @@ type ControlMessage struct {
 	//	*ControlMessage_CommandResponse
 	//	*ControlMessage_InfoRequest
 	//	*ControlMessage_InfoResponse
+	//	*ControlMessage_ExitRequest
+	//	*ControlMessage_ExitAssignment
+	//	*ControlMessage_AuthChallenge
+	//	*ControlMessage_ExitConfirm
+	//	*ControlMessage_RoleUpdate
+	//	*ControlMessage_RoleUpdateAck
+	//	*ControlMessage_ExitResume
+	//	*ControlMessage_ExitResumeAck
 	Payload       isControlMessage_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -215,6 +229,78 @@ func (x *ControlMessage) GetInfoResponse() *InfoResponse {
 	return nil
 }
 
+func (x *ControlMessage) GetExitRequest() *ExitRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_ExitRequest); ok {
+			return x.ExitRequest
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetExitAssignment() *ExitAssignment {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_ExitAssignment); ok {
+			return x.ExitAssignment
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetAuthChallenge() *AuthChallenge {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_AuthChallenge); ok {
+			return x.AuthChallenge
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetExitConfirm() *ExitConfirm {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_ExitConfirm); ok {
+			return x.ExitConfirm
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetRoleUpdate() *RoleUpdate {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_RoleUpdate); ok {
+			return x.RoleUpdate
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetRoleUpdateAck() *RoleUpdateAck {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_RoleUpdateAck); ok {
+			return x.RoleUpdateAck
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetExitResume() *ExitResume {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_ExitResume); ok {
+			return x.ExitResume
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetExitResumeAck() *ExitResumeAck {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_ExitResumeAck); ok {
+			return x.ExitResumeAck
+		}
+	}
+	return nil
+}
+
 type isControlMessage_Payload interface {
 	isControlMessage_Payload()
 }
@@ -251,6 +337,38 @@ type ControlMessage_InfoResponse struct {
 	InfoResponse *InfoResponse `protobuf:"bytes,17,opt,name=info_response,json=infoResponse,proto3,oneof"`
 }
 
+type ControlMessage_ExitRequest struct {
+	ExitRequest *ExitRequest `protobuf:"bytes,18,opt,name=exit_request,json=exitRequest,proto3,oneof"`
+}
+
+type ControlMessage_ExitAssignment struct {
+	ExitAssignment *ExitAssignment `protobuf:"bytes,19,opt,name=exit_assignment,json=exitAssignment,proto3,oneof"`
+}
+
+type ControlMessage_AuthChallenge struct {
+	AuthChallenge *AuthChallenge `protobuf:"bytes,20,opt,name=auth_challenge,json=authChallenge,proto3,oneof"`
+}
+
+type ControlMessage_ExitConfirm struct {
+	ExitConfirm *ExitConfirm `protobuf:"bytes,21,opt,name=exit_confirm,json=exitConfirm,proto3,oneof"`
+}
+
+type ControlMessage_RoleUpdate struct {
+	RoleUpdate *RoleUpdate `protobuf:"bytes,22,opt,name=role_update,json=roleUpdate,proto3,oneof"`
+}
+
+type ControlMessage_RoleUpdateAck struct {
+	RoleUpdateAck *RoleUpdateAck `protobuf:"bytes,23,opt,name=role_update_ack,json=roleUpdateAck,proto3,oneof"`
+}
+
+type ControlMessage_ExitResume struct {
+	ExitResume *ExitResume `protobuf:"bytes,24,opt,name=exit_resume,json=exitResume,proto3,oneof"`
+}
+
+type ControlMessage_ExitResumeAck struct {
+	ExitResumeAck *ExitResumeAck `protobuf:"bytes,25,opt,name=exit_resume_ack,json=exitResumeAck,proto3,oneof"`
+}
+
 func (*ControlMessage_AuthRequest) isControlMessage_Payload() {}
 
 func (*ControlMessage_AuthResponse) isControlMessage_Payload() {}
@@ -267,21 +385,92 @@ func (*ControlMessage_InfoRequest) isControlMessage_Payload() {}
 
 func (*ControlMessage_InfoResponse) isControlMessage_Payload() {}
 
+func (*ControlMessage_ExitRequest) isControlMessage_Payload() {}
+
+func (*ControlMessage_ExitAssignment) isControlMessage_Payload() {}
+
+func (*ControlMessage_AuthChallenge) isControlMessage_Payload() {}
+
+func (*ControlMessage_ExitConfirm) isControlMessage_Payload() {}
+
+func (*ControlMessage_RoleUpdate) isControlMessage_Payload() {}
+
+func (*ControlMessage_RoleUpdateAck) isControlMessage_Payload() {}
+
+func (*ControlMessage_ExitResume) isControlMessage_Payload() {}
+
+func (*ControlMessage_ExitResumeAck) isControlMessage_Payload() {}
+
+// Sent by the SuperNode as soon as a stream opens; the peer must sign the nonce
+type AuthChallenge struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nonce         string                 `protobuf:"bytes,1,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	ExpiresAt     int64                  `protobuf:"varint,2,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"` // Unix seconds
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthChallenge) Reset() {
+	*x = AuthChallenge{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthChallenge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthChallenge) ProtoMessage() {}
+
+func (x *AuthChallenge) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthChallenge.ProtoReflect.Descriptor instead.
+func (*AuthChallenge) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AuthChallenge) GetNonce() string {
+	if x != nil {
+		return x.Nonce
+	}
+	return ""
+}
+
+func (x *AuthChallenge) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
 type AuthRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	PeerId        string                 `protobuf:"bytes,1,opt,name=peer_id,json=peerId,proto3" json:"peer_id,omitempty"`
 	Role          string                 `protobuf:"bytes,2,opt,name=role,proto3" json:"role,omitempty"` // "client", "exit", "supernode"
 	PubkeyB64     string                 `protobuf:"bytes,3,opt,name=pubkey_b64,json=pubkeyB64,proto3" json:"pubkey_b64,omitempty"`
 	Region        string                 `protobuf:"bytes,4,opt,name=region,proto3" json:"region,omitempty"`
-	Signature     string                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"` // Sign(peer_id||role||region||nonce)
-	Nonce         string                 `protobuf:"bytes,6,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Signature     string                 `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`                      // Sign(peer_id||role||region||nonce||timestamp||channel_binding)
+	Nonce         string                 `protobuf:"bytes,6,opt,name=nonce,proto3" json:"nonce,omitempty"`                              // Echo of AuthChallenge.nonce
+	Timestamp     int64                  `protobuf:"varint,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                     // Unix seconds when the request was signed
+	MaxClients    int32                  `protobuf:"varint,8,opt,name=max_clients,json=maxClients,proto3" json:"max_clients,omitempty"` // Clients an exit or hybrid peer accepts; 0 leaves it to the SuperNode
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *AuthRequest) Reset() {
 	*x = AuthRequest{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[1]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -293,7 +482,7 @@ func (x *AuthRequest) String() string {
 func (*AuthRequest) ProtoMessage() {}
 
 func (x *AuthRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[1]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -306,7 +495,7 @@ func (x *AuthRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AuthRequest.ProtoReflect.Descriptor instead.
 func (*AuthRequest) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{1}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *AuthRequest) GetPeerId() string {
@@ -351,6 +540,20 @@ func (x *AuthRequest) GetNonce() string {
 	return ""
 }
 
+func (x *AuthRequest) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *AuthRequest) GetMaxClients() int32 {
+	if x != nil {
+		return x.MaxClients
+	}
+	return 0
+}
+
 type AuthResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -362,7 +565,7 @@ type AuthResponse struct {
 
 func (x *AuthResponse) Reset() {
 	*x = AuthResponse{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[2]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -374,7 +577,7 @@ func (x *AuthResponse) String() string {
 func (*AuthResponse) ProtoMessage() {}
 
 func (x *AuthResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[2]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -387,7 +590,7 @@ func (x *AuthResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AuthResponse.ProtoReflect.Descriptor instead.
 func (*AuthResponse) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{2}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *AuthResponse) GetSuccess() bool {
@@ -421,7 +624,7 @@ type PingRequest struct {
 
 func (x *PingRequest) Reset() {
 	*x = PingRequest{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[3]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -433,7 +636,7 @@ func (x *PingRequest) String() string {
 func (*PingRequest) ProtoMessage() {}
 
 func (x *PingRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[3]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -446,7 +649,7 @@ func (x *PingRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PingRequest.ProtoReflect.Descriptor instead.
 func (*PingRequest) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{3}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *PingRequest) GetTimestamp() int64 {
@@ -474,7 +677,7 @@ type PongResponse struct {
 
 func (x *PongResponse) Reset() {
 	*x = PongResponse{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[4]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -486,7 +689,7 @@ func (x *PongResponse) String() string {
 func (*PongResponse) ProtoMessage() {}
 
 func (x *PongResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[4]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -499,7 +702,7 @@ func (x *PongResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PongResponse.ProtoReflect.Descriptor instead.
 func (*PongResponse) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{4}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *PongResponse) GetTimestamp() int64 {
@@ -534,7 +737,7 @@ type Command struct {
 
 func (x *Command) Reset() {
 	*x = Command{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[5]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -546,7 +749,7 @@ func (x *Command) String() string {
 func (*Command) ProtoMessage() {}
 
 func (x *Command) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[5]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -559,7 +762,7 @@ func (x *Command) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Command.ProtoReflect.Descriptor instead.
 func (*Command) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{5}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Command) GetCommandId() string {
@@ -595,7 +798,7 @@ type CommandResponse struct {
 
 func (x *CommandResponse) Reset() {
 	*x = CommandResponse{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[6]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -607,7 +810,7 @@ func (x *CommandResponse) String() string {
 func (*CommandResponse) ProtoMessage() {}
 
 func (x *CommandResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[6]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -620,7 +823,7 @@ func (x *CommandResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommandResponse.ProtoReflect.Descriptor instead.
 func (*CommandResponse) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{6}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *CommandResponse) GetCommandId() string {
@@ -661,7 +864,7 @@ type InfoRequest struct {
 
 func (x *InfoRequest) Reset() {
 	*x = InfoRequest{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[7]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -673,7 +876,7 @@ func (x *InfoRequest) String() string {
 func (*InfoRequest) ProtoMessage() {}
 
 func (x *InfoRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[7]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -686,7 +889,7 @@ func (x *InfoRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use InfoRequest.ProtoReflect.Descriptor instead.
 func (*InfoRequest) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{7}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *InfoRequest) GetPeerId() string {
@@ -713,7 +916,7 @@ type InfoResponse struct {
 
 func (x *InfoResponse) Reset() {
 	*x = InfoResponse{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[8]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -725,7 +928,7 @@ func (x *InfoResponse) String() string {
 func (*InfoResponse) ProtoMessage() {}
 
 func (x *InfoResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[8]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -738,7 +941,7 @@ func (x *InfoResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use InfoResponse.ProtoReflect.Descriptor instead.
 func (*InfoResponse) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{8}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *InfoResponse) GetPeerId() string {
@@ -755,31 +958,32 @@ func (x *InfoResponse) GetInfo() map[string]string {
 	return nil
 }
 
-// Inter-SuperNode communication
-type RequestExitPeerRequest struct {
-	state                 protoimpl.MessageState `protogen:"open.v1"`
-	ClientId              string                 `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
-	Region                string                 `protobuf:"bytes,2,opt,name=region,proto3" json:"region,omitempty"`
-	RequestingSupernodeId string                 `protobuf:"bytes,3,opt,name=requesting_supernode_id,json=requestingSupernodeId,proto3" json:"requesting_supernode_id,omitempty"`
-	unknownFields         protoimpl.UnknownFields
-	sizeCache             protoimpl.SizeCache
+// Client-initiated request for an exit peer in a region
+type ExitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	PeerId        string                 `protobuf:"bytes,2,opt,name=peer_id,json=peerId,proto3" json:"peer_id,omitempty"`
+	TargetRegion  string                 `protobuf:"bytes,3,opt,name=target_region,json=targetRegion,proto3" json:"target_region,omitempty"`
+	WgPublicKey   string                 `protobuf:"bytes,4,opt,name=wg_public_key,json=wgPublicKey,proto3" json:"wg_public_key,omitempty"` // Client's WireGuard public key
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *RequestExitPeerRequest) Reset() {
-	*x = RequestExitPeerRequest{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[9]
+func (x *ExitRequest) Reset() {
+	*x = ExitRequest{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RequestExitPeerRequest) String() string {
+func (x *ExitRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RequestExitPeerRequest) ProtoMessage() {}
+func (*ExitRequest) ProtoMessage() {}
 
-func (x *RequestExitPeerRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[9]
+func (x *ExitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -790,57 +994,68 @@ func (x *RequestExitPeerRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RequestExitPeerRequest.ProtoReflect.Descriptor instead.
-func (*RequestExitPeerRequest) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{9}
+// Deprecated: Use ExitRequest.ProtoReflect.Descriptor instead.
+func (*ExitRequest) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{10}
 }
 
-func (x *RequestExitPeerRequest) GetClientId() string {
+func (x *ExitRequest) GetRequestId() string {
 	if x != nil {
-		return x.ClientId
+		return x.RequestId
 	}
 	return ""
 }
 
-func (x *RequestExitPeerRequest) GetRegion() string {
+func (x *ExitRequest) GetPeerId() string {
 	if x != nil {
-		return x.Region
+		return x.PeerId
 	}
 	return ""
 }
 
-func (x *RequestExitPeerRequest) GetRequestingSupernodeId() string {
+func (x *ExitRequest) GetTargetRegion() string {
 	if x != nil {
-		return x.RequestingSupernodeId
+		return x.TargetRegion
 	}
 	return ""
 }
 
-type RequestExitPeerResponse struct {
+func (x *ExitRequest) GetWgPublicKey() string {
+	if x != nil {
+		return x.WgPublicKey
+	}
+	return ""
+}
+
+// SuperNode reply to an ExitRequest
+type ExitAssignment struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
-	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
-	ExitPeer      *ExitPeerInfo          `protobuf:"bytes,3,opt,name=exit_peer,json=exitPeer,proto3" json:"exit_peer,omitempty"`
-	SessionId     string                 `protobuf:"bytes,4,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	ExitPeer      *ExitPeerInfo          `protobuf:"bytes,4,opt,name=exit_peer,json=exitPeer,proto3" json:"exit_peer,omitempty"`
+	SessionId     string                 `protobuf:"bytes,5,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	AllocatedIp   string                 `protobuf:"bytes,6,opt,name=allocated_ip,json=allocatedIp,proto3" json:"allocated_ip,omitempty"`    // Tunnel IP assigned by the exit peer
+	AllocatedIp6  string                 `protobuf:"bytes,7,opt,name=allocated_ip6,json=allocatedIp6,proto3" json:"allocated_ip6,omitempty"` // Tunnel IPv6 address, empty if the exit has no IPv6
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *RequestExitPeerResponse) Reset() {
-	*x = RequestExitPeerResponse{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[10]
+func (x *ExitAssignment) Reset() {
+	*x = ExitAssignment{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RequestExitPeerResponse) String() string {
+func (x *ExitAssignment) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RequestExitPeerResponse) ProtoMessage() {}
+func (*ExitAssignment) ProtoMessage() {}
 
-func (x *RequestExitPeerResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[10]
+func (x *ExitAssignment) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -851,55 +1066,864 @@ func (x *RequestExitPeerResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RequestExitPeerResponse.ProtoReflect.Descriptor instead.
-func (*RequestExitPeerResponse) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{10}
+// Deprecated: Use ExitAssignment.ProtoReflect.Descriptor instead.
+func (*ExitAssignment) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *RequestExitPeerResponse) GetSuccess() bool {
+func (x *ExitAssignment) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *ExitAssignment) GetSuccess() bool {
 	if x != nil {
 		return x.Success
 	}
 	return false
 }
 
-func (x *RequestExitPeerResponse) GetMessage() string {
+func (x *ExitAssignment) GetMessage() string {
 	if x != nil {
 		return x.Message
 	}
 	return ""
 }
 
-func (x *RequestExitPeerResponse) GetExitPeer() *ExitPeerInfo {
+func (x *ExitAssignment) GetExitPeer() *ExitPeerInfo {
 	if x != nil {
 		return x.ExitPeer
 	}
 	return nil
 }
 
-func (x *RequestExitPeerResponse) GetSessionId() string {
+func (x *ExitAssignment) GetSessionId() string {
 	if x != nil {
 		return x.SessionId
 	}
 	return ""
 }
 
-type ExitPeerInfo struct {
-	state                    protoimpl.MessageState `protogen:"open.v1"`
-	PeerId                   string                 `protobuf:"bytes,1,opt,name=peer_id,json=peerId,proto3" json:"peer_id,omitempty"`
-	PublicKey                string                 `protobuf:"bytes,2,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
-	Endpoint                 string                 `protobuf:"bytes,3,opt,name=endpoint,proto3" json:"endpoint,omitempty"` // IP:port
-	AllowedIps               []string               `protobuf:"bytes,4,rep,name=allowed_ips,json=allowedIps,proto3" json:"allowed_ips,omitempty"`
-	SupportsDirectConnection bool                   `protobuf:"varint,5,opt,name=supports_direct_connection,json=supportsDirectConnection,proto3" json:"supports_direct_connection,omitempty"`
-	unknownFields            protoimpl.UnknownFields
-	sizeCache                protoimpl.SizeCache
+func (x *ExitAssignment) GetAllocatedIp() string {
+	if x != nil {
+		return x.AllocatedIp
+	}
+	return ""
 }
 
-func (x *ExitPeerInfo) Reset() {
-	*x = ExitPeerInfo{}
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[11]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *ExitAssignment) GetAllocatedIp6() string {
+	if x != nil {
+		return x.AllocatedIp6
+	}
+	return ""
+}
+
+// Sent by a client once it has applied (or failed to apply) an ExitAssignment.
+// The SuperNode tears the exit session down unless it is confirmed in time.
+// success=false for an active session means the client disconnected from the
+// exit, and releases it.
+type ExitConfirm struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExitConfirm) Reset() {
+	*x = ExitConfirm{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExitConfirm) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExitConfirm) ProtoMessage() {}
+
+func (x *ExitConfirm) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExitConfirm.ProtoReflect.Descriptor instead.
+func (*ExitConfirm) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ExitConfirm) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *ExitConfirm) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ExitConfirm) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// Sent by a peer to change its role on the open stream, e.g. when exit mode
+// is toggled. Leaving the exit role first moves the peer's exit clients away.
+type RoleUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Role          string                 `protobuf:"bytes,2,opt,name=role,proto3" json:"role,omitempty"`                                // "client", "exit" or "hybrid"
+	MaxClients    int32                  `protobuf:"varint,3,opt,name=max_clients,json=maxClients,proto3" json:"max_clients,omitempty"` // As in AuthRequest
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoleUpdate) Reset() {
+	*x = RoleUpdate{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoleUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoleUpdate) ProtoMessage() {}
+
+func (x *RoleUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoleUpdate.ProtoReflect.Descriptor instead.
+func (*RoleUpdate) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RoleUpdate) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *RoleUpdate) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *RoleUpdate) GetMaxClients() int32 {
+	if x != nil {
+		return x.MaxClients
+	}
+	return 0
+}
+
+type RoleUpdateAck struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	RequestId       string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Success         bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Message         string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Role            string                 `protobuf:"bytes,4,opt,name=role,proto3" json:"role,omitempty"`                                               // Role the SuperNode now has for the peer
+	MigratedClients int32                  `protobuf:"varint,5,opt,name=migrated_clients,json=migratedClients,proto3" json:"migrated_clients,omitempty"` // Exit clients moved to another exit
+	ReleasedClients int32                  `protobuf:"varint,6,opt,name=released_clients,json=releasedClients,proto3" json:"released_clients,omitempty"` // Exit clients that could not be moved and lost their exit
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *RoleUpdateAck) Reset() {
+	*x = RoleUpdateAck{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoleUpdateAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoleUpdateAck) ProtoMessage() {}
+
+func (x *RoleUpdateAck) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoleUpdateAck.ProtoReflect.Descriptor instead.
+func (*RoleUpdateAck) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RoleUpdateAck) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *RoleUpdateAck) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *RoleUpdateAck) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *RoleUpdateAck) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *RoleUpdateAck) GetMigratedClients() int32 {
+	if x != nil {
+		return x.MigratedClients
+	}
+	return 0
+}
+
+func (x *RoleUpdateAck) GetReleasedClients() int32 {
+	if x != nil {
+		return x.ReleasedClients
+	}
+	return 0
+}
+
+// Sent by a client that reconnected to another SuperNode while it still uses
+// an exit session tracked by the previous one. The new SuperNode claims the
+// session, so that the previous one does not release it once the client's
+// reconnect grace runs out.
+type ExitResume struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	SessionId     string                 `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	HomeSupernode string                 `protobuf:"bytes,3,opt,name=home_supernode,json=homeSupernode,proto3" json:"home_supernode,omitempty"` // Address of the SuperNode the session was confirmed or last resumed on
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExitResume) Reset() {
+	*x = ExitResume{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExitResume) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExitResume) ProtoMessage() {}
+
+func (x *ExitResume) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExitResume.ProtoReflect.Descriptor instead.
+func (*ExitResume) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ExitResume) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *ExitResume) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *ExitResume) GetHomeSupernode() string {
+	if x != nil {
+		return x.HomeSupernode
+	}
+	return ""
+}
+
+type ExitResumeAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExitResumeAck) Reset() {
+	*x = ExitResumeAck{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExitResumeAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExitResumeAck) ProtoMessage() {}
+
+func (x *ExitResumeAck) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExitResumeAck.ProtoReflect.Descriptor instead.
+func (*ExitResumeAck) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ExitResumeAck) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *ExitResumeAck) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ExitResumeAck) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// Inter-SuperNode communication
+type RequestExitPeerRequest struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	ClientId              string                 `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Region                string                 `protobuf:"bytes,2,opt,name=region,proto3" json:"region,omitempty"`
+	RequestingSupernodeId string                 `protobuf:"bytes,3,opt,name=requesting_supernode_id,json=requestingSupernodeId,proto3" json:"requesting_supernode_id,omitempty"`
+	ClientPubkey          string                 `protobuf:"bytes,4,opt,name=client_pubkey,json=clientPubkey,proto3" json:"client_pubkey,omitempty"`         // Client's WireGuard public key
+	ExcludePeerIds        []string               `protobuf:"bytes,5,rep,name=exclude_peer_ids,json=excludePeerIds,proto3" json:"exclude_peer_ids,omitempty"` // Exit peers not to pick, e.g. the one a client is rotating away from
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *RequestExitPeerRequest) Reset() {
+	*x = RequestExitPeerRequest{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestExitPeerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestExitPeerRequest) ProtoMessage() {}
+
+func (x *RequestExitPeerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestExitPeerRequest.ProtoReflect.Descriptor instead.
+func (*RequestExitPeerRequest) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *RequestExitPeerRequest) GetClientId() string {
+	if x != nil {
+		return x.ClientId
+	}
+	return ""
+}
+
+func (x *RequestExitPeerRequest) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *RequestExitPeerRequest) GetRequestingSupernodeId() string {
+	if x != nil {
+		return x.RequestingSupernodeId
+	}
+	return ""
+}
+
+func (x *RequestExitPeerRequest) GetClientPubkey() string {
+	if x != nil {
+		return x.ClientPubkey
+	}
+	return ""
+}
+
+func (x *RequestExitPeerRequest) GetExcludePeerIds() []string {
+	if x != nil {
+		return x.ExcludePeerIds
+	}
+	return nil
+}
+
+type RequestExitPeerResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	ExitPeer      *ExitPeerInfo          `protobuf:"bytes,3,opt,name=exit_peer,json=exitPeer,proto3" json:"exit_peer,omitempty"`
+	SessionId     string                 `protobuf:"bytes,4,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	AllocatedIp   string                 `protobuf:"bytes,5,opt,name=allocated_ip,json=allocatedIp,proto3" json:"allocated_ip,omitempty"`    // Tunnel IP assigned by the exit peer
+	AllocatedIp6  string                 `protobuf:"bytes,6,opt,name=allocated_ip6,json=allocatedIp6,proto3" json:"allocated_ip6,omitempty"` // Tunnel IPv6 address, empty if the exit has no IPv6
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequestExitPeerResponse) Reset() {
+	*x = RequestExitPeerResponse{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestExitPeerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestExitPeerResponse) ProtoMessage() {}
+
+func (x *RequestExitPeerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestExitPeerResponse.ProtoReflect.Descriptor instead.
+func (*RequestExitPeerResponse) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *RequestExitPeerResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *RequestExitPeerResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *RequestExitPeerResponse) GetExitPeer() *ExitPeerInfo {
+	if x != nil {
+		return x.ExitPeer
+	}
+	return nil
+}
+
+func (x *RequestExitPeerResponse) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *RequestExitPeerResponse) GetAllocatedIp() string {
+	if x != nil {
+		return x.AllocatedIp
+	}
+	return ""
+}
+
+func (x *RequestExitPeerResponse) GetAllocatedIp6() string {
+	if x != nil {
+		return x.AllocatedIp6
+	}
+	return ""
+}
+
+// Forwards a client's ExitConfirm to the SuperNode that owns the exit
+type ConfirmExitPeerRequest struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	SessionId             string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	RequestingSupernodeId string                 `protobuf:"bytes,2,opt,name=requesting_supernode_id,json=requestingSupernodeId,proto3" json:"requesting_supernode_id,omitempty"`
+	Success               bool                   `protobuf:"varint,3,opt,name=success,proto3" json:"success,omitempty"`
+	Message               string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *ConfirmExitPeerRequest) Reset() {
+	*x = ConfirmExitPeerRequest{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfirmExitPeerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfirmExitPeerRequest) ProtoMessage() {}
+
+func (x *ConfirmExitPeerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfirmExitPeerRequest.ProtoReflect.Descriptor instead.
+func (*ConfirmExitPeerRequest) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ConfirmExitPeerRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *ConfirmExitPeerRequest) GetRequestingSupernodeId() string {
+	if x != nil {
+		return x.RequestingSupernodeId
+	}
+	return ""
+}
+
+func (x *ConfirmExitPeerRequest) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ConfirmExitPeerRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type ConfirmExitPeerResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfirmExitPeerResponse) Reset() {
+	*x = ConfirmExitPeerResponse{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfirmExitPeerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfirmExitPeerResponse) ProtoMessage() {}
+
+func (x *ConfirmExitPeerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfirmExitPeerResponse.ProtoReflect.Descriptor instead.
+func (*ConfirmExitPeerResponse) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ConfirmExitPeerResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ConfirmExitPeerResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// Claims an active exit session of a client that failed over to the
+// requesting SuperNode. The SuperNode giving the session up keeps the exit
+// set up on behalf of the requesting one, or hands the session back if the
+// requesting SuperNode owns the exit.
+type ClaimExitSessionRequest struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	SessionId             string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	ClientId              string                 `protobuf:"bytes,2,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	RequestingSupernodeId string                 `protobuf:"bytes,3,opt,name=requesting_supernode_id,json=requestingSupernodeId,proto3" json:"requesting_supernode_id,omitempty"`
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *ClaimExitSessionRequest) Reset() {
+	*x = ClaimExitSessionRequest{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClaimExitSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClaimExitSessionRequest) ProtoMessage() {}
+
+func (x *ClaimExitSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClaimExitSessionRequest.ProtoReflect.Descriptor instead.
+func (*ClaimExitSessionRequest) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ClaimExitSessionRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *ClaimExitSessionRequest) GetClientId() string {
+	if x != nil {
+		return x.ClientId
+	}
+	return ""
+}
+
+func (x *ClaimExitSessionRequest) GetRequestingSupernodeId() string {
+	if x != nil {
+		return x.RequestingSupernodeId
+	}
+	return ""
+}
+
+type ClaimExitSessionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	SupernodeId   string                 `protobuf:"bytes,3,opt,name=supernode_id,json=supernodeId,proto3" json:"supernode_id,omitempty"` // SuperNode that gave the session up
+	Returned      bool                   `protobuf:"varint,4,opt,name=returned,proto3" json:"returned,omitempty"`                         // The requesting SuperNode owns the exit and tracks the session again
+	ClientPubkey  string                 `protobuf:"bytes,5,opt,name=client_pubkey,json=clientPubkey,proto3" json:"client_pubkey,omitempty"`
+	Region        string                 `protobuf:"bytes,6,opt,name=region,proto3" json:"region,omitempty"`
+	ExitPeer      *ExitPeerInfo          `protobuf:"bytes,7,opt,name=exit_peer,json=exitPeer,proto3" json:"exit_peer,omitempty"`
+	AllocatedIp   string                 `protobuf:"bytes,8,opt,name=allocated_ip,json=allocatedIp,proto3" json:"allocated_ip,omitempty"`
+	AllocatedIp6  string                 `protobuf:"bytes,9,opt,name=allocated_ip6,json=allocatedIp6,proto3" json:"allocated_ip6,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClaimExitSessionResponse) Reset() {
+	*x = ClaimExitSessionResponse{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClaimExitSessionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClaimExitSessionResponse) ProtoMessage() {}
+
+func (x *ClaimExitSessionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClaimExitSessionResponse.ProtoReflect.Descriptor instead.
+func (*ClaimExitSessionResponse) Descriptor() ([]byte, []int) {
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ClaimExitSessionResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *ClaimExitSessionResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ClaimExitSessionResponse) GetSupernodeId() string {
+	if x != nil {
+		return x.SupernodeId
+	}
+	return ""
+}
+
+func (x *ClaimExitSessionResponse) GetReturned() bool {
+	if x != nil {
+		return x.Returned
+	}
+	return false
+}
+
+func (x *ClaimExitSessionResponse) GetClientPubkey() string {
+	if x != nil {
+		return x.ClientPubkey
+	}
+	return ""
+}
+
+func (x *ClaimExitSessionResponse) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *ClaimExitSessionResponse) GetExitPeer() *ExitPeerInfo {
+	if x != nil {
+		return x.ExitPeer
+	}
+	return nil
+}
+
+func (x *ClaimExitSessionResponse) GetAllocatedIp() string {
+	if x != nil {
+		return x.AllocatedIp
+	}
+	return ""
+}
+
+func (x *ClaimExitSessionResponse) GetAllocatedIp6() string {
+	if x != nil {
+		return x.AllocatedIp6
+	}
+	return ""
+}
+
+type ExitPeerInfo struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	PeerId                   string                 `protobuf:"bytes,1,opt,name=peer_id,json=peerId,proto3" json:"peer_id,omitempty"`
+	PublicKey                string                 `protobuf:"bytes,2,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	Endpoint                 string                 `protobuf:"bytes,3,opt,name=endpoint,proto3" json:"endpoint,omitempty"` // IP:port
+	AllowedIps               []string               `protobuf:"bytes,4,rep,name=allowed_ips,json=allowedIps,proto3" json:"allowed_ips,omitempty"`
+	SupportsDirectConnection bool                   `protobuf:"varint,5,opt,name=supports_direct_connection,json=supportsDirectConnection,proto3" json:"supports_direct_connection,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *ExitPeerInfo) Reset() {
+	*x = ExitPeerInfo{}
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *ExitPeerInfo) String() string {
@@ -909,7 +1933,7 @@ func (x *ExitPeerInfo) String() string {
 func (*ExitPeerInfo) ProtoMessage() {}
 
 func (x *ExitPeerInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_clientPeer_proto_super_node_proto_msgTypes[11]
+	mi := &file_clientPeer_proto_super_node_proto_msgTypes[23]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -922,7 +1946,7 @@ func (x *ExitPeerInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ExitPeerInfo.ProtoReflect.Descriptor instead.
 func (*ExitPeerInfo) Descriptor() ([]byte, []int) {
-	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{11}
+	return file_clientPeer_proto_super_node_proto_rawDescGZIP(), []int{23}
 }
 
 func (x *ExitPeerInfo) GetPeerId() string {
@@ -964,7 +1988,7 @@ var File_clientPeer_proto_super_node_proto protoreflect.FileDescriptor
 
 const file_clientPeer_proto_super_node_proto_rawDesc = "" +
 	"\n" +
-	"!clientPeer/proto/super_node.proto\x12\acontrol\"\xb8\x04\n" +
+	"!clientPeer/proto/super_node.proto\x12\acontrol\"\xa7\b\n" +
 	"\x0eControlMessage\x12\x1d\n" +
 	"\n" +
 	"message_id\x18\x01 \x01(\tR\tmessageId\x12\x1c\n" +
@@ -977,8 +2001,22 @@ const file_clientPeer_proto_super_node_proto_rawDesc = "" +
 	"\acommand\x18\x0e \x01(\v2\x10.control.CommandH\x00R\acommand\x12E\n" +
 	"\x10command_response\x18\x0f \x01(\v2\x18.control.CommandResponseH\x00R\x0fcommandResponse\x129\n" +
 	"\finfo_request\x18\x10 \x01(\v2\x14.control.InfoRequestH\x00R\vinfoRequest\x12<\n" +
-	"\rinfo_response\x18\x11 \x01(\v2\x15.control.InfoResponseH\x00R\finfoResponseB\t\n" +
-	"\apayload\"\xa5\x01\n" +
+	"\rinfo_response\x18\x11 \x01(\v2\x15.control.InfoResponseH\x00R\finfoResponse\x129\n" +
+	"\fexit_request\x18\x12 \x01(\v2\x14.control.ExitRequestH\x00R\vexitRequest\x12B\n" +
+	"\x0fexit_assignment\x18\x13 \x01(\v2\x17.control.ExitAssignmentH\x00R\x0eexitAssignment\x12?\n" +
+	"\x0eauth_challenge\x18\x14 \x01(\v2\x16.control.AuthChallengeH\x00R\rauthChallenge\x129\n" +
+	"\fexit_confirm\x18\x15 \x01(\v2\x14.control.ExitConfirmH\x00R\vexitConfirm\x126\n" +
+	"\vrole_update\x18\x16 \x01(\v2\x13.control.RoleUpdateH\x00R\n" +
+	"roleUpdate\x12@\n" +
+	"\x0frole_update_ack\x18\x17 \x01(\v2\x16.control.RoleUpdateAckH\x00R\rroleUpdateAck\x126\n" +
+	"\vexit_resume\x18\x18 \x01(\v2\x13.control.ExitResumeH\x00R\n" +
+	"exitResume\x12@\n" +
+	"\x0fexit_resume_ack\x18\x19 \x01(\v2\x16.control.ExitResumeAckH\x00R\rexitResumeAckB\t\n" +
+	"\apayload\"D\n" +
+	"\rAuthChallenge\x12\x14\n" +
+	"\x05nonce\x18\x01 \x01(\tR\x05nonce\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x02 \x01(\x03R\texpiresAt\"\xe4\x01\n" +
 	"\vAuthRequest\x12\x17\n" +
 	"\apeer_id\x18\x01 \x01(\tR\x06peerId\x12\x12\n" +
 	"\x04role\x18\x02 \x01(\tR\x04role\x12\x1d\n" +
@@ -986,7 +2024,10 @@ const file_clientPeer_proto_super_node_proto_rawDesc = "" +
 	"pubkey_b64\x18\x03 \x01(\tR\tpubkeyB64\x12\x16\n" +
 	"\x06region\x18\x04 \x01(\tR\x06region\x12\x1c\n" +
 	"\tsignature\x18\x05 \x01(\tR\tsignature\x12\x14\n" +
-	"\x05nonce\x18\x06 \x01(\tR\x05nonce\"a\n" +
+	"\x05nonce\x18\x06 \x01(\tR\x05nonce\x12\x1c\n" +
+	"\ttimestamp\x18\a \x01(\x03R\ttimestamp\x12\x1f\n" +
+	"\vmax_clients\x18\b \x01(\x05R\n" +
+	"maxClients\"a\n" +
 	"\fAuthResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1d\n" +
@@ -1024,17 +2065,93 @@ const file_clientPeer_proto_super_node_proto_rawDesc = "" +
 	"\x04info\x18\x02 \x03(\v2\x1f.control.InfoResponse.InfoEntryR\x04info\x1a7\n" +
 	"\tInfoEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x85\x01\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8e\x01\n" +
+	"\vExitRequest\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x17\n" +
+	"\apeer_id\x18\x02 \x01(\tR\x06peerId\x12#\n" +
+	"\rtarget_region\x18\x03 \x01(\tR\ftargetRegion\x12\"\n" +
+	"\rwg_public_key\x18\x04 \x01(\tR\vwgPublicKey\"\xfe\x01\n" +
+	"\x0eExitAssignment\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x122\n" +
+	"\texit_peer\x18\x04 \x01(\v2\x15.control.ExitPeerInfoR\bexitPeer\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x05 \x01(\tR\tsessionId\x12!\n" +
+	"\fallocated_ip\x18\x06 \x01(\tR\vallocatedIp\x12#\n" +
+	"\rallocated_ip6\x18\a \x01(\tR\fallocatedIp6\"`\n" +
+	"\vExitConfirm\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"`\n" +
+	"\n" +
+	"RoleUpdate\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x12\n" +
+	"\x04role\x18\x02 \x01(\tR\x04role\x12\x1f\n" +
+	"\vmax_clients\x18\x03 \x01(\x05R\n" +
+	"maxClients\"\xcc\x01\n" +
+	"\rRoleUpdateAck\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x12\n" +
+	"\x04role\x18\x04 \x01(\tR\x04role\x12)\n" +
+	"\x10migrated_clients\x18\x05 \x01(\x05R\x0fmigratedClients\x12)\n" +
+	"\x10released_clients\x18\x06 \x01(\x05R\x0freleasedClients\"q\n" +
+	"\n" +
+	"ExitResume\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\x12%\n" +
+	"\x0ehome_supernode\x18\x03 \x01(\tR\rhomeSupernode\"b\n" +
+	"\rExitResumeAck\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"\xd4\x01\n" +
 	"\x16RequestExitPeerRequest\x12\x1b\n" +
 	"\tclient_id\x18\x01 \x01(\tR\bclientId\x12\x16\n" +
 	"\x06region\x18\x02 \x01(\tR\x06region\x126\n" +
-	"\x17requesting_supernode_id\x18\x03 \x01(\tR\x15requestingSupernodeId\"\xa0\x01\n" +
+	"\x17requesting_supernode_id\x18\x03 \x01(\tR\x15requestingSupernodeId\x12#\n" +
+	"\rclient_pubkey\x18\x04 \x01(\tR\fclientPubkey\x12(\n" +
+	"\x10exclude_peer_ids\x18\x05 \x03(\tR\x0eexcludePeerIds\"\xe8\x01\n" +
 	"\x17RequestExitPeerResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x122\n" +
 	"\texit_peer\x18\x03 \x01(\v2\x15.control.ExitPeerInfoR\bexitPeer\x12\x1d\n" +
 	"\n" +
-	"session_id\x18\x04 \x01(\tR\tsessionId\"\xc1\x01\n" +
+	"session_id\x18\x04 \x01(\tR\tsessionId\x12!\n" +
+	"\fallocated_ip\x18\x05 \x01(\tR\vallocatedIp\x12#\n" +
+	"\rallocated_ip6\x18\x06 \x01(\tR\fallocatedIp6\"\xa3\x01\n" +
+	"\x16ConfirmExitPeerRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x126\n" +
+	"\x17requesting_supernode_id\x18\x02 \x01(\tR\x15requestingSupernodeId\x12\x18\n" +
+	"\asuccess\x18\x03 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage\"M\n" +
+	"\x17ConfirmExitPeerResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x8d\x01\n" +
+	"\x17ClaimExitSessionRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1b\n" +
+	"\tclient_id\x18\x02 \x01(\tR\bclientId\x126\n" +
+	"\x17requesting_supernode_id\x18\x03 \x01(\tR\x15requestingSupernodeId\"\xc6\x02\n" +
+	"\x18ClaimExitSessionResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12!\n" +
+	"\fsupernode_id\x18\x03 \x01(\tR\vsupernodeId\x12\x1a\n" +
+	"\breturned\x18\x04 \x01(\bR\breturned\x12#\n" +
+	"\rclient_pubkey\x18\x05 \x01(\tR\fclientPubkey\x12\x16\n" +
+	"\x06region\x18\x06 \x01(\tR\x06region\x122\n" +
+	"\texit_peer\x18\a \x01(\v2\x15.control.ExitPeerInfoR\bexitPeer\x12!\n" +
+	"\fallocated_ip\x18\b \x01(\tR\vallocatedIp\x12#\n" +
+	"\rallocated_ip6\x18\t \x01(\tR\fallocatedIp6\"\xc1\x01\n" +
 	"\fExitPeerInfo\x12\x17\n" +
 	"\apeer_id\x18\x01 \x01(\tR\x06peerId\x12\x1d\n" +
 	"\n" +
@@ -1042,18 +2159,22 @@ const file_clientPeer_proto_super_node_proto_rawDesc = "" +
 	"\bendpoint\x18\x03 \x01(\tR\bendpoint\x12\x1f\n" +
 	"\vallowed_ips\x18\x04 \x03(\tR\n" +
 	"allowedIps\x12<\n" +
-	"\x1asupports_direct_connection\x18\x05 \x01(\bR\x18supportsDirectConnection*O\n" +
+	"\x1asupports_direct_connection\x18\x05 \x01(\bR\x18supportsDirectConnection*u\n" +
 	"\vCommandType\x12\x0e\n" +
 	"\n" +
 	"SETUP_EXIT\x10\x00\x12\x0f\n" +
 	"\vROTATE_PEER\x10\x01\x12\x0f\n" +
 	"\vRELAY_SETUP\x10\x02\x12\x0e\n" +
 	"\n" +
-	"DISCONNECT\x10\x032`\n" +
+	"DISCONNECT\x10\x03\x12\x11\n" +
+	"\rACTIVATE_EXIT\x10\x04\x12\x11\n" +
+	"\rTEARDOWN_EXIT\x10\x052`\n" +
 	"\rControlStream\x12O\n" +
-	"\x17PersistentControlStream\x12\x17.control.ControlMessage\x1a\x17.control.ControlMessage(\x010\x012a\n" +
+	"\x17PersistentControlStream\x12\x17.control.ControlMessage\x1a\x17.control.ControlMessage(\x010\x012\x90\x02\n" +
 	"\tSuperNode\x12T\n" +
-	"\x0fRequestExitPeer\x12\x1f.control.RequestExitPeerRequest\x1a .control.RequestExitPeerResponseB\x19Z\x17myDvpn/clientPeer/protob\x06proto3"
+	"\x0fRequestExitPeer\x12\x1f.control.RequestExitPeerRequest\x1a .control.RequestExitPeerResponse\x12T\n" +
+	"\x0fConfirmExitPeer\x12\x1f.control.ConfirmExitPeerRequest\x1a .control.ConfirmExitPeerResponse\x12W\n" +
+	"\x10ClaimExitSession\x12 .control.ClaimExitSessionRequest\x1a!.control.ClaimExitSessionResponseB\x19Z\x17myDvpn/clientPeer/protob\x06proto3"
 
 var (
 	file_clientPeer_proto_super_node_proto_rawDescOnce sync.Once
@@ -1068,48 +2189,74 @@ func file_clientPeer_proto_super_node_proto_rawDescGZIP() []byte {
 }
 
 var file_clientPeer_proto_super_node_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_clientPeer_proto_super_node_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_clientPeer_proto_super_node_proto_msgTypes = make([]protoimpl.MessageInfo, 27)
 var file_clientPeer_proto_super_node_proto_goTypes = []any{
-	(CommandType)(0),                // 0: control.CommandType
-	(*ControlMessage)(nil),          // 1: control.ControlMessage
-	(*AuthRequest)(nil),             // 2: control.AuthRequest
-	(*AuthResponse)(nil),            // 3: control.AuthResponse
-	(*PingRequest)(nil),             // 4: control.PingRequest
-	(*PongResponse)(nil),            // 5: control.PongResponse
-	(*Command)(nil),                 // 6: control.Command
-	(*CommandResponse)(nil),         // 7: control.CommandResponse
-	(*InfoRequest)(nil),             // 8: control.InfoRequest
-	(*InfoResponse)(nil),            // 9: control.InfoResponse
-	(*RequestExitPeerRequest)(nil),  // 10: control.RequestExitPeerRequest
-	(*RequestExitPeerResponse)(nil), // 11: control.RequestExitPeerResponse
-	(*ExitPeerInfo)(nil),            // 12: control.ExitPeerInfo
-	nil,                             // 13: control.Command.PayloadEntry
-	nil,                             // 14: control.CommandResponse.ResultEntry
-	nil,                             // 15: control.InfoResponse.InfoEntry
+	(CommandType)(0),                 // 0: control.CommandType
+	(*ControlMessage)(nil),           // 1: control.ControlMessage
+	(*AuthChallenge)(nil),            // 2: control.AuthChallenge
+	(*AuthRequest)(nil),              // 3: control.AuthRequest
+	(*AuthResponse)(nil),             // 4: control.AuthResponse
+	(*PingRequest)(nil),              // 5: control.PingRequest
+	(*PongResponse)(nil),             // 6: control.PongResponse
+	(*Command)(nil),                  // 7: control.Command
+	(*CommandResponse)(nil),          // 8: control.CommandResponse
+	(*InfoRequest)(nil),              // 9: control.InfoRequest
+	(*InfoResponse)(nil),             // 10: control.InfoResponse
+	(*ExitRequest)(nil),              // 11: control.ExitRequest
+	(*ExitAssignment)(nil),           // 12: control.ExitAssignment
+	(*ExitConfirm)(nil),              // 13: control.ExitConfirm
+	(*RoleUpdate)(nil),               // 14: control.RoleUpdate
+	(*RoleUpdateAck)(nil),            // 15: control.RoleUpdateAck
+	(*ExitResume)(nil),               // 16: control.ExitResume
+	(*ExitResumeAck)(nil),            // 17: control.ExitResumeAck
+	(*RequestExitPeerRequest)(nil),   // 18: control.RequestExitPeerRequest
+	(*RequestExitPeerResponse)(nil),  // 19: control.RequestExitPeerResponse
+	(*ConfirmExitPeerRequest)(nil),   // 20: control.ConfirmExitPeerRequest
+	(*ConfirmExitPeerResponse)(nil),  // 21: control.ConfirmExitPeerResponse
+	(*ClaimExitSessionRequest)(nil),  // 22: control.ClaimExitSessionRequest
+	(*ClaimExitSessionResponse)(nil), // 23: control.ClaimExitSessionResponse
+	(*ExitPeerInfo)(nil),             // 24: control.ExitPeerInfo
+	nil,                              // 25: control.Command.PayloadEntry
+	nil,                              // 26: control.CommandResponse.ResultEntry
+	nil,                              // 27: control.InfoResponse.InfoEntry
 }
 var file_clientPeer_proto_super_node_proto_depIdxs = []int32{
-	2,  // 0: control.ControlMessage.auth_request:type_name -> control.AuthRequest
-	3,  // 1: control.ControlMessage.auth_response:type_name -> control.AuthResponse
-	4,  // 2: control.ControlMessage.ping_request:type_name -> control.PingRequest
-	5,  // 3: control.ControlMessage.pong_response:type_name -> control.PongResponse
-	6,  // 4: control.ControlMessage.command:type_name -> control.Command
-	7,  // 5: control.ControlMessage.command_response:type_name -> control.CommandResponse
-	8,  // 6: control.ControlMessage.info_request:type_name -> control.InfoRequest
-	9,  // 7: control.ControlMessage.info_response:type_name -> control.InfoResponse
-	0,  // 8: control.Command.type:type_name -> control.CommandType
-	13, // 9: control.Command.payload:type_name -> control.Command.PayloadEntry
-	14, // 10: control.CommandResponse.result:type_name -> control.CommandResponse.ResultEntry
-	15, // 11: control.InfoResponse.info:type_name -> control.InfoResponse.InfoEntry
-	12, // 12: control.RequestExitPeerResponse.exit_peer:type_name -> control.ExitPeerInfo
-	1,  // 13: control.ControlStream.PersistentControlStream:input_type -> control.ControlMessage
-	10, // 14: control.SuperNode.RequestExitPeer:input_type -> control.RequestExitPeerRequest
-	1,  // 15: control.ControlStream.PersistentControlStream:output_type -> control.ControlMessage
-	11, // 16: control.SuperNode.RequestExitPeer:output_type -> control.RequestExitPeerResponse
-	15, // [15:17] is the sub-list for method output_type
-	13, // [13:15] is the sub-list for method input_type
-	13, // [13:13] is the sub-list for extension type_name
-	13, // [13:13] is the sub-list for extension extendee
-	0,  // [0:13] is the sub-list for field type_name
+	3,  // 0: control.ControlMessage.auth_request:type_name -> control.AuthRequest
+	4,  // 1: control.ControlMessage.auth_response:type_name -> control.AuthResponse
+	5,  // 2: control.ControlMessage.ping_request:type_name -> control.PingRequest
+	6,  // 3: control.ControlMessage.pong_response:type_name -> control.PongResponse
+	7,  // 4: control.ControlMessage.command:type_name -> control.Command
+	8,  // 5: control.ControlMessage.command_response:type_name -> control.CommandResponse
+	9,  // 6: control.ControlMessage.info_request:type_name -> control.InfoRequest
+	10, // 7: control.ControlMessage.info_response:type_name -> control.InfoResponse
+	11, // 8: control.ControlMessage.exit_request:type_name -> control.ExitRequest
+	12, // 9: control.ControlMessage.exit_assignment:type_name -> control.ExitAssignment
+	2,  // 10: control.ControlMessage.auth_challenge:type_name -> control.AuthChallenge
+	13, // 11: control.ControlMessage.exit_confirm:type_name -> control.ExitConfirm
+	14, // 12: control.ControlMessage.role_update:type_name -> control.RoleUpdate
+	15, // 13: control.ControlMessage.role_update_ack:type_name -> control.RoleUpdateAck
+	16, // 14: control.ControlMessage.exit_resume:type_name -> control.ExitResume
+	17, // 15: control.ControlMessage.exit_resume_ack:type_name -> control.ExitResumeAck
+	0,  // 16: control.Command.type:type_name -> control.CommandType
+	25, // 17: control.Command.payload:type_name -> control.Command.PayloadEntry
+	26, // 18: control.CommandResponse.result:type_name -> control.CommandResponse.ResultEntry
+	27, // 19: control.InfoResponse.info:type_name -> control.InfoResponse.InfoEntry
+	24, // 20: control.ExitAssignment.exit_peer:type_name -> control.ExitPeerInfo
+	24, // 21: control.RequestExitPeerResponse.exit_peer:type_name -> control.ExitPeerInfo
+	24, // 22: control.ClaimExitSessionResponse.exit_peer:type_name -> control.ExitPeerInfo
+	1,  // 23: control.ControlStream.PersistentControlStream:input_type -> control.ControlMessage
+	18, // 24: control.SuperNode.RequestExitPeer:input_type -> control.RequestExitPeerRequest
+	20, // 25: control.SuperNode.ConfirmExitPeer:input_type -> control.ConfirmExitPeerRequest
+	22, // 26: control.SuperNode.ClaimExitSession:input_type -> control.ClaimExitSessionRequest
+	1,  // 27: control.ControlStream.PersistentControlStream:output_type -> control.ControlMessage
+	19, // 28: control.SuperNode.RequestExitPeer:output_type -> control.RequestExitPeerResponse
+	21, // 29: control.SuperNode.ConfirmExitPeer:output_type -> control.ConfirmExitPeerResponse
+	23, // 30: control.SuperNode.ClaimExitSession:output_type -> control.ClaimExitSessionResponse
+	27, // [27:31] is the sub-list for method output_type
+	23, // [23:27] is the sub-list for method input_type
+	23, // [23:23] is the sub-list for extension type_name
+	23, // [23:23] is the sub-list for extension extendee
+	0,  // [0:23] is the sub-list for field type_name
 }
 
 func init() { file_clientPeer_proto_super_node_proto_init() }
@@ -1126,6 +2273,14 @@ func file_clientPeer_proto_super_node_proto_init() {
 		(*ControlMessage_CommandResponse)(nil),
 		(*ControlMessage_InfoRequest)(nil),
 		(*ControlMessage_InfoResponse)(nil),
+		(*ControlMessage_ExitRequest)(nil),
+		(*ControlMessage_ExitAssignment)(nil),
+		(*ControlMessage_AuthChallenge)(nil),
+		(*ControlMessage_ExitConfirm)(nil),
+		(*ControlMessage_RoleUpdate)(nil),
+		(*ControlMessage_RoleUpdateAck)(nil),
+		(*ControlMessage_ExitResume)(nil),
+		(*ControlMessage_ExitResumeAck)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -1133,7 +2288,7 @@ func file_clientPeer_proto_super_node_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_clientPeer_proto_super_node_proto_rawDesc), len(file_clientPeer_proto_super_node_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   15,
+			NumMessages:   27,
 			NumExtensions: 0,
 			NumServices:   2,
 		},
@@ -121,7 +121,9 @@ var ControlStream_ServiceDesc = grpc.ServiceDesc{
 }
 
 const (
-	SuperNode_RequestExitPeer_FullMethodName = "/control.SuperNode/RequestExitPeer"
+	SuperNode_RequestExitPeer_FullMethodName  = "/control.SuperNode/RequestExitPeer"
+	SuperNode_ConfirmExitPeer_FullMethodName  = "/control.SuperNode/ConfirmExitPeer"
+	SuperNode_ClaimExitSession_FullMethodName = "/control.SuperNode/ClaimExitSession"
 )
 
 // SuperNodeClient is the client API for SuperNode service.
@@ -132,6 +134,9 @@ const (
 type SuperNodeClient interface {
 	// Request exit peers from another SuperNode
 	RequestExitPeer(ctx context.Context, in *RequestExitPeerRequest, opts ...grpc.CallOption) (*RequestExitPeerResponse, error)
+	ConfirmExitPeer(ctx context.Context, in *ConfirmExitPeerRequest, opts ...grpc.CallOption) (*ConfirmExitPeerResponse, error)
+	// Hand an active exit session over to the SuperNode its client failed over to
+	ClaimExitSession(ctx context.Context, in *ClaimExitSessionRequest, opts ...grpc.CallOption) (*ClaimExitSessionResponse, error)
 }
 
 type superNodeClient struct {
@@ -152,6 +157,26 @@ func (c *superNodeClient) RequestExitPeer(ctx context.Context, in *RequestExitPe
 	return out, nil
 }
 
+func (c *superNodeClient) ConfirmExitPeer(ctx context.Context, in *ConfirmExitPeerRequest, opts ...grpc.CallOption) (*ConfirmExitPeerResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfirmExitPeerResponse)
+	err := c.cc.Invoke(ctx, SuperNode_ConfirmExitPeer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *superNodeClient) ClaimExitSession(ctx context.Context, in *ClaimExitSessionRequest, opts ...grpc.CallOption) (*ClaimExitSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClaimExitSessionResponse)
+	err := c.cc.Invoke(ctx, SuperNode_ClaimExitSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SuperNodeServer is the server API for SuperNode service.
 // All implementations must embed UnimplementedSuperNodeServer
 // for forward compatibility.
@@ -160,6 +185,9 @@ func (c *superNodeClient) RequestExitPeer(ctx context.Context, in *RequestExitPe
 type SuperNodeServer interface {
 	// Request exit peers from another SuperNode
 	RequestExitPeer(context.Context, *RequestExitPeerRequest) (*RequestExitPeerResponse, error)
+	ConfirmExitPeer(context.Context, *ConfirmExitPeerRequest) (*ConfirmExitPeerResponse, error)
+	// Hand an active exit session over to the SuperNode its client failed over to
+	ClaimExitSession(context.Context, *ClaimExitSessionRequest) (*ClaimExitSessionResponse, error)
 	mustEmbedUnimplementedSuperNodeServer()
 }
 
@@ -173,6 +201,12 @@ type UnimplementedSuperNodeServer struct{}
 func (UnimplementedSuperNodeServer) RequestExitPeer(context.Context, *RequestExitPeerRequest) (*RequestExitPeerResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RequestExitPeer not implemented")
 }
+func (UnimplementedSuperNodeServer) ConfirmExitPeer(context.Context, *ConfirmExitPeerRequest) (*ConfirmExitPeerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmExitPeer not implemented")
+}
+func (UnimplementedSuperNodeServer) ClaimExitSession(context.Context, *ClaimExitSessionRequest) (*ClaimExitSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClaimExitSession not implemented")
+}
 func (UnimplementedSuperNodeServer) mustEmbedUnimplementedSuperNodeServer() {}
 func (UnimplementedSuperNodeServer) testEmbeddedByValue()                   {}
 
@@ -212,6 +246,42 @@ func _SuperNode_RequestExitPeer_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SuperNode_ConfirmExitPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfirmExitPeerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SuperNodeServer).ConfirmExitPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SuperNode_ConfirmExitPeer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SuperNodeServer).ConfirmExitPeer(ctx, req.(*ConfirmExitPeerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SuperNode_ClaimExitSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClaimExitSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SuperNodeServer).ClaimExitSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SuperNode_ClaimExitSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SuperNodeServer).ClaimExitSession(ctx, req.(*ClaimExitSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // SuperNode_ServiceDesc is the grpc.ServiceDesc for SuperNode service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -223,6 +293,14 @@ var SuperNode_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RequestExitPeer",
 			Handler:    _SuperNode_RequestExitPeer_Handler,
 		},
+		{
+			MethodName: "ConfirmExitPeer",
+			Handler:    _SuperNode_ConfirmExitPeer_Handler,
+		},
+		{
+			MethodName: "ClaimExitSession",
+			Handler:    _SuperNode_ClaimExitSession_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "clientPeer/proto/super_node.proto",
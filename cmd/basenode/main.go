@@ -2,18 +2,38 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
+	"myDvpn/base/raft"
 	"myDvpn/base/server"
+	"myDvpn/base/store"
+	"myDvpn/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	// Keystore management subcommands
+	if handled, err := utils.RunKeystoreCommand(os.Args[1:], "basenode", os.Stdout); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Parse command line flags
 	listenAddr := flag.String("listen", "0.0.0.0:50051", "Address to listen on")
+	dataDir := flag.String("data-dir", "", "Directory for durable SuperNode state (in-memory only when empty)")
+	clusterID := flag.String("cluster-id", "", "This BaseNode's ID in a replicated cluster (standalone when empty)")
+	clusterPeers := flag.String("cluster-peers", "", "Cluster members as id=host:port,... including this BaseNode")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	tlsOpts := utils.RegisterTLSFlags(flag.CommandLine)
+	keystoreOpts := utils.RegisterKeystoreFlags(flag.CommandLine)
+	metricsOpts := utils.RegisterMetricsFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Setup logger
@@ -24,8 +44,65 @@ func main() {
 	}
 	logger.SetLevel(level)
 
+	// Load persistent identity
+	keystore, err := keystoreOpts.Load("basenode", logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load keystore")
+	}
+	logger.WithField("identity", utils.PublicKeyToBase64(keystore.Identity.PublicKey)).Info("Loaded keystore")
+
+	// Setup transport credentials
+	creds, err := utils.NewTLSCredentials(tlsOpts, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to configure TLS")
+	}
+
+	// Open SuperNode store; cluster members keep their durable state in the replicated log
+	var supernodeStore store.SuperNodeStore = store.NewMemoryStore()
+	if *dataDir != "" && *clusterID == "" {
+		fileStore, err := store.NewFileStore(*dataDir)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to open SuperNode store")
+		}
+		supernodeStore = fileStore
+	}
+
 	// Create BaseNode
-	baseNode := server.NewBaseNode(*listenAddr, logger)
+	baseNode := server.NewBaseNode(*listenAddr, supernodeStore, creds, logger)
+
+	// Join the replicated cluster
+	if *clusterID != "" {
+		peers, err := raft.ParsePeers(*clusterPeers)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid cluster member list")
+		}
+
+		var storage raft.Storage = raft.NewMemoryStorage()
+		if *dataDir != "" {
+			fileStorage, err := raft.NewFileStorage(filepath.Join(*dataDir, "raft"))
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to open cluster log")
+			}
+			storage = fileStorage
+		} else {
+			logger.Warn("Cluster log is in memory only; a restarted member rejoins with an empty log")
+		}
+
+		if err := baseNode.EnableCluster(raft.DefaultConfig(*clusterID, peers), storage); err != nil {
+			logger.WithError(err).Fatal("Failed to join BaseNode cluster")
+		}
+	}
+
+	// Expose Prometheus metrics
+	if metricsOpts.Enabled() {
+		registry := utils.NewMetricsRegistry()
+		if err := baseNode.RegisterMetrics(registry); err != nil {
+			logger.WithError(err).Fatal("Failed to register metrics")
+		}
+		if _, err := metricsOpts.Serve(registry, logger); err != nil {
+			logger.WithError(err).Fatal("Failed to start metrics server")
+		}
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
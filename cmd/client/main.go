@@ -2,20 +2,38 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	baseclient "myDvpn/base/client"
 	"myDvpn/clientPeer/client"
+	"myDvpn/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	// Keystore management subcommands
+	if handled, err := utils.RunKeystoreCommand(os.Args[1:], "client-1", os.Stdout); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Parse command line flags
 	id := flag.String("id", "client-1", "Client peer ID")
 	region := flag.String("region", "us-east-1", "Region")
-	supernodeAddr := flag.String("supernode", "localhost:50052", "SuperNode address")
+	supernodeAddr := flag.String("supernode", "localhost:50052", "SuperNode address, or a comma-separated list in order of preference")
+	baseNodeAddr := flag.String("basenode", "", "BaseNode address(es) to look up backup SuperNodes of the region on (optional)")
+	exitRegion := flag.String("exit-region", "", "Request an exit peer in this region after startup")
+	wgBackend := flag.String("wg-backend", utils.BackendKernel, "WireGuard backend (kernel, userspace, channel, memory)")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	tlsOpts := utils.RegisterTLSFlags(flag.CommandLine)
+	keystoreOpts := utils.RegisterKeystoreFlags(flag.CommandLine)
+	metricsOpts := utils.RegisterMetricsFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Setup logger
@@ -26,11 +44,42 @@ func main() {
 	}
 	logger.SetLevel(level)
 
+	// Load persistent identity
+	keystore, err := keystoreOpts.Load(*id, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load keystore")
+	}
+	logger.WithField("identity", utils.PublicKeyToBase64(keystore.Identity.PublicKey)).Info("Loaded keystore")
+
+	// Setup transport credentials
+	creds, err := utils.NewTLSCredentials(tlsOpts, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to configure TLS")
+	}
+
+	// Create WireGuard backend
+	wgManager, err := utils.NewWireGuardBackend(*wgBackend, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create WireGuard backend")
+	}
+
 	// Create client peer
-	peer, err := client.NewPeer(*id, *region, *supernodeAddr, logger)
+	peer, err := client.NewPeer(*id, *region, *supernodeAddr, wgManager, keystore, creds, logger)
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to create client peer")
 	}
+	peer.SetBaseNodes(baseclient.ParseAddrs(*baseNodeAddr))
+
+	// Expose Prometheus metrics
+	if metricsOpts.Enabled() {
+		registry := utils.NewMetricsRegistry()
+		if err := peer.RegisterMetrics(registry); err != nil {
+			logger.WithError(err).Fatal("Failed to register metrics")
+		}
+		if _, err := metricsOpts.Serve(registry, logger); err != nil {
+			logger.WithError(err).Fatal("Failed to start metrics server")
+		}
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -46,6 +95,20 @@ func main() {
 		if err := peer.Start(); err != nil {
 			logger.WithError(err).Fatal("Client peer failed")
 		}
+
+		if *exitRegion == "" {
+			return
+		}
+
+		exitConfig, err := peer.RequestExit(*exitRegion)
+		if err != nil {
+			logger.WithError(err).Error("Failed to request exit peer")
+			return
+		}
+
+		if err := peer.ConnectToExit(exitConfig); err != nil {
+			logger.WithError(err).Error("Failed to connect to exit peer")
+		}
 	}()
 
 	// Wait for shutdown signal
@@ -2,21 +2,43 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	baseclient "myDvpn/base/client"
 	"myDvpn/exitpeer"
+	"myDvpn/utils"
+	"myDvpn/utils/ipam"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	// Keystore management subcommands
+	if handled, err := utils.RunKeystoreCommand(os.Args[1:], "exit-1", os.Stdout); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Parse command line flags
 	id := flag.String("id", "exit-1", "Exit peer ID")
 	region := flag.String("region", "us-west-1", "Region")
-	supernodeAddr := flag.String("supernode", "localhost:50053", "SuperNode address")
+	supernodeAddr := flag.String("supernode", "localhost:50053", "SuperNode address, or a comma-separated list in order of preference")
+	baseNodeAddr := flag.String("basenode", "", "BaseNode address(es) to look up backup SuperNodes of the region on (optional)")
 	listenPort := flag.Int("port", 51820, "WireGuard listen port")
+	maxClients := flag.Int("max-clients", 250, "Clients this exit accepts, advertised to the SuperNode (0 for no limit)")
+	leaseDir := flag.String("lease-dir", "", "Directory for client address leases (default <config dir>/mydvpn/leases/<id>)")
+	ipv6 := flag.Bool("ipv6", true, "Give clients IPv6 with NAT66 (their IPv6 traffic is dropped when off or unavailable)")
+	wgBackend := flag.String("wg-backend", utils.BackendKernel, "WireGuard backend (kernel, userspace, channel, memory)")
+	firewallKind := flag.String("firewall", utils.FirewallIptables, "Firewall backend for NAT rules (iptables, nftables, memory)")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	tlsOpts := utils.RegisterTLSFlags(flag.CommandLine)
+	keystoreOpts := utils.RegisterKeystoreFlags(flag.CommandLine)
+	metricsOpts := utils.RegisterMetricsFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Setup logger
@@ -27,11 +49,56 @@ func main() {
 	}
 	logger.SetLevel(level)
 
+	// Load persistent identity
+	keystore, err := keystoreOpts.Load(*id, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load keystore")
+	}
+	logger.WithField("identity", utils.PublicKeyToBase64(keystore.Identity.PublicKey)).Info("Loaded keystore")
+
+	// Setup transport credentials
+	creds, err := utils.NewTLSCredentials(tlsOpts, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to configure TLS")
+	}
+
+	// Create WireGuard backend
+	wgManager, err := utils.NewWireGuardBackend(*wgBackend, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create WireGuard backend")
+	}
+
+	// Create firewall backend
+	firewall, err := utils.NewFirewall(*firewallKind, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create firewall")
+	}
+
 	// Create exit peer
-	exitPeer, err := exitpeer.NewExitPeer(*id, *region, *supernodeAddr, *listenPort, logger)
+	exitPeer, err := exitpeer.NewExitPeer(*id, *region, *supernodeAddr, *listenPort, wgManager, firewall, keystore, creds, logger)
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to create exit peer")
 	}
+	exitPeer.SetMaxClients(*maxClients)
+	exitPeer.SetIPv6(*ipv6)
+	if *leaseDir == "" {
+		*leaseDir = ipam.DefaultDir(*id)
+	}
+	if err := exitPeer.SetLeaseDir(*leaseDir); err != nil {
+		logger.WithError(err).Fatal("Failed to load address leases")
+	}
+	exitPeer.SetBaseNodes(baseclient.ParseAddrs(*baseNodeAddr))
+
+	// Expose Prometheus metrics
+	if metricsOpts.Enabled() {
+		registry := utils.NewMetricsRegistry()
+		if err := exitPeer.RegisterMetrics(registry); err != nil {
+			logger.WithError(err).Fatal("Failed to register metrics")
+		}
+		if _, err := metricsOpts.Serve(registry, logger); err != nil {
+			logger.WithError(err).Fatal("Failed to start metrics server")
+		}
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
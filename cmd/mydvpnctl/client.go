@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	baseclient "myDvpn/base/client"
+	"myDvpn/base/proto"
+	adminProto "myDvpn/super/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// options are the global flags, which are accepted before or after the subcommand
+type options struct {
+	basenodes string
+	supernode string
+	adminPort int
+	tokenFile string
+	output    string
+	timeout   time.Duration
+	tls       *utils.TLSOptions
+}
+
+// ctl holds the global options and the connections opened by a subcommand
+type ctl struct {
+	*options
+	globals *flag.FlagSet
+	logger  *logrus.Logger
+	stdout  io.Writer
+
+	creds      *utils.TLSCredentials
+	baseClient *baseclient.FailoverClient
+	adminToken string
+	adminConns []*grpc.ClientConn
+}
+
+// context returns a context bounded by the per-call timeout
+func (c *ctl) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// credentials builds the transport credentials once the flags are final
+func (c *ctl) credentials() (*utils.TLSCredentials, error) {
+	if c.creds == nil {
+		creds, err := utils.NewTLSCredentials(c.tls, c.logger)
+		if err != nil {
+			return nil, err
+		}
+		c.creds = creds
+	}
+	return c.creds, nil
+}
+
+// base returns a client for the BaseNode cluster
+func (c *ctl) base() (proto.BaseNodeClient, error) {
+	if c.baseClient == nil {
+		creds, err := c.credentials()
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := baseclient.NewFailoverClient(baseclient.ParseAddrs(c.basenodes), creds, c.logger)
+		if err != nil {
+			return nil, err
+		}
+		c.baseClient = client
+	}
+	return c.baseClient, nil
+}
+
+// admin returns an admin API client for the SuperNode at addr
+func (c *ctl) admin(addr string) (adminProto.AdminClient, error) {
+	creds, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.adminToken == "" {
+		token, err := utils.ReadAdminToken(c.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		c.adminToken = token
+	}
+
+	conn, err := grpc.Dial(addr, creds.DialOption(), creds.AdminTokenDialOption(c.adminToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial SuperNode admin API %s: %w", addr, err)
+	}
+	c.adminConns = append(c.adminConns, conn)
+
+	return adminProto.NewAdminClient(conn), nil
+}
+
+// close closes every open connection
+func (c *ctl) close() {
+	if c.baseClient != nil {
+		c.baseClient.Close()
+		c.baseClient = nil
+	}
+	for _, conn := range c.adminConns {
+		conn.Close()
+	}
+	c.adminConns = nil
+}
+
+// describeError strips the gRPC framing from an error for display
+func describeError(err error) string {
+	if s, ok := status.FromError(err); ok {
+		return fmt.Sprintf("%s (%s)", s.Message(), s.Code())
+	}
+	return err.Error()
+}
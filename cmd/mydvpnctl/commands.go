@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"myDvpn/base/proto"
+	adminProto "myDvpn/super/proto"
+)
+
+// supernodeView is a SuperNode directory entry
+type supernodeView struct {
+	SupernodeID   string `json:"supernode_id"`
+	Region        string `json:"region"`
+	Address       string `json:"address"`
+	Load          int32  `json:"load"`
+	Capacity      int32  `json:"capacity"`
+	ExitClients   int32  `json:"exit_clients"`
+	ExitCapacity  int32  `json:"exit_capacity"`
+	Verified      bool   `json:"verified"`
+	LastHeartbeat int64  `json:"last_heartbeat"`
+}
+
+// peerView is a peer connected to a SuperNode
+type peerView struct {
+	PeerID           string  `json:"peer_id"`
+	Role             string  `json:"role"`
+	Region           string  `json:"region"`
+	SessionID        string  `json:"session_id"`
+	PublicKey        string  `json:"public_key"`
+	RemoteAddr       string  `json:"remote_addr"`
+	LastHeartbeat    int64   `json:"last_heartbeat"`
+	ConnectedSince   int64   `json:"connected_since"`
+	LatencyMs        float64 `json:"latency_ms"`
+	MessagesReceived int64   `json:"messages_received"`
+	MessagesSent     int64   `json:"messages_sent"`
+	CommandsExecuted int64   `json:"commands_executed"`
+	CommandsFailed   int64   `json:"commands_failed"`
+}
+
+// relayView is a relay forwarding rule
+type relayView struct {
+	ClientID  string `json:"client_id"`
+	ClientIP  string `json:"client_ip"`
+	ExitIP    string `json:"exit_ip"`
+	ExitPort  int32  `json:"exit_port"`
+	LocalPort int32  `json:"local_port"`
+	SessionID string `json:"session_id"`
+}
+
+// resultView is the outcome of an operator action
+type resultView struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Result  map[string]string `json:"result,omitempty"`
+}
+
+// topologyNode is a SuperNode with the peers connected to it
+type topologyNode struct {
+	supernodeView
+	Draining bool       `json:"draining"`
+	Peers    []peerView `json:"peers,omitempty"`
+	Error    string     `json:"error,omitempty"` // Why peers could not be listed
+}
+
+// topologyRegion groups the SuperNodes of a region
+type topologyRegion struct {
+	Region     string          `json:"region"`
+	Supernodes []*topologyNode `json:"supernodes"`
+}
+
+// newFlagSet creates a subcommand flag set that also accepts the global flags
+func newFlagSet(c *ctl, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	c.globals.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	return fs
+}
+
+// parseArgs parses flags placed anywhere among the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	var values []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		values = append(values, args[0])
+		args = args[1:]
+	}
+
+	if len(values) != positional {
+		return nil, fmt.Errorf("%s: expected %d argument(s), got %d", fs.Name(), positional, len(values))
+	}
+	return values, nil
+}
+
+// runSupernodesList lists SuperNodes registered with the BaseNode
+func runSupernodesList(c *ctl, args []string) error {
+	if _, err := parseArgs(newFlagSet(c, "supernodes list"), args, 0); err != nil {
+		return err
+	}
+
+	supernodes, err := c.listSupernodes()
+	if err != nil {
+		return err
+	}
+
+	t := &table{headers: []string{"SUPERNODE", "REGION", "ADDRESS", "LOAD", "CAPACITY", "EXIT CLIENTS", "VERIFIED", "HEARTBEAT"}}
+	for _, sn := range supernodes {
+		t.addRow(sn.SupernodeID, sn.Region, sn.Address,
+			strconv.Itoa(int(sn.Load)), strconv.Itoa(int(sn.Capacity)),
+			fmt.Sprintf("%d/%d", sn.ExitClients, sn.ExitCapacity),
+			strconv.FormatBool(sn.Verified), formatAge(sn.LastHeartbeat))
+	}
+
+	return c.emitTable(supernodes, t)
+}
+
+// runSupernodeDrain drains the SuperNode or resumes it
+func runSupernodeDrain(c *ctl, args []string) error {
+	fs := newFlagSet(c, "supernode drain")
+	resume := fs.Bool("resume", false, "Accept peers and exit allocations again")
+	disconnect := fs.Bool("disconnect-peers", false, "Also send DISCONNECT to every connected peer")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	client, err := c.admin(c.supernode)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := client.DrainNode(ctx, &adminProto.DrainNodeRequest{
+		Resume:          *resume,
+		DisconnectPeers: *disconnect,
+	})
+	if err != nil {
+		return err
+	}
+
+	view := struct {
+		Draining          bool   `json:"draining"`
+		PeersDisconnected int32  `json:"peers_disconnected"`
+		Message           string `json:"message"`
+	}{resp.Draining, resp.PeersDisconnected, resp.Message}
+
+	return c.emit(view, func(w io.Writer) error {
+		fmt.Fprintln(w, resp.Message)
+		if *disconnect && resp.Draining {
+			fmt.Fprintf(w, "Disconnected %d peer(s)\n", resp.PeersDisconnected)
+		}
+		return nil
+	})
+}
+
+// runPeersList lists peers connected to the SuperNode
+func runPeersList(c *ctl, args []string) error {
+	fs := newFlagSet(c, "peers list")
+	region := fs.String("region", "", "Only peers in this region")
+	role := fs.String("role", "", "Only peers with this role (client, exit, hybrid)")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	peers, _, err := c.listPeers(c.supernode, *region, *role)
+	if err != nil {
+		return err
+	}
+
+	t := &table{headers: []string{"PEER", "ROLE", "REGION", "REMOTE", "LATENCY", "HEARTBEAT", "CONNECTED", "COMMANDS", "FAILED"}}
+	for _, p := range peers {
+		t.addRow(p.PeerID, p.Role, p.Region, orDash(p.RemoteAddr),
+			fmt.Sprintf("%.0fms", p.LatencyMs), formatAge(p.LastHeartbeat), formatAge(p.ConnectedSince),
+			strconv.FormatInt(p.CommandsExecuted, 10), strconv.FormatInt(p.CommandsFailed, 10))
+	}
+
+	return c.emitTable(peers, t)
+}
+
+// runPeerShow shows a single connected peer
+func runPeerShow(c *ctl, args []string) error {
+	values, err := parseArgs(newFlagSet(c, "peer show"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.admin(c.supernode)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	info, err := client.GetPeer(ctx, &adminProto.GetPeerRequest{PeerId: values[0]})
+	if err != nil {
+		return err
+	}
+
+	p := newPeerView(info)
+	t := &table{headers: []string{"FIELD", "VALUE"}}
+	t.addRow("peer", p.PeerID)
+	t.addRow("role", p.Role)
+	t.addRow("region", p.Region)
+	t.addRow("session", p.SessionID)
+	t.addRow("public key", p.PublicKey)
+	t.addRow("remote", orDash(p.RemoteAddr))
+	t.addRow("connected", formatAge(p.ConnectedSince))
+	t.addRow("heartbeat", formatAge(p.LastHeartbeat))
+	t.addRow("latency", fmt.Sprintf("%.0fms", p.LatencyMs))
+	t.addRow("messages", fmt.Sprintf("%d received, %d sent", p.MessagesReceived, p.MessagesSent))
+	t.addRow("commands", fmt.Sprintf("%d executed, %d failed", p.CommandsExecuted, p.CommandsFailed))
+
+	return c.emitTable(p, t)
+}
+
+// runPeerKick disconnects a peer and closes its stream
+func runPeerKick(c *ctl, args []string) error {
+	fs := newFlagSet(c, "peer kick")
+	reason := fs.String("reason", "", "Reason sent to the peer")
+	values, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.admin(c.supernode)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := client.DisconnectPeer(ctx, &adminProto.DisconnectPeerRequest{
+		PeerId: values[0],
+		Reason: *reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.emitResult(&resultView{Success: resp.Success, Message: resp.Message})
+}
+
+// runPeerRevoke revokes a peer in the SuperNode's registry and disconnects it
+func runPeerRevoke(c *ctl, args []string) error {
+	values, err := parseArgs(newFlagSet(c, "peer revoke"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.admin(c.supernode)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := client.RevokePeer(ctx, &adminProto.RevokePeerRequest{PeerId: values[0]})
+	if err != nil {
+		return err
+	}
+
+	result := &resultView{Success: resp.Success, Message: resp.Message}
+	if resp.Success {
+		result.Result = map[string]string{"was_connected": strconv.FormatBool(resp.WasConnected)}
+	}
+	return c.emitResult(result)
+}
+
+// runExitRotate asks a client to move to a new exit peer
+func runExitRotate(c *ctl, args []string) error {
+	fs := newFlagSet(c, "exit rotate")
+	region := fs.String("region", "", "Region of the new exit (default: the client's current exit region)")
+	wait := fs.Duration("wait", 30*time.Second, "How long the client may take to rotate")
+	values, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.admin(c.supernode)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]string{}
+	if *region != "" {
+		payload["target_region"] = *region
+	}
+
+	// The call lasts as long as the client is allowed to take
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout+*wait)
+	defer cancel()
+
+	resp, err := client.SendCommand(ctx, &adminProto.SendCommandRequest{
+		PeerId:         values[0],
+		Type:           "ROTATE_PEER",
+		Payload:        payload,
+		TimeoutSeconds: int32(wait.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.emitResult(&resultView{Success: resp.Success, Message: resp.Message, Result: resp.Result})
+}
+
+// runRelaysList lists relay forwarding rules on the SuperNode
+func runRelaysList(c *ctl, args []string) error {
+	if _, err := parseArgs(newFlagSet(c, "relays list"), args, 0); err != nil {
+		return err
+	}
+
+	client, err := c.admin(c.supernode)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := client.ListRelays(ctx, &adminProto.ListRelaysRequest{})
+	if err != nil {
+		return err
+	}
+
+	relays := []relayView{}
+	t := &table{headers: []string{"CLIENT", "CLIENT IP", "EXIT", "LOCAL PORT", "SESSION"}}
+	for _, r := range resp.Relays {
+		relays = append(relays, relayView{
+			ClientID:  r.ClientId,
+			ClientIP:  r.ClientIp,
+			ExitIP:    r.ExitIp,
+			ExitPort:  r.ExitPort,
+			LocalPort: r.LocalPort,
+			SessionID: r.SessionId,
+		})
+		t.addRow(r.ClientId, r.ClientIp, net.JoinHostPort(r.ExitIp, strconv.Itoa(int(r.ExitPort))),
+			strconv.Itoa(int(r.LocalPort)), orDash(r.SessionId))
+	}
+
+	return c.emitTable(relays, t)
+}
+
+// runTopology shows regions, their SuperNodes and the peers connected to each
+func runTopology(c *ctl, args []string) error {
+	if _, err := parseArgs(newFlagSet(c, "topology"), args, 0); err != nil {
+		return err
+	}
+
+	supernodes, err := c.listSupernodes()
+	if err != nil {
+		return err
+	}
+
+	regions := []*topologyRegion{}
+	byRegion := make(map[string]*topologyRegion)
+	for _, sn := range supernodes {
+		region, exists := byRegion[sn.Region]
+		if !exists {
+			region = &topologyRegion{Region: sn.Region}
+			byRegion[sn.Region] = region
+			regions = append(regions, region)
+		}
+
+		node := &topologyNode{supernodeView: sn}
+		if c.adminPort > 0 {
+			host, _, _ := net.SplitHostPort(sn.Address)
+			peers, draining, err := c.listPeers(net.JoinHostPort(host, strconv.Itoa(c.adminPort)), "", "")
+			if err != nil {
+				node.Error = describeError(err)
+			}
+			node.Peers = peers
+			node.Draining = draining
+		}
+		region.Supernodes = append(region.Supernodes, node)
+	}
+
+	return c.emit(regions, func(w io.Writer) error {
+		for _, region := range regions {
+			fmt.Fprintln(w, region.Region)
+			for _, node := range region.Supernodes {
+				writeTopologyNode(w, node, c.adminPort > 0)
+			}
+		}
+		return nil
+	})
+}
+
+// writeTopologyNode renders a SuperNode and its peers grouped by role
+func writeTopologyNode(w io.Writer, node *topologyNode, withPeers bool) {
+	var flags []string
+	if !node.Verified {
+		flags = append(flags, "unverified")
+	}
+	if node.Draining {
+		flags = append(flags, "draining")
+	}
+
+	line := fmt.Sprintf("  %s  %s  load %d/%d  exits %d/%d  heartbeat %s", node.SupernodeID, node.Address, node.Load, node.Capacity, node.ExitClients, node.ExitCapacity, formatAge(node.LastHeartbeat))
+	if len(flags) > 0 {
+		line += "  [" + strings.Join(flags, ", ") + "]"
+	}
+	fmt.Fprintln(w, line)
+
+	if !withPeers {
+		return
+	}
+	if node.Error != "" {
+		fmt.Fprintf(w, "    peers unavailable: %s\n", node.Error)
+		return
+	}
+
+	byRole := make(map[string][]string)
+	var roles []string
+	for _, p := range node.Peers {
+		if _, seen := byRole[p.Role]; !seen {
+			roles = append(roles, p.Role)
+		}
+		byRole[p.Role] = append(byRole[p.Role], p.PeerID)
+	}
+	sort.Strings(roles)
+
+	if len(roles) == 0 {
+		fmt.Fprintln(w, "    no peers")
+	}
+	for _, role := range roles {
+		fmt.Fprintf(w, "    %-8s %s\n", role, strings.Join(byRole[role], ", "))
+	}
+}
+
+// listSupernodes fetches the SuperNode directory sorted by region and ID
+func (c *ctl) listSupernodes() ([]supernodeView, error) {
+	client, err := c.base()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := client.ListSuperNodes(ctx, &proto.ListSuperNodesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	supernodes := []supernodeView{}
+	for _, sn := range resp.Supernodes {
+		supernodes = append(supernodes, supernodeView{
+			SupernodeID:   sn.SupernodeId,
+			Region:        sn.Region,
+			Address:       net.JoinHostPort(sn.IpAddress, strconv.Itoa(int(sn.Port))),
+			Load:          sn.CurrentLoad,
+			Capacity:      sn.MaxCapacity,
+			ExitClients:   sn.Load.GetExitClients(),
+			ExitCapacity:  sn.Load.GetExitCapacity(),
+			Verified:      sn.Verified,
+			LastHeartbeat: sn.LastHeartbeat,
+		})
+	}
+
+	sort.Slice(supernodes, func(i, j int) bool {
+		if supernodes[i].Region != supernodes[j].Region {
+			return supernodes[i].Region < supernodes[j].Region
+		}
+		return supernodes[i].SupernodeID < supernodes[j].SupernodeID
+	})
+
+	return supernodes, nil
+}
+
+// listPeers lists the peers of the SuperNode at addr and whether it is draining
+func (c *ctl) listPeers(addr, region, role string) ([]peerView, bool, error) {
+	client, err := c.admin(addr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	resp, err := client.ListPeers(ctx, &adminProto.ListPeersRequest{Region: region, Role: role})
+	if err != nil {
+		return nil, false, err
+	}
+
+	peers := []peerView{}
+	for _, info := range resp.Peers {
+		peers = append(peers, newPeerView(info))
+	}
+	return peers, resp.Draining, nil
+}
+
+// emitResult writes the outcome of an operator action
+func (c *ctl) emitResult(result *resultView) error {
+	if err := c.emit(result, func(w io.Writer) error {
+		fmt.Fprintln(w, result.Message)
+
+		keys := make([]string, 0, len(result.Result))
+		for key := range result.Result {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %s: %s\n", key, result.Result[key])
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if !result.Success {
+		return fmt.Errorf("command failed")
+	}
+	return nil
+}
+
+// newPeerView converts an admin PeerInfo for output
+func newPeerView(info *adminProto.PeerInfo) peerView {
+	p := peerView{
+		PeerID:        info.PeerId,
+		Role:          info.Role,
+		Region:        info.Region,
+		SessionID:     info.SessionId,
+		PublicKey:     info.PublicKey,
+		RemoteAddr:    info.RemoteAddr,
+		LastHeartbeat: info.LastHeartbeat,
+	}
+	if info.Stats != nil {
+		p.ConnectedSince = info.Stats.ConnectedSince
+		p.LatencyMs = info.Stats.LatencyMs
+		p.MessagesReceived = info.Stats.MessagesReceived
+		p.MessagesSent = info.Stats.MessagesSent
+		p.CommandsExecuted = info.Stats.CommandsExecuted
+		p.CommandsFailed = info.Stats.CommandsFailed
+	}
+	return p
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	adminProto "myDvpn/super/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+const testAdminToken = "test-admin-token-0123456789"
+
+// fakeAdmin records the admin calls it receives
+type fakeAdmin struct {
+	adminProto.UnimplementedAdminServer
+
+	mutex    sync.Mutex
+	kicked   []*adminProto.DisconnectPeerRequest
+	revoked  []string
+	commands []*adminProto.SendCommandRequest
+	drains   []*adminProto.DrainNodeRequest
+
+	fail bool // Report every action as failed
+}
+
+func (fa *fakeAdmin) DisconnectPeer(ctx context.Context, req *adminProto.DisconnectPeerRequest) (*adminProto.DisconnectPeerResponse, error) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	fa.kicked = append(fa.kicked, req)
+	return &adminProto.DisconnectPeerResponse{Success: !fa.fail, Message: "Peer disconnected"}, nil
+}
+
+func (fa *fakeAdmin) RevokePeer(ctx context.Context, req *adminProto.RevokePeerRequest) (*adminProto.RevokePeerResponse, error) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	fa.revoked = append(fa.revoked, req.PeerId)
+	return &adminProto.RevokePeerResponse{Success: !fa.fail, Message: "Peer " + req.PeerId + " revoked", WasConnected: true}, nil
+}
+
+func (fa *fakeAdmin) SendCommand(ctx context.Context, req *adminProto.SendCommandRequest) (*adminProto.SendCommandResponse, error) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	fa.commands = append(fa.commands, req)
+	return &adminProto.SendCommandResponse{CommandId: "cmd-1", Success: !fa.fail, Message: "Rotated"}, nil
+}
+
+func (fa *fakeAdmin) DrainNode(ctx context.Context, req *adminProto.DrainNodeRequest) (*adminProto.DrainNodeResponse, error) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+
+	fa.drains = append(fa.drains, req)
+	return &adminProto.DrainNodeResponse{Draining: !req.Resume, Message: "Draining"}, nil
+}
+
+// startFakeAdmin serves a fakeAdmin guarded by testAdminToken and returns its address
+func startFakeAdmin(t *testing.T) (*fakeAdmin, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	fa := &fakeAdmin{}
+	server := grpc.NewServer(utils.AdminTokenServerOptions(testAdminToken)...)
+	adminProto.RegisterAdminServer(server, fa)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return fa, listener.Addr().String()
+}
+
+// runCtl runs mydvpnctl with args as main does and returns what it wrote to stdout
+func runCtl(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	opts := &options{}
+	fs := newGlobalFlagSet(opts, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+
+	cmd, cmdArgs := findCommand(fs.Args())
+	if cmd == nil {
+		t.Fatalf("no command in %v", args)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var stdout bytes.Buffer
+	c := &ctl{options: opts, globals: fs, logger: logger, stdout: &stdout}
+	err := cmd.run(c, cmdArgs)
+	c.close()
+
+	return stdout.String(), err
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		path string
+		rest []string
+	}{
+		{args: []string{"peers", "list"}, path: "peers list", rest: []string{}},
+		{args: []string{"peer", "kick", "c1", "-reason", "maintenance"}, path: "peer kick", rest: []string{"c1", "-reason", "maintenance"}},
+		{args: []string{"peer", "revoke", "c1"}, path: "peer revoke", rest: []string{"c1"}},
+		{args: []string{"topology", "-o", "json"}, path: "topology", rest: []string{"-o", "json"}},
+		{args: []string{"peer"}},
+		{args: []string{"peers", "show"}},
+		{args: []string{"kick", "peer", "c1"}},
+		{args: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			cmd, rest := findCommand(tt.args)
+			if tt.path == "" {
+				if cmd != nil {
+					t.Fatalf("matched %q, want no command", cmd.path)
+				}
+				return
+			}
+			if cmd == nil || cmd.path != tt.path {
+				t.Fatalf("matched %v, want %q", cmd, tt.path)
+			}
+			if !reflect.DeepEqual(rest, tt.rest) {
+				t.Fatalf("arguments %q, want %q", rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional int
+		values     []string
+		reason     string
+		output     string
+		ok         bool
+	}{
+		{name: "flag after the argument", args: []string{"c1", "-reason", "maintenance"}, positional: 1, values: []string{"c1"}, reason: "maintenance", ok: true},
+		{name: "flag before the argument", args: []string{"-reason=maintenance", "c1"}, positional: 1, values: []string{"c1"}, reason: "maintenance", ok: true},
+		{name: "global flag among arguments", args: []string{"c1", "-o", "json"}, positional: 1, values: []string{"c1"}, output: outputJSON, ok: true},
+		{name: "no arguments", args: nil, positional: 0, ok: true},
+		{name: "missing argument", args: []string{"-reason", "maintenance"}, positional: 1},
+		{name: "extra argument", args: []string{"c1", "c2"}, positional: 1},
+		{name: "unknown flag", args: []string{"c1", "-force"}, positional: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &options{}
+			c := &ctl{options: opts, globals: newGlobalFlagSet(opts, flag.ContinueOnError)}
+
+			fs := newFlagSet(c, "peer kick")
+			fs.SetOutput(io.Discard)
+			reason := fs.String("reason", "", "")
+
+			values, err := parseArgs(fs, tt.args, tt.positional)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("parsed %q", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseArgs: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.values) || *reason != tt.reason {
+				t.Fatalf("values %q, reason %q; want %q, %q", values, *reason, tt.values, tt.reason)
+			}
+			if tt.output != "" && opts.output != tt.output {
+				t.Fatalf("output %q, want %q", opts.output, tt.output)
+			}
+		})
+	}
+}
+
+func TestPeerKick(t *testing.T) {
+	t.Setenv("MYDVPN_ADMIN_TOKEN", testAdminToken)
+	fa, addr := startFakeAdmin(t)
+
+	out, err := runCtl(t, "-insecure", "-supernode", addr, "peer", "kick", "c1", "-reason", "maintenance")
+	if err != nil {
+		t.Fatalf("peer kick: %v", err)
+	}
+	if len(fa.kicked) != 1 || fa.kicked[0].PeerId != "c1" || fa.kicked[0].Reason != "maintenance" {
+		t.Fatalf("admin API got %v, want c1 kicked for maintenance", fa.kicked)
+	}
+	if !strings.Contains(out, "Peer disconnected") {
+		t.Fatalf("output %q does not report the result", out)
+	}
+
+	// A kick without a peer never reaches the SuperNode
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "peer", "kick"); err == nil {
+		t.Fatal("peer kick without a peer ID succeeded")
+	}
+	if len(fa.kicked) != 1 {
+		t.Fatalf("admin API got %d kicks, want 1", len(fa.kicked))
+	}
+}
+
+func TestPeerRevoke(t *testing.T) {
+	t.Setenv("MYDVPN_ADMIN_TOKEN", testAdminToken)
+	fa, addr := startFakeAdmin(t)
+
+	out, err := runCtl(t, "-insecure", "-supernode", addr, "peer", "revoke", "c1", "-o", "json")
+	if err != nil {
+		t.Fatalf("peer revoke: %v", err)
+	}
+	if !reflect.DeepEqual(fa.revoked, []string{"c1"}) {
+		t.Fatalf("admin API revoked %v, want [c1]", fa.revoked)
+	}
+
+	var result resultView
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("output %q is not JSON: %v", out, err)
+	}
+	if !result.Success || result.Result["was_connected"] != "true" {
+		t.Fatalf("result %+v, want success for a connected peer", result)
+	}
+
+	// Failed actions make the command fail after printing the result
+	fa.fail = true
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "peer", "revoke", "c2"); err == nil {
+		t.Fatal("failed revoke was reported as success")
+	}
+}
+
+func TestExitRotate(t *testing.T) {
+	t.Setenv("MYDVPN_ADMIN_TOKEN", testAdminToken)
+	fa, addr := startFakeAdmin(t)
+
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "exit", "rotate", "-region", "r2", "c1", "-wait", "5s"); err != nil {
+		t.Fatalf("exit rotate: %v", err)
+	}
+	if len(fa.commands) != 1 {
+		t.Fatalf("admin API got %d commands, want 1", len(fa.commands))
+	}
+	cmd := fa.commands[0]
+	if cmd.PeerId != "c1" || cmd.Type != "ROTATE_PEER" || cmd.Payload["target_region"] != "r2" || cmd.TimeoutSeconds != 5 {
+		t.Fatalf("admin API got %v, want ROTATE_PEER of c1 to r2 within 5s", cmd)
+	}
+
+	// Without -region the SuperNode keeps the client's region
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "exit", "rotate", "c1"); err != nil {
+		t.Fatalf("exit rotate: %v", err)
+	}
+	if _, set := fa.commands[1].Payload["target_region"]; set {
+		t.Fatalf("payload %v, want no target region", fa.commands[1].Payload)
+	}
+}
+
+func TestSupernodeDrain(t *testing.T) {
+	t.Setenv("MYDVPN_ADMIN_TOKEN", testAdminToken)
+	fa, addr := startFakeAdmin(t)
+
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "supernode", "drain", "-disconnect-peers"); err != nil {
+		t.Fatalf("supernode drain: %v", err)
+	}
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "supernode", "drain", "-resume"); err != nil {
+		t.Fatalf("supernode drain -resume: %v", err)
+	}
+
+	if len(fa.drains) != 2 || fa.drains[0].Resume || !fa.drains[0].DisconnectPeers || !fa.drains[1].Resume || fa.drains[1].DisconnectPeers {
+		t.Fatalf("admin API got %v, want a drain with disconnects, then a resume", fa.drains)
+	}
+}
+
+func TestAdminCallsNeedToken(t *testing.T) {
+	fa, addr := startFakeAdmin(t)
+
+	t.Setenv("MYDVPN_ADMIN_TOKEN", "")
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "peer", "kick", "c1"); err == nil {
+		t.Fatal("peer kick without an admin token succeeded")
+	}
+
+	t.Setenv("MYDVPN_ADMIN_TOKEN", "wrong-admin-token-0123456789")
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "peer", "kick", "c1"); err == nil {
+		t.Fatal("peer kick with the wrong admin token succeeded")
+	}
+
+	if len(fa.kicked) != 0 {
+		t.Fatalf("admin API got %v, want no kicks", fa.kicked)
+	}
+}
+
+func TestUnknownOutputFormat(t *testing.T) {
+	t.Setenv("MYDVPN_ADMIN_TOKEN", testAdminToken)
+	_, addr := startFakeAdmin(t)
+
+	if _, err := runCtl(t, "-insecure", "-supernode", addr, "-o", "yaml", "peer", "kick", "c1"); err == nil {
+		t.Fatal("unknown output format was accepted")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Output formats accepted by -o
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// command is a mydvpnctl subcommand such as "peers list"
+type command struct {
+	path    string
+	args    string
+	summary string
+	run     func(c *ctl, args []string) error
+}
+
+// commands lists every subcommand in the order shown by usage
+var commands = []command{
+	{"supernodes list", "", "List SuperNodes registered with the BaseNode", runSupernodesList},
+	{"supernode drain", "[-resume] [-disconnect-peers]", "Drain the SuperNode, or resume it", runSupernodeDrain},
+	{"peers list", "[-region R] [-role R]", "List peers connected to the SuperNode", runPeersList},
+	{"peer show", "<peer-id>", "Show a connected peer and its stream statistics", runPeerShow},
+	{"peer kick", "<peer-id> [-reason TEXT]", "Disconnect a peer; it stays away until restarted", runPeerKick},
+	{"peer revoke", "<peer-id>", "Revoke a peer in the registry and disconnect it", runPeerRevoke},
+	{"exit rotate", "<client-id> [-region R]", "Move a client to a new exit peer", runExitRotate},
+	{"relays list", "", "List relay forwarding rules on the SuperNode", runRelaysList},
+	{"topology", "", "Show regions, SuperNodes and, with -admin-port, their peers", runTopology},
+}
+
+func main() {
+	opts := &options{}
+	fs := newGlobalFlagSet(opts, flag.ExitOnError)
+	fs.Usage = func() { usage(fs, os.Stderr) }
+	fs.Parse(os.Args[1:])
+
+	cmd, args := findCommand(fs.Args())
+	if cmd == nil {
+		usage(fs, os.Stderr)
+		os.Exit(2)
+	}
+
+	// Only warnings from the shared packages are worth showing on a terminal
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(logrus.WarnLevel)
+
+	c := &ctl{
+		options: opts,
+		globals: fs,
+		logger:  logger,
+		stdout:  os.Stdout,
+	}
+
+	err := cmd.run(c, args)
+	c.close()
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fail(err)
+	}
+}
+
+// newGlobalFlagSet registers the global flags into opts
+func newGlobalFlagSet(opts *options, errorHandling flag.ErrorHandling) *flag.FlagSet {
+	fs := flag.NewFlagSet("mydvpnctl", errorHandling)
+	fs.StringVar(&opts.basenodes, "basenode", "localhost:50051", "BaseNode address, or a comma-separated list of BaseNode cluster members")
+	fs.StringVar(&opts.supernode, "supernode", "127.0.0.1:50053", "SuperNode admin API address")
+	fs.IntVar(&opts.adminPort, "admin-port", 0, "Admin API port of every SuperNode, used by topology to reach them")
+	fs.StringVar(&opts.tokenFile, "admin-token-file", "", "File containing the admin API token (default $MYDVPN_ADMIN_TOKEN)")
+	fs.StringVar(&opts.output, "o", outputTable, "Output format (table, json)")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "Timeout for each API call")
+	opts.tls = utils.RegisterTLSFlags(fs)
+	return fs
+}
+
+// findCommand matches the longest subcommand path at the start of args
+func findCommand(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].path)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].path {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+// usage prints the subcommands and global flags
+func usage(fs *flag.FlagSet, w io.Writer) {
+	fmt.Fprintf(w, "Usage: mydvpnctl [flags] <command> [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-46s %s\n", strings.TrimSpace(cmd.path+" "+cmd.args), cmd.summary)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// fail prints an error and exits
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "mydvpnctl: %s\n", describeError(err))
+	os.Exit(1)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// table is rendered with aligned columns, or as JSON from its source value
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+// addRow appends a row of cells
+func (t *table) addRow(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// write renders the table with aligned columns
+func (t *table) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// emit writes value as JSON with -o json, and otherwise calls render
+func (c *ctl) emit(value interface{}, render func(w io.Writer) error) error {
+	switch c.output {
+	case outputJSON:
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(c.stdout, string(data))
+		return err
+	case outputTable:
+		return render(c.stdout)
+	default:
+		return fmt.Errorf("unknown output format %q (want table or json)", c.output)
+	}
+}
+
+// emitTable writes value as JSON with -o json, and otherwise the table
+func (c *ctl) emitTable(value interface{}, t *table) error {
+	return c.emit(value, t.write)
+}
+
+// formatAge renders a Unix timestamp as time elapsed, e.g. "42s"
+func formatAge(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+
+	age := time.Since(time.Unix(unix, 0))
+	switch {
+	case age < 0:
+		return "0s"
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
+
+// orDash renders empty values as "-"
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -2,21 +2,51 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	baseclient "myDvpn/base/client"
+	"myDvpn/super/dataplane"
 	"myDvpn/super/server"
+	"myDvpn/utils"
+	"myDvpn/utils/ipam"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	// Keystore management subcommands
+	if handled, err := utils.RunKeystoreCommand(os.Args[1:], "supernode-1", os.Stdout); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Parse command line flags
 	id := flag.String("id", "supernode-1", "SuperNode ID")
 	region := flag.String("region", "us-east-1", "Region")
 	listenAddr := flag.String("listen", "0.0.0.0:50052", "Address to listen on")
-	baseNodeAddr := flag.String("basenode", "localhost:50051", "BaseNode address")
+	baseNodeAddr := flag.String("basenode", "localhost:50051", "BaseNode address, or a comma-separated list of BaseNode cluster members")
+	firewallKind := flag.String("firewall", utils.FirewallIptables, "Firewall backend for relay rules (iptables, nftables, memory)")
+	externalInterface := flag.String("external-interface", "eth0", "External interface relayed traffic leaves through")
+	relayInterface := flag.String("relay-interface", "wg-relay", "WireGuard interface relayed clients connect to")
+	relayPort := flag.Int("relay-port", 0, "WireGuard listen port of the relay interface (no relay interface when 0)")
+	leaseDir := flag.String("lease-dir", "", "Directory for relayed client address leases (default <config dir>/mydvpn/leases/<id>)")
+	wgBackend := flag.String("wg-backend", utils.BackendKernel, "WireGuard backend for the relay interface (kernel, userspace, channel, memory)")
+	registryPath := flag.String("peer-registry", "", "Peer registry file (pinned and provisioned peer keys)")
+	registryMode := flag.String("peer-registry-mode", server.RegistryModeTOFU, "Unknown peers: tofu (pin key on first use) or strict (reject)")
+	exitSelection := flag.String("exit-selection", server.ExitSelectionLeastClients, "Exit selection strategy (least-clients, lowest-rtt, weighted-random, consistent-hash)")
+	maxPeers := flag.Int("max-peers", 1000, "Peer streams this SuperNode accepts, reported to the BaseNode as its capacity")
+	relayBandwidth := flag.Int64("relay-bandwidth-mbps", 0, "Relay bandwidth this SuperNode can carry, reported to the BaseNode (0 if unknown)")
+	adminAddr := flag.String("admin-listen", "", "Serve the admin API on this address (e.g. 127.0.0.1:50053); disabled when empty")
+	adminTokenFile := flag.String("admin-token-file", "", "File containing the admin API token (default $MYDVPN_ADMIN_TOKEN)")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	tlsOpts := utils.RegisterTLSFlags(flag.CommandLine)
+	keystoreOpts := utils.RegisterKeystoreFlags(flag.CommandLine)
+	metricsOpts := utils.RegisterMetricsFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Setup logger
@@ -27,8 +57,82 @@ func main() {
 	}
 	logger.SetLevel(level)
 
+	// Load persistent identity
+	keystore, err := keystoreOpts.Load(*id, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load keystore")
+	}
+	logger.WithField("identity", utils.PublicKeyToBase64(keystore.Identity.PublicKey)).Info("Loaded keystore")
+
+	// Setup transport credentials
+	creds, err := utils.NewTLSCredentials(tlsOpts, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to configure TLS")
+	}
+
 	// Create SuperNode
-	superNode := server.NewSuperNode(*id, *region, *listenAddr, *baseNodeAddr, logger)
+	superNode := server.NewSuperNode(*id, *region, *listenAddr, baseclient.ParseAddrs(*baseNodeAddr), creds, logger)
+
+	// Create peer registry
+	registry, err := server.NewPeerRegistry(*registryMode, *registryPath, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load peer registry")
+	}
+	superNode.SetPeerRegistry(registry)
+
+	// Configure exit selection
+	selector, err := server.NewExitSelector(*exitSelection)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid exit selection strategy")
+	}
+	superNode.SetExitSelector(selector)
+	superNode.SetCapacity(*maxPeers, *relayBandwidth*1000*1000)
+
+	// Create firewall backend for relay rules
+	firewall, err := utils.NewFirewall(*firewallKind, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create firewall")
+	}
+	superNode.SetRelayManager(dataplane.NewRelayManager(logger, *externalInterface, firewall))
+
+	// Create the WireGuard relay interface
+	if *relayPort > 0 {
+		wgManager, err := utils.NewWireGuardBackend(*wgBackend, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create WireGuard backend")
+		}
+		relayDataplane, err := dataplane.NewWireGuardDataplane(*relayInterface, *relayPort, wgManager, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create relay interface")
+		}
+		if *leaseDir == "" {
+			*leaseDir = ipam.DefaultDir(*id)
+		}
+		if err := relayDataplane.SetLeaseDir(*leaseDir); err != nil {
+			logger.WithError(err).Fatal("Failed to load address leases")
+		}
+		superNode.SetRelayDataplane(relayDataplane)
+	}
+
+	// Enable the operator API
+	if *adminAddr != "" {
+		token, err := utils.ReadAdminToken(*adminTokenFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load admin token")
+		}
+		superNode.SetAdmin(*adminAddr, token)
+	}
+
+	// Expose Prometheus metrics
+	if metricsOpts.Enabled() {
+		registry := utils.NewMetricsRegistry()
+		if err := superNode.RegisterMetrics(registry); err != nil {
+			logger.WithError(err).Fatal("Failed to register metrics")
+		}
+		if _, err := metricsOpts.Serve(registry, logger); err != nil {
+			logger.WithError(err).Fatal("Failed to start metrics server")
+		}
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -9,7 +9,10 @@ import (
 	"strings"
 	"syscall"
 
+	baseclient "myDvpn/base/client"
 	"myDvpn/clientPeer/client"
+	"myDvpn/utils"
+	"myDvpn/utils/ipam"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,13 +24,30 @@ type UIInterface struct {
 }
 
 func main() {
+	// Keystore management subcommands
+	if handled, err := utils.RunKeystoreCommand(os.Args[1:], "peer-1", os.Stdout); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Parse command line flags
 	id := flag.String("id", "peer-1", "Peer ID")
 	region := flag.String("region", "us-east-1", "Region")
-	supernodeAddr := flag.String("supernode", "localhost:50052", "SuperNode address")
+	supernodeAddr := flag.String("supernode", "localhost:50052", "SuperNode address, or a comma-separated list in order of preference")
+	baseNodeAddr := flag.String("basenode", "", "BaseNode address(es) to look up backup SuperNodes of the region on (optional)")
 	exitPort := flag.Int("exit-port", 51820, "WireGuard listen port for exit mode")
+	leaseDir := flag.String("lease-dir", "", "Directory for exit client address leases (default <config dir>/mydvpn/leases/<id>)")
+	ipv6 := flag.Bool("ipv6", true, "Give exit clients IPv6 with NAT66 (their IPv6 traffic is dropped when off or unavailable)")
+	wgBackend := flag.String("wg-backend", utils.BackendKernel, "WireGuard backend (kernel, userspace, channel, memory)")
+	firewallKind := flag.String("firewall", utils.FirewallIptables, "Firewall backend for NAT rules (iptables, nftables, memory)")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
 	noUI := flag.Bool("no-ui", false, "Disable interactive UI")
+	tlsOpts := utils.RegisterTLSFlags(flag.CommandLine)
+	keystoreOpts := utils.RegisterKeystoreFlags(flag.CommandLine)
+	metricsOpts := utils.RegisterMetricsFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Setup logger
@@ -38,11 +58,44 @@ func main() {
 	}
 	logger.SetLevel(level)
 
+	// Load persistent identity
+	keystore, err := keystoreOpts.Load(*id, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load keystore")
+	}
+	logger.WithField("identity", utils.PublicKeyToBase64(keystore.Identity.PublicKey)).Info("Loaded keystore")
+
+	// Setup transport credentials
+	creds, err := utils.NewTLSCredentials(tlsOpts, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to configure TLS")
+	}
+
+	// Create WireGuard backend
+	wgManager, err := utils.NewWireGuardBackend(*wgBackend, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create WireGuard backend")
+	}
+
+	// Create firewall backend
+	firewall, err := utils.NewFirewall(*firewallKind, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create firewall")
+	}
+
 	// Create unified peer
-	peer, err := client.NewUnifiedPeer(*id, *region, *supernodeAddr, *exitPort, logger)
+	peer, err := client.NewUnifiedPeer(*id, *region, *supernodeAddr, *exitPort, wgManager, firewall, keystore, creds, logger)
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to create unified peer")
 	}
+	peer.SetBaseNodes(baseclient.ParseAddrs(*baseNodeAddr))
+	peer.SetIPv6(*ipv6)
+	if *leaseDir == "" {
+		*leaseDir = ipam.DefaultDir(*id)
+	}
+	if err := peer.SetLeaseDir(*leaseDir); err != nil {
+		logger.WithError(err).Fatal("Failed to load address leases")
+	}
 
 	// Setup UI callbacks
 	peer.SetModeChangedCallback(func(mode client.PeerMode) {
@@ -62,6 +115,17 @@ func main() {
 		printPrompt()
 	})
 
+	// Expose Prometheus metrics
+	if metricsOpts.Enabled() {
+		registry := utils.NewMetricsRegistry()
+		if err := peer.RegisterMetrics(registry); err != nil {
+			logger.WithError(err).Fatal("Failed to register metrics")
+		}
+		if _, err := metricsOpts.Serve(registry, logger); err != nil {
+			logger.WithError(err).Fatal("Failed to start metrics server")
+		}
+	}
+
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -140,6 +204,9 @@ func (ui *UIInterface) handleCommand(input string) {
 	case "toggle-exit", "te":
 		ui.handleToggleExit(parts)
 		
+	case "hybrid", "hy":
+		ui.handleHybrid(parts)
+		
 	case "connect", "c":
 		ui.handleConnect(parts)
 		
@@ -168,6 +235,8 @@ func (ui *UIInterface) printHelp() {
 	fmt.Println("  status (s)         - Show current status")
 	fmt.Println("  toggle-exit (te)   - Toggle exit node mode on/off")
 	fmt.Println("                       Usage: toggle-exit on|off")
+	fmt.Println("  hybrid (hy)        - Serve as exit while keeping your own exit")
+	fmt.Println("                       Usage: hybrid on|off")
 	fmt.Println("  connect (c)        - Connect to exit peer")
 	fmt.Println("                       Usage: connect [region]")
 	fmt.Println("  disconnect (d)     - Disconnect from current exit")
@@ -219,16 +288,38 @@ func (ui *UIInterface) handleToggleExit(parts []string) {
 	if enabled {
 		fmt.Println("✅ Exit mode enabled - You are now providing VPN services!")
 		fmt.Println("   Other peers can connect through you.")
+		fmt.Println("   Your own exit connection was closed; use 'hybrid on' to keep one.")
 	} else {
 		fmt.Println("✅ Exit mode disabled - You are now in client-only mode.")
 	}
 }
 
+func (ui *UIInterface) handleHybrid(parts []string) {
+	if len(parts) < 2 {
+		fmt.Println("❌ Usage: hybrid on|off")
+		return
+	}
+	
+	enabled := strings.ToLower(parts[1]) == "on"
+	
+	if err := ui.peer.SetHybridMode(enabled); err != nil {
+		fmt.Printf("❌ Failed to switch hybrid mode: %v\n", err)
+		return
+	}
+	
+	if enabled {
+		fmt.Println("✅ Hybrid mode enabled - You are providing VPN services")
+		fmt.Println("   and can still connect through another exit.")
+	} else {
+		fmt.Println("✅ Hybrid mode disabled - You are now in client-only mode.")
+	}
+}
+
 func (ui *UIInterface) handleConnect(parts []string) {
 	currentMode := ui.peer.GetCurrentMode()
 	if currentMode != client.ModeClient && currentMode != client.ModeHybrid {
 		fmt.Println("❌ Cannot connect: peer is not in client mode")
-		fmt.Println("   Use 'toggle-exit off' to enable client mode")
+		fmt.Println("   Use 'toggle-exit off' or 'hybrid on' to enable client mode")
 		return
 	}
 	
@@ -287,6 +378,9 @@ func (ui *UIInterface) printActiveClients() {
 	for i, client := range clients {
 		fmt.Printf("  %d. %s\n", i+1, client.ClientID)
 		fmt.Printf("     IP: %s\n", client.AllocatedIP)
+		if client.AllocatedIP6 != "" {
+			fmt.Printf("     IPv6: %s\n", client.AllocatedIP6)
+		}
 		fmt.Printf("     Connected: %s\n", client.ConnectedAt.Format("2006-01-02 15:04:05"))
 		fmt.Printf("     Session: %s\n", client.SessionID)
 		fmt.Println()
@@ -2,12 +2,16 @@ package exitpeer
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"myDvpn/clientPeer/client"
 	"myDvpn/clientPeer/proto"
 	"myDvpn/utils"
+	"myDvpn/utils/ipam"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -20,7 +24,8 @@ type ExitPeer struct {
 	logger          *logrus.Logger
 	
 	streamManager   *client.PersistentStreamManager
-	wgManager       *utils.WireGuardManager
+	wgManager       utils.WireGuardBackend
+	firewall        utils.Firewall
 	
 	// WireGuard configuration
 	interfaceName   string
@@ -30,7 +35,10 @@ type ExitPeer struct {
 	// Client management
 	activeClients   map[string]*ClientInfo
 	clientsMux      sync.RWMutex
-	ipAllocator     *IPAllocator
+	ipPool          *ipam.Pool
+	ip6Pool         *ipam.Pool
+	maxClients      int // 0 means no limit beyond the IP pool
+	ipv6            bool // Clients get IPv6 with NAT66; without it their IPv6 is dropped
 }
 
 // ClientInfo represents information about a connected client
@@ -38,65 +46,38 @@ type ClientInfo struct {
 	ClientID      string
 	PublicKey     string
 	AllocatedIP   string
+	AllocatedIP6  string // Empty when the exit has no IPv6
 	AllowedIPs    []string
 	SessionID     string
 	SetupTime     int64
+	Activated     bool // Set once the SuperNode confirms the client applied the session
 }
 
-// IPAllocator manages IP allocation for clients
-type IPAllocator struct {
-	cidr      string
-	usedIPs   map[string]bool
-	mutex     sync.Mutex
-}
-
-// NewIPAllocator creates a new IP allocator
-func NewIPAllocator(cidr string) *IPAllocator {
-	return &IPAllocator{
-		cidr:    cidr,
-		usedIPs: make(map[string]bool),
-	}
-}
-
-// AllocateIP allocates an IP address for a client
-func (ia *IPAllocator) AllocateIP() (string, error) {
-	ia.mutex.Lock()
-	defer ia.mutex.Unlock()
-
-	ip, err := utils.AllocateClientIP(ia.cidr, ia.usedIPs)
-	if err != nil {
-		return "", err
-	}
-
-	ia.usedIPs[ip] = true
-	return ip, nil
-}
-
-// ReleaseIP releases an IP address
-func (ia *IPAllocator) ReleaseIP(ip string) {
-	ia.mutex.Lock()
-	defer ia.mutex.Unlock()
-	delete(ia.usedIPs, ip)
-}
+// unconfirmedClientTTL is how long a client set up by SETUP_EXIT is kept
+// without ACTIVATE_EXIT before the exit releases it on its own
+const unconfirmedClientTTL = 3 * time.Minute
 
 // NewExitPeer creates a new exit peer
-func NewExitPeer(id, region, supernodeAddr string, listenPort int, logger *logrus.Logger) (*ExitPeer, error) {
+func NewExitPeer(id, region, supernodeAddr string, listenPort int, wgManager utils.WireGuardBackend, firewall utils.Firewall, keystore *utils.Keystore, creds *utils.TLSCredentials, logger *logrus.Logger) (*ExitPeer, error) {
 	// Create persistent stream manager
-	streamManager, err := client.NewPersistentStreamManager(id, "exit", region, supernodeAddr, logger)
+	streamManager, err := client.NewPersistentStreamManager(id, "exit", region, supernodeAddr, keystore.Identity, creds, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream manager: %w", err)
 	}
 
-	// Create WireGuard manager
-	wgManager, err := utils.NewWireGuardManager()
+	// WireGuard key from the keystore so the exit keeps its identity across restarts
+	privateKey, err := keystore.WireGuardKey(utils.WireGuardKeyExit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create WireGuard manager: %w", err)
+		return nil, err
 	}
 
-	// Generate private key
-	privateKey, err := utils.GenerateKey()
+	ipPool, err := ipam.NewPool(utils.ExitPoolIPv4) // Exit peer network
+	if err != nil {
+		return nil, err
+	}
+	ip6Pool, err := ipam.NewPool(utils.ExitPoolIPv6)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate private key: %w", err)
+		return nil, err
 	}
 
 	ep := &ExitPeer{
@@ -106,11 +87,14 @@ func NewExitPeer(id, region, supernodeAddr string, listenPort int, logger *logru
 		logger:        logger,
 		streamManager: streamManager,
 		wgManager:     wgManager,
+		firewall:      firewall,
 		interfaceName: fmt.Sprintf("wg-exit-%s", id),
 		privateKey:    privateKey,
 		listenPort:    listenPort,
 		activeClients: make(map[string]*ClientInfo),
-		ipAllocator:   NewIPAllocator("10.9.0.0/24"), // Exit peer network
+		ipPool:        ipPool,
+		ip6Pool:       ip6Pool,
+		ipv6:          true,
 	}
 
 	// Register custom command handlers
@@ -119,6 +103,33 @@ func NewExitPeer(id, region, supernodeAddr string, listenPort int, logger *logru
 	return ep, nil
 }
 
+// SetMaxClients limits how many clients the exit accepts and advertises the
+// limit to the SuperNode; 0 removes the limit
+func (ep *ExitPeer) SetMaxClients(maxClients int) {
+	ep.maxClients = maxClients
+	ep.streamManager.SetMaxClients(maxClients)
+}
+
+// SetIPv6 turns IPv6 for clients on or off. It is also turned off at start
+// if the host cannot forward IPv6; clients' IPv6 traffic is then dropped.
+func (ep *ExitPeer) SetIPv6(enabled bool) {
+	ep.ipv6 = enabled
+}
+
+// SetLeaseDir keeps the client address leases in dir so that clients get the
+// same addresses after a restart
+func (ep *ExitPeer) SetLeaseDir(dir string) error {
+	if err := ep.ipPool.Load(filepath.Join(dir, "ipv4.json")); err != nil {
+		return err
+	}
+	return ep.ip6Pool.Load(filepath.Join(dir, "ipv6.json"))
+}
+
+// SetBaseNodes lets the peer fail over to SuperNodes of its region listed on these BaseNodes
+func (ep *ExitPeer) SetBaseNodes(addrs []string) {
+	ep.streamManager.SetBaseNodes(addrs)
+}
+
 // Start starts the exit peer
 func (ep *ExitPeer) Start() error {
 	// Initialize WireGuard interface
@@ -136,6 +147,8 @@ func (ep *ExitPeer) Start() error {
 		return fmt.Errorf("failed to start stream manager: %w", err)
 	}
 
+	go ep.unconfirmedClientCollector()
+
 	ep.logger.WithFields(logrus.Fields{
 		"peer_id":    ep.id,
 		"region":     ep.region,
@@ -161,6 +174,11 @@ func (ep *ExitPeer) Stop() error {
 	// Stop stream manager
 	ep.streamManager.Stop()
 
+	// Remove NAT rules
+	if err := ep.firewall.Remove(exitRuleSetID(ep.interfaceName)); err != nil {
+		ep.logger.WithError(err).Warn("Failed to remove NAT rules")
+	}
+
 	// Cleanup WireGuard
 	if err := ep.cleanupWireGuard(); err != nil {
 		ep.logger.WithError(err).Warn("Failed to cleanup WireGuard interface")
@@ -193,7 +211,11 @@ func (ep *ExitPeer) initializeWireGuard() error {
 	}
 
 	// Set interface IP
-	if err := ep.wgManager.SetInterfaceIP(ep.interfaceName, "10.9.0.1/24"); err != nil {
+	gateway, err := utils.PoolGateway(utils.ExitPoolIPv4)
+	if err != nil {
+		return err
+	}
+	if err := ep.wgManager.SetInterfaceIP(ep.interfaceName, gateway); err != nil {
 		return fmt.Errorf("failed to set interface IP: %w", err)
 	}
 
@@ -209,26 +231,60 @@ func (ep *ExitPeer) cleanupWireGuard() error {
 // enableForwarding enables IP forwarding and NAT
 func (ep *ExitPeer) enableForwarding() error {
 	// Enable IP forwarding
-	if err := utils.EnableIPForwarding(); err != nil {
+	if err := ep.firewall.EnableForwarding(); err != nil {
 		return fmt.Errorf("failed to enable IP forwarding: %w", err)
 	}
 
-	// Add NAT rule (assuming eth0 as external interface)
-	if err := utils.AddNATRule(ep.interfaceName, "eth0"); err != nil {
+	clientCIDR6 := ""
+	if ep.ipv6 {
+		if err := ep.enableIPv6(); err != nil {
+			ep.logger.WithError(err).Warn("IPv6 unavailable, blocking clients' IPv6 traffic")
+			ep.ipv6 = false
+		} else {
+			clientCIDR6 = utils.ExitPoolIPv6
+		}
+	}
+
+	// Add NAT rules (assuming eth0 as external interface)
+	if err := ep.firewall.Apply(utils.ExitNATRuleSet(exitRuleSetID(ep.interfaceName), ep.interfaceName, utils.ExitPoolIPv4, clientCIDR6, "eth0")); err != nil {
 		return fmt.Errorf("failed to add NAT rule: %w", err)
 	}
 
-	ep.logger.Info("IP forwarding and NAT enabled")
+	ep.logger.WithField("ipv6", ep.ipv6).Info("IP forwarding and NAT enabled")
+	return nil
+}
+
+// enableIPv6 turns on IPv6 forwarding and gives the interface its IPv6 gateway address
+func (ep *ExitPeer) enableIPv6() error {
+	if err := ep.firewall.EnableIPv6Forwarding(); err != nil {
+		return err
+	}
+
+	gateway, err := utils.PoolGateway(utils.ExitPoolIPv6)
+	if err != nil {
+		return err
+	}
+	if err := ep.wgManager.SetInterfaceIP(ep.interfaceName, gateway); err != nil {
+		return fmt.Errorf("failed to set interface IPv6 address: %w", err)
+	}
 	return nil
 }
 
+// exitRuleSetID names the firewall rule set for an exit interface
+func exitRuleSetID(interfaceName string) string {
+	return "exit-" + interfaceName
+}
+
 // registerCommandHandlers registers custom command handlers for exit peer
 func (ep *ExitPeer) registerCommandHandlers() {
 	// Override the SETUP_EXIT handler
 	ep.streamManager.RegisterCommandHandler(proto.CommandType_SETUP_EXIT, ep.handleSetupExit)
+	ep.streamManager.RegisterCommandHandler(proto.CommandType_ACTIVATE_EXIT, ep.handleActivateExit)
+	ep.streamManager.RegisterCommandHandler(proto.CommandType_TEARDOWN_EXIT, ep.handleTeardownExit)
 }
 
-// handleSetupExit handles SETUP_EXIT commands from SuperNode
+// handleSetupExit handles SETUP_EXIT commands from SuperNode. It is idempotent
+// per session_id: a retry returns the allocation made by the first attempt.
 func (ep *ExitPeer) handleSetupExit(cmd *proto.Command) *proto.CommandResponse {
 	clientID := cmd.Payload["client_id"]
 	clientPubKey := cmd.Payload["client_pubkey"]
@@ -260,6 +316,9 @@ func (ep *ExitPeer) handleSetupExit(cmd *proto.Command) *proto.CommandResponse {
 	result := make(map[string]string)
 	if clientInfo != nil {
 		result["allocated_ip"] = clientInfo.AllocatedIP
+		if clientInfo.AllocatedIP6 != "" {
+			result["allocated_ip6"] = clientInfo.AllocatedIP6
+		}
 		result["endpoint"] = fmt.Sprintf("0.0.0.0:%d", ep.listenPort) // Will be replaced with actual IP
 		result["public_key"] = ep.privateKey.PublicKey().String()
 	}
@@ -272,36 +331,155 @@ func (ep *ExitPeer) handleSetupExit(cmd *proto.Command) *proto.CommandResponse {
 	}
 }
 
+// handleActivateExit marks a client's session as confirmed so it is kept
+func (ep *ExitPeer) handleActivateExit(cmd *proto.Command) *proto.CommandResponse {
+	clientID := cmd.Payload["client_id"]
+	sessionID := cmd.Payload["session_id"]
+
+	ep.clientsMux.Lock()
+	defer ep.clientsMux.Unlock()
+
+	clientInfo, exists := ep.activeClients[clientID]
+	if !exists || clientInfo.SessionID != sessionID {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   fmt.Sprintf("session %s is not set up", sessionID),
+		}
+	}
+
+	clientInfo.Activated = true
+
+	ep.logger.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"session_id": sessionID,
+	}).Info("Activated client session")
+
+	return &proto.CommandResponse{
+		CommandId: cmd.CommandId,
+		Success:   true,
+		Message:   "Session activated",
+	}
+}
+
+// handleTeardownExit undoes SETUP_EXIT for a session. Tearing down a session
+// that is already gone succeeds, so the SuperNode can retry it freely.
+func (ep *ExitPeer) handleTeardownExit(cmd *proto.Command) *proto.CommandResponse {
+	clientID := cmd.Payload["client_id"]
+	sessionID := cmd.Payload["session_id"]
+
+	ep.clientsMux.Lock()
+	defer ep.clientsMux.Unlock()
+
+	clientInfo, exists := ep.activeClients[clientID]
+	if !exists || clientInfo.SessionID != sessionID {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   true,
+			Message:   "Session already torn down",
+		}
+	}
+
+	if err := ep.removeClientUnsafe(clientID); err != nil {
+		return &proto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   false,
+			Message:   fmt.Sprintf("Failed to remove client: %v", err),
+		}
+	}
+
+	ep.logger.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"session_id": sessionID,
+		"reason":     cmd.Payload["reason"],
+	}).Info("Tore down client session")
+
+	return &proto.CommandResponse{
+		CommandId: cmd.CommandId,
+		Success:   true,
+		Message:   "Session torn down",
+	}
+}
+
+// unconfirmedClientCollector releases clients whose sessions were never activated
+func (ep *ExitPeer) unconfirmedClientCollector() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ep.clientsMux.Lock()
+		for clientID, clientInfo := range ep.activeClients {
+			if clientInfo.Activated || time.Since(time.Unix(clientInfo.SetupTime, 0)) < unconfirmedClientTTL {
+				continue
+			}
+			ep.logger.WithFields(logrus.Fields{
+				"client_id":  clientID,
+				"session_id": clientInfo.SessionID,
+			}).Warn("Releasing client whose session was never confirmed")
+			if err := ep.removeClientUnsafe(clientID); err != nil {
+				ep.logger.WithError(err).WithField("client_id", clientID).Warn("Failed to release unconfirmed client")
+			}
+		}
+		ep.clientsMux.Unlock()
+	}
+}
+
 // addClient adds a new client to the exit peer
 func (ep *ExitPeer) addClient(clientID, clientPubKey, sessionID, allowedIPs string) error {
 	ep.clientsMux.Lock()
 	defer ep.clientsMux.Unlock()
 
-	// Check if client already exists
-	if _, exists := ep.activeClients[clientID]; exists {
-		return fmt.Errorf("client %s already exists", clientID)
+	// A retried SETUP_EXIT for the same session keeps the existing allocation;
+	// a new session from the same client replaces the old one
+	if existing, exists := ep.activeClients[clientID]; exists {
+		if existing.SessionID == sessionID {
+			if existing.PublicKey != clientPubKey {
+				return fmt.Errorf("session %s is already set up with a different public key", sessionID)
+			}
+			ep.logger.WithFields(logrus.Fields{
+				"client_id":  clientID,
+				"session_id": sessionID,
+			}).Info("Client already set up for session")
+			return nil
+		}
+		if err := ep.removeClientUnsafe(clientID); err != nil {
+			return fmt.Errorf("failed to replace previous session %s: %w", existing.SessionID, err)
+		}
+	}
+
+	if ep.maxClients > 0 && len(ep.activeClients) >= ep.maxClients {
+		return fmt.Errorf("exit peer is at capacity (%d clients)", ep.maxClients)
 	}
 
-	// Allocate IP for client
-	allocatedIP, err := ep.ipAllocator.AllocateIP()
+	// Lease IPs for client; a returning client gets its previous addresses
+	allocatedIP, err := ep.ipPool.Allocate(clientID)
 	if err != nil {
 		return fmt.Errorf("failed to allocate IP: %w", err)
 	}
 
+	var allocatedIP6 string
+	if ep.ipv6 {
+		allocatedIP6, err = ep.ip6Pool.Allocate(clientID)
+		if err != nil {
+			ep.releaseIPs(clientID)
+			return fmt.Errorf("failed to allocate IPv6 address: %w", err)
+		}
+	}
+
 	// Parse allowed IPs
-	allowedIPList := []string{allowedIPs}
+	allowedIPList := strings.Split(allowedIPs, ",")
 	if allowedIPs == "" {
-		allowedIPList = []string{"0.0.0.0/0"} // Default to all traffic
+		allowedIPList = utils.FullTunnelAllowedIPs() // Default to all traffic
 	}
 
 	// Add peer to WireGuard
 	peerConfig := utils.PeerConfig{
 		PublicKey:  clientPubKey,
-		AllowedIPs: []string{fmt.Sprintf("%s/32", allocatedIP)},
+		AllowedIPs: utils.TunnelAddresses(allocatedIP, allocatedIP6),
 	}
 
 	if err := ep.wgManager.AddPeer(ep.interfaceName, peerConfig); err != nil {
-		ep.ipAllocator.ReleaseIP(allocatedIP)
+		ep.releaseIPs(clientID)
 		return fmt.Errorf("failed to add peer to WireGuard: %w", err)
 	}
 
@@ -309,18 +487,20 @@ func (ep *ExitPeer) addClient(clientID, clientPubKey, sessionID, allowedIPs stri
 	clientInfo := &ClientInfo{
 		ClientID:    clientID,
 		PublicKey:   clientPubKey,
-		AllocatedIP: allocatedIP,
-		AllowedIPs:  allowedIPList,
-		SessionID:   sessionID,
-		SetupTime:   time.Now().Unix(),
+		AllocatedIP:  allocatedIP,
+		AllocatedIP6: allocatedIP6,
+		AllowedIPs:   allowedIPList,
+		SessionID:    sessionID,
+		SetupTime:    time.Now().Unix(),
 	}
 
 	ep.activeClients[clientID] = clientInfo
 
 	ep.logger.WithFields(logrus.Fields{
-		"client_id":    clientID,
-		"allocated_ip": allocatedIP,
-		"session_id":   sessionID,
+		"client_id":     clientID,
+		"allocated_ip":  allocatedIP,
+		"allocated_ip6": allocatedIP6,
+		"session_id":    sessionID,
 	}).Info("Added client to exit peer")
 
 	return nil
@@ -346,7 +526,7 @@ func (ep *ExitPeer) removeClientUnsafe(clientID string) error {
 	}
 
 	// Release IP
-	ep.ipAllocator.ReleaseIP(clientInfo.AllocatedIP)
+	ep.releaseIPs(clientID)
 
 	// Remove from active clients
 	delete(ep.activeClients, clientID)
@@ -359,6 +539,15 @@ func (ep *ExitPeer) removeClientUnsafe(clientID string) error {
 	return nil
 }
 
+// releaseIPs ends a client's leases; its addresses stay reserved for it for a while
+func (ep *ExitPeer) releaseIPs(clientID string) {
+	for _, pool := range []*ipam.Pool{ep.ipPool, ep.ip6Pool} {
+		if err := pool.Release(clientID); err != nil {
+			ep.logger.WithError(err).WithField("client_id", clientID).Warn("Failed to save released lease")
+		}
+	}
+}
+
 // GetActiveClients returns a list of active clients
 func (ep *ExitPeer) GetActiveClients() []*ClientInfo {
 	ep.clientsMux.RLock()
@@ -386,6 +575,35 @@ func (ep *ExitPeer) IsConnected() bool {
 	return ep.streamManager.IsConnected()
 }
 
+// RegisterMetrics registers the exit peer's metrics with a Prometheus registry
+func (ep *ExitPeer) RegisterMetrics(registerer prometheus.Registerer) error {
+	activeClients := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   utils.MetricsNamespace,
+		Subsystem:   "exit",
+		Name:        "active_clients",
+		Help:        "Clients currently served by this exit",
+		ConstLabels: prometheus.Labels{"exit_id": ep.id},
+	}, func() float64 {
+		ep.clientsMux.RLock()
+		defer ep.clientsMux.RUnlock()
+		return float64(len(ep.activeClients))
+	})
+
+	collectors := append(ep.streamManager.Collectors(),
+		activeClients,
+		utils.NewWireGuardCollector(ep.wgManager, func() []string {
+			return []string{ep.interfaceName}
+		}),
+	)
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetStats returns exit peer statistics
 func (ep *ExitPeer) GetStats() map[string]interface{} {
 	ep.clientsMux.RLock()
@@ -0,0 +1,112 @@
+package exitpeer
+
+import (
+	"testing"
+
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+)
+
+// newTestExitPeer creates an exit peer on the memory backend with its
+// interface and NAT set up, without connecting to a SuperNode
+func newTestExitPeer(t *testing.T) (*ExitPeer, *utils.MemoryWireGuardBackend) {
+	t.Helper()
+
+	wg := utils.NewMemoryWireGuardBackend()
+	ep, err := NewExitPeer("exit-1", "r1", "127.0.0.1:1", 51820, wg, utils.NewMemoryFirewall(), testutil.Keystore(t), utils.InsecureCredentials(), testutil.Logger())
+	if err != nil {
+		t.Fatalf("NewExitPeer: %v", err)
+	}
+	if err := ep.initializeWireGuard(); err != nil {
+		t.Fatalf("initializeWireGuard: %v", err)
+	}
+	if err := ep.enableForwarding(); err != nil {
+		t.Fatalf("enableForwarding: %v", err)
+	}
+	return ep, wg
+}
+
+func TestSetupExitAddsClientPeer(t *testing.T) {
+	ep, wg := newTestExitPeer(t)
+	clientPubKey := testutil.PublicKey(t)
+
+	resp := ep.handleSetupExit(testutil.SetupExitCommand("cmd-1", "c1", clientPubKey, "s1"))
+	if !resp.Success {
+		t.Fatalf("SETUP_EXIT failed: %s", resp.Message)
+	}
+	if resp.CommandId != "cmd-1" {
+		t.Fatalf("response for command %q, want cmd-1", resp.CommandId)
+	}
+
+	ip, ip6 := resp.Result["allocated_ip"], resp.Result["allocated_ip6"]
+	if ip == "" || ip6 == "" {
+		t.Fatalf("allocated addresses %q and %q, want both", ip, ip6)
+	}
+	if resp.Result["public_key"] != ep.GetPublicKey() {
+		t.Fatalf("exit public key %q, want %q", resp.Result["public_key"], ep.GetPublicKey())
+	}
+	testutil.ExpectClientPeer(t, wg, ep.interfaceName, clientPubKey, ip, ip6)
+
+	// A retried SETUP_EXIT for the same session keeps the allocation
+	retry := ep.handleSetupExit(testutil.SetupExitCommand("cmd-2", "c1", clientPubKey, "s1"))
+	if !retry.Success || retry.Result["allocated_ip"] != ip || retry.Result["allocated_ip6"] != ip6 {
+		t.Fatalf("retried SETUP_EXIT: success %v, addresses %q and %q, want %q and %q",
+			retry.Success, retry.Result["allocated_ip"], retry.Result["allocated_ip6"], ip, ip6)
+	}
+
+	teardown := ep.handleTeardownExit(testutil.TeardownExitCommand("cmd-3", "c1", "s1"))
+	if !teardown.Success {
+		t.Fatalf("TEARDOWN_EXIT failed: %s", teardown.Message)
+	}
+	testutil.ExpectNoPeers(t, wg, ep.interfaceName)
+	if clients := ep.GetActiveClients(); len(clients) != 0 {
+		t.Fatalf("%d active clients after teardown, want 0", len(clients))
+	}
+}
+
+func TestSetupExitRejectsMissingParameters(t *testing.T) {
+	ep, wg := newTestExitPeer(t)
+
+	resp := ep.handleSetupExit(testutil.SetupExitCommand("cmd-1", "c1", "", "s1"))
+	if resp.Success {
+		t.Fatal("SETUP_EXIT without a client key succeeded")
+	}
+	testutil.ExpectNoPeers(t, wg, ep.interfaceName)
+}
+
+func TestSetupExitRejectsSessionWithOtherKey(t *testing.T) {
+	ep, wg := newTestExitPeer(t)
+	clientPubKey := testutil.PublicKey(t)
+
+	resp := ep.handleSetupExit(testutil.SetupExitCommand("cmd-1", "c1", clientPubKey, "s1"))
+	if !resp.Success {
+		t.Fatalf("SETUP_EXIT failed: %s", resp.Message)
+	}
+	ip, ip6 := resp.Result["allocated_ip"], resp.Result["allocated_ip6"]
+
+	// The same session cannot be taken over with another key
+	hijack := ep.handleSetupExit(testutil.SetupExitCommand("cmd-2", "c1", testutil.PublicKey(t), "s1"))
+	if hijack.Success {
+		t.Fatal("SETUP_EXIT for a set up session accepted another public key")
+	}
+	testutil.ExpectClientPeer(t, wg, ep.interfaceName, clientPubKey, ip, ip6)
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	ep, _ := newTestExitPeer(t)
+
+	registry := utils.NewMetricsRegistry()
+	if err := ep.RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics: %v", err)
+	}
+	testutil.ExpectMetrics(t, registry,
+		"mydvpn_peer_reconnects_total",
+		"mydvpn_peer_connected",
+		"mydvpn_exit_active_clients",
+		"mydvpn_wireguard_peers",
+	)
+
+	if err := ep.RegisterMetrics(registry); err == nil {
+		t.Fatal("registering the exit metrics twice succeeded")
+	}
+}
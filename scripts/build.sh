@@ -53,6 +53,13 @@ else
     echo "❌ Legacy Exit Peer build failed - check if source files exist"
 fi
 
+echo "Building mydvpnctl..."
+if go build -o bin/mydvpnctl ./cmd/mydvpnctl 2>/dev/null; then
+    echo "✓ mydvpnctl built successfully"
+else
+    echo "❌ mydvpnctl build failed - check if source files exist"
+fi
+
 echo ""
 echo "=== Build Summary ==="
 ls -la bin/
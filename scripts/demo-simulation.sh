@@ -18,11 +18,11 @@ if ! pgrep -f basenode > /dev/null; then
     cd /mnt/EDU/myDvpn
     
     # Start BaseNode in background
-    ./bin/basenode --listen=127.0.0.1:50061 --log-level=error > /dev/null 2>&1 &
+    ./bin/basenode --insecure --listen=127.0.0.1:50061 --log-level=error > /dev/null 2>&1 &
     BASENODE_PID=$!
     
     # Start SuperNode in background  
-    ./bin/supernode --id=demo-sn --region=demo --listen=127.0.0.1:50062 --basenode=127.0.0.1:50061 --log-level=error > /dev/null 2>&1 &
+    ./bin/supernode --insecure --id=demo-sn --region=demo --listen=127.0.0.1:50062 --basenode=127.0.0.1:50061 --log-level=error > /dev/null 2>&1 &
     SUPERNODE_PID=$!
     
     sleep 2
@@ -138,7 +138,7 @@ echo "  ✅ Cross-region connectivity"
 echo "  ✅ Simultaneous client/exit operation (hybrid mode)"
 echo ""
 echo "🚀 To run with real WireGuard interfaces:"
-echo "  sudo ./bin/unified-client --id=my-peer"
+echo "  sudo ./bin/unified-client --insecure --id=my-peer"
 echo ""
 echo "💡 The unified client enables true decentralization where"
 echo "   every user can contribute to network capacity!"
@@ -56,7 +56,7 @@ echo "🚀 Starting unified client demo peer..."
 echo ""
 
 # Start the unified client with demo commands
-./bin/unified-client \
+./bin/unified-client --insecure \
     --id=demo-peer \
     --region=us-east-1 \
     --supernode=localhost:50052 \
@@ -76,7 +76,7 @@ echo "  ✅ Real-time status updates and connection management"
 echo "  ✅ Interactive UI for easy operation"
 echo ""
 echo "Try running your own unified client:"
-echo "  ./bin/unified-client --id=my-peer"
+echo "  ./bin/unified-client --insecure --id=my-peer"
 echo ""
 echo "Then experiment with the commands:"
 echo "  > toggle-exit on     # Become an exit peer"
@@ -78,7 +78,7 @@ Documentation=https://github.com/mydvpn/docs
 Type=simple
 User=$USER
 WorkingDirectory=$PROJECT_DIR
-ExecStart=$PROJECT_DIR/bin/basenode \\
+ExecStart=$PROJECT_DIR/bin/basenode --insecure \\
     --listen=0.0.0.0:50051 \\
     --log-level=info
 Restart=always
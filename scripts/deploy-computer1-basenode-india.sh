@@ -49,7 +49,7 @@ Documentation=https://github.com/mydvpn/docs
 Type=simple
 User=$USER
 WorkingDirectory=$PWD
-ExecStart=$PWD/bin/basenode \\
+ExecStart=$PWD/bin/basenode --insecure \\
     --listen=0.0.0.0:50051 \\
     --log-level=info
 Restart=always
@@ -60,7 +60,7 @@ Requires=network.target
 Type=simple
 User=root
 WorkingDirectory=$PWD
-ExecStart=$PWD/bin/supernode \\
+ExecStart=$PWD/bin/supernode --insecure \\
     --id=supernode-india \\
     --region=india \\
     --listen=0.0.0.0:50052 \\
@@ -57,7 +57,7 @@ Requires=network.target
 Type=simple
 User=root
 WorkingDirectory=$PWD
-ExecStart=$PWD/bin/unified-client \\
+ExecStart=$PWD/bin/unified-client --insecure \\
     --id=client-india \\
     --region=india \\
     --supernode=192.168.1.101:50052 \\
@@ -109,7 +109,7 @@ run_interactive() {
     echo "Press Enter to start..."
     read
     
-    sudo ./bin/unified-client \
+    sudo ./bin/unified-client --insecure \
         --id=client-india-interactive \
         --region=india \
         --supernode=192.168.1.101:50052 \
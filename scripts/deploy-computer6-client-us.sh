@@ -57,7 +57,7 @@ Requires=network.target
 Type=simple
 User=root
 WorkingDirectory=$PWD
-ExecStart=$PWD/bin/unified-client \\
+ExecStart=$PWD/bin/unified-client --insecure \\
     --id=client-us \\
     --region=us \\
     --supernode=192.168.1.46:50052 \\
@@ -109,7 +109,7 @@ run_interactive() {
     echo "Press Enter to start..."
     read
     
-    sudo ./bin/unified-client \
+    sudo ./bin/unified-client --insecure \
         --id=client-us-interactive \
         --region=us \
         --supernode=192.168.1.46:50052 \
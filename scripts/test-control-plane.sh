@@ -67,7 +67,7 @@ echo "   control plane (authentication, discovery, coordination)"
 echo "   is working perfectly!"
 echo ""
 echo "🚀 To test with real WireGuard (requires sudo):"
-echo "   sudo ./bin/unified-client --id=my-peer --region=us-east-1"
+echo "   sudo ./bin/unified-client --insecure --id=my-peer --region=us-east-1"
 echo ""
 echo "📊 Recent activity from logs:"
 echo "   $(tail -1 logs/supernode-a.log 2>/dev/null || echo 'No recent activity')"
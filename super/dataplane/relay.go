@@ -2,9 +2,13 @@ package dataplane
 
 import (
 	"fmt"
-	"os/exec"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 
+	"myDvpn/utils"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -14,6 +18,7 @@ type RelayManager struct {
 	activeRules       map[string]*RelayRule
 	rulesMux          sync.RWMutex
 	externalInterface string
+	firewall          utils.Firewall
 }
 
 // RelayRule represents a forwarding rule
@@ -26,12 +31,13 @@ type RelayRule struct {
 	SessionID string
 }
 
-// NewRelayManager creates a new relay manager
-func NewRelayManager(logger *logrus.Logger, externalInterface string) *RelayManager {
+// NewRelayManager creates a new relay manager that installs its rules through the given firewall
+func NewRelayManager(logger *logrus.Logger, externalInterface string, firewall utils.Firewall) *RelayManager {
 	return &RelayManager{
 		logger:            logger,
 		activeRules:       make(map[string]*RelayRule),
 		externalInterface: externalInterface,
+		firewall:          firewall,
 	}
 }
 
@@ -47,21 +53,13 @@ func (rm *RelayManager) SetupRelay(rule *RelayRule) error {
 	}
 
 	// Enable IP forwarding
-	if err := rm.enableIPForwarding(); err != nil {
+	if err := rm.firewall.EnableForwarding(); err != nil {
 		return fmt.Errorf("failed to enable IP forwarding: %w", err)
 	}
 
-	// Set up MASQUERADE rule for outbound traffic
-	if err := rm.addMasqueradeRule(rule.ClientIP); err != nil {
-		return fmt.Errorf("failed to add masquerade rule: %w", err)
-	}
-
-	// Set up forwarding rules if needed for specific exit
-	if rule.ExitIP != "" && rule.ExitPort > 0 {
-		if err := rm.addPortForwardRule(rule); err != nil {
-			rm.removeMasqueradeRule(rule.ClientIP) // Cleanup on failure
-			return fmt.Errorf("failed to add port forward rule: %w", err)
-		}
+	// All rules for the client are applied as one unit so a failure leaves nothing behind
+	if err := rm.firewall.Apply(rm.buildRuleSet(rule)); err != nil {
+		return fmt.Errorf("failed to apply relay rules: %w", err)
 	}
 
 	rm.activeRules[rule.ClientID] = rule
@@ -83,21 +81,17 @@ func (rm *RelayManager) RemoveRelay(clientID string) error {
 	rm.rulesMux.Lock()
 	defer rm.rulesMux.Unlock()
 
-	rule, exists := rm.activeRules[clientID]
-	if !exists {
-		return fmt.Errorf("no relay rule found for client %s", clientID)
-	}
+	return rm.removeRelayLocked(clientID)
+}
 
-	// Remove masquerade rule
-	if err := rm.removeMasqueradeRule(rule.ClientIP); err != nil {
-		rm.logger.WithError(err).Warn("Failed to remove masquerade rule")
+// removeRelayLocked removes a client's rules; the caller must hold rulesMux
+func (rm *RelayManager) removeRelayLocked(clientID string) error {
+	if _, exists := rm.activeRules[clientID]; !exists {
+		return fmt.Errorf("no relay rule found for client %s", clientID)
 	}
 
-	// Remove port forward rule if it exists
-	if rule.ExitIP != "" && rule.ExitPort > 0 {
-		if err := rm.removePortForwardRule(rule); err != nil {
-			rm.logger.WithError(err).Warn("Failed to remove port forward rule")
-		}
+	if err := rm.firewall.Remove(relayRuleSetID(clientID)); err != nil {
+		rm.logger.WithError(err).WithField("client_id", clientID).Warn("Failed to remove relay rules")
 	}
 
 	delete(rm.activeRules, clientID)
@@ -106,115 +100,41 @@ func (rm *RelayManager) RemoveRelay(clientID string) error {
 	return nil
 }
 
-// enableIPForwarding enables IP forwarding on the system
-func (rm *RelayManager) enableIPForwarding() error {
-	cmd := exec.Command("sysctl", "-w", "net.ipv4.ip_forward=1")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to enable IP forwarding: %w", err)
-	}
-	return nil
-}
+// buildRuleSet translates a relay rule into firewall rules
+func (rm *RelayManager) buildRuleSet(rule *RelayRule) *utils.FirewallRuleSet {
+	clientCIDR := fmt.Sprintf("%s/32", rule.ClientIP)
 
-// addMasqueradeRule adds a MASQUERADE rule for outbound traffic
-func (rm *RelayManager) addMasqueradeRule(clientIP string) error {
-	// Add MASQUERADE rule for traffic from client IP
-	cmd := exec.Command("iptables", "-t", "nat", "-A", "POSTROUTING",
-		"-s", fmt.Sprintf("%s/32", clientIP),
-		"-o", rm.externalInterface,
-		"-j", "MASQUERADE")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to add MASQUERADE rule: %w", err)
+	ruleSet := &utils.FirewallRuleSet{
+		ID: relayRuleSetID(rule.ClientID),
+		Masquerade: []utils.MasqueradeRule{
+			{Source: clientCIDR, OutInterface: rm.externalInterface},
+		},
+		Forward: []utils.ForwardRule{
+			{Source: clientCIDR},
+		},
 	}
 
-	// Allow forwarding for this client
-	cmd = exec.Command("iptables", "-A", "FORWARD",
-		"-s", fmt.Sprintf("%s/32", clientIP),
-		"-j", "ACCEPT")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to add FORWARD rule: %w", err)
-	}
-
-	return nil
-}
-
-// removeMasqueradeRule removes a MASQUERADE rule
-func (rm *RelayManager) removeMasqueradeRule(clientIP string) error {
-	// Remove MASQUERADE rule
-	cmd := exec.Command("iptables", "-t", "nat", "-D", "POSTROUTING",
-		"-s", fmt.Sprintf("%s/32", clientIP),
-		"-o", rm.externalInterface,
-		"-j", "MASQUERADE")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to remove MASQUERADE rule: %w", err)
-	}
-
-	// Remove FORWARD rule
-	cmd = exec.Command("iptables", "-D", "FORWARD",
-		"-s", fmt.Sprintf("%s/32", clientIP),
-		"-j", "ACCEPT")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to remove FORWARD rule: %w", err)
-	}
-
-	return nil
-}
-
-// addPortForwardRule adds a port forwarding rule
-func (rm *RelayManager) addPortForwardRule(rule *RelayRule) error {
-	// Add DNAT rule for incoming traffic
-	cmd := exec.Command("iptables", "-t", "nat", "-A", "PREROUTING",
-		"-p", "udp",
-		"--dport", fmt.Sprintf("%d", rule.LocalPort),
-		"-j", "DNAT",
-		"--to-destination", fmt.Sprintf("%s:%d", rule.ExitIP, rule.ExitPort))
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to add DNAT rule: %w", err)
-	}
-
-	// Add FORWARD rule for the forwarded traffic
-	cmd = exec.Command("iptables", "-A", "FORWARD",
-		"-p", "udp",
-		"-d", rule.ExitIP,
-		"--dport", fmt.Sprintf("%d", rule.ExitPort),
-		"-j", "ACCEPT")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to add FORWARD rule for port forwarding: %w", err)
-	}
-
-	return nil
+	// Set up forwarding rules if needed for specific exit
+	if rule.ExitIP != "" && rule.ExitPort > 0 {
+		ruleSet.DNAT = append(ruleSet.DNAT, utils.DNATRule{
+			Protocol:  "udp",
+			DestPort:  rule.LocalPort,
+			ToAddress: rule.ExitIP,
+			ToPort:    rule.ExitPort,
+		})
+		ruleSet.Forward = append(ruleSet.Forward, utils.ForwardRule{
+			Destination: rule.ExitIP,
+			Protocol:    "udp",
+			DestPort:    rule.ExitPort,
+		})
+	}
+
+	return ruleSet
 }
 
-// removePortForwardRule removes a port forwarding rule
-func (rm *RelayManager) removePortForwardRule(rule *RelayRule) error {
-	// Remove DNAT rule
-	cmd := exec.Command("iptables", "-t", "nat", "-D", "PREROUTING",
-		"-p", "udp",
-		"--dport", fmt.Sprintf("%d", rule.LocalPort),
-		"-j", "DNAT",
-		"--to-destination", fmt.Sprintf("%s:%d", rule.ExitIP, rule.ExitPort))
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to remove DNAT rule: %w", err)
-	}
-
-	// Remove FORWARD rule
-	cmd = exec.Command("iptables", "-D", "FORWARD",
-		"-p", "udp",
-		"-d", rule.ExitIP,
-		"--dport", fmt.Sprintf("%d", rule.ExitPort),
-		"-j", "ACCEPT")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to remove FORWARD rule for port forwarding: %w", err)
-	}
-
-	return nil
+// relayRuleSetID names the firewall rule set for a relayed client
+func relayRuleSetID(clientID string) string {
+	return "relay-" + clientID
 }
 
 // GetActiveRules returns all active relay rules
@@ -229,17 +149,40 @@ func (rm *RelayManager) GetActiveRules() []*RelayRule {
 	return rules
 }
 
+// TrafficBytes returns the bytes received plus sent on the external interface
+// relayed traffic leaves through, as counted by the kernel
+func (rm *RelayManager) TrafficBytes() (uint64, error) {
+	var total uint64
+	for _, counter := range []string{"rx_bytes", "tx_bytes"} {
+		data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/%s", rm.externalInterface, counter))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s of %s: %w", counter, rm.externalInterface, err)
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s of %s: %w", counter, rm.externalInterface, err)
+		}
+		total += value
+	}
+	return total, nil
+}
+
 // Cleanup removes all relay rules
 func (rm *RelayManager) Cleanup() error {
 	rm.rulesMux.Lock()
 	defer rm.rulesMux.Unlock()
 
 	for clientID := range rm.activeRules {
-		if err := rm.RemoveRelay(clientID); err != nil {
+		if err := rm.removeRelayLocked(clientID); err != nil {
 			rm.logger.WithError(err).WithField("client_id", clientID).Warn("Failed to remove relay rule during cleanup")
 		}
 	}
 
+	// Catch anything left over from a rule set that failed to remove
+	if err := rm.firewall.Flush(); err != nil {
+		rm.logger.WithError(err).Warn("Failed to flush firewall rules during cleanup")
+	}
+
 	rm.activeRules = make(map[string]*RelayRule)
 	rm.logger.Info("Relay manager cleaned up")
 	return nil
@@ -2,9 +2,11 @@ package dataplane
 
 import (
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"myDvpn/utils"
+	"myDvpn/utils/ipam"
 	"github.com/sirupsen/logrus"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -14,11 +16,13 @@ type WireGuardDataplane struct {
 	interfaceName string
 	listenPort    int
 	privateKey    wgtypes.Key
-	wgManager     *utils.WireGuardManager
+	wgManager     utils.WireGuardBackend
 	activePeers   map[string]*PeerInfo
 	peersMux      sync.RWMutex
 	logger        *logrus.Logger
-	ipAllocator   *IPAllocator
+	ipPool        *ipam.Pool
+	ip6Pool       *ipam.Pool
+	ipv6          bool // Set once the interface has its IPv6 address
 }
 
 // PeerInfo contains information about an active peer
@@ -27,58 +31,26 @@ type PeerInfo struct {
 	PublicKey  string
 	ClientID   string
 	AllocatedIP string
+	AllocatedIP6 string // Empty when the relay has no IPv6
 	AllowedIPs []string
 	SessionID  string
 }
 
-// IPAllocator manages IP address allocation
-type IPAllocator struct {
-	cidr    string
-	usedIPs map[string]bool
-	mutex   sync.Mutex
-}
-
-// NewIPAllocator creates a new IP allocator
-func NewIPAllocator(cidr string) *IPAllocator {
-	return &IPAllocator{
-		cidr:    cidr,
-		usedIPs: make(map[string]bool),
-	}
-}
-
-// AllocateIP allocates a new IP address
-func (ia *IPAllocator) AllocateIP() (string, error) {
-	ia.mutex.Lock()
-	defer ia.mutex.Unlock()
-
-	ip, err := utils.AllocateClientIP(ia.cidr, ia.usedIPs)
+// NewWireGuardDataplane creates a new WireGuard dataplane
+func NewWireGuardDataplane(interfaceName string, listenPort int, wgManager utils.WireGuardBackend, logger *logrus.Logger) (*WireGuardDataplane, error) {
+	// Generate private key
+	privateKey, err := utils.GenerateKey()
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
-	ia.usedIPs[ip] = true
-	return ip, nil
-}
-
-// ReleaseIP releases an IP address
-func (ia *IPAllocator) ReleaseIP(ip string) {
-	ia.mutex.Lock()
-	defer ia.mutex.Unlock()
-
-	delete(ia.usedIPs, ip)
-}
-
-// NewWireGuardDataplane creates a new WireGuard dataplane
-func NewWireGuardDataplane(interfaceName string, listenPort int, logger *logrus.Logger) (*WireGuardDataplane, error) {
-	wgManager, err := utils.NewWireGuardManager()
+	ipPool, err := ipam.NewPool(utils.RelayPoolIPv4) // Default relay network
 	if err != nil {
-		return nil, fmt.Errorf("failed to create WireGuard manager: %w", err)
+		return nil, err
 	}
-
-	// Generate private key
-	privateKey, err := utils.GenerateKey()
+	ip6Pool, err := ipam.NewPool(utils.RelayPoolIPv6)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate private key: %w", err)
+		return nil, err
 	}
 
 	return &WireGuardDataplane{
@@ -88,7 +60,8 @@ func NewWireGuardDataplane(interfaceName string, listenPort int, logger *logrus.
 		wgManager:     wgManager,
 		activePeers:   make(map[string]*PeerInfo),
 		logger:        logger,
-		ipAllocator:   NewIPAllocator("10.8.0.0/24"), // Default relay network
+		ipPool:        ipPool,
+		ip6Pool:       ip6Pool,
 	}, nil
 }
 
@@ -110,10 +83,25 @@ func (wd *WireGuardDataplane) Initialize() error {
 	}
 
 	// Set interface IP
-	if err := wd.wgManager.SetInterfaceIP(wd.interfaceName, "10.8.0.1/24"); err != nil {
+	gateway, err := utils.PoolGateway(utils.RelayPoolIPv4)
+	if err != nil {
+		return err
+	}
+	if err := wd.wgManager.SetInterfaceIP(wd.interfaceName, gateway); err != nil {
 		return fmt.Errorf("failed to set interface IP: %w", err)
 	}
 
+	// Relayed peers get IPv6 addresses as well if the host has IPv6
+	gateway6, err := utils.PoolGateway(utils.RelayPoolIPv6)
+	if err != nil {
+		return err
+	}
+	if err := wd.wgManager.SetInterfaceIP(wd.interfaceName, gateway6); err != nil {
+		wd.logger.WithError(err).Warn("Failed to set interface IPv6 address, relaying IPv4 only")
+	} else {
+		wd.ipv6 = true
+	}
+
 	wd.logger.WithFields(logrus.Fields{
 		"interface": wd.interfaceName,
 		"port":      wd.listenPort,
@@ -135,30 +123,40 @@ func (wd *WireGuardDataplane) SetupRelayForClient(clientID, clientPublicKey, ses
 		}
 	}
 
-	// Allocate IP for client
-	allocatedIP, err := wd.ipAllocator.AllocateIP()
+	// Lease IPs for client; a returning client gets its previous addresses
+	allocatedIP, err := wd.ipPool.Allocate(clientID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to allocate IP: %w", err)
 	}
 
+	var allocatedIP6 string
+	if wd.ipv6 {
+		allocatedIP6, err = wd.ip6Pool.Allocate(clientID)
+		if err != nil {
+			wd.releaseIPs(clientID)
+			return nil, fmt.Errorf("failed to allocate IPv6 address: %w", err)
+		}
+	}
+
 	// Add peer to WireGuard interface
 	peerConfig := utils.PeerConfig{
 		PublicKey:  clientPublicKey,
-		AllowedIPs: []string{fmt.Sprintf("%s/32", allocatedIP)},
+		AllowedIPs: utils.TunnelAddresses(allocatedIP, allocatedIP6),
 	}
 
 	if err := wd.wgManager.AddPeer(wd.interfaceName, peerConfig); err != nil {
-		wd.ipAllocator.ReleaseIP(allocatedIP)
+		wd.releaseIPs(clientID)
 		return nil, fmt.Errorf("failed to add peer to WireGuard: %w", err)
 	}
 
 	peerInfo := &PeerInfo{
-		PeerID:      fmt.Sprintf("relay-%s", clientID),
-		PublicKey:   clientPublicKey,
-		ClientID:    clientID,
-		AllocatedIP: allocatedIP,
-		AllowedIPs:  []string{fmt.Sprintf("%s/32", allocatedIP)},
-		SessionID:   sessionID,
+		PeerID:       fmt.Sprintf("relay-%s", clientID),
+		PublicKey:    clientPublicKey,
+		ClientID:     clientID,
+		AllocatedIP:  allocatedIP,
+		AllocatedIP6: allocatedIP6,
+		AllowedIPs:   peerConfig.AllowedIPs,
+		SessionID:    sessionID,
 	}
 
 	wd.activePeers[peerInfo.PeerID] = peerInfo
@@ -196,7 +194,7 @@ func (wd *WireGuardDataplane) RemoveRelay(clientID string) error {
 	}
 
 	// Release IP
-	wd.ipAllocator.ReleaseIP(peerToRemove.AllocatedIP)
+	wd.releaseIPs(clientID)
 
 	// Remove from active peers
 	delete(wd.activePeers, peerToRemove.PeerID)
@@ -209,6 +207,24 @@ func (wd *WireGuardDataplane) RemoveRelay(clientID string) error {
 	return nil
 }
 
+// releaseIPs ends a relayed client's leases; its addresses stay reserved for it for a while
+func (wd *WireGuardDataplane) releaseIPs(clientID string) {
+	for _, pool := range []*ipam.Pool{wd.ipPool, wd.ip6Pool} {
+		if err := pool.Release(clientID); err != nil {
+			wd.logger.WithError(err).WithField("client_id", clientID).Warn("Failed to save released lease")
+		}
+	}
+}
+
+// SetLeaseDir keeps the relayed clients' address leases in dir so that they
+// get the same addresses after a restart
+func (wd *WireGuardDataplane) SetLeaseDir(dir string) error {
+	if err := wd.ipPool.Load(filepath.Join(dir, "ipv4.json")); err != nil {
+		return err
+	}
+	return wd.ip6Pool.Load(filepath.Join(dir, "ipv6.json"))
+}
+
 // GetPublicKey returns the public key of this interface
 func (wd *WireGuardDataplane) GetPublicKey() string {
 	return wd.privateKey.PublicKey().String()
@@ -233,7 +249,7 @@ func (wd *WireGuardDataplane) Cleanup() error {
 	for clientID := range wd.activePeers {
 		// Release IPs
 		if peer := wd.activePeers[clientID]; peer != nil {
-			wd.ipAllocator.ReleaseIP(peer.AllocatedIP)
+			wd.releaseIPs(peer.ClientID)
 		}
 	}
 	wd.activePeers = make(map[string]*PeerInfo)
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+	adminProto "myDvpn/super/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultAdminCommandTimeout bounds SendCommand when the caller sets no timeout
+	defaultAdminCommandTimeout = 15 * time.Second
+
+	// maxAdminCommandTimeout caps caller-supplied SendCommand timeouts
+	maxAdminCommandTimeout = 2 * time.Minute
+)
+
+// AdminServer implements the SuperNode operator API
+type AdminServer struct {
+	adminProto.UnimplementedAdminServer
+
+	sn *SuperNode
+}
+
+// SetAdmin enables the admin API on its own listener, guarded by token
+func (sn *SuperNode) SetAdmin(listenAddr, token string) {
+	sn.adminAddr = listenAddr
+	sn.adminToken = token
+}
+
+// startAdmin serves the admin API in the background
+func (sn *SuperNode) startAdmin() error {
+	serverCreds, err := sn.creds.ServerOption()
+	if err != nil {
+		return fmt.Errorf("failed to configure admin server credentials: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", sn.adminAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for admin API on %s: %w", sn.adminAddr, err)
+	}
+
+	// Keep the bound address, which differs from the configured one for port 0
+	sn.adminAddr = listener.Addr().String()
+
+	sn.adminServer = grpc.NewServer(append(utils.AdminTokenServerOptions(sn.adminToken), serverCreds)...)
+	adminProto.RegisterAdminServer(sn.adminServer, &AdminServer{sn: sn})
+
+	go func() {
+		if err := sn.adminServer.Serve(listener); err != nil {
+			sn.logger.WithError(err).Error("Admin server failed")
+		}
+	}()
+
+	sn.logger.WithField("addr", sn.adminAddr).Info("Serving admin API")
+	return nil
+}
+
+// IsDraining reports whether the SuperNode refuses new peers and exit allocations
+func (sn *SuperNode) IsDraining() bool {
+	return sn.draining.Load()
+}
+
+// ListPeers lists peers with an active control stream
+func (as *AdminServer) ListPeers(ctx context.Context, req *adminProto.ListPeersRequest) (*adminProto.ListPeersResponse, error) {
+	resp := &adminProto.ListPeersResponse{
+		SupernodeId: as.sn.id,
+		Region:      as.sn.region,
+		Draining:    as.sn.IsDraining(),
+	}
+
+	for _, streamInfo := range as.sn.streamManager.GetActiveStreams() {
+		if req.Role != "" && string(streamInfo.Role) != req.Role {
+			continue
+		}
+		if req.Region != "" && streamInfo.Region != req.Region {
+			continue
+		}
+		resp.Peers = append(resp.Peers, peerInfoFromStream(streamInfo))
+	}
+
+	sort.Slice(resp.Peers, func(i, j int) bool {
+		return resp.Peers[i].PeerId < resp.Peers[j].PeerId
+	})
+
+	return resp, nil
+}
+
+// GetPeer returns a single connected peer
+func (as *AdminServer) GetPeer(ctx context.Context, req *adminProto.GetPeerRequest) (*adminProto.PeerInfo, error) {
+	streamInfo, exists := as.sn.streamManager.GetStream(req.PeerId)
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "peer %s is not connected", req.PeerId)
+	}
+	return peerInfoFromStream(streamInfo), nil
+}
+
+// DisconnectPeer sends DISCONNECT to a peer and closes its stream
+func (as *AdminServer) DisconnectPeer(ctx context.Context, req *adminProto.DisconnectPeerRequest) (*adminProto.DisconnectPeerResponse, error) {
+	if _, exists := as.sn.streamManager.GetStream(req.PeerId); !exists {
+		return nil, status.Errorf(codes.NotFound, "peer %s is not connected", req.PeerId)
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "disconnected by operator"
+	}
+
+	if err := as.sn.disconnectPeer(req.PeerId, reason); err != nil {
+		return &adminProto.DisconnectPeerResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	as.sn.logger.WithFields(logrus.Fields{
+		"peer_id": req.PeerId,
+		"reason":  reason,
+	}).Info("Disconnected peer on operator request")
+
+	return &adminProto.DisconnectPeerResponse{
+		Success: true,
+		Message: "Peer disconnected",
+	}, nil
+}
+
+// RevokePeer revokes a peer in the registry and disconnects it if it is connected
+func (as *AdminServer) RevokePeer(ctx context.Context, req *adminProto.RevokePeerRequest) (*adminProto.RevokePeerResponse, error) {
+	if req.PeerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "peer_id is required")
+	}
+
+	_, connected := as.sn.streamManager.GetStream(req.PeerId)
+
+	if err := as.sn.RevokePeer(req.PeerId); err != nil {
+		return &adminProto.RevokePeerResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	as.sn.logger.WithFields(logrus.Fields{
+		"peer_id":   req.PeerId,
+		"connected": connected,
+	}).Warn("Revoked peer on operator request")
+
+	return &adminProto.RevokePeerResponse{
+		Success:      true,
+		Message:      fmt.Sprintf("Peer %s revoked", req.PeerId),
+		WasConnected: connected,
+	}, nil
+}
+
+// SendCommand sends a command to a peer and waits for its response.
+// ROTATE_PEER is driven by the SuperNode, which sets up the new exit and
+// passes it to the client; only its target_region payload is used.
+func (as *AdminServer) SendCommand(ctx context.Context, req *adminProto.SendCommandRequest) (*adminProto.SendCommandResponse, error) {
+	commandType, known := controlProto.CommandType_value[req.Type]
+	if !known {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown command type %q", req.Type)
+	}
+
+	if _, exists := as.sn.streamManager.GetStream(req.PeerId); !exists {
+		return nil, status.Errorf(codes.NotFound, "peer %s is not connected", req.PeerId)
+	}
+
+	timeout := defaultAdminCommandTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	if timeout > maxAdminCommandTimeout {
+		timeout = maxAdminCommandTimeout
+	}
+
+	if controlProto.CommandType(commandType) == controlProto.CommandType_ROTATE_PEER {
+		as.sn.logger.WithFields(logrus.Fields{
+			"peer_id":       req.PeerId,
+			"target_region": req.Payload["target_region"],
+		}).Info("Rotating exit on operator request")
+
+		resp, err := as.sn.RotateClientExit(ctx, req.PeerId, req.Payload["target_region"], timeout)
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "rotation failed: %v", err)
+		}
+		return &adminProto.SendCommandResponse{
+			CommandId: resp.CommandId,
+			Success:   resp.Success,
+			Message:   resp.Message,
+			Result:    resp.Result,
+		}, nil
+	}
+
+	command := &controlProto.Command{
+		CommandId: fmt.Sprintf("admin-%d", time.Now().UnixNano()),
+		Type:      controlProto.CommandType(commandType),
+		Payload:   req.Payload,
+	}
+
+	as.sn.logger.WithFields(logrus.Fields{
+		"peer_id":      req.PeerId,
+		"command_id":   command.CommandId,
+		"command_type": command.Type,
+	}).Info("Sending command on operator request")
+
+	resp, err := as.sn.sendCommandAndWait(ctx, req.PeerId, command, timeout)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "command failed: %v", err)
+	}
+
+	return &adminProto.SendCommandResponse{
+		CommandId: resp.CommandId,
+		Success:   resp.Success,
+		Message:   resp.Message,
+		Result:    resp.Result,
+	}, nil
+}
+
+// ListRelays lists active relay forwarding rules
+func (as *AdminServer) ListRelays(ctx context.Context, req *adminProto.ListRelaysRequest) (*adminProto.ListRelaysResponse, error) {
+	resp := &adminProto.ListRelaysResponse{}
+	if as.sn.relayManager == nil {
+		return resp, nil
+	}
+
+	for _, rule := range as.sn.relayManager.GetActiveRules() {
+		resp.Relays = append(resp.Relays, &adminProto.RelayInfo{
+			ClientId:  rule.ClientID,
+			ClientIp:  rule.ClientIP,
+			ExitIp:    rule.ExitIP,
+			ExitPort:  int32(rule.ExitPort),
+			LocalPort: int32(rule.LocalPort),
+			SessionId: rule.SessionID,
+		})
+	}
+
+	sort.Slice(resp.Relays, func(i, j int) bool {
+		return resp.Relays[i].ClientId < resp.Relays[j].ClientId
+	})
+
+	return resp, nil
+}
+
+// DrainNode stops the SuperNode from accepting new peers and exit allocations, or resumes
+func (as *AdminServer) DrainNode(ctx context.Context, req *adminProto.DrainNodeRequest) (*adminProto.DrainNodeResponse, error) {
+	sn := as.sn
+	draining := !req.Resume
+	changed := sn.draining.Swap(draining) != draining
+
+	sn.logger.WithFields(logrus.Fields{
+		"draining":         draining,
+		"disconnect_peers": req.DisconnectPeers,
+	}).Warn("Drain state changed on operator request")
+
+	// Tell the BaseNode right away so it stops (or resumes) sending work here
+	if changed {
+		go func() {
+			if err := sn.registerWithBaseNode(); err != nil {
+				sn.logger.WithError(err).Warn("Failed to report drain state to BaseNode")
+			}
+		}()
+	}
+
+	resp := &adminProto.DrainNodeResponse{Draining: draining}
+
+	if draining && req.DisconnectPeers {
+		for _, streamInfo := range sn.streamManager.GetActiveStreams() {
+			if err := sn.disconnectPeer(streamInfo.PeerID, "supernode draining"); err != nil {
+				sn.logger.WithError(err).WithField("peer_id", streamInfo.PeerID).Warn("Failed to disconnect peer while draining")
+				continue
+			}
+			resp.PeersDisconnected++
+		}
+	}
+
+	if draining {
+		resp.Message = fmt.Sprintf("SuperNode %s is draining", sn.id)
+	} else {
+		resp.Message = fmt.Sprintf("SuperNode %s is accepting peers", sn.id)
+	}
+
+	return resp, nil
+}
+
+// disconnectPeer sends DISCONNECT with a reason to a connected peer and closes
+// its stream, so the peer is gone even if it ignores the command
+func (sn *SuperNode) disconnectPeer(peerID, reason string) error {
+	disconnect := &controlProto.ControlMessage{
+		MessageId: fmt.Sprintf("disconnect-%d", time.Now().UnixNano()),
+		Timestamp: time.Now().Unix(),
+		Payload: &controlProto.ControlMessage_Command{
+			Command: &controlProto.Command{
+				CommandId: fmt.Sprintf("disconnect-%s-%d", peerID, time.Now().UnixNano()),
+				Type:      controlProto.CommandType_DISCONNECT,
+				Payload:   map[string]string{"reason": reason},
+			},
+		},
+	}
+	if err := sn.streamManager.SendMessageToPeer(peerID, disconnect); err != nil {
+		sn.logger.WithError(err).WithField("peer_id", peerID).Warn("Failed to send DISCONNECT, closing the stream anyway")
+	}
+
+	if !sn.streamManager.CloseStream(peerID, reason) {
+		return fmt.Errorf("peer %s is not connected", peerID)
+	}
+	return nil
+}
+
+// peerInfoFromStream converts a stream to its admin representation
+func peerInfoFromStream(streamInfo *StreamInfo) *adminProto.PeerInfo {
+	streamInfo.mutex.RLock()
+	defer streamInfo.mutex.RUnlock()
+
+	return &adminProto.PeerInfo{
+		PeerId:        streamInfo.PeerID,
+		Role:          string(streamInfo.Role),
+		Region:        streamInfo.Region,
+		SessionId:     streamInfo.SessionID,
+		PublicKey:     streamInfo.PublicKey,
+		RemoteAddr:    streamInfo.RemoteAddr,
+		LastHeartbeat: streamInfo.LastHeartbeat.Unix(),
+		Stats: &adminProto.PeerStats{
+			MessagesReceived: streamInfo.Stats.MessagesReceived,
+			MessagesSent:     streamInfo.Stats.MessagesSent,
+			CommandsExecuted: streamInfo.Stats.CommandsExecuted,
+			CommandsFailed:   streamInfo.Stats.CommandsFailed,
+			LatencyMs:        streamInfo.Stats.LatencyMs,
+			ConnectedSince:   streamInfo.Stats.ConnectedSince.Unix(),
+		},
+	}
+}
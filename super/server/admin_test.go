@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	baseclient "myDvpn/base/client"
+	adminProto "myDvpn/super/proto"
+	"myDvpn/utils"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testAdminToken = "test-admin-token-0123456789"
+
+// startTestAdmin serves the admin API of sn on a free local port
+func startTestAdmin(t *testing.T, sn *SuperNode) {
+	t.Helper()
+
+	sn.SetAdmin("127.0.0.1:0", testAdminToken)
+	if err := sn.startAdmin(); err != nil {
+		t.Fatalf("startAdmin: %v", err)
+	}
+	t.Cleanup(sn.adminServer.Stop)
+}
+
+// dialTestAdmin returns an admin client presenting token, or no token when empty
+func dialTestAdmin(t *testing.T, sn *SuperNode, token string) adminProto.AdminClient {
+	t.Helper()
+
+	creds := utils.InsecureCredentials()
+	opts := []grpc.DialOption{creds.DialOption()}
+	if token != "" {
+		opts = append(opts, creds.AdminTokenDialOption(token))
+	}
+
+	conn, err := grpc.NewClient(sn.adminAddr, opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return adminProto.NewAdminClient(conn)
+}
+
+// newTestAdmin starts the admin API of a fresh SuperNode and returns an authorized client
+func newTestAdmin(t *testing.T) (*SuperNode, adminProto.AdminClient) {
+	t.Helper()
+
+	sn := newTestSuperNode()
+	startTestAdmin(t, sn)
+	return sn, dialTestAdmin(t, sn, testAdminToken)
+}
+
+// expectCode fails the test unless err is a gRPC error with code
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+
+	if status.Code(err) != code {
+		t.Fatalf("error %v, want code %s", err, code)
+	}
+}
+
+// expectStreamClosed fails the test unless the peer's stream was closed by the SuperNode
+func expectStreamClosed(t *testing.T, streamInfo *StreamInfo) {
+	t.Helper()
+
+	select {
+	case <-streamInfo.Closed():
+	default:
+		t.Fatalf("stream of %s is still open", streamInfo.PeerID)
+	}
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	sn, _ := newTestAdmin(t)
+
+	tests := []struct {
+		name  string
+		token string
+		code  codes.Code
+	}{
+		{name: "no token", code: codes.Unauthenticated},
+		{name: "wrong token", token: "wrong-admin-token-0123456789", code: codes.Unauthenticated},
+		{name: "admin token", token: testAdminToken, code: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dialTestAdmin(t, sn, tt.token)
+			_, err := client.ListPeers(context.Background(), &adminProto.ListPeersRequest{})
+			expectCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestAdminListAndGetPeers(t *testing.T) {
+	sn, client := newTestAdmin(t)
+	connectTestPeer(t, sn, "exit-1", RoleExit)
+	connectTestPeer(t, sn, "c1", RoleClient)
+
+	resp, err := client.ListPeers(context.Background(), &adminProto.ListPeersRequest{})
+	if err != nil {
+		t.Fatalf("ListPeers: %v", err)
+	}
+	if resp.SupernodeId != "sn-test" || len(resp.Peers) != 2 || resp.Peers[0].PeerId != "c1" || resp.Peers[1].PeerId != "exit-1" {
+		t.Fatalf("ListPeers returned %v, want c1 and exit-1 on sn-test", resp)
+	}
+
+	resp, err = client.ListPeers(context.Background(), &adminProto.ListPeersRequest{Role: string(RoleExit)})
+	if err != nil {
+		t.Fatalf("ListPeers: %v", err)
+	}
+	if len(resp.Peers) != 1 || resp.Peers[0].PeerId != "exit-1" {
+		t.Fatalf("exit peers %v, want only exit-1", resp.Peers)
+	}
+
+	info, err := client.GetPeer(context.Background(), &adminProto.GetPeerRequest{PeerId: "c1"})
+	if err != nil {
+		t.Fatalf("GetPeer: %v", err)
+	}
+	if info.Role != string(RoleClient) || info.Region != "r1" || info.SessionId == "" {
+		t.Fatalf("GetPeer returned %v, want the c1 client stream in r1", info)
+	}
+
+	_, err = client.GetPeer(context.Background(), &adminProto.GetPeerRequest{PeerId: "c2"})
+	expectCode(t, err, codes.NotFound)
+}
+
+func TestAdminDisconnectPeerClosesStream(t *testing.T) {
+	sn, client := newTestAdmin(t)
+	connectTestPeer(t, sn, "c1", RoleClient)
+	streamInfo, _ := sn.streamManager.GetStream("c1")
+
+	resp, err := client.DisconnectPeer(context.Background(), &adminProto.DisconnectPeerRequest{PeerId: "c1", Reason: "maintenance"})
+	if err != nil || !resp.Success {
+		t.Fatalf("DisconnectPeer: %v, %v", resp, err)
+	}
+	expectStreamClosed(t, streamInfo)
+	if reason := streamInfo.CloseReason(); reason != "maintenance" {
+		t.Fatalf("stream closed for %q, want %q", reason, "maintenance")
+	}
+
+	_, err = client.DisconnectPeer(context.Background(), &adminProto.DisconnectPeerRequest{PeerId: "c2"})
+	expectCode(t, err, codes.NotFound)
+}
+
+func TestAdminRevokePeer(t *testing.T) {
+	sn, client := newTestAdmin(t)
+	registry, _ := newTestRegistry(t, RegistryModeTOFU, &PeerRecord{PeerID: "c1", PublicKey: "key-1"})
+	sn.SetPeerRegistry(registry)
+	connectTestPeer(t, sn, "c1", RoleClient)
+	streamInfo, _ := sn.streamManager.GetStream("c1")
+
+	resp, err := client.RevokePeer(context.Background(), &adminProto.RevokePeerRequest{PeerId: "c1"})
+	if err != nil || !resp.Success || !resp.WasConnected {
+		t.Fatalf("RevokePeer: %v, %v", resp, err)
+	}
+	expectStreamClosed(t, streamInfo)
+	if err := registry.Authorize("c1", "key-1", RoleClient); err == nil {
+		t.Fatal("revoked peer can still authenticate")
+	}
+
+	// Peers that are not connected are revoked for their next login
+	resp, err = client.RevokePeer(context.Background(), &adminProto.RevokePeerRequest{PeerId: "c2"})
+	if err != nil || !resp.Success || resp.WasConnected {
+		t.Fatalf("RevokePeer of an offline peer: %v, %v", resp, err)
+	}
+	if err := registry.Authorize("c2", "key-2", RoleClient); err == nil {
+		t.Fatal("revoked offline peer can authenticate")
+	}
+
+	_, err = client.RevokePeer(context.Background(), &adminProto.RevokePeerRequest{})
+	expectCode(t, err, codes.InvalidArgument)
+}
+
+func TestAdminDrainNode(t *testing.T) {
+	sn, client := newTestAdmin(t)
+
+	// The drain state is reported to a BaseNode that is not running
+	baseClient, err := baseclient.NewFailoverClient([]string{"127.0.0.1:1"}, utils.InsecureCredentials(), sn.logger)
+	if err != nil {
+		t.Fatalf("NewFailoverClient: %v", err)
+	}
+	sn.baseClient = baseClient
+	t.Cleanup(func() { baseClient.Close() })
+
+	connectTestPeer(t, sn, "c1", RoleClient)
+	connectTestPeer(t, sn, "exit-1", RoleExit)
+	c1, _ := sn.streamManager.GetStream("c1")
+	exit1, _ := sn.streamManager.GetStream("exit-1")
+
+	resp, err := client.DrainNode(context.Background(), &adminProto.DrainNodeRequest{DisconnectPeers: true})
+	if err != nil {
+		t.Fatalf("DrainNode: %v", err)
+	}
+	if !resp.Draining || resp.PeersDisconnected != 2 || !sn.IsDraining() {
+		t.Fatalf("DrainNode returned %v, want draining with 2 peers disconnected", resp)
+	}
+	expectStreamClosed(t, c1)
+	expectStreamClosed(t, exit1)
+
+	resp, err = client.DrainNode(context.Background(), &adminProto.DrainNodeRequest{Resume: true})
+	if err != nil {
+		t.Fatalf("DrainNode: %v", err)
+	}
+	if resp.Draining || sn.IsDraining() {
+		t.Fatalf("DrainNode returned %v after resuming, want not draining", resp)
+	}
+}
+
+func TestAdminSendCommand(t *testing.T) {
+	sn, client := newTestAdmin(t)
+	connectTestPeer(t, sn, "exit-1", RoleExit)
+
+	resp, err := client.SendCommand(context.Background(), &adminProto.SendCommandRequest{
+		PeerId:         "exit-1",
+		Type:           "RELAY_SETUP",
+		TimeoutSeconds: 5,
+	})
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	if !resp.Success || !strings.HasPrefix(resp.CommandId, "admin-") {
+		t.Fatalf("SendCommand returned %v, want the peer's successful response", resp)
+	}
+
+	_, err = client.SendCommand(context.Background(), &adminProto.SendCommandRequest{PeerId: "exit-1", Type: "REBOOT"})
+	expectCode(t, err, codes.InvalidArgument)
+
+	_, err = client.SendCommand(context.Background(), &adminProto.SendCommandRequest{PeerId: "c2", Type: "RELAY_SETUP"})
+	expectCode(t, err, codes.NotFound)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// authChallengeTTL is how long a peer has to answer an auth challenge
+	authChallengeTTL = 30 * time.Second
+
+	// authClockSkew is the tolerated difference between peer and SuperNode clocks
+	authClockSkew = 30 * time.Second
+)
+
+// NonceStore tracks outstanding auth challenges. A nonce can be redeemed once,
+// before it expires; afterwards it is forgotten and any replay is rejected.
+type NonceStore struct {
+	nonces map[string]time.Time // nonce -> expiry
+	ttl    time.Duration
+	mutex  sync.Mutex
+}
+
+// NewNonceStore creates a nonce store whose nonces live for ttl
+func NewNonceStore(ttl time.Duration) *NonceStore {
+	return &NonceStore{
+		nonces: make(map[string]time.Time),
+		ttl:    ttl,
+	}
+}
+
+// Issue generates and records a fresh nonce
+func (ns *NonceStore) Issue() (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	nonce := base64.StdEncoding.EncodeToString(buf)
+	now := time.Now()
+	expiresAt := now.Add(ns.ttl)
+
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	// Drop challenges that were never answered
+	for n, expiry := range ns.nonces {
+		if now.After(expiry) {
+			delete(ns.nonces, n)
+		}
+	}
+
+	ns.nonces[nonce] = expiresAt
+	return nonce, expiresAt, nil
+}
+
+// Redeem consumes a nonce, failing if it was never issued, already used or expired
+func (ns *NonceStore) Redeem(nonce string) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	expiry, exists := ns.nonces[nonce]
+	if !exists {
+		return fmt.Errorf("unknown or already used nonce")
+	}
+
+	delete(ns.nonces, nonce)
+
+	if time.Now().After(expiry) {
+		return fmt.Errorf("nonce expired")
+	}
+	return nil
+}
+
+// Outstanding returns the number of challenges awaiting an answer
+func (ns *NonceStore) Outstanding() int {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+	return len(ns.nonces)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"testing"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// fakePeerStream is a peer's control stream that answers every command with success
+type fakePeerStream struct {
+	grpc.ServerStream
+	peerID string
+	sn     *SuperNode
+}
+
+func (s *fakePeerStream) Send(msg *controlProto.ControlMessage) error {
+	if cmd := msg.GetCommand(); cmd != nil {
+		go s.sn.handleCommandResponse(s.peerID, &controlProto.CommandResponse{
+			CommandId: cmd.CommandId,
+			Success:   true,
+		})
+	}
+	return nil
+}
+
+func (s *fakePeerStream) Recv() (*controlProto.ControlMessage, error) {
+	return nil, io.EOF
+}
+
+func (s *fakePeerStream) Context() context.Context {
+	return context.Background()
+}
+
+// newTestSuperNode creates a SuperNode that is not started
+func newTestSuperNode() *SuperNode {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewSuperNode("sn-test", "r1", "127.0.0.1:0", nil, utils.InsecureCredentials(), logger)
+}
+
+// connectTestPeer registers a peer stream and returns its stream session ID
+func connectTestPeer(t *testing.T, sn *SuperNode, peerID string, role PeerRole) string {
+	t.Helper()
+
+	stream := &fakePeerStream{peerID: peerID, sn: sn}
+	sessionID, err := sn.streamManager.RegisterStream(peerID, role, "r1", "", "", stream)
+	if err != nil {
+		t.Fatalf("RegisterStream(%s): %v", peerID, err)
+	}
+	return sessionID
+}
+
+func TestNonceStoreRedeemsOnce(t *testing.T) {
+	ns := NewNonceStore(time.Minute)
+
+	nonce, expiresAt, err := ns.Issue()
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if time.Until(expiresAt) <= 0 {
+		t.Fatalf("nonce expires at %v, want in the future", expiresAt)
+	}
+
+	if err := ns.Redeem(nonce); err != nil {
+		t.Fatalf("first Redeem: %v", err)
+	}
+	if err := ns.Redeem(nonce); err == nil {
+		t.Fatal("nonce was redeemed twice")
+	}
+	if err := ns.Redeem("never-issued"); err == nil {
+		t.Fatal("redeemed a nonce that was never issued")
+	}
+}
+
+func TestNonceStoreExpiresNonces(t *testing.T) {
+	ns := NewNonceStore(time.Millisecond)
+
+	expired, _, err := ns.Issue()
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if err := ns.Redeem(expired); err == nil {
+		t.Fatal("expired nonce was redeemed")
+	}
+
+	// Unanswered challenges are dropped when the next one is issued
+	if _, _, err := ns.Issue(); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, _, err := ns.Issue(); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if n := ns.Outstanding(); n != 1 {
+		t.Fatalf("%d outstanding challenges, want 1", n)
+	}
+}
+
+// signedAuthRequest answers a challenge for peerID, signing over channelBinding
+func signedAuthRequest(t *testing.T, key ed25519.PrivateKey, peerID, nonce string, timestamp time.Time, channelBinding []byte) *controlProto.AuthRequest {
+	t.Helper()
+
+	req := &controlProto.AuthRequest{
+		PeerId:    peerID,
+		Role:      string(RoleClient),
+		PubkeyB64: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Region:    "r1",
+		Nonce:     nonce,
+		Timestamp: timestamp.Unix(),
+	}
+	payload := utils.AuthSignaturePayload(req.PeerId, req.Role, req.Region, req.Nonce, req.Timestamp, channelBinding)
+	req.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return req
+}
+
+func TestHandleAuthRequestChecksChallenge(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		auth func(sn *SuperNode, nonce string) (*controlProto.AuthRequest, string)
+		ok   bool
+	}{
+		{
+			name: "answer to the issued challenge",
+			auth: func(sn *SuperNode, nonce string) (*controlProto.AuthRequest, string) {
+				return signedAuthRequest(t, key, "c1", nonce, time.Now(), nil), nonce
+			},
+			ok: true,
+		},
+		{
+			name: "nonce issued for another stream",
+			auth: func(sn *SuperNode, nonce string) (*controlProto.AuthRequest, string) {
+				other, _, _ := sn.authNonces.Issue()
+				return signedAuthRequest(t, key, "c1", other, time.Now(), nil), nonce
+			},
+		},
+		{
+			name: "nonce already used",
+			auth: func(sn *SuperNode, nonce string) (*controlProto.AuthRequest, string) {
+				if err := sn.authNonces.Redeem(nonce); err != nil {
+					t.Fatalf("Redeem: %v", err)
+				}
+				return signedAuthRequest(t, key, "c1", nonce, time.Now(), nil), nonce
+			},
+		},
+		{
+			name: "timestamp outside the allowed skew",
+			auth: func(sn *SuperNode, nonce string) (*controlProto.AuthRequest, string) {
+				return signedAuthRequest(t, key, "c1", nonce, time.Now().Add(-2*authClockSkew), nil), nonce
+			},
+		},
+		{
+			name: "signature bound to another connection",
+			auth: func(sn *SuperNode, nonce string) (*controlProto.AuthRequest, string) {
+				return signedAuthRequest(t, key, "c1", nonce, time.Now(), []byte("other-connection")), nonce
+			},
+		},
+		{
+			name: "signature for another peer ID",
+			auth: func(sn *SuperNode, nonce string) (*controlProto.AuthRequest, string) {
+				req := signedAuthRequest(t, key, "c1", nonce, time.Now(), nil)
+				req.PeerId = "c2"
+				return req, nonce
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sn := newTestSuperNode()
+			nonce, _, err := sn.authNonces.Issue()
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+
+			req, streamNonce := tt.auth(sn, nonce)
+			stream := &fakePeerStream{}
+			peerID, _, err := sn.handleAuthRequest(req, streamNonce, stream)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("handleAuthRequest: %v", err)
+				}
+				if peerID != "c1" {
+					t.Fatalf("authenticated %q, want c1", peerID)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("handleAuthRequest accepted the request")
+			}
+			if _, connected := sn.streamManager.GetStream(req.PeerId); connected {
+				t.Fatal("rejected peer was registered")
+			}
+		})
+	}
+}
+
+func TestHandleAuthRequestRejectsReplay(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	sn := newTestSuperNode()
+	nonce, _, err := sn.authNonces.Issue()
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	req := signedAuthRequest(t, key, "c1", nonce, time.Now(), nil)
+	if _, _, err := sn.handleAuthRequest(req, nonce, &fakePeerStream{}); err != nil {
+		t.Fatalf("handleAuthRequest: %v", err)
+	}
+
+	// The same answer replayed on a stream given the same challenge is refused
+	if _, _, err := sn.handleAuthRequest(req, nonce, &fakePeerStream{}); err == nil {
+		t.Fatal("replayed auth request was accepted")
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"myDvpn/clientPeer/proto"
+)
+
+var (
+	// ErrCommandTimeout is returned when a peer does not answer a command before its deadline
+	ErrCommandTimeout = errors.New("command timed out")
+
+	// ErrStreamLost is returned when a peer's stream closes before it answers a command
+	ErrStreamLost = errors.New("peer stream lost before command completed")
+)
+
+// CommandFuture is the pending result of a command sent to a peer. It is
+// resolved by the peer's CommandResponse with the same command_id, or failed
+// when its deadline passes or the stream it was sent on goes away.
+type CommandFuture struct {
+	CommandID   string
+	PeerID      string
+	CommandType proto.CommandType
+
+	sessionID string
+	sentAt    time.Time
+	timer     *time.Timer
+
+	done chan struct{}
+	resp *proto.CommandResponse
+	err  error
+}
+
+// Done is closed once the future is resolved or failed
+func (f *CommandFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the future completes or ctx ends. A response with
+// Success=false is returned as a response, not as an error.
+func (f *CommandFuture) Wait(ctx context.Context) (*proto.CommandResponse, error) {
+	select {
+	case <-f.done:
+		return f.resp, f.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("stopped waiting for command %s: %w", f.CommandID, ctx.Err())
+	}
+}
+
+// pendingCommands tracks command futures by command_id
+type pendingCommands struct {
+	futures map[string]*CommandFuture
+	mutex   sync.Mutex
+}
+
+// add registers a future, rejecting a command_id that is already in flight
+func (pc *pendingCommands) add(future *CommandFuture) error {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	if _, exists := pc.futures[future.CommandID]; exists {
+		return fmt.Errorf("command %s is already in flight", future.CommandID)
+	}
+	pc.futures[future.CommandID] = future
+	return nil
+}
+
+// take removes and returns the future for a command_id if match accepts it
+func (pc *pendingCommands) take(commandID string, match func(*CommandFuture) bool) (*CommandFuture, bool) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	future, exists := pc.futures[commandID]
+	if !exists || !match(future) {
+		return nil, false
+	}
+	delete(pc.futures, commandID)
+	return future, true
+}
+
+// takeAll removes and returns every future match accepts
+func (pc *pendingCommands) takeAll(match func(*CommandFuture) bool) []*CommandFuture {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	var taken []*CommandFuture
+	for commandID, future := range pc.futures {
+		if match(future) {
+			delete(pc.futures, commandID)
+			taken = append(taken, future)
+		}
+	}
+	return taken
+}
+
+// count returns the number of commands in flight
+func (pc *pendingCommands) count() int {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	return len(pc.futures)
+}
+
+// SendCommand sends a command to a peer and returns a future for its response.
+// The future fails with ErrCommandTimeout after timeout and with ErrStreamLost
+// if the peer's stream closes first.
+func (sm *StreamManager) SendCommand(peerID string, command *proto.Command, timeout time.Duration) (*CommandFuture, error) {
+	streamInfo, exists := sm.GetStream(peerID)
+	if !exists {
+		return nil, fmt.Errorf("no active stream for peer %s", peerID)
+	}
+
+	if timeout <= 0 {
+		timeout = commandTrackingTimeout
+	}
+
+	streamInfo.mutex.Lock()
+	defer streamInfo.mutex.Unlock()
+
+	future := &CommandFuture{
+		CommandID:   command.CommandId,
+		PeerID:      peerID,
+		CommandType: command.Type,
+		sessionID:   streamInfo.SessionID,
+		sentAt:      time.Now(),
+		done:        make(chan struct{}),
+	}
+	future.timer = time.AfterFunc(timeout, func() {
+		if f, taken := sm.pending.take(future.CommandID, func(f *CommandFuture) bool { return f == future }); taken {
+			sm.failCommand(f, CommandOutcomeTimeout, ErrCommandTimeout)
+			sm.recordCommandFailure(f.PeerID)
+		}
+	})
+
+	// Track before sending so a fast response always finds its future
+	if err := sm.pending.add(future); err != nil {
+		future.timer.Stop()
+		return nil, err
+	}
+
+	message := &proto.ControlMessage{
+		MessageId: fmt.Sprintf("cmd-%d", time.Now().UnixNano()),
+		Timestamp: time.Now().Unix(),
+		Payload: &proto.ControlMessage_Command{
+			Command: command,
+		},
+	}
+
+	if err := streamInfo.Stream.Send(message); err != nil {
+		future.timer.Stop()
+		sm.pending.take(command.CommandId, func(f *CommandFuture) bool { return f == future })
+		sm.commandsFailed.Add(1)
+		streamInfo.Stats.CommandsFailed++
+		streamInfo.Stats.LastCommandFailure = time.Now()
+		sm.commandDuration.WithLabelValues(command.Type.String(), CommandOutcomeSendError).Observe(0)
+		return nil, fmt.Errorf("failed to send command to peer %s: %w", peerID, err)
+	}
+
+	streamInfo.Stats.MessagesSent++
+	sm.commandsProcessed.Add(1)
+
+	return future, nil
+}
+
+// resolveCommand completes the future matching a response from peerID.
+// Responses for unknown commands, or from a peer other than the one the
+// command was sent to, are ignored and reported as untracked.
+func (sm *StreamManager) resolveCommand(peerID string, resp *proto.CommandResponse) bool {
+	future, tracked := sm.pending.take(resp.CommandId, func(f *CommandFuture) bool {
+		return f.PeerID == peerID
+	})
+	if !tracked {
+		return false
+	}
+
+	future.timer.Stop()
+
+	outcome := CommandOutcomeSuccess
+	if !resp.Success {
+		outcome = CommandOutcomeFailure
+	}
+	sm.commandDuration.WithLabelValues(future.CommandType.String(), outcome).Observe(time.Since(future.sentAt).Seconds())
+
+	future.resp = resp
+	close(future.done)
+	return true
+}
+
+// failCommand completes a future that was already removed from the pending set with an error
+func (sm *StreamManager) failCommand(future *CommandFuture, outcome string, err error) {
+	future.timer.Stop()
+
+	sm.commandsFailed.Add(1)
+	sm.commandDuration.WithLabelValues(future.CommandType.String(), outcome).Observe(time.Since(future.sentAt).Seconds())
+
+	future.err = fmt.Errorf("command %s to peer %s: %w", future.CommandID, future.PeerID, err)
+	close(future.done)
+}
+
+// abandonCommands fails every command sent on a peer's session with ErrStreamLost
+func (sm *StreamManager) abandonCommands(peerID, sessionID string) {
+	lost := sm.pending.takeAll(func(f *CommandFuture) bool {
+		return f.PeerID == peerID && f.sessionID == sessionID
+	})
+	for _, future := range lost {
+		sm.failCommand(future, CommandOutcomeStreamLost, ErrStreamLost)
+	}
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// silentPeerStream is a peer's control stream that records commands and never answers
+type silentPeerStream struct {
+	grpc.ServerStream
+
+	mutex   sync.Mutex
+	sent    []*controlProto.Command
+	sendErr error
+}
+
+func (s *silentPeerStream) Send(msg *controlProto.ControlMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	if cmd := msg.GetCommand(); cmd != nil {
+		s.sent = append(s.sent, cmd)
+	}
+	return nil
+}
+
+func (s *silentPeerStream) Recv() (*controlProto.ControlMessage, error) {
+	return nil, io.EOF
+}
+
+func (s *silentPeerStream) Context() context.Context {
+	return context.Background()
+}
+
+// newTestStreamManager creates a stream manager with a silent stream for each peer
+func newTestStreamManager(t *testing.T, peerIDs ...string) (*StreamManager, map[string]*silentPeerStream) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	sm := NewStreamManager(logger)
+
+	streams := make(map[string]*silentPeerStream)
+	for _, peerID := range peerIDs {
+		streams[peerID] = &silentPeerStream{}
+		if _, err := sm.RegisterStream(peerID, RoleExit, "r1", "", "", streams[peerID]); err != nil {
+			t.Fatalf("RegisterStream(%s): %v", peerID, err)
+		}
+	}
+	return sm, streams
+}
+
+// sendTestCommand sends a SETUP_EXIT with commandID to peerID
+func sendTestCommand(t *testing.T, sm *StreamManager, peerID, commandID string, timeout time.Duration) *CommandFuture {
+	t.Helper()
+
+	future, err := sm.SendCommand(peerID, &controlProto.Command{CommandId: commandID, Type: controlProto.CommandType_SETUP_EXIT}, timeout)
+	if err != nil {
+		t.Fatalf("SendCommand: %v", err)
+	}
+	return future
+}
+
+// waitFuture waits a bounded time for a future to complete
+func waitFuture(t *testing.T, future *CommandFuture) (*controlProto.CommandResponse, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := future.Wait(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("command %s never completed", future.CommandID)
+	}
+	return resp, err
+}
+
+// commandStats returns a copy of a peer's stream statistics
+func commandStats(t *testing.T, sm *StreamManager, peerID string) PeerStats {
+	t.Helper()
+
+	streamInfo, exists := sm.GetStream(peerID)
+	if !exists {
+		t.Fatalf("%s has no stream", peerID)
+	}
+
+	streamInfo.mutex.RLock()
+	defer streamInfo.mutex.RUnlock()
+	return *streamInfo.Stats
+}
+
+// expectPending fails the test unless the future has not completed yet
+func expectPending(t *testing.T, future *CommandFuture) {
+	t.Helper()
+
+	select {
+	case <-future.Done():
+		t.Fatalf("command %s completed early", future.CommandID)
+	default:
+	}
+}
+
+func TestCommandFutureResolvesOnResponse(t *testing.T) {
+	sm, streams := newTestStreamManager(t, "exit-1", "exit-2")
+	future := sendTestCommand(t, sm, "exit-1", "cmd-1", time.Minute)
+
+	if len(streams["exit-1"].sent) != 1 || streams["exit-1"].sent[0].CommandId != "cmd-1" {
+		t.Fatalf("exit-1 got %v, want cmd-1", streams["exit-1"].sent)
+	}
+	expectPending(t, future)
+
+	// Only the peer the command was sent to can answer it
+	sm.UpdateCommandResult("exit-2", &controlProto.CommandResponse{CommandId: "cmd-1", Success: true})
+	expectPending(t, future)
+
+	sm.UpdateCommandResult("exit-1", &controlProto.CommandResponse{CommandId: "cmd-1", Success: false, Message: "no capacity"})
+	resp, err := waitFuture(t, future)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if resp.Success || resp.Message != "no capacity" {
+		t.Fatalf("response %v, want the peer's failure", resp)
+	}
+	if n := sm.pending.count(); n != 0 {
+		t.Fatalf("%d commands in flight, want 0", n)
+	}
+
+	if stats := commandStats(t, sm, "exit-1"); stats.CommandsExecuted != 1 || stats.CommandsFailed != 1 {
+		t.Fatalf("stats %+v, want 1 command executed and failed", stats)
+	}
+
+	// A repeated response finds nothing to resolve
+	if sm.resolveCommand("exit-1", &controlProto.CommandResponse{CommandId: "cmd-1", Success: true}) {
+		t.Fatal("a command was resolved twice")
+	}
+}
+
+func TestCommandFutureTimesOut(t *testing.T) {
+	sm, _ := newTestStreamManager(t, "exit-1")
+	future := sendTestCommand(t, sm, "exit-1", "cmd-1", 20*time.Millisecond)
+
+	resp, err := waitFuture(t, future)
+	if !errors.Is(err, ErrCommandTimeout) || resp != nil {
+		t.Fatalf("Wait returned %v, %v; want ErrCommandTimeout", resp, err)
+	}
+
+	if stats := commandStats(t, sm, "exit-1"); stats.CommandsFailed != 1 || stats.LastCommandFailure.IsZero() {
+		t.Fatalf("stats %+v, want the unanswered command counted as failed", stats)
+	}
+
+	// The answer arriving after the deadline is not tracked any more
+	if sm.resolveCommand("exit-1", &controlProto.CommandResponse{CommandId: "cmd-1", Success: true}) {
+		t.Fatal("a timed out command was resolved")
+	}
+}
+
+func TestCommandFutureFailsOnStreamLoss(t *testing.T) {
+	tests := []struct {
+		name string
+		lose func(t *testing.T, sm *StreamManager, sessionID string)
+	}{
+		{
+			name: "stream closes",
+			lose: func(t *testing.T, sm *StreamManager, sessionID string) {
+				if !sm.UnregisterStream("exit-1", sessionID) {
+					t.Fatal("stream was not unregistered")
+				}
+			},
+		},
+		{
+			name: "stream is replaced by a reconnect",
+			lose: func(t *testing.T, sm *StreamManager, sessionID string) {
+				if _, err := sm.RegisterStream("exit-1", RoleExit, "r1", "", "", &silentPeerStream{}); err != nil {
+					t.Fatalf("RegisterStream: %v", err)
+				}
+			},
+		},
+		{
+			name: "stream goes stale",
+			lose: func(t *testing.T, sm *StreamManager, sessionID string) {
+				streamInfo, _ := sm.GetStream("exit-1")
+				streamInfo.LastHeartbeat = time.Now().Add(-time.Hour)
+				sm.CheckStaleStreams(time.Minute)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, _ := newTestStreamManager(t, "exit-1", "exit-2")
+			streamInfo, _ := sm.GetStream("exit-1")
+			lost := sendTestCommand(t, sm, "exit-1", "cmd-1", time.Minute)
+			other := sendTestCommand(t, sm, "exit-2", "cmd-2", time.Minute)
+
+			tt.lose(t, sm, streamInfo.SessionID)
+
+			resp, err := waitFuture(t, lost)
+			if !errors.Is(err, ErrStreamLost) || resp != nil {
+				t.Fatalf("Wait returned %v, %v; want ErrStreamLost", resp, err)
+			}
+			expectPending(t, other)
+		})
+	}
+}
+
+func TestCommandFutureKeepsCommandsOfNewStream(t *testing.T) {
+	sm, _ := newTestStreamManager(t, "exit-1")
+	old, _ := sm.GetStream("exit-1")
+
+	if _, err := sm.RegisterStream("exit-1", RoleExit, "r1", "", "", &silentPeerStream{}); err != nil {
+		t.Fatalf("RegisterStream: %v", err)
+	}
+	future := sendTestCommand(t, sm, "exit-1", "cmd-1", time.Minute)
+
+	// The superseded stream's handler returning must not fail the new stream's commands
+	if sm.UnregisterStream("exit-1", old.SessionID) {
+		t.Fatal("superseded stream removed its replacement")
+	}
+	expectPending(t, future)
+}
+
+func TestSendCommandFailures(t *testing.T) {
+	sm, streams := newTestStreamManager(t, "exit-1")
+	sendTestCommand(t, sm, "exit-1", "cmd-1", time.Minute)
+
+	// A command_id already in flight is refused
+	if _, err := sm.SendCommand("exit-1", &controlProto.Command{CommandId: "cmd-1"}, time.Minute); err == nil {
+		t.Fatal("command_id in flight was sent again")
+	}
+
+	if _, err := sm.SendCommand("exit-2", &controlProto.Command{CommandId: "cmd-2"}, time.Minute); err == nil {
+		t.Fatal("command sent to a peer without a stream")
+	}
+
+	// A command that cannot be sent is not left in flight
+	streams["exit-1"].sendErr = errors.New("transport is closing")
+	if _, err := sm.SendCommand("exit-1", &controlProto.Command{CommandId: "cmd-3"}, time.Minute); err == nil {
+		t.Fatal("SendCommand ignored the send error")
+	}
+	if n := sm.pending.count(); n != 1 {
+		t.Fatalf("%d commands in flight, want only cmd-1", n)
+	}
+}
+
+func TestCommandFutureWaitStopsWithContext(t *testing.T) {
+	sm, _ := newTestStreamManager(t, "exit-1")
+	future := sendTestCommand(t, sm, "exit-1", "cmd-1", time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := future.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait returned %v, want context.Canceled", err)
+	}
+
+	// The command stays in flight for another waiter
+	sm.UpdateCommandResult("exit-1", &controlProto.CommandResponse{CommandId: "cmd-1", Success: true})
+	if resp, err := waitFuture(t, future); err != nil || !resp.Success {
+		t.Fatalf("Wait returned %v, %v; want the peer's response", resp, err)
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// exitSetupTimeout bounds how long we wait for an exit peer to answer SETUP_EXIT
+const exitSetupTimeout = 15 * time.Second
+
+// exitAllocation describes an exit peer that has accepted a client
+type exitAllocation struct {
+	ExitPeer     *controlProto.ExitPeerInfo
+	SessionID    string
+	AllocatedIP  string
+	AllocatedIP6 string // Empty when the exit has no IPv6
+
+	// Address and ID of the remote SuperNode that set up the exit, empty when local
+	OwnerAddr string
+	OwnerID   string
+}
+
+// handleExitRequest allocates an exit for a client and replies with an ExitAssignment
+func (sn *SuperNode) handleExitRequest(peerID string, req *controlProto.ExitRequest) {
+	sn.logger.WithFields(logrus.Fields{
+		"peer_id":       peerID,
+		"request_id":    req.RequestId,
+		"target_region": req.TargetRegion,
+	}).Info("Received exit request")
+
+	assignment := &controlProto.ExitAssignment{
+		RequestId: req.RequestId,
+	}
+
+	allocation, err := sn.allocateExit(context.Background(), peerID, req.WgPublicKey, req.TargetRegion, nil)
+	if err != nil {
+		sn.logger.WithError(err).WithField("peer_id", peerID).Warn("Exit allocation failed")
+		assignment.Success = false
+		assignment.Message = err.Error()
+	} else {
+		assignment.Success = true
+		assignment.Message = "Exit peer allocated successfully"
+		assignment.ExitPeer = allocation.ExitPeer
+		assignment.SessionId = allocation.SessionID
+		assignment.AllocatedIp = allocation.AllocatedIP
+		assignment.AllocatedIp6 = allocation.AllocatedIP6
+
+		// The exit is released again unless the client confirms the assignment
+		sn.trackExitSession(&exitSession{
+			SessionID:    allocation.SessionID,
+			ClientID:     peerID,
+			ExitPeerID:   allocation.ExitPeer.PeerId,
+			ClientPubKey: req.WgPublicKey,
+			Region:       exitRegion(req.TargetRegion, sn.region),
+			OwnerAddr:    allocation.OwnerAddr,
+			OwnerID:      allocation.OwnerID,
+			Assignment:   allocation,
+		}, exitConfirmTimeout)
+	}
+
+	response := &controlProto.ControlMessage{
+		MessageId: fmt.Sprintf("exit-assign-%d", time.Now().UnixNano()),
+		Timestamp: time.Now().Unix(),
+		Payload: &controlProto.ControlMessage_ExitAssignment{
+			ExitAssignment: assignment,
+		},
+	}
+
+	if err := sn.streamManager.SendMessageToPeer(peerID, response); err != nil {
+		sn.logger.WithError(err).WithField("peer_id", peerID).Error("Failed to send exit assignment")
+
+		if assignment.Success {
+			if session, tracked := sn.exitSessions.take(assignment.SessionId, func(s *exitSession) bool { return true }); tracked {
+				sn.releaseExitSession(session, "exit assignment could not be delivered")
+			}
+		}
+	}
+}
+
+// allocateExit allocates an exit peer for a client in the requested region,
+// never picking one of the exit peers in exclude
+func (sn *SuperNode) allocateExit(ctx context.Context, clientID, clientPubKey, targetRegion string, exclude []string) (*exitAllocation, error) {
+	if clientPubKey == "" {
+		return nil, fmt.Errorf("client WireGuard public key is required")
+	}
+
+	if targetRegion != "" && targetRegion != sn.region {
+		return sn.allocateRemoteExit(clientID, clientPubKey, targetRegion, exclude)
+	}
+
+	return sn.allocateLocalExit(ctx, clientID, clientPubKey, exclude)
+}
+
+// allocateLocalExit selects one of our exit peers and drives SETUP_EXIT on it
+func (sn *SuperNode) allocateLocalExit(ctx context.Context, clientID, clientPubKey string, exclude []string) (*exitAllocation, error) {
+	if sn.IsDraining() {
+		return nil, fmt.Errorf("SuperNode %s is draining", sn.id)
+	}
+
+	candidates := sn.exitCandidates(clientID, exclude)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no exit peers available in region %s", sn.region)
+	}
+
+	selected := sn.exitSelector.Select(clientID, candidates)
+	selectedPeer, exists := sn.streamManager.GetStream(selected.PeerID)
+	if !exists {
+		return nil, fmt.Errorf("exit peer %s disconnected", selected.PeerID)
+	}
+
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"exit_peer":  selected.PeerID,
+		"strategy":   sn.exitSelector.Name(),
+		"candidates": len(candidates),
+		"clients":    selected.Clients,
+		"capacity":   selected.Capacity,
+	}).Debug("Selected exit peer")
+
+	sessionID := fmt.Sprintf("%s-%s-%d", clientID, selectedPeer.PeerID, time.Now().UnixNano())
+
+	setupCommand := &controlProto.Command{
+		CommandId: fmt.Sprintf("setup-exit-%d", time.Now().UnixNano()),
+		Type:      controlProto.CommandType_SETUP_EXIT,
+		Payload: map[string]string{
+			"client_id":     clientID,
+			"client_pubkey": clientPubKey,
+			"session_id":    sessionID,
+			"allowed_ips":   strings.Join(utils.FullTunnelAllowedIPs(), ","),
+		},
+	}
+
+	resp, err := sn.sendCommandAndWait(ctx, selectedPeer.PeerID, setupCommand, exitSetupTimeout)
+	if err != nil {
+		// The exit may have set the client up without us hearing back
+		go sn.teardownExit(selectedPeer.PeerID, clientID, sessionID, "setup was not acknowledged")
+		return nil, fmt.Errorf("failed to setup exit peer %s: %w", selectedPeer.PeerID, err)
+	}
+
+	if !resp.Success {
+		return nil, fmt.Errorf("exit peer %s rejected setup: %s", selectedPeer.PeerID, resp.Message)
+	}
+
+	exitPubKey := resp.Result["public_key"]
+	allocatedIP := resp.Result["allocated_ip"]
+	allocatedIP6 := resp.Result["allocated_ip6"]
+	if exitPubKey == "" || allocatedIP == "" {
+		go sn.teardownExit(selectedPeer.PeerID, clientID, sessionID, "incomplete setup result")
+		return nil, fmt.Errorf("exit peer %s returned incomplete setup result", selectedPeer.PeerID)
+	}
+
+	endpoint, err := resolveExitEndpoint(resp.Result["endpoint"], selectedPeer.RemoteAddr)
+	if err != nil {
+		go sn.teardownExit(selectedPeer.PeerID, clientID, sessionID, "invalid endpoint")
+		return nil, fmt.Errorf("exit peer %s returned invalid endpoint: %w", selectedPeer.PeerID, err)
+	}
+
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":     clientID,
+		"exit_peer":     selectedPeer.PeerID,
+		"endpoint":      endpoint,
+		"allocated_ip":  allocatedIP,
+		"allocated_ip6": allocatedIP6,
+		"session_id":    sessionID,
+	}).Info("Allocated local exit peer")
+
+	return &exitAllocation{
+		ExitPeer: &controlProto.ExitPeerInfo{
+			PeerId:                   selectedPeer.PeerID,
+			PublicKey:                exitPubKey,
+			Endpoint:                 endpoint,
+			AllowedIps:               utils.FullTunnelAllowedIPs(),
+			SupportsDirectConnection: true,
+		},
+		SessionID:    sessionID,
+		AllocatedIP:  allocatedIP,
+		AllocatedIP6: allocatedIP6,
+	}, nil
+}
+
+// sendCommandAndWait sends a command and blocks until the peer answers, the
+// command times out, the peer's stream is lost or ctx ends
+func (sn *SuperNode) sendCommandAndWait(ctx context.Context, peerID string, command *controlProto.Command, timeout time.Duration) (*controlProto.CommandResponse, error) {
+	future, err := sn.streamManager.SendCommand(peerID, command, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return future.Wait(ctx)
+}
+
+// exitRegion is the region an exit request is served from
+func exitRegion(targetRegion, localRegion string) string {
+	if targetRegion == "" {
+		return localRegion
+	}
+	return targetRegion
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveExitEndpoint replaces an unspecified endpoint host with the exit's observed address
+func resolveExitEndpoint(reported, remoteAddr string) (string, error) {
+	host, port, err := net.SplitHostPort(reported)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		remoteHost, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			return "", fmt.Errorf("exit reported no host and remote address is unknown")
+		}
+		host = remoteHost
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"myDvpn/base/proto"
+	controlProto "myDvpn/clientPeer/proto"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// remoteExitTimeout bounds a single RequestExitPeer call to a remote SuperNode
+const remoteExitTimeout = exitSetupTimeout + 5*time.Second
+
+// allocateRemoteExit brokers an exit in another region through the BaseNode
+func (sn *SuperNode) allocateRemoteExit(clientID, clientPubKey, targetRegion string, exclude []string) (*exitAllocation, error) {
+	if sn.baseClient == nil {
+		return nil, fmt.Errorf("not connected to BaseNode")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	regionResp, err := sn.baseClient.RequestExitRegion(ctx, &proto.RequestExitRegionRequest{
+		TargetRegion:          targetRegion,
+		RequestingSupernodeId: sn.id,
+	})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query BaseNode for region %s: %w", targetRegion, err)
+	}
+
+	// Candidates arrive from the BaseNode already sorted by load
+	var failures []string
+	for _, candidate := range regionResp.CandidateSupernodes {
+		if candidate.SupernodeId == sn.id {
+			continue
+		}
+
+		allocation, err := sn.requestExitFromSuperNode(candidate, clientID, clientPubKey, targetRegion, exclude)
+		if err != nil {
+			sn.logger.WithError(err).WithFields(logrus.Fields{
+				"supernode_id": candidate.SupernodeId,
+				"region":       targetRegion,
+			}).Warn("Remote SuperNode could not provide exit, trying next candidate")
+			failures = append(failures, fmt.Sprintf("%s: %v", candidate.SupernodeId, err))
+			continue
+		}
+
+		sn.logger.WithFields(logrus.Fields{
+			"client_id":    clientID,
+			"supernode_id": candidate.SupernodeId,
+			"exit_peer":    allocation.ExitPeer.PeerId,
+			"session_id":   allocation.SessionID,
+		}).Info("Allocated remote exit peer")
+
+		return allocation, nil
+	}
+
+	if len(failures) == 0 {
+		return nil, fmt.Errorf("no SuperNodes available in region %s", targetRegion)
+	}
+
+	return nil, fmt.Errorf("no SuperNode in region %s could provide an exit: %s", targetRegion, strings.Join(failures, "; "))
+}
+
+// requestExitFromSuperNode calls RequestExitPeer on a single remote SuperNode
+func (sn *SuperNode) requestExitFromSuperNode(candidate *proto.SuperNodeInfo, clientID, clientPubKey, targetRegion string, exclude []string) (*exitAllocation, error) {
+	addr := net.JoinHostPort(candidate.IpAddress, strconv.Itoa(int(candidate.Port)))
+
+	conn, err := sn.getRemoteConn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteExitTimeout)
+	defer cancel()
+
+	resp, err := controlProto.NewSuperNodeClient(conn).RequestExitPeer(ctx, &controlProto.RequestExitPeerRequest{
+		ClientId:              clientID,
+		Region:                targetRegion,
+		RequestingSupernodeId: sn.id,
+		ClientPubkey:          clientPubKey,
+		ExcludePeerIds:        exclude,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("RequestExitPeer failed: %w", err)
+	}
+
+	if !resp.Success {
+		return nil, fmt.Errorf("%s", resp.Message)
+	}
+
+	if resp.ExitPeer == nil || resp.AllocatedIp == "" {
+		return nil, fmt.Errorf("incomplete exit peer response")
+	}
+
+	return &exitAllocation{
+		ExitPeer:     resp.ExitPeer,
+		SessionID:    resp.SessionId,
+		AllocatedIP:  resp.AllocatedIp,
+		AllocatedIP6: resp.AllocatedIp6,
+		OwnerAddr:    addr,
+		OwnerID:      candidate.SupernodeId,
+	}, nil
+}
+
+// getRemoteConn returns a cached connection to a remote SuperNode
+func (sn *SuperNode) getRemoteConn(addr string) (*grpc.ClientConn, error) {
+	sn.remoteConnsMux.Lock()
+	defer sn.remoteConnsMux.Unlock()
+
+	if conn, exists := sn.remoteConns[addr]; exists {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(addr, sn.creds.DialOption())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SuperNode %s: %w", addr, err)
+	}
+
+	sn.remoteConns[addr] = conn
+	return conn, nil
+}
+
+// closeRemoteConns closes all cached remote SuperNode connections
+func (sn *SuperNode) closeRemoteConns() {
+	sn.remoteConnsMux.Lock()
+	defer sn.remoteConnsMux.Unlock()
+
+	for addr, conn := range sn.remoteConns {
+		conn.Close()
+		delete(sn.remoteConns, addr)
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A client that fails over keeps its tunnel, but the exit session behind it
+// is tracked by the SuperNode it left, which releases the session once the
+// client's reconnect grace runs out. After reconnecting elsewhere the client
+// sends ExitResume naming that home SuperNode, and the new SuperNode claims
+// the session from it with ClaimExitSession:
+//
+//   - the home SuperNode keeps the session for the new one, as if the new
+//     SuperNode had requested the exit through RequestExitPeer, and the new
+//     SuperNode tracks it as a session owned by the home SuperNode;
+//   - if the new SuperNode owns the exit itself, as on failing back, the home
+//     SuperNode forgets the session and the owner tracks it for its own
+//     client again.
+//
+// A SuperNode that holds the session for the home SuperNode takes it back
+// even if the home SuperNode cannot be reached. Otherwise a failed claim is
+// reported to the client, which requests a new exit.
+
+// exitClaimTimeout bounds a ClaimExitSession call
+const exitClaimTimeout = 10 * time.Second
+
+// handOver gives up an active session of one of our own clients to the
+// SuperNode requester. The session is kept for it, or forgotten if requester
+// owns the exit; returned reports which.
+func (es *exitSessions) handOver(sessionID, clientID, requester string) (session *exitSession, returned bool, err error) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	session, exists := es.active[sessionID]
+	if !exists || session.ClientID != clientID || session.Requester != "" {
+		return nil, false, fmt.Errorf("no active exit session %s of client %s", sessionID, clientID)
+	}
+
+	if session.OwnerID == requester {
+		delete(es.active, sessionID)
+		return session, true, nil
+	}
+
+	session.Requester = requester
+	return session, false, nil
+}
+
+// reclaim makes an active session we hold for another SuperNode a session of
+// our own client again. from names that SuperNode; empty accepts any.
+func (es *exitSessions) reclaim(sessionID, clientID, from string) (*exitSession, bool) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	session, exists := es.active[sessionID]
+	if !exists || session.ClientID != clientID || session.Requester == "" {
+		return nil, false
+	}
+	if from != "" && session.Requester != from {
+		return nil, false
+	}
+
+	session.Requester = ""
+	return session, true
+}
+
+// handleExitResume claims the exit session a client kept across a failover
+// from the SuperNode it left, and acknowledges the outcome
+func (sn *SuperNode) handleExitResume(peerID string, resume *controlProto.ExitResume) {
+	ack := &controlProto.ExitResumeAck{
+		RequestId: resume.RequestId,
+	}
+
+	logger := sn.logger.WithFields(logrus.Fields{
+		"client_id":      peerID,
+		"session_id":     resume.SessionId,
+		"home_supernode": resume.HomeSupernode,
+	})
+
+	if err := sn.resumeExitSession(peerID, resume); err != nil {
+		logger.WithError(err).Warn("Could not resume exit session after failover")
+		ack.Message = err.Error()
+	} else {
+		logger.Info("Resumed exit session after failover")
+		ack.Success = true
+		ack.Message = "Exit session resumed"
+	}
+
+	response := &controlProto.ControlMessage{
+		MessageId: fmt.Sprintf("exit-resume-ack-%d", time.Now().UnixNano()),
+		Timestamp: time.Now().Unix(),
+		Payload: &controlProto.ControlMessage_ExitResumeAck{
+			ExitResumeAck: ack,
+		},
+	}
+
+	if err := sn.streamManager.SendMessageToPeer(peerID, response); err != nil {
+		logger.WithError(err).Error("Failed to send exit resume acknowledgement")
+	}
+}
+
+// resumeExitSession claims a client's exit session from its home SuperNode
+// and tracks it as a session of our own client
+func (sn *SuperNode) resumeExitSession(clientID string, resume *controlProto.ExitResume) error {
+	if resume.SessionId == "" || resume.HomeSupernode == "" {
+		return fmt.Errorf("session ID and home SuperNode are required")
+	}
+
+	resp, err := sn.claimExitSession(resume.HomeSupernode, resume.SessionId, clientID)
+	if err != nil {
+		// We may serve the exit for the home SuperNode; the client is back, so keep it
+		if session, reclaimed := sn.exitSessions.reclaim(resume.SessionId, clientID, ""); reclaimed {
+			sn.logger.WithError(err).WithField("session_id", resume.SessionId).Warn("Home SuperNode unreachable, taking back exit session we serve")
+			sn.replaceExitSessions(session)
+			return nil
+		}
+		return err
+	}
+
+	if resp.Returned {
+		session, reclaimed := sn.exitSessions.reclaim(resume.SessionId, clientID, resp.SupernodeId)
+		if !reclaimed {
+			return fmt.Errorf("SuperNode %s returned exit session %s, which we do not hold", resp.SupernodeId, resume.SessionId)
+		}
+		sn.replaceExitSessions(session)
+		return nil
+	}
+
+	if resp.ExitPeer == nil || resp.ExitPeer.PeerId == "" {
+		return fmt.Errorf("SuperNode %s returned no exit peer for session %s", resp.SupernodeId, resume.SessionId)
+	}
+
+	allocation := &exitAllocation{
+		ExitPeer:     resp.ExitPeer,
+		SessionID:    resume.SessionId,
+		AllocatedIP:  resp.AllocatedIp,
+		AllocatedIP6: resp.AllocatedIp6,
+		OwnerAddr:    resume.HomeSupernode,
+		OwnerID:      resp.SupernodeId,
+	}
+
+	session := &exitSession{
+		SessionID:    resume.SessionId,
+		ClientID:     clientID,
+		ExitPeerID:   resp.ExitPeer.PeerId,
+		ClientPubKey: resp.ClientPubkey,
+		Region:       resp.Region,
+		OwnerAddr:    allocation.OwnerAddr,
+		OwnerID:      allocation.OwnerID,
+	}
+	// Rotating back to the exit needs a complete assignment
+	if resp.ExitPeer.PublicKey != "" && resp.AllocatedIp != "" {
+		session.Assignment = allocation
+	}
+
+	sn.replaceExitSessions(session)
+	return nil
+}
+
+// claimExitSession calls ClaimExitSession on a client's home SuperNode
+func (sn *SuperNode) claimExitSession(homeAddr, sessionID, clientID string) (*controlProto.ClaimExitSessionResponse, error) {
+	conn, err := sn.getRemoteConn(homeAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exitClaimTimeout)
+	defer cancel()
+
+	resp, err := controlProto.NewSuperNodeClient(conn).ClaimExitSession(ctx, &controlProto.ClaimExitSessionRequest{
+		SessionId:             sessionID,
+		ClientId:              clientID,
+		RequestingSupernodeId: sn.id,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ClaimExitSession to %s failed: %w", homeAddr, err)
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("SuperNode %s refused to hand over session %s: %s", homeAddr, sessionID, resp.Message)
+	}
+	return resp, nil
+}
+
+// ClaimExitSession hands an active exit session of one of our clients over
+// to the SuperNode the client failed over to
+func (sn *SuperNode) ClaimExitSession(ctx context.Context, req *controlProto.ClaimExitSessionRequest) (*controlProto.ClaimExitSessionResponse, error) {
+	if req.SessionId == "" || req.ClientId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "session ID and client ID are required")
+	}
+
+	if err := sn.authenticateSuperNode(ctx, req.RequestingSupernodeId); err != nil {
+		return nil, err
+	}
+
+	// The client authenticated on the requesting SuperNode, so a stream we
+	// may still have for it is about to be found stale; the session is no
+	// longer ours to release then
+	session, returned, err := sn.exitSessions.handOver(req.SessionId, req.ClientId, req.RequestingSupernodeId)
+	if err != nil {
+		return &controlProto.ClaimExitSessionResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":            session.ClientID,
+		"exit_peer":            session.ExitPeerID,
+		"session_id":           session.SessionID,
+		"requesting_supernode": req.RequestingSupernodeId,
+		"returned":             returned,
+	}).Info("Handed exit session over to SuperNode")
+
+	resp := &controlProto.ClaimExitSessionResponse{
+		Success:      true,
+		Message:      "Exit session handed over",
+		SupernodeId:  sn.id,
+		Returned:     returned,
+		ClientPubkey: session.ClientPubKey,
+		Region:       session.Region,
+		ExitPeer:     &controlProto.ExitPeerInfo{PeerId: session.ExitPeerID},
+	}
+	if session.Assignment != nil {
+		resp.ExitPeer = session.Assignment.ExitPeer
+		resp.AllocatedIp = session.Assignment.AllocatedIP
+		resp.AllocatedIp6 = session.Assignment.AllocatedIP6
+	}
+	return resp, nil
+}
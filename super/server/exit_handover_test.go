@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// startHandoverSuperNode creates a SuperNode serving the SuperNode service on
+// a loopback port, as other SuperNodes reach it, and returns its address
+func startHandoverSuperNode(t *testing.T, id string) (*SuperNode, string) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	sn := NewSuperNode(id, "r1", "127.0.0.1:0", nil, utils.InsecureCredentials(), logger)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	server := grpc.NewServer()
+	controlProto.RegisterSuperNodeServer(server, sn)
+	go server.Serve(listener)
+
+	t.Cleanup(func() {
+		server.Stop()
+		sn.closeRemoteConns()
+	})
+	return sn, listener.Addr().String()
+}
+
+// disconnectTestPeer closes a peer's stream as PersistentControlStream does when the peer goes away
+func disconnectTestPeer(t *testing.T, sn *SuperNode, peerID string) {
+	t.Helper()
+
+	streamInfo, exists := sn.streamManager.GetStream(peerID)
+	if !exists {
+		t.Fatalf("peer %s is not connected", peerID)
+	}
+	if sn.streamManager.UnregisterStream(peerID, streamInfo.SessionID) {
+		sn.peerStreamClosed(peerID)
+	}
+}
+
+// resumeExit sends the ExitResume of a client that reconnected to sn and returns the acknowledgement
+func resumeExit(t *testing.T, sn *SuperNode, client *scriptedPeerStream, sessionID, homeAddr string) *controlProto.ExitResumeAck {
+	t.Helper()
+
+	sn.handleExitResume(client.peerID, &controlProto.ExitResume{
+		RequestId:     "resume-" + homeAddr,
+		SessionId:     sessionID,
+		HomeSupernode: homeAddr,
+	})
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	for i := len(client.messages) - 1; i >= 0; i-- {
+		if ack := client.messages[i].GetExitResumeAck(); ack != nil {
+			return ack
+		}
+	}
+	t.Fatal("client got no ExitResumeAck")
+	return nil
+}
+
+// handoverTest is a client c1 of SuperNode a using exit-1 of a, and a second SuperNode b
+type handoverTest struct {
+	a, b         *SuperNode
+	aAddr, bAddr string
+	exit         *scriptedPeerStream
+	sessionID    string
+}
+
+func newHandoverTest(t *testing.T) *handoverTest {
+	t.Helper()
+
+	grace := exitSessionReconnectGrace
+	exitSessionReconnectGrace = 20 * time.Millisecond
+	t.Cleanup(func() { exitSessionReconnectGrace = grace })
+
+	ht := &handoverTest{}
+	ht.a, ht.aAddr = startHandoverSuperNode(t, "sn-a")
+	ht.b, ht.bAddr = startHandoverSuperNode(t, "sn-b")
+	ht.exit = connectScriptedPeer(t, ht.a, "exit-1", RoleExit, (&testExit{peerID: "exit-1"}).respond)
+	connectScriptedPeer(t, ht.a, "c1", RoleClient, nil)
+
+	ht.a.handleExitRequest("c1", &controlProto.ExitRequest{RequestId: "req-1", PeerId: "c1", WgPublicKey: "key-c1"})
+	setups := ht.exit.received(controlProto.CommandType_SETUP_EXIT)
+	if len(setups) != 1 {
+		t.Fatalf("exit got %d SETUP_EXIT, want 1", len(setups))
+	}
+	ht.sessionID = setups[0].Payload["session_id"]
+
+	ht.a.handleExitConfirm("c1", &controlProto.ExitConfirm{SessionId: ht.sessionID, Success: true})
+	if current, exists := ht.a.exitSessions.current("c1"); !exists || current.SessionID != ht.sessionID {
+		t.Fatalf("current session of c1 on sn-a %+v, want %s", current, ht.sessionID)
+	}
+	return ht
+}
+
+// failOver moves c1 from one SuperNode to the other and resumes its session there
+func (ht *handoverTest) failOver(t *testing.T, from, to *SuperNode, homeAddr string) *controlProto.ExitResumeAck {
+	t.Helper()
+
+	disconnectTestPeer(t, from, "c1")
+	client := connectScriptedPeer(t, to, "c1", RoleClient, nil)
+	ack := resumeExit(t, to, client, ht.sessionID, homeAddr)
+
+	// Outlast the reconnect grace of the SuperNode c1 left
+	time.Sleep(10 * exitSessionReconnectGrace)
+	return ack
+}
+
+// expectNoTeardown fails the test if the exit was told to drop the session
+func (ht *handoverTest) expectNoTeardown(t *testing.T) {
+	t.Helper()
+
+	if teardowns := ht.exit.received(controlProto.CommandType_TEARDOWN_EXIT); len(teardowns) != 0 {
+		t.Fatalf("exit got teardowns %v, want the tunnel kept", teardowns)
+	}
+}
+
+func TestExitSessionSurvivesFailoverAndFailback(t *testing.T) {
+	ht := newHandoverTest(t)
+
+	// Fail over to sn-b, which claims the session from sn-a
+	if ack := ht.failOver(t, ht.a, ht.b, ht.aAddr); !ack.Success {
+		t.Fatalf("resume on sn-b failed: %s", ack.Message)
+	}
+	ht.expectNoTeardown(t)
+
+	current, exists := ht.b.exitSessions.current("c1")
+	if !exists || current.SessionID != ht.sessionID || current.OwnerAddr != ht.aAddr || current.OwnerID != "sn-a" {
+		t.Fatalf("current session of c1 on sn-b %+v, want %s owned by sn-a", current, ht.sessionID)
+	}
+	if current.Assignment == nil || current.Assignment.ExitPeer.PublicKey != "key-exit-1" {
+		t.Fatalf("session on sn-b has assignment %+v, want the exit-1 assignment", current.Assignment)
+	}
+	if _, exists := ht.a.exitSessions.current("c1"); exists {
+		t.Fatal("sn-a still tracks the session for its own client")
+	}
+	if n := ht.a.exitSessions.countActive(); n != 1 {
+		t.Fatalf("sn-a holds %d active sessions, want the one kept for sn-b", n)
+	}
+
+	// Fail back to sn-a, which owns the exit and takes the session back
+	if ack := ht.failOver(t, ht.b, ht.a, ht.bAddr); !ack.Success {
+		t.Fatalf("resume on sn-a failed: %s", ack.Message)
+	}
+	ht.expectNoTeardown(t)
+
+	if current, exists := ht.a.exitSessions.current("c1"); !exists || current.SessionID != ht.sessionID {
+		t.Fatalf("current session of c1 on sn-a %+v, want %s", current, ht.sessionID)
+	}
+	if n := ht.b.exitSessions.countActive(); n != 0 {
+		t.Fatalf("sn-b holds %d active sessions, want 0", n)
+	}
+
+	// sn-a tracks the session for real again: the client leaving the exit releases it
+	ht.a.handleExitConfirm("c1", &controlProto.ExitConfirm{SessionId: ht.sessionID, Success: false, Message: "disconnected from exit"})
+	if teardowns := ht.exit.received(controlProto.CommandType_TEARDOWN_EXIT); len(teardowns) != 1 || teardowns[0].Payload["session_id"] != ht.sessionID {
+		t.Fatalf("exit got teardowns %v, want %s torn down", teardowns, ht.sessionID)
+	}
+}
+
+func TestResumedExitSessionIsReleasedThroughNewSuperNode(t *testing.T) {
+	ht := newHandoverTest(t)
+
+	if ack := ht.failOver(t, ht.a, ht.b, ht.aAddr); !ack.Success {
+		t.Fatalf("resume on sn-b failed: %s", ack.Message)
+	}
+
+	// The release is forwarded to sn-a, which owns the exit
+	ht.b.handleExitConfirm("c1", &controlProto.ExitConfirm{SessionId: ht.sessionID, Success: false, Message: "disconnected from exit"})
+	if teardowns := ht.exit.received(controlProto.CommandType_TEARDOWN_EXIT); len(teardowns) != 1 {
+		t.Fatalf("exit got %d teardowns, want 1", len(teardowns))
+	}
+	if n := ht.a.exitSessions.countActive() + ht.b.exitSessions.countActive(); n != 0 {
+		t.Fatalf("%d active sessions left, want 0", n)
+	}
+}
+
+func TestExitResumeFailures(t *testing.T) {
+	ht := newHandoverTest(t)
+	disconnectTestPeer(t, ht.a, "c1")
+	client := connectScriptedPeer(t, ht.b, "c1", RoleClient, nil)
+
+	// Unknown sessions and unreachable SuperNodes cannot be claimed
+	if ack := resumeExit(t, ht.b, client, "other-session", ht.aAddr); ack.Success {
+		t.Fatal("unknown session was resumed")
+	}
+	if ack := resumeExit(t, ht.b, client, ht.sessionID, "127.0.0.1:1"); ack.Success {
+		t.Fatal("session was resumed from an unreachable SuperNode")
+	}
+	if _, exists := ht.b.exitSessions.current("c1"); exists {
+		t.Fatal("sn-b tracks a session it could not claim")
+	}
+
+	// Only the client the session belongs to can claim it
+	resp, err := ht.b.claimExitSession(ht.aAddr, ht.sessionID, "c2")
+	if err == nil {
+		t.Fatalf("session of c1 was handed over for c2: %+v", resp)
+	}
+
+	// A SuperNode serving the exit for an unreachable home SuperNode takes the session back
+	if ack := resumeExit(t, ht.b, client, ht.sessionID, ht.aAddr); !ack.Success {
+		t.Fatalf("resume on sn-b failed: %s", ack.Message)
+	}
+	disconnectTestPeer(t, ht.b, "c1")
+	client = connectScriptedPeer(t, ht.a, "c1", RoleClient, nil)
+	if ack := resumeExit(t, ht.a, client, ht.sessionID, "127.0.0.1:1"); !ack.Success {
+		t.Fatalf("sn-a did not take back the session it serves: %s", ack.Message)
+	}
+	if current, exists := ht.a.exitSessions.current("c1"); !exists || current.SessionID != ht.sessionID {
+		t.Fatalf("current session of c1 on sn-a %+v, want %s", current, ht.sessionID)
+	}
+}
+
+func TestClaimExitSessionValidatesRequest(t *testing.T) {
+	sn := newTestSuperNode()
+
+	_, err := sn.ClaimExitSession(context.Background(), &controlProto.ClaimExitSessionRequest{ClientId: "c1", RequestingSupernodeId: "sn-b"})
+	expectCode(t, err, codes.InvalidArgument)
+}
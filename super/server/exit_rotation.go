@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+
+	"github.com/sirupsen/logrus"
+)
+
+// exitMigrationTimeout bounds moving one exit client away from an exit that
+// goes away
+const exitMigrationTimeout = 30 * time.Second
+
+// rotationActivateAttempts is how often ACTIVATE_EXIT is sent for the exit a
+// client has already switched to before the client is sent back
+const rotationActivateAttempts = 3
+
+// rotationActivateRetryDelay is the pause between those attempts
+var rotationActivateRetryDelay = 2 * time.Second
+
+// RotateClientExit moves a client from its current exit to a new one without
+// dropping its tunnel. A new exit is set up first and handed to the client in
+// ROTATE_PEER; the client switches once the new exit handshakes, after which
+// the new session is activated and the old exit torn down. If the client
+// cannot switch, the new exit is released and the old one stays in use. If the
+// new exit cannot be activated once the client switched, the client is sent
+// back to its old exit, which is only torn down after a successful activation.
+// targetRegion defaults to the region of the client's current exit.
+func (sn *SuperNode) RotateClientExit(ctx context.Context, clientID, targetRegion string, timeout time.Duration) (*controlProto.CommandResponse, error) {
+	current, exists := sn.exitSessions.current(clientID)
+	if !exists {
+		return nil, fmt.Errorf("client %s has no active exit session to rotate", clientID)
+	}
+
+	if targetRegion == "" {
+		targetRegion = current.Region
+	}
+
+	allocation, err := sn.allocateExit(ctx, clientID, current.ClientPubKey, targetRegion, []string{current.ExitPeerID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate new exit: %w", err)
+	}
+
+	session := &exitSession{
+		SessionID:    allocation.SessionID,
+		ClientID:     clientID,
+		ExitPeerID:   allocation.ExitPeer.PeerId,
+		ClientPubKey: current.ClientPubKey,
+		Region:       targetRegion,
+		OwnerAddr:    allocation.OwnerAddr,
+		OwnerID:      allocation.OwnerID,
+		Assignment:   allocation,
+	}
+
+	// The deadline only matters if we stop waiting for the client ourselves
+	sn.trackExitSession(session, timeout+exitSessionCommandTimeout)
+
+	command := rotatePeerCommand(allocation, current.SessionID)
+
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":      clientID,
+		"old_exit_peer":  current.ExitPeerID,
+		"new_exit_peer":  session.ExitPeerID,
+		"old_session_id": current.SessionID,
+		"new_session_id": session.SessionID,
+	}).Info("Rotating client to new exit peer")
+
+	resp, err := sn.sendCommandAndWait(ctx, clientID, command, timeout)
+
+	pending, tracked := sn.exitSessions.take(session.SessionID, func(s *exitSession) bool { return s == session })
+	if !tracked {
+		return nil, fmt.Errorf("new exit session %s expired during rotation", session.SessionID)
+	}
+
+	if err != nil {
+		sn.releaseExitSession(pending, "client did not complete rotation")
+		return nil, fmt.Errorf("client %s did not complete rotation: %w", clientID, err)
+	}
+	if !resp.Success {
+		sn.releaseExitSession(pending, fmt.Sprintf("client could not rotate: %s", resp.Message))
+		return resp, nil
+	}
+
+	if err := sn.activateRotatedSession(pending); err != nil {
+		sn.revertRotation(current, pending, timeout)
+		return nil, fmt.Errorf("client %s switched to %s but activation failed: %w", clientID, session.ExitPeerID, err)
+	}
+
+	// Activation releases the old session, which tears down the old exit
+	sn.replaceExitSessions(pending)
+
+	if resp.Result == nil {
+		resp.Result = make(map[string]string)
+	}
+	resp.Result["old_session_id"] = current.SessionID
+	resp.Result["new_session_id"] = session.SessionID
+	resp.Result["old_exit_peer_id"] = current.ExitPeerID
+	resp.Result["new_exit_peer_id"] = session.ExitPeerID
+
+	return resp, nil
+}
+
+// activateRotatedSession activates the exit a client has switched to,
+// retrying since giving up on it moves the client once more
+func (sn *SuperNode) activateRotatedSession(session *exitSession) error {
+	var err error
+	for attempt := 1; attempt <= rotationActivateAttempts; attempt++ {
+		if err = sn.confirmExitSession(session); err == nil {
+			return nil
+		}
+
+		sn.logger.WithError(err).WithFields(logrus.Fields{
+			"client_id":  session.ClientID,
+			"exit_peer":  session.ExitPeerID,
+			"session_id": session.SessionID,
+			"attempt":    attempt,
+		}).Warn("Failed to activate exit the client rotated to")
+
+		if attempt < rotationActivateAttempts {
+			time.Sleep(rotationActivateRetryDelay)
+		}
+	}
+	return err
+}
+
+// revertRotation sends a client back to the exit of its previous session,
+// which is still set up, and releases the exit it could not stay on
+func (sn *SuperNode) revertRotation(previous, failed *exitSession, timeout time.Duration) {
+	logger := sn.logger.WithFields(logrus.Fields{
+		"client_id":      failed.ClientID,
+		"exit_peer":      previous.ExitPeerID,
+		"session_id":     previous.SessionID,
+		"failed_session": failed.SessionID,
+	})
+
+	if previous.Assignment == nil {
+		logger.Error("Cannot send client back to its previous exit, its assignment is unknown")
+	} else {
+		// Runs to completion even if the caller of the rotation stopped waiting
+		resp, err := sn.sendCommandAndWait(context.Background(), failed.ClientID, rotatePeerCommand(previous.Assignment, failed.SessionID), timeout)
+		if err == nil && !resp.Success {
+			err = fmt.Errorf("client refused: %s", resp.Message)
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to send client back to its previous exit")
+		} else {
+			logger.Info("Sent client back to its previous exit")
+		}
+	}
+
+	sn.releaseExitSession(failed, "exit could not be activated after rotation")
+}
+
+// rotatePeerCommand builds the ROTATE_PEER moving a client from the session
+// oldSessionID to the exit of allocation
+func rotatePeerCommand(allocation *exitAllocation, oldSessionID string) *controlProto.Command {
+	return &controlProto.Command{
+		CommandId: fmt.Sprintf("rotate-peer-%d", time.Now().UnixNano()),
+		Type:      controlProto.CommandType_ROTATE_PEER,
+		Payload: map[string]string{
+			"exit_peer_id":   allocation.ExitPeer.PeerId,
+			"public_key":     allocation.ExitPeer.PublicKey,
+			"endpoint":       allocation.ExitPeer.Endpoint,
+			"allowed_ips":    strings.Join(allocation.ExitPeer.AllowedIps, ","),
+			"allocated_ip":   allocation.AllocatedIP,
+			"allocated_ip6":  allocation.AllocatedIP6,
+			"session_id":     allocation.SessionID,
+			"old_session_id": oldSessionID,
+		},
+	}
+}
+
+// releaseOwnExitSessions releases the sessions a peer holds as a client of other exits
+func (sn *SuperNode) releaseOwnExitSessions(peerID, reason string) {
+	pending, active := sn.exitSessions.onExit(func(s *exitSession) bool {
+		return s.ClientID == peerID && s.Requester == ""
+	})
+
+	for _, session := range pending {
+		if taken, ok := sn.exitSessions.take(session.SessionID, func(s *exitSession) bool { return s == session }); ok {
+			sn.releaseExitSession(taken, reason)
+		}
+	}
+	for _, session := range active {
+		if taken, ok := sn.exitSessions.takeActive(session.SessionID, func(s *exitSession) bool { return s == session }); ok {
+			sn.releaseExitSession(taken, reason)
+		}
+	}
+}
+
+// migrateExitClients moves every client off an exit that is going away. Our
+// own clients are rotated to another exit without dropping their tunnel;
+// sessions of other SuperNodes and clients that cannot be rotated are released.
+func (sn *SuperNode) migrateExitClients(exitPeerID, reason string) (int, int) {
+	onExit := func(s *exitSession) bool {
+		return s.ExitPeerID == exitPeerID && s.OwnerAddr == ""
+	}
+
+	pending, active := sn.exitSessions.onExit(onExit)
+	if len(pending) == 0 && len(active) == 0 {
+		return 0, 0
+	}
+
+	var migrated, released atomic.Int32
+	for _, session := range pending {
+		if taken, ok := sn.exitSessions.take(session.SessionID, func(s *exitSession) bool { return s == session }); ok {
+			sn.releaseExitSession(taken, reason)
+			released.Add(1)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, session := range active {
+		if session.Requester != "" {
+			if taken, ok := sn.exitSessions.takeActive(session.SessionID, func(s *exitSession) bool { return s == session }); ok {
+				sn.releaseExitSession(taken, reason)
+				released.Add(1)
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(session *exitSession) {
+			defer wg.Done()
+
+			resp, err := sn.RotateClientExit(context.Background(), session.ClientID, "", exitMigrationTimeout)
+			if err == nil && !resp.Success {
+				err = fmt.Errorf("%s", resp.Message)
+			}
+			if err == nil {
+				migrated.Add(1)
+				return
+			}
+
+			sn.logger.WithError(err).WithFields(logrus.Fields{
+				"client_id": session.ClientID,
+				"exit_peer": exitPeerID,
+			}).Warn("Could not move client off exit peer")
+
+			if taken, ok := sn.exitSessions.takeActive(session.SessionID, func(s *exitSession) bool { return s == session }); ok {
+				sn.releaseExitSession(taken, reason)
+			}
+			released.Add(1)
+		}(session)
+	}
+	wg.Wait()
+
+	sn.logger.WithFields(logrus.Fields{
+		"exit_peer": exitPeerID,
+		"migrated":  migrated.Load(),
+		"released":  released.Load(),
+	}).Info("Migrated clients off exit peer")
+
+	return int(migrated.Load()), int(released.Load())
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+
+	"google.golang.org/grpc"
+)
+
+// scriptedPeerStream is a peer's control stream that records the messages it
+// receives and answers commands with respond, or with success when respond is nil
+type scriptedPeerStream struct {
+	grpc.ServerStream
+	peerID  string
+	sm      *StreamManager
+	respond func(cmd *controlProto.Command) *controlProto.CommandResponse
+
+	mutex    sync.Mutex
+	commands []*controlProto.Command
+	messages []*controlProto.ControlMessage // Everything but commands
+}
+
+func (s *scriptedPeerStream) Send(msg *controlProto.ControlMessage) error {
+	cmd := msg.GetCommand()
+
+	s.mutex.Lock()
+	if cmd == nil {
+		s.messages = append(s.messages, msg)
+	} else {
+		s.commands = append(s.commands, cmd)
+	}
+	s.mutex.Unlock()
+
+	if cmd == nil {
+		return nil
+	}
+
+	resp := &controlProto.CommandResponse{Success: true}
+	if s.respond != nil {
+		resp = s.respond(cmd)
+	}
+	resp.CommandId = cmd.CommandId
+	go s.sm.UpdateCommandResult(s.peerID, resp)
+	return nil
+}
+
+func (s *scriptedPeerStream) Recv() (*controlProto.ControlMessage, error) {
+	return nil, io.EOF
+}
+
+func (s *scriptedPeerStream) Context() context.Context {
+	return context.Background()
+}
+
+// received returns the commands of a type the peer received so far
+func (s *scriptedPeerStream) received(commandType controlProto.CommandType) []*controlProto.Command {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var commands []*controlProto.Command
+	for _, cmd := range s.commands {
+		if cmd.Type == commandType {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// connectScriptedPeer registers a scripted stream for a peer
+func connectScriptedPeer(t *testing.T, sn *SuperNode, peerID string, role PeerRole, respond func(*controlProto.Command) *controlProto.CommandResponse) *scriptedPeerStream {
+	t.Helper()
+
+	stream := &scriptedPeerStream{peerID: peerID, sm: sn.streamManager, respond: respond}
+	if _, err := sn.streamManager.RegisterStream(peerID, role, "r1", "", "", stream); err != nil {
+		t.Fatalf("RegisterStream(%s): %v", peerID, err)
+	}
+	return stream
+}
+
+// testExit answers SETUP_EXIT as an exit peer would; ACTIVATE_EXIT fails
+// while failActivations is positive
+type testExit struct {
+	peerID          string
+	failActivations int
+	mutex           sync.Mutex
+}
+
+func (te *testExit) respond(cmd *controlProto.Command) *controlProto.CommandResponse {
+	switch cmd.Type {
+	case controlProto.CommandType_SETUP_EXIT:
+		return &controlProto.CommandResponse{
+			Success: true,
+			Result: map[string]string{
+				"public_key":   "key-" + te.peerID,
+				"allocated_ip": "10.8.0.2",
+				"endpoint":     "198.51.100.1:51820",
+			},
+		}
+	case controlProto.CommandType_ACTIVATE_EXIT:
+		te.mutex.Lock()
+		defer te.mutex.Unlock()
+		if te.failActivations > 0 {
+			te.failActivations--
+			return &controlProto.CommandResponse{Success: false, Message: "unreachable"}
+		}
+	}
+	return &controlProto.CommandResponse{Success: true}
+}
+
+// rotationTest is a SuperNode with client c1 on exit-1 in session s1, and exit-2 to rotate to
+type rotationTest struct {
+	sn       *SuperNode
+	client   *scriptedPeerStream
+	exit1    *scriptedPeerStream
+	exit2    *scriptedPeerStream
+	exit2Cfg *testExit
+}
+
+func newRotationTest(t *testing.T, clientRespond func(*controlProto.Command) *controlProto.CommandResponse) *rotationTest {
+	t.Helper()
+
+	delay := rotationActivateRetryDelay
+	rotationActivateRetryDelay = time.Millisecond
+	t.Cleanup(func() { rotationActivateRetryDelay = delay })
+
+	rt := &rotationTest{sn: newTestSuperNode(), exit2Cfg: &testExit{peerID: "exit-2"}}
+	rt.exit1 = connectScriptedPeer(t, rt.sn, "exit-1", RoleExit, (&testExit{peerID: "exit-1"}).respond)
+	rt.exit2 = connectScriptedPeer(t, rt.sn, "exit-2", RoleExit, rt.exit2Cfg.respond)
+	rt.client = connectScriptedPeer(t, rt.sn, "c1", RoleClient, clientRespond)
+
+	rt.sn.exitSessions.activate(&exitSession{
+		SessionID:    "s1",
+		ClientID:     "c1",
+		ExitPeerID:   "exit-1",
+		ClientPubKey: "key-c1",
+		Region:       "r1",
+		Assignment: &exitAllocation{
+			ExitPeer: &controlProto.ExitPeerInfo{
+				PeerId:    "exit-1",
+				PublicKey: "key-exit-1",
+				Endpoint:  "198.51.100.1:51820",
+			},
+			SessionID:   "s1",
+			AllocatedIP: "10.8.0.2",
+		},
+	})
+	return rt
+}
+
+// expectCurrentSession fails the test unless the client's active session is on exitPeerID
+func (rt *rotationTest) expectCurrentSession(t *testing.T, exitPeerID string) *exitSession {
+	t.Helper()
+
+	current, exists := rt.sn.exitSessions.current("c1")
+	if !exists || current.ExitPeerID != exitPeerID {
+		t.Fatalf("current session %+v, want one on %s", current, exitPeerID)
+	}
+	if n := rt.sn.exitSessions.countActive(); n != 1 {
+		t.Fatalf("%d active sessions, want 1", n)
+	}
+	return current
+}
+
+func TestRotateClientExit(t *testing.T) {
+	rt := newRotationTest(t, nil)
+
+	resp, err := rt.sn.RotateClientExit(context.Background(), "c1", "", 5*time.Second)
+	if err != nil {
+		t.Fatalf("RotateClientExit: %v", err)
+	}
+	current := rt.expectCurrentSession(t, "exit-2")
+	if !resp.Success || resp.Result["old_session_id"] != "s1" || resp.Result["new_session_id"] != current.SessionID {
+		t.Fatalf("rotation result %v, want s1 replaced by %s", resp, current.SessionID)
+	}
+
+	rotations := rt.client.received(controlProto.CommandType_ROTATE_PEER)
+	if len(rotations) != 1 {
+		t.Fatalf("client got %d ROTATE_PEER, want 1", len(rotations))
+	}
+	payload := rotations[0].Payload
+	if payload["exit_peer_id"] != "exit-2" || payload["public_key"] != "key-exit-2" || payload["old_session_id"] != "s1" {
+		t.Fatalf("ROTATE_PEER payload %v, want exit-2 replacing s1", payload)
+	}
+
+	if n := len(rt.exit2.received(controlProto.CommandType_ACTIVATE_EXIT)); n != 1 {
+		t.Fatalf("exit-2 got %d ACTIVATE_EXIT, want 1", n)
+	}
+	teardowns := rt.exit1.received(controlProto.CommandType_TEARDOWN_EXIT)
+	if len(teardowns) != 1 || teardowns[0].Payload["session_id"] != "s1" {
+		t.Fatalf("exit-1 got teardowns %v, want s1 torn down", teardowns)
+	}
+}
+
+func TestRotateClientExitKeepsOldExitWhenClientCannotSwitch(t *testing.T) {
+	rt := newRotationTest(t, func(cmd *controlProto.Command) *controlProto.CommandResponse {
+		return &controlProto.CommandResponse{Success: false, Message: "no handshake"}
+	})
+
+	resp, err := rt.sn.RotateClientExit(context.Background(), "c1", "", 5*time.Second)
+	if err != nil {
+		t.Fatalf("RotateClientExit: %v", err)
+	}
+	if resp.Success {
+		t.Fatal("rotation succeeded although the client could not switch")
+	}
+
+	rt.expectCurrentSession(t, "exit-1")
+	if n := len(rt.exit2.received(controlProto.CommandType_TEARDOWN_EXIT)); n != 1 {
+		t.Fatalf("exit-2 got %d teardowns, want 1", n)
+	}
+	if n := len(rt.exit1.received(controlProto.CommandType_TEARDOWN_EXIT)); n != 0 {
+		t.Fatalf("exit-1 got %d teardowns, want 0", n)
+	}
+}
+
+func TestRotateClientExitRetriesActivation(t *testing.T) {
+	rt := newRotationTest(t, nil)
+	rt.exit2Cfg.failActivations = rotationActivateAttempts - 1
+
+	if _, err := rt.sn.RotateClientExit(context.Background(), "c1", "", 5*time.Second); err != nil {
+		t.Fatalf("RotateClientExit: %v", err)
+	}
+
+	rt.expectCurrentSession(t, "exit-2")
+	if n := len(rt.exit2.received(controlProto.CommandType_ACTIVATE_EXIT)); n != rotationActivateAttempts {
+		t.Fatalf("exit-2 got %d ACTIVATE_EXIT, want %d", n, rotationActivateAttempts)
+	}
+	if n := len(rt.exit2.received(controlProto.CommandType_TEARDOWN_EXIT)); n != 0 {
+		t.Fatalf("exit-2 got %d teardowns, want 0", n)
+	}
+}
+
+func TestRotateClientExitRevertsWhenActivationFails(t *testing.T) {
+	rt := newRotationTest(t, nil)
+	rt.exit2Cfg.failActivations = rotationActivateAttempts
+
+	if _, err := rt.sn.RotateClientExit(context.Background(), "c1", "", 5*time.Second); err == nil {
+		t.Fatal("rotation to an exit that cannot be activated succeeded")
+	}
+
+	// The client is sent back to exit-1, which was never torn down
+	rt.expectCurrentSession(t, "exit-1")
+	rotations := rt.client.received(controlProto.CommandType_ROTATE_PEER)
+	if len(rotations) != 2 {
+		t.Fatalf("client got %d ROTATE_PEER, want 2", len(rotations))
+	}
+	back := rotations[1].Payload
+	if back["exit_peer_id"] != "exit-1" || back["public_key"] != "key-exit-1" || back["session_id"] != "s1" || back["old_session_id"] != rotations[0].Payload["session_id"] {
+		t.Fatalf("second ROTATE_PEER payload %v, want the client sent back to s1 on exit-1", back)
+	}
+	if n := len(rt.exit1.received(controlProto.CommandType_TEARDOWN_EXIT)); n != 0 {
+		t.Fatalf("exit-1 got %d teardowns, want 0", n)
+	}
+
+	teardowns := rt.exit2.received(controlProto.CommandType_TEARDOWN_EXIT)
+	if len(teardowns) != 1 || !strings.HasPrefix(teardowns[0].Payload["session_id"], "c1-exit-2-") {
+		t.Fatalf("exit-2 got teardowns %v, want the new session released", teardowns)
+	}
+}
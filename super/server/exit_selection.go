@@ -0,0 +1,198 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Exit selection strategies, chosen per SuperNode
+const (
+	ExitSelectionLeastClients   = "least-clients"
+	ExitSelectionLowestRTT      = "lowest-rtt"
+	ExitSelectionWeightedRandom = "weighted-random"
+	ExitSelectionConsistentHash = "consistent-hash"
+)
+
+const (
+	// defaultExitCapacity is assumed for exits that do not advertise a capacity
+	defaultExitCapacity = 250
+
+	// exitFailureCooldown is how long an exit whose command failed is passed over
+	exitFailureCooldown = 2 * time.Minute
+)
+
+// ExitCandidate is a local exit peer that could take a client
+type ExitCandidate struct {
+	PeerID    string
+	Clients   int
+	Capacity  int
+	LatencyMs float64
+}
+
+// load returns the fraction of the exit's capacity in use
+func (c *ExitCandidate) load() float64 {
+	return float64(c.Clients) / float64(c.Capacity)
+}
+
+// ExitSelector chooses the exit peer a client is set up on. Candidates are
+// never empty, are sorted by peer ID, have spare capacity and have no recent
+// command failures.
+type ExitSelector interface {
+	Name() string
+	Select(clientID string, candidates []*ExitCandidate) *ExitCandidate
+}
+
+// NewExitSelector returns the exit selection strategy with the given name
+func NewExitSelector(name string) (ExitSelector, error) {
+	switch name {
+	case ExitSelectionLeastClients:
+		return &leastClientsSelector{}, nil
+	case ExitSelectionLowestRTT:
+		return &lowestRTTSelector{}, nil
+	case ExitSelectionWeightedRandom:
+		return &weightedRandomSelector{}, nil
+	case ExitSelectionConsistentHash:
+		return &consistentHashSelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown exit selection strategy %q", name)
+	}
+}
+
+// leastClientsSelector picks the exit with the lowest share of its capacity in use
+type leastClientsSelector struct{}
+
+func (s *leastClientsSelector) Name() string { return ExitSelectionLeastClients }
+
+func (s *leastClientsSelector) Select(clientID string, candidates []*ExitCandidate) *ExitCandidate {
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.load() < best.load() {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// lowestRTTSelector picks the exit with the lowest heartbeat latency, breaking
+// ties by load. Exits that have not reported a latency yet come last.
+type lowestRTTSelector struct{}
+
+func (s *lowestRTTSelector) Name() string { return ExitSelectionLowestRTT }
+
+func (s *lowestRTTSelector) Select(clientID string, candidates []*ExitCandidate) *ExitCandidate {
+	rtt := func(c *ExitCandidate) float64 {
+		if c.LatencyMs <= 0 {
+			return float64(time.Hour.Milliseconds())
+		}
+		return c.LatencyMs
+	}
+
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if rtt(candidate) < rtt(best) || (rtt(candidate) == rtt(best) && candidate.load() < best.load()) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// weightedRandomSelector picks an exit at random, weighted by spare capacity
+type weightedRandomSelector struct{}
+
+func (s *weightedRandomSelector) Name() string { return ExitSelectionWeightedRandom }
+
+func (s *weightedRandomSelector) Select(clientID string, candidates []*ExitCandidate) *ExitCandidate {
+	total := 0
+	for _, candidate := range candidates {
+		total += spareCapacity(candidate)
+	}
+	if total == 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	n := rand.Intn(total)
+	for _, candidate := range candidates {
+		n -= spareCapacity(candidate)
+		if n < 0 {
+			return candidate
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// spareCapacity returns how many more clients an exit accepts
+func spareCapacity(c *ExitCandidate) int {
+	if c.Clients >= c.Capacity {
+		return 0
+	}
+	return c.Capacity - c.Clients
+}
+
+// consistentHashSelector keeps a client on the same exit for as long as that
+// exit is a candidate, using rendezvous hashing so that exits joining or
+// leaving only move the clients hashed to them
+type consistentHashSelector struct{}
+
+func (s *consistentHashSelector) Name() string { return ExitSelectionConsistentHash }
+
+func (s *consistentHashSelector) Select(clientID string, candidates []*ExitCandidate) *ExitCandidate {
+	var best *ExitCandidate
+	var bestScore uint64
+	for _, candidate := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(clientID))
+		h.Write([]byte{0})
+		h.Write([]byte(candidate.PeerID))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// exitCandidates lists the local exit peers a client could be set up on.
+// Full exits are left out, since they refuse new clients, and so are exits
+// with a command failure in the last exitFailureCooldown: a client handed to
+// an exit that just failed is likely to lose its tunnel again, so the request
+// rather fails here and the client retries.
+func (sn *SuperNode) exitCandidates(clientID string, exclude []string) []*ExitCandidate {
+	clients := sn.exitSessions.clientsPerExit()
+
+	var candidates []*ExitCandidate
+	for _, role := range []PeerRole{RoleExit, RoleHybrid} {
+		for _, streamInfo := range sn.streamManager.GetStreamsByRole(role) {
+			// A peer can never be its own exit
+			if streamInfo.PeerID == clientID || containsString(exclude, streamInfo.PeerID) {
+				continue
+			}
+
+			streamInfo.mutex.RLock()
+			candidate := &ExitCandidate{
+				PeerID:    streamInfo.PeerID,
+				Clients:   clients[streamInfo.PeerID],
+				Capacity:  streamInfo.MaxClients,
+				LatencyMs: streamInfo.Stats.LatencyMs,
+			}
+			lastFailure := streamInfo.Stats.LastCommandFailure
+			streamInfo.mutex.RUnlock()
+
+			if time.Since(lastFailure) <= exitFailureCooldown {
+				continue
+			}
+			if candidate.Capacity <= 0 {
+				candidate.Capacity = defaultExitCapacity
+			}
+			if candidate.Clients >= candidate.Capacity {
+				continue
+			}
+
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].PeerID < candidates[j].PeerID })
+	return candidates
+}
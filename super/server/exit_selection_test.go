@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExitSelectors(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   string
+		candidates []*ExitCandidate
+		want       string
+	}{
+		{
+			name:     "least clients picks the lowest share of capacity",
+			strategy: ExitSelectionLeastClients,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 5, Capacity: 10},
+				{PeerID: "exit-2", Clients: 10, Capacity: 100},
+				{PeerID: "exit-3", Clients: 2, Capacity: 10},
+			},
+			want: "exit-2",
+		},
+		{
+			name:     "least clients keeps the first of equally loaded exits",
+			strategy: ExitSelectionLeastClients,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 1, Capacity: 10},
+				{PeerID: "exit-2", Clients: 1, Capacity: 10},
+			},
+			want: "exit-1",
+		},
+		{
+			name:     "lowest RTT picks the closest exit",
+			strategy: ExitSelectionLowestRTT,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 0, Capacity: 10, LatencyMs: 40},
+				{PeerID: "exit-2", Clients: 9, Capacity: 10, LatencyMs: 12},
+				{PeerID: "exit-3", Clients: 0, Capacity: 10, LatencyMs: 25},
+			},
+			want: "exit-2",
+		},
+		{
+			name:     "lowest RTT breaks ties by load",
+			strategy: ExitSelectionLowestRTT,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 6, Capacity: 10, LatencyMs: 12},
+				{PeerID: "exit-2", Clients: 3, Capacity: 10, LatencyMs: 12},
+			},
+			want: "exit-2",
+		},
+		{
+			name:     "lowest RTT puts exits without a latency last",
+			strategy: ExitSelectionLowestRTT,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 0, Capacity: 10},
+				{PeerID: "exit-2", Clients: 5, Capacity: 10, LatencyMs: 300},
+			},
+			want: "exit-2",
+		},
+		{
+			name:     "weighted random with a single candidate",
+			strategy: ExitSelectionWeightedRandom,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 3, Capacity: 10},
+			},
+			want: "exit-1",
+		},
+		{
+			name:     "weighted random never picks an exit without spare capacity",
+			strategy: ExitSelectionWeightedRandom,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 10, Capacity: 10},
+				{PeerID: "exit-2", Clients: 3, Capacity: 10},
+				{PeerID: "exit-3", Clients: 12, Capacity: 10},
+			},
+			want: "exit-2",
+		},
+		{
+			name:     "consistent hash with a single candidate",
+			strategy: ExitSelectionConsistentHash,
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 9, Capacity: 10},
+			},
+			want: "exit-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := NewExitSelector(tt.strategy)
+			if err != nil {
+				t.Fatalf("NewExitSelector: %v", err)
+			}
+			if selector.Name() != tt.strategy {
+				t.Fatalf("selector named %q, want %q", selector.Name(), tt.strategy)
+			}
+
+			// Random strategies must give the same answer every time
+			for i := 0; i < 50; i++ {
+				if got := selector.Select("c1", tt.candidates); got.PeerID != tt.want {
+					t.Fatalf("selected %s, want %s", got.PeerID, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewExitSelectorRejectsUnknownStrategy(t *testing.T) {
+	if _, err := NewExitSelector("round-robin"); err == nil {
+		t.Fatal("unknown strategy was accepted")
+	}
+}
+
+func TestWeightedRandomSelectorFollowsSpareCapacity(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []*ExitCandidate
+		// minimum share of selections for exit-1, out of 1000
+		minShare int
+		maxShare int
+	}{
+		{
+			name: "equal spare capacity",
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 0, Capacity: 100},
+				{PeerID: "exit-2", Clients: 50, Capacity: 150},
+			},
+			minShare: 400,
+			maxShare: 600,
+		},
+		{
+			name: "one exit nearly full",
+			candidates: []*ExitCandidate{
+				{PeerID: "exit-1", Clients: 0, Capacity: 1000},
+				{PeerID: "exit-2", Clients: 99, Capacity: 100},
+			},
+			minShare: 980,
+			maxShare: 1000,
+		},
+	}
+
+	selector := &weightedRandomSelector{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			share := 0
+			for i := 0; i < 1000; i++ {
+				if selector.Select("c1", tt.candidates).PeerID == "exit-1" {
+					share++
+				}
+			}
+			if share < tt.minShare || share > tt.maxShare {
+				t.Fatalf("exit-1 selected %d times in 1000, want %d to %d", share, tt.minShare, tt.maxShare)
+			}
+		})
+	}
+}
+
+func TestConsistentHashSelectorKeepsClients(t *testing.T) {
+	candidates := []*ExitCandidate{
+		{PeerID: "exit-1", Capacity: 10},
+		{PeerID: "exit-2", Capacity: 10},
+		{PeerID: "exit-3", Capacity: 10},
+		{PeerID: "exit-4", Capacity: 10},
+	}
+	selector := &consistentHashSelector{}
+
+	tests := []struct {
+		name   string
+		change func(candidates []*ExitCandidate, selected string) []*ExitCandidate
+		moved  bool
+		// exit that joined and may take over clients hashed to it
+		joined string
+	}{
+		{
+			name: "load changes",
+			change: func(candidates []*ExitCandidate, selected string) []*ExitCandidate {
+				var changed []*ExitCandidate
+				for _, c := range candidates {
+					changed = append(changed, &ExitCandidate{PeerID: c.PeerID, Clients: 9, Capacity: 10})
+				}
+				return changed
+			},
+		},
+		{
+			name: "another exit leaves",
+			change: func(candidates []*ExitCandidate, selected string) []*ExitCandidate {
+				var changed []*ExitCandidate
+				removed := false
+				for _, c := range candidates {
+					if c.PeerID != selected && !removed {
+						removed = true
+						continue
+					}
+					changed = append(changed, c)
+				}
+				return changed
+			},
+		},
+		{
+			name: "an exit joins",
+			change: func(candidates []*ExitCandidate, selected string) []*ExitCandidate {
+				return append([]*ExitCandidate{{PeerID: "exit-0", Capacity: 10}}, candidates...)
+			},
+			joined: "exit-0",
+		},
+		{
+			name: "the selected exit leaves",
+			change: func(candidates []*ExitCandidate, selected string) []*ExitCandidate {
+				var changed []*ExitCandidate
+				for _, c := range candidates {
+					if c.PeerID != selected {
+						changed = append(changed, c)
+					}
+				}
+				return changed
+			},
+			moved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, clientID := range []string{"c1", "c2", "c3", "c4", "c5", "c6"} {
+				selected := selector.Select(clientID, candidates).PeerID
+				changed := tt.change(candidates, selected)
+				after := selector.Select(clientID, changed).PeerID
+
+				if tt.joined != "" && after == tt.joined {
+					continue
+				}
+				if moved := after != selected; moved != tt.moved {
+					t.Fatalf("client %s moved from %s to %s: %v, want %v", clientID, selected, after, moved, tt.moved)
+				}
+			}
+		})
+	}
+}
+
+// failCommandsOf records a command failure of a peer at when
+func failCommandsOf(t *testing.T, sn *SuperNode, peerID string, when time.Time) {
+	t.Helper()
+
+	streamInfo, exists := sn.streamManager.GetStream(peerID)
+	if !exists {
+		t.Fatalf("peer %s is not connected", peerID)
+	}
+	streamInfo.mutex.Lock()
+	streamInfo.Stats.CommandsFailed++
+	streamInfo.Stats.LastCommandFailure = when
+	streamInfo.mutex.Unlock()
+}
+
+// candidateIDs returns the peer IDs of candidates
+func candidateIDs(candidates []*ExitCandidate) []string {
+	var ids []string
+	for _, c := range candidates {
+		ids = append(ids, c.PeerID)
+	}
+	return ids
+}
+
+func TestExitCandidatesSkipFailingAndFullExits(t *testing.T) {
+	sn := newTestSuperNode()
+	for _, id := range []string{"exit-4", "exit-1", "exit-2", "exit-3", "exit-5"} {
+		connectTestPeer(t, sn, id, RoleExit)
+	}
+	connectTestPeer(t, sn, "h1", RoleHybrid)
+
+	// exit-1 failed just now, exit-2 long enough ago to be tried again
+	failCommandsOf(t, sn, "exit-1", time.Now())
+	failCommandsOf(t, sn, "exit-2", time.Now().Add(-2*exitFailureCooldown))
+
+	// exit-3 is full
+	sn.streamManager.SetMaxClients("exit-3", 1)
+	sn.exitSessions.activate(&exitSession{SessionID: "s1", ClientID: "c9", ExitPeerID: "exit-3"})
+
+	got := candidateIDs(sn.exitCandidates("h1", []string{"exit-5"}))
+	if len(got) != 2 || got[0] != "exit-2" || got[1] != "exit-4" {
+		t.Fatalf("candidates %v, want [exit-2 exit-4]", got)
+	}
+
+	// Exits that all failed recently are never handed out
+	failCommandsOf(t, sn, "exit-2", time.Now())
+	failCommandsOf(t, sn, "exit-4", time.Now())
+	if got := candidateIDs(sn.exitCandidates("h1", []string{"exit-5"})); len(got) != 0 {
+		t.Fatalf("candidates %v, want none", got)
+	}
+	if _, err := sn.allocateLocalExit(context.Background(), "h1", "key-h1", []string{"exit-5"}); err == nil {
+		t.Fatal("exit allocated although every exit failed recently")
+	}
+}
@@ -0,0 +1,472 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Exit setup runs as a small saga. The exit accepts SETUP_EXIT, the client
+// confirms it applied the ExitAssignment, then the exit is told to activate
+// the session. A failure or timeout at any step sends TEARDOWN_EXIT to the
+// exit so its WireGuard peer and tunnel IP are released; exits also drop
+// sessions that are never activated in case the teardown is lost as well.
+//
+// Activated sessions stay tracked by the SuperNode the client is connected
+// to, so a later assignment for the same client (a new request or a
+// ROTATE_PEER) releases the exit it replaces. A session is also released when
+// the client disconnects from its exit, and when the client or the exit goes
+// away: right away if its stream went stale, or if it does not reconnect
+// within exitSessionReconnectGrace after its stream closed. A client that
+// fails over to another SuperNode has that SuperNode claim its session, so
+// the one it left keeps the exit for the new one instead (exit_handover.go).
+
+const (
+	// exitConfirmTimeout bounds how long a client has to confirm an exit assignment
+	exitConfirmTimeout = 60 * time.Second
+
+	// remoteExitConfirmTimeout is the confirmation window of a session set up
+	// for another SuperNode, which first has to hear from its client
+	remoteExitConfirmTimeout = exitConfirmTimeout + remoteExitTimeout
+
+	// exitSessionCommandTimeout bounds ACTIVATE_EXIT and TEARDOWN_EXIT
+	exitSessionCommandTimeout = 15 * time.Second
+)
+
+// exitSessionReconnectGrace is how long the sessions of a peer whose stream
+// closed are kept for it to reconnect. A client keeps its tunnel while its
+// control stream reconnects, and so does an exit.
+var exitSessionReconnectGrace = 60 * time.Second
+
+// exitSession is an exit allocation, awaiting confirmation or active
+type exitSession struct {
+	SessionID    string
+	ClientID     string
+	ExitPeerID   string
+	ClientPubKey string
+	Region       string
+
+	// Address and ID of the SuperNode that owns the exit, when it is not us.
+	// The owner runs the exit side of the saga and we forward the confirmation.
+	OwnerAddr string
+	OwnerID   string
+
+	// SuperNode the session was set up for through RequestExitPeer, if any
+	Requester string
+
+	// Exit assignment handed to our client, used to send the client back to
+	// this exit if a rotation away from it cannot be completed
+	Assignment *exitAllocation
+
+	timer *time.Timer
+}
+
+// exitSessions tracks unconfirmed and active exit sessions by session_id
+type exitSessions struct {
+	sessions map[string]*exitSession
+	active   map[string]*exitSession
+	closed   map[string]*time.Timer // Peers whose stream closed, by peer ID
+	mutex    sync.Mutex
+}
+
+// newExitSessions creates an empty session table
+func newExitSessions() *exitSessions {
+	return &exitSessions{
+		sessions: make(map[string]*exitSession),
+		active:   make(map[string]*exitSession),
+		closed:   make(map[string]*time.Timer),
+	}
+}
+
+// take removes and returns a session if match accepts it, stopping its deadline
+func (es *exitSessions) take(sessionID string, match func(*exitSession) bool) (*exitSession, bool) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	session, exists := es.sessions[sessionID]
+	if !exists || !match(session) {
+		return nil, false
+	}
+	delete(es.sessions, sessionID)
+	session.timer.Stop()
+	return session, true
+}
+
+// count returns the number of sessions awaiting confirmation
+func (es *exitSessions) count() int {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	return len(es.sessions)
+}
+
+// countActive returns the number of activated sessions
+func (es *exitSessions) countActive() int {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	return len(es.active)
+}
+
+// clientsPerExit counts the pending and active sessions on each of our own
+// exits. Sessions leave the table once released, so only sessions still set
+// up on an exit are counted.
+func (es *exitSessions) clientsPerExit() map[string]int {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	counts := make(map[string]int)
+	for _, table := range []map[string]*exitSession{es.sessions, es.active} {
+		for _, session := range table {
+			if session.OwnerAddr == "" {
+				counts[session.ExitPeerID]++
+			}
+		}
+	}
+	return counts
+}
+
+// onExit returns the pending and active sessions match accepts, leaving them tracked
+func (es *exitSessions) onExit(match func(*exitSession) bool) (pending, active []*exitSession) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	for _, session := range es.sessions {
+		if match(session) {
+			pending = append(pending, session)
+		}
+	}
+	for _, session := range es.active {
+		if match(session) {
+			active = append(active, session)
+		}
+	}
+	return pending, active
+}
+
+// activate records a confirmed session. For sessions of our own clients it
+// removes and returns the client's earlier sessions, which it replaces. An
+// entry for the same session is overwritten, never released.
+func (es *exitSessions) activate(session *exitSession) []*exitSession {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	var replaced []*exitSession
+	if session.Requester == "" {
+		for sessionID, existing := range es.active {
+			if sessionID != session.SessionID && existing.ClientID == session.ClientID && existing.Requester == "" {
+				delete(es.active, sessionID)
+				replaced = append(replaced, existing)
+			}
+		}
+	}
+
+	es.active[session.SessionID] = session
+	return replaced
+}
+
+// takeActive removes and returns an active session if match accepts it
+func (es *exitSessions) takeActive(sessionID string, match func(*exitSession) bool) (*exitSession, bool) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	session, exists := es.active[sessionID]
+	if !exists || !match(session) {
+		return nil, false
+	}
+	delete(es.active, sessionID)
+	return session, true
+}
+
+// current returns the active session of one of our own clients
+func (es *exitSessions) current(clientID string) (*exitSession, bool) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	for _, session := range es.active {
+		if session.ClientID == clientID && session.Requester == "" {
+			return session, true
+		}
+	}
+	return nil, false
+}
+
+// trackExitSession starts the confirmation deadline of a new exit session.
+// The session is torn down unless it is confirmed within timeout.
+func (sn *SuperNode) trackExitSession(session *exitSession, timeout time.Duration) {
+	sn.exitSessions.mutex.Lock()
+	defer sn.exitSessions.mutex.Unlock()
+
+	session.timer = time.AfterFunc(timeout, func() {
+		expired, taken := sn.exitSessions.take(session.SessionID, func(s *exitSession) bool { return s == session })
+		if taken {
+			sn.releaseExitSession(expired, "exit assignment was not confirmed in time")
+		}
+	})
+	sn.exitSessions.sessions[session.SessionID] = session
+}
+
+// handleExitConfirm completes or rolls back the session a client confirmed.
+// Success=false for a session that is already active means the client
+// disconnected from its exit, which releases the session.
+func (sn *SuperNode) handleExitConfirm(peerID string, confirm *controlProto.ExitConfirm) {
+	ownedBy := func(s *exitSession) bool {
+		return s.ClientID == peerID && s.Requester == ""
+	}
+
+	session, exists := sn.exitSessions.take(confirm.SessionId, ownedBy)
+	if !exists && !confirm.Success {
+		if session, exists = sn.exitSessions.takeActive(confirm.SessionId, ownedBy); exists {
+			sn.releaseExitSession(session, fmt.Sprintf("client disconnected: %s", confirm.Message))
+			return
+		}
+	}
+	if !exists {
+		sn.logger.WithFields(logrus.Fields{
+			"peer_id":    peerID,
+			"session_id": confirm.SessionId,
+		}).Warn("Exit confirmation for unknown or expired session")
+		return
+	}
+
+	if !confirm.Success {
+		sn.releaseExitSession(session, fmt.Sprintf("client could not apply exit assignment: %s", confirm.Message))
+		return
+	}
+
+	if err := sn.activateExitSession(session); err != nil {
+		sn.logger.WithError(err).WithFields(logrus.Fields{
+			"client_id":  session.ClientID,
+			"session_id": session.SessionID,
+		}).Error("Failed to activate exit session")
+	}
+}
+
+// activateExitSession tells the exit (or the SuperNode owning it) to keep a
+// confirmed session, tearing it down if the exit cannot be reached. Once
+// active, the session releases any earlier session of the same client.
+func (sn *SuperNode) activateExitSession(session *exitSession) error {
+	if err := sn.confirmExitSession(session); err != nil {
+		if session.OwnerAddr == "" {
+			sn.teardownExit(session.ExitPeerID, session.ClientID, session.SessionID, "activation failed")
+		}
+		return err
+	}
+
+	sn.replaceExitSessions(session)
+	return nil
+}
+
+// confirmExitSession sends ACTIVATE_EXIT for a session, or forwards the
+// confirmation to the SuperNode owning the exit, leaving it set up on failure
+func (sn *SuperNode) confirmExitSession(session *exitSession) error {
+	if session.OwnerAddr != "" {
+		return sn.forwardExitConfirm(session, true, "")
+	}
+
+	command := &controlProto.Command{
+		CommandId: fmt.Sprintf("activate-exit-%d", time.Now().UnixNano()),
+		Type:      controlProto.CommandType_ACTIVATE_EXIT,
+		Payload: map[string]string{
+			"client_id":  session.ClientID,
+			"session_id": session.SessionID,
+		},
+	}
+
+	resp, err := sn.sendCommandAndWait(context.Background(), session.ExitPeerID, command, exitSessionCommandTimeout)
+	if err == nil && !resp.Success {
+		err = fmt.Errorf("exit peer %s refused activation: %s", session.ExitPeerID, resp.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":  session.ClientID,
+		"exit_peer":  session.ExitPeerID,
+		"session_id": session.SessionID,
+	}).Info("Exit session active")
+	return nil
+}
+
+// replaceExitSessions marks a session active and releases the ones it replaces
+func (sn *SuperNode) replaceExitSessions(session *exitSession) {
+	for _, replaced := range sn.exitSessions.activate(session) {
+		sn.releaseExitSession(replaced, fmt.Sprintf("replaced by session %s", session.SessionID))
+	}
+}
+
+// releaseExitSession rolls back an exit session that failed, was never
+// confirmed or has been replaced
+func (sn *SuperNode) releaseExitSession(session *exitSession, reason string) {
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":  session.ClientID,
+		"exit_peer":  session.ExitPeerID,
+		"session_id": session.SessionID,
+		"reason":     reason,
+	}).Warn("Releasing exit session")
+
+	if session.OwnerAddr != "" {
+		if err := sn.forwardExitConfirm(session, false, reason); err != nil {
+			sn.logger.WithError(err).WithField("session_id", session.SessionID).Warn("Failed to report rollback to owning SuperNode; it will expire the session")
+		}
+		return
+	}
+
+	sn.teardownExit(session.ExitPeerID, session.ClientID, session.SessionID, reason)
+}
+
+// peerStreamClosed releases the exit sessions of a peer whose stream closed
+// unless it reconnects within exitSessionReconnectGrace
+func (sn *SuperNode) peerStreamClosed(peerID string) {
+	sn.exitSessions.mutex.Lock()
+	defer sn.exitSessions.mutex.Unlock()
+
+	if timer, exists := sn.exitSessions.closed[peerID]; exists {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(exitSessionReconnectGrace, func() {
+		sn.exitSessions.mutex.Lock()
+		current := sn.exitSessions.closed[peerID] == timer
+		if current {
+			delete(sn.exitSessions.closed, peerID)
+		}
+		sn.exitSessions.mutex.Unlock()
+
+		if current {
+			sn.releasePeerSessions(peerID, "peer did not reconnect")
+		}
+	})
+	sn.exitSessions.closed[peerID] = timer
+}
+
+// peerReconnected keeps the exit sessions of a peer whose stream closed
+func (sn *SuperNode) peerReconnected(peerID string) {
+	sn.exitSessions.mutex.Lock()
+	defer sn.exitSessions.mutex.Unlock()
+
+	if timer, exists := sn.exitSessions.closed[peerID]; exists {
+		timer.Stop()
+		delete(sn.exitSessions.closed, peerID)
+	}
+}
+
+// releasePeerSessions releases the exit sessions of a peer that is gone: the
+// ones it holds as a client, and every session on it as an exit, whose
+// clients are moved to another exit where possible. A peer that is connected
+// again keeps its sessions.
+func (sn *SuperNode) releasePeerSessions(peerID, reason string) {
+	if _, connected := sn.streamManager.GetStream(peerID); connected {
+		return
+	}
+
+	sn.releaseOwnExitSessions(peerID, reason)
+	sn.migrateExitClients(peerID, reason)
+}
+
+// teardownExit sends TEARDOWN_EXIT, the compensating step for SETUP_EXIT.
+// If the exit cannot be reached it drops the session itself once it expires.
+func (sn *SuperNode) teardownExit(exitPeerID, clientID, sessionID, reason string) {
+	sn.exitTeardowns.Add(1)
+
+	command := &controlProto.Command{
+		CommandId: fmt.Sprintf("teardown-exit-%d", time.Now().UnixNano()),
+		Type:      controlProto.CommandType_TEARDOWN_EXIT,
+		Payload: map[string]string{
+			"client_id":  clientID,
+			"session_id": sessionID,
+			"reason":     reason,
+		},
+	}
+
+	resp, err := sn.sendCommandAndWait(context.Background(), exitPeerID, command, exitSessionCommandTimeout)
+	if err == nil && !resp.Success {
+		err = fmt.Errorf("%s", resp.Message)
+	}
+	if err != nil {
+		sn.logger.WithError(err).WithFields(logrus.Fields{
+			"exit_peer":  exitPeerID,
+			"session_id": sessionID,
+		}).Warn("Exit teardown failed; the exit will expire the session")
+		return
+	}
+
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"exit_peer":  exitPeerID,
+		"session_id": sessionID,
+	}).Info("Tore down exit session")
+}
+
+// forwardExitConfirm passes a client's confirmation to the SuperNode owning the exit
+func (sn *SuperNode) forwardExitConfirm(session *exitSession, success bool, message string) error {
+	conn, err := sn.getRemoteConn(session.OwnerAddr)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exitSessionCommandTimeout+5*time.Second)
+	defer cancel()
+
+	resp, err := controlProto.NewSuperNodeClient(conn).ConfirmExitPeer(ctx, &controlProto.ConfirmExitPeerRequest{
+		SessionId:             session.SessionID,
+		RequestingSupernodeId: sn.id,
+		Success:               success,
+		Message:               message,
+	})
+	if err != nil {
+		return fmt.Errorf("ConfirmExitPeer to %s failed: %w", session.OwnerAddr, err)
+	}
+	if !resp.Success {
+		return fmt.Errorf("SuperNode %s rejected confirmation: %s", session.OwnerAddr, resp.Message)
+	}
+	return nil
+}
+
+// ConfirmExitPeer completes or rolls back a session set up through
+// RequestExitPeer. Success=false also releases a session that is already active.
+func (sn *SuperNode) ConfirmExitPeer(ctx context.Context, req *controlProto.ConfirmExitPeerRequest) (*controlProto.ConfirmExitPeerResponse, error) {
+	if err := sn.authenticateSuperNode(ctx, req.RequestingSupernodeId); err != nil {
+		return nil, err
+	}
+
+	requestedBy := func(s *exitSession) bool {
+		return s.Requester == req.RequestingSupernodeId
+	}
+
+	session, exists := sn.exitSessions.take(req.SessionId, requestedBy)
+	if !exists && !req.Success {
+		session, exists = sn.exitSessions.takeActive(req.SessionId, requestedBy)
+	}
+	if !exists {
+		return &controlProto.ConfirmExitPeerResponse{
+			Success: false,
+			Message: fmt.Sprintf("exit session %s is unknown or expired", req.SessionId),
+		}, nil
+	}
+
+	if !req.Success {
+		sn.releaseExitSession(session, fmt.Sprintf("released by SuperNode %s: %s", req.RequestingSupernodeId, req.Message))
+		return &controlProto.ConfirmExitPeerResponse{
+			Success: true,
+			Message: "Exit session torn down",
+		}, nil
+	}
+
+	if err := sn.activateExitSession(session); err != nil {
+		return &controlProto.ConfirmExitPeerResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &controlProto.ConfirmExitPeerResponse{
+		Success: true,
+		Message: "Exit session active",
+	}, nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"time"
+
+	"myDvpn/base/proto"
+)
+
+// defaultMaxPeers is the number of peer streams a SuperNode accepts unless configured
+const defaultMaxPeers = 1000
+
+// relayTrafficSample is a reading of the relay interface's byte counters
+type relayTrafficSample struct {
+	bytes uint64
+	at    time.Time
+}
+
+// SetCapacity sets the peer streams the SuperNode accepts and the relay
+// bandwidth it can carry in bits per second (0 if unknown), as reported to the BaseNode
+func (sn *SuperNode) SetCapacity(maxPeers int, relayBandwidthBps int64) {
+	sn.maxPeers = maxPeers
+	sn.relayBandwidthCapacity = relayBandwidthBps
+}
+
+// exitCapacity returns how many clients our exit and hybrid peers accept in
+// total and how many are set up on them
+func (sn *SuperNode) exitCapacity() (capacity, clients int) {
+	perExit := sn.exitSessions.clientsPerExit()
+
+	for _, role := range []PeerRole{RoleExit, RoleHybrid} {
+		for _, streamInfo := range sn.streamManager.GetStreamsByRole(role) {
+			streamInfo.mutex.RLock()
+			maxClients := streamInfo.MaxClients
+			streamInfo.mutex.RUnlock()
+
+			if maxClients <= 0 {
+				maxClients = defaultExitCapacity
+			}
+			capacity += maxClients
+			clients += perExit[streamInfo.PeerID]
+		}
+	}
+	return capacity, clients
+}
+
+// relayBandwidth returns the relay interface's throughput in bits per second
+// since the previous call, or 0 if its counters cannot be read
+func (sn *SuperNode) relayBandwidth() int64 {
+	if sn.relayManager == nil {
+		return 0
+	}
+
+	bytes, err := sn.relayManager.TrafficBytes()
+	if err != nil {
+		sn.logger.WithError(err).Debug("Relay traffic counters unavailable")
+		return 0
+	}
+
+	sn.relaySampleMux.Lock()
+	defer sn.relaySampleMux.Unlock()
+
+	previous := sn.relaySample
+	sn.relaySample = relayTrafficSample{bytes: bytes, at: time.Now()}
+
+	elapsed := sn.relaySample.at.Sub(previous.at).Seconds()
+	if previous.at.IsZero() || elapsed <= 0 || bytes < previous.bytes {
+		return 0
+	}
+	return int64(float64(bytes-previous.bytes) * 8 / elapsed)
+}
+
+// loadReport returns the load and capacity sent to the BaseNode with every heartbeat
+func (sn *SuperNode) loadReport() (currentLoad, maxCapacity int32, load *proto.SuperNodeLoad) {
+	load = &proto.SuperNodeLoad{
+		Clients:                   int32(len(sn.streamManager.GetStreamsByRole(RoleClient))),
+		Exits:                     int32(len(sn.streamManager.GetStreamsByRole(RoleExit))),
+		Hybrids:                   int32(len(sn.streamManager.GetStreamsByRole(RoleHybrid))),
+		RelayBandwidthBps:         sn.relayBandwidth(),
+		RelayBandwidthCapacityBps: sn.relayBandwidthCapacity,
+	}
+
+	exitCapacity, exitClients := sn.exitCapacity()
+	load.ExitCapacity = int32(exitCapacity)
+	load.ExitClients = int32(exitClients)
+
+	if sn.relayManager != nil {
+		load.RelaySessions = int32(len(sn.relayManager.GetActiveRules()))
+	}
+
+	maxCapacity = int32(sn.maxPeers)
+	currentLoad = int32(len(sn.streamManager.GetActiveStreams()))
+
+	// A full node is never offered as a candidate
+	if sn.IsDraining() {
+		currentLoad = maxCapacity
+		load.ExitClients = load.ExitCapacity
+	}
+
+	return currentLoad, maxCapacity, load
+}
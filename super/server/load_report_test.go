@@ -0,0 +1,81 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+)
+
+func TestLoadReportDropsAfterClientDisconnects(t *testing.T) {
+	tests := []struct {
+		name       string
+		disconnect func(sn *SuperNode, streamSession string)
+	}{
+		{
+			name: "client disconnects from exit",
+			disconnect: func(sn *SuperNode, streamSession string) {
+				sn.handleExitConfirm("c1", &controlProto.ExitConfirm{SessionId: "s1", Message: "disconnected from exit"})
+			},
+		},
+		{
+			name: "client stream closes",
+			disconnect: func(sn *SuperNode, streamSession string) {
+				if !sn.streamManager.UnregisterStream("c1", streamSession) {
+					t.Fatal("client stream was not unregistered")
+				}
+				sn.releasePeerSessions("c1", "peer did not reconnect")
+			},
+		},
+		{
+			name: "client stream goes stale",
+			disconnect: func(sn *SuperNode, streamSession string) {
+				streamInfo, _ := sn.streamManager.GetStream("c1")
+				streamInfo.LastHeartbeat = time.Now().Add(-time.Hour)
+				for _, peerID := range sn.streamManager.CheckStaleStreams(time.Minute) {
+					sn.releasePeerSessions(peerID, "stream went stale")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sn := newTestSuperNode()
+			connectTestPeer(t, sn, "exit-1", RoleExit)
+			streamSession := connectTestPeer(t, sn, "c1", RoleClient)
+
+			sn.exitSessions.activate(&exitSession{SessionID: "s1", ClientID: "c1", ExitPeerID: "exit-1"})
+
+			_, _, load := sn.loadReport()
+			if load.ExitClients != 1 || load.ExitCapacity != defaultExitCapacity {
+				t.Fatalf("before disconnect: exit clients %d of %d, want 1 of %d", load.ExitClients, load.ExitCapacity, defaultExitCapacity)
+			}
+
+			tt.disconnect(sn, streamSession)
+
+			_, _, load = sn.loadReport()
+			if load.ExitClients != 0 {
+				t.Fatalf("after disconnect: exit clients %d, want 0", load.ExitClients)
+			}
+			if n := sn.exitSessions.countActive(); n != 0 {
+				t.Fatalf("after disconnect: %d active sessions, want 0", n)
+			}
+		})
+	}
+}
+
+func TestLoadReportKeepsSessionsOfConnectedClient(t *testing.T) {
+	sn := newTestSuperNode()
+	connectTestPeer(t, sn, "exit-1", RoleExit)
+	connectTestPeer(t, sn, "c1", RoleClient)
+
+	sn.exitSessions.activate(&exitSession{SessionID: "s1", ClientID: "c1", ExitPeerID: "exit-1"})
+
+	// A grace timer firing after the client reconnected leaves its session alone
+	sn.releasePeerSessions("c1", "peer did not reconnect")
+
+	if _, _, load := sn.loadReport(); load.ExitClients != 1 {
+		t.Fatalf("exit clients %d, want 1", load.ExitClients)
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"myDvpn/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// superNodeCollector reports SuperNode state to Prometheus. Gauges are computed
+// from the live stream table at scrape time so they can never drift.
+type superNodeCollector struct {
+	sn *SuperNode
+
+	streams          *prometheus.Desc
+	authFailures     *prometheus.Desc
+	commandsSent     *prometheus.Desc
+	commandsFailed   *prometheus.Desc
+	commandsInFlight *prometheus.Desc
+	relayRules       *prometheus.Desc
+	pendingAuth      *prometheus.Desc
+	exitSessions     *prometheus.Desc
+	activeSessions   *prometheus.Desc
+	exitTeardowns    *prometheus.Desc
+	exitCapacity     *prometheus.Desc
+	exitClients      *prometheus.Desc
+}
+
+// newSuperNodeCollector creates the collector for a SuperNode
+func newSuperNodeCollector(sn *SuperNode) *superNodeCollector {
+	constLabels := prometheus.Labels{"supernode_id": sn.id}
+
+	return &superNodeCollector{
+		sn: sn,
+		streams: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "active_streams"),
+			"Authenticated control streams by peer role and region",
+			[]string{"role", "region"}, constLabels,
+		),
+		authFailures: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "auth_failures_total"),
+			"Control streams rejected during authentication",
+			nil, constLabels,
+		),
+		commandsSent: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "commands_sent_total"),
+			"Commands delivered to peers",
+			nil, constLabels,
+		),
+		commandsFailed: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "commands_failed_total"),
+			"Commands that could not be sent, failed on the peer or were never answered",
+			nil, constLabels,
+		),
+		commandsInFlight: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "commands_in_flight"),
+			"Commands sent to peers and awaiting a response",
+			nil, constLabels,
+		),
+		relayRules: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "relay_rules"),
+			"Active relay forwarding rules",
+			nil, constLabels,
+		),
+		pendingAuth: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "auth_challenges_outstanding"),
+			"Auth challenges issued and not yet answered",
+			nil, constLabels,
+		),
+		exitSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "exit_sessions_unconfirmed"),
+			"Exit sessions set up and awaiting client confirmation",
+			nil, constLabels,
+		),
+		activeSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "exit_sessions_active"),
+			"Confirmed exit sessions tracked by this SuperNode",
+			nil, constLabels,
+		),
+		exitTeardowns: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "exit_teardowns_total"),
+			"Compensating TEARDOWN_EXIT commands sent for failed or unconfirmed exit sessions",
+			nil, constLabels,
+		),
+		exitCapacity: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "exit_capacity"),
+			"Clients the connected exit and hybrid peers accept in total",
+			nil, constLabels,
+		),
+		exitClients: prometheus.NewDesc(
+			prometheus.BuildFQName(utils.MetricsNamespace, "supernode", "exit_clients"),
+			"Clients set up on the connected exit and hybrid peers",
+			nil, constLabels,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *superNodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.streams
+	ch <- c.authFailures
+	ch <- c.commandsSent
+	ch <- c.commandsFailed
+	ch <- c.commandsInFlight
+	ch <- c.relayRules
+	ch <- c.pendingAuth
+	ch <- c.exitSessions
+	ch <- c.activeSessions
+	ch <- c.exitTeardowns
+	ch <- c.exitCapacity
+	ch <- c.exitClients
+}
+
+// Collect implements prometheus.Collector
+func (c *superNodeCollector) Collect(ch chan<- prometheus.Metric) {
+	sm := c.sn.streamManager
+
+	type streamKey struct {
+		role   PeerRole
+		region string
+	}
+	counts := make(map[streamKey]int)
+	for _, streamInfo := range sm.GetActiveStreams() {
+		counts[streamKey{role: streamInfo.Role, region: streamInfo.Region}]++
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.streams, prometheus.GaugeValue, float64(count), string(key.role), key.region)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.authFailures, prometheus.CounterValue, float64(sm.authFailures.Load()))
+	ch <- prometheus.MustNewConstMetric(c.commandsSent, prometheus.CounterValue, float64(sm.commandsProcessed.Load()))
+	ch <- prometheus.MustNewConstMetric(c.commandsFailed, prometheus.CounterValue, float64(sm.commandsFailed.Load()))
+	ch <- prometheus.MustNewConstMetric(c.commandsInFlight, prometheus.GaugeValue, float64(sm.pending.count()))
+	ch <- prometheus.MustNewConstMetric(c.pendingAuth, prometheus.GaugeValue, float64(c.sn.authNonces.Outstanding()))
+	ch <- prometheus.MustNewConstMetric(c.exitSessions, prometheus.GaugeValue, float64(c.sn.exitSessions.count()))
+	ch <- prometheus.MustNewConstMetric(c.activeSessions, prometheus.GaugeValue, float64(c.sn.exitSessions.countActive()))
+	ch <- prometheus.MustNewConstMetric(c.exitTeardowns, prometheus.CounterValue, float64(c.sn.exitTeardowns.Load()))
+
+	exitCapacity, exitClients := c.sn.exitCapacity()
+	ch <- prometheus.MustNewConstMetric(c.exitCapacity, prometheus.GaugeValue, float64(exitCapacity))
+	ch <- prometheus.MustNewConstMetric(c.exitClients, prometheus.GaugeValue, float64(exitClients))
+
+	if c.sn.relayManager != nil {
+		ch <- prometheus.MustNewConstMetric(c.relayRules, prometheus.GaugeValue, float64(len(c.sn.relayManager.GetActiveRules())))
+	}
+}
+
+// RegisterMetrics registers the SuperNode's metrics with a Prometheus registry
+func (sn *SuperNode) RegisterMetrics(registerer prometheus.Registerer) error {
+	if err := registerer.Register(newSuperNodeCollector(sn)); err != nil {
+		return err
+	}
+	return registerer.Register(sn.streamManager.commandDuration)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+
+	"myDvpn/utils"
+	"myDvpn/utils/testutil"
+)
+
+func TestSuperNodeRegisterMetrics(t *testing.T) {
+	sn := newTestSuperNode()
+	connectTestPeer(t, sn, "exit-1", RoleExit)
+	sn.exitSessions.activate(&exitSession{SessionID: "s1", ClientID: "c1", ExitPeerID: "exit-1"})
+
+	registry := utils.NewMetricsRegistry()
+	if err := sn.RegisterMetrics(registry); err != nil {
+		t.Fatalf("RegisterMetrics: %v", err)
+	}
+
+	testutil.ExpectMetrics(t, registry,
+		"mydvpn_supernode_active_streams",
+		"mydvpn_supernode_auth_failures_total",
+		"mydvpn_supernode_commands_in_flight",
+		"mydvpn_supernode_exit_sessions_active",
+		"mydvpn_supernode_exit_capacity",
+		"mydvpn_supernode_exit_clients",
+		"go_goroutines",
+	)
+
+	if err := sn.RegisterMetrics(registry); err == nil {
+		t.Fatal("registering the SuperNode metrics twice succeeded")
+	}
+}
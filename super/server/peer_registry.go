@@ -0,0 +1,312 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Registry modes
+const (
+	RegistryModeTOFU   = "tofu"   // Unknown peers are pinned to the key they first present
+	RegistryModeStrict = "strict" // Only pre-provisioned peers may authenticate
+)
+
+// registryCheckInterval is how often the SuperNode looks for peers revoked
+// in the registry file while they are connected
+const registryCheckInterval = 10 * time.Second
+
+// PeerRecord binds a peer ID to its Ed25519 public key
+type PeerRecord struct {
+	PeerID       string     `json:"peer_id"`
+	PublicKey    string     `json:"public_key"`              // Base64 Ed25519 public key
+	AllowedRoles []PeerRole `json:"allowed_roles,omitempty"` // Empty allows every peer role
+	Revoked      bool       `json:"revoked,omitempty"`
+	PinnedAt     time.Time  `json:"pinned_at,omitempty"` // Set for trust-on-first-use pins
+}
+
+// peerRegistryFile is the on-disk registry format
+type peerRegistryFile struct {
+	Peers []*PeerRecord `json:"peers"`
+}
+
+// PeerRegistry decides which peer IDs may authenticate with which keys and roles.
+// With a file configured, pre-provisioned records are read from it, pins learned
+// on first use are written back, and edits made to it are picked up automatically.
+type PeerRegistry struct {
+	mode    string
+	path    string
+	records map[string]*PeerRecord
+	stamp   string
+	logger  *logrus.Logger
+	mutex   sync.Mutex
+}
+
+// NewPeerRegistry creates a registry in the given mode, loading path if it is set
+func NewPeerRegistry(mode, path string, logger *logrus.Logger) (*PeerRegistry, error) {
+	switch mode {
+	case RegistryModeTOFU, RegistryModeStrict:
+	default:
+		return nil, fmt.Errorf("unknown peer registry mode %q (want tofu or strict)", mode)
+	}
+
+	if mode == RegistryModeStrict && path == "" {
+		return nil, fmt.Errorf("strict peer registry requires a registry file")
+	}
+
+	pr := &PeerRegistry{
+		mode:    mode,
+		path:    path,
+		records: make(map[string]*PeerRecord),
+		logger:  logger,
+	}
+
+	if path != "" {
+		if err := pr.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	return pr, nil
+}
+
+// Authorize checks that a peer may authenticate with the given key and role,
+// pinning the key if the peer is unknown and the registry is in TOFU mode
+func (pr *PeerRegistry) Authorize(peerID, publicKey string, role PeerRole) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.maybeReload()
+
+	record, exists := pr.records[peerID]
+	if !exists {
+		if pr.mode != RegistryModeTOFU {
+			return fmt.Errorf("peer %s is not provisioned", peerID)
+		}
+
+		record = &PeerRecord{
+			PeerID:    peerID,
+			PublicKey: publicKey,
+			PinnedAt:  time.Now(),
+		}
+		pr.records[peerID] = record
+
+		if err := pr.save(); err != nil {
+			delete(pr.records, peerID)
+			return fmt.Errorf("failed to persist key pin: %w", err)
+		}
+
+		pr.logger.WithFields(logrus.Fields{
+			"peer_id":    peerID,
+			"public_key": publicKey,
+		}).Info("Pinned peer key on first use")
+		return nil
+	}
+
+	if record.Revoked {
+		return fmt.Errorf("peer %s is revoked", peerID)
+	}
+
+	if record.PublicKey != publicKey {
+		return fmt.Errorf("peer %s presented a key that does not match its pinned key", peerID)
+	}
+
+	if len(record.AllowedRoles) > 0 {
+		allowed := false
+		for _, r := range record.AllowedRoles {
+			if r == role {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("peer %s is not allowed the %s role", peerID, role)
+		}
+	}
+
+	return nil
+}
+
+// RevokedPeers picks up edits to the registry file and returns the IDs of
+// the revoked peers
+func (pr *PeerRegistry) RevokedPeers() []string {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.maybeReload()
+
+	var revoked []string
+	for peerID, record := range pr.records {
+		if record.Revoked {
+			revoked = append(revoked, peerID)
+		}
+	}
+	sort.Strings(revoked)
+	return revoked
+}
+
+// Provision adds or replaces a peer record
+func (pr *PeerRegistry) Provision(record *PeerRecord) error {
+	if record.PeerID == "" || record.PublicKey == "" {
+		return fmt.Errorf("peer_id and public_key are required")
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	// Keep edits made to the file since we last read it
+	pr.maybeReload()
+
+	previous := pr.records[record.PeerID]
+	pr.records[record.PeerID] = record
+
+	if err := pr.save(); err != nil {
+		if previous != nil {
+			pr.records[record.PeerID] = previous
+		} else {
+			delete(pr.records, record.PeerID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Revoke marks a peer as revoked; it can no longer authenticate
+func (pr *PeerRegistry) Revoke(peerID string) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.maybeReload()
+
+	record, exists := pr.records[peerID]
+	if !exists {
+		// Revoking an unknown ID blocks it from being pinned later
+		record = &PeerRecord{PeerID: peerID}
+		pr.records[peerID] = record
+	}
+
+	wasRevoked := record.Revoked
+	record.Revoked = true
+
+	if err := pr.save(); err != nil {
+		record.Revoked = wasRevoked
+		if !exists {
+			delete(pr.records, peerID)
+		}
+		return err
+	}
+
+	pr.logger.WithField("peer_id", peerID).Warn("Revoked peer")
+	return nil
+}
+
+// GetRecord returns a copy of a peer's record
+func (pr *PeerRegistry) GetRecord(peerID string) (*PeerRecord, bool) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	record, exists := pr.records[peerID]
+	if !exists {
+		return nil, false
+	}
+	copied := *record
+	return &copied, true
+}
+
+// maybeReload reloads the registry file if it changed on disk; the caller must hold mutex
+func (pr *PeerRegistry) maybeReload() {
+	if pr.path == "" {
+		return
+	}
+	if err := pr.reload(); err != nil {
+		pr.logger.WithError(err).Warn("Failed to reload peer registry, keeping previous records")
+	}
+}
+
+// reload reads the registry file if its modification stamp changed
+func (pr *PeerRegistry) reload() error {
+	info, err := os.Stat(pr.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing provisioned yet; the file is created on the first pin
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat peer registry: %w", err)
+	}
+
+	stamp := fmt.Sprintf("%d:%s", info.Size(), info.ModTime().Format(time.RFC3339Nano))
+	if stamp == pr.stamp {
+		return nil
+	}
+
+	data, err := os.ReadFile(pr.path)
+	if err != nil {
+		return fmt.Errorf("failed to read peer registry: %w", err)
+	}
+
+	var file peerRegistryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse peer registry %s: %w", pr.path, err)
+	}
+
+	records := make(map[string]*PeerRecord)
+	for _, record := range file.Peers {
+		if record.PeerID == "" {
+			return fmt.Errorf("peer registry %s has a record without peer_id", pr.path)
+		}
+		records[record.PeerID] = record
+	}
+
+	if pr.stamp != "" {
+		pr.logger.WithField("peers", len(records)).Info("Reloaded peer registry")
+	}
+
+	pr.records = records
+	pr.stamp = stamp
+	return nil
+}
+
+// save writes the registry file; the caller must hold mutex
+func (pr *PeerRegistry) save() error {
+	if pr.path == "" {
+		return nil
+	}
+
+	file := peerRegistryFile{}
+	for _, record := range pr.records {
+		file.Peers = append(file.Peers, record)
+	}
+	sort.Slice(file.Peers, func(i, j int) bool {
+		return file.Peers[i].PeerID < file.Peers[j].PeerID
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode peer registry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(pr.path), 0700); err != nil {
+		return fmt.Errorf("failed to create peer registry directory: %w", err)
+	}
+
+	tmp := pr.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write peer registry: %w", err)
+	}
+	if err := os.Rename(tmp, pr.path); err != nil {
+		return fmt.Errorf("failed to install peer registry: %w", err)
+	}
+
+	// Don't treat our own write as an external edit
+	if info, err := os.Stat(pr.path); err == nil {
+		pr.stamp = fmt.Sprintf("%d:%s", info.Size(), info.ModTime().Format(time.RFC3339Nano))
+	}
+	return nil
+}
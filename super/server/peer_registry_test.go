@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRegistry creates a registry backed by a file in a temporary directory
+func newTestRegistry(t *testing.T, mode string, records ...*PeerRecord) (*PeerRegistry, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "peers.json")
+	if len(records) > 0 {
+		writeRegistryFile(t, path, records...)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	registry, err := NewPeerRegistry(mode, path, logger)
+	if err != nil {
+		t.Fatalf("NewPeerRegistry: %v", err)
+	}
+	return registry, path
+}
+
+// writeRegistryFile replaces the registry file as an operator would
+func writeRegistryFile(t *testing.T, path string, records ...*PeerRecord) {
+	t.Helper()
+
+	data, err := json.Marshal(peerRegistryFile{Peers: records})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// Make sure the edit is noticed even within the file system's timestamp granularity
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+func TestPeerRegistryPinsOnFirstUse(t *testing.T) {
+	registry, path := newTestRegistry(t, RegistryModeTOFU)
+
+	if err := registry.Authorize("c1", "key-1", RoleClient); err != nil {
+		t.Fatalf("first Authorize: %v", err)
+	}
+	if err := registry.Authorize("c1", "key-1", RoleExit); err != nil {
+		t.Fatalf("Authorize with the pinned key: %v", err)
+	}
+	if err := registry.Authorize("c1", "key-2", RoleClient); err == nil {
+		t.Fatal("peer authenticated with a key other than its pin")
+	}
+
+	// The pin survives a restart
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	restarted, err := NewPeerRegistry(RegistryModeTOFU, path, logger)
+	if err != nil {
+		t.Fatalf("NewPeerRegistry: %v", err)
+	}
+	if err := restarted.Authorize("c1", "key-2", RoleClient); err == nil {
+		t.Fatal("pin was lost on restart")
+	}
+	if record, exists := restarted.GetRecord("c1"); !exists || record.PublicKey != "key-1" || record.PinnedAt.IsZero() {
+		t.Fatalf("restored record %+v, want a pin of key-1", record)
+	}
+}
+
+func TestPeerRegistryStrictMode(t *testing.T) {
+	registry, _ := newTestRegistry(t, RegistryModeStrict,
+		&PeerRecord{PeerID: "exit-1", PublicKey: "key-exit", AllowedRoles: []PeerRole{RoleExit, RoleHybrid}},
+		&PeerRecord{PeerID: "c1", PublicKey: "key-c1"},
+	)
+
+	tests := []struct {
+		name   string
+		peerID string
+		key    string
+		role   PeerRole
+		ok     bool
+	}{
+		{name: "provisioned peer", peerID: "c1", key: "key-c1", role: RoleClient, ok: true},
+		{name: "provisioned peer in an allowed role", peerID: "exit-1", key: "key-exit", role: RoleHybrid, ok: true},
+		{name: "provisioned peer in another role", peerID: "exit-1", key: "key-exit", role: RoleClient},
+		{name: "provisioned peer with another key", peerID: "c1", key: "key-other", role: RoleClient},
+		{name: "unknown peer", peerID: "c2", key: "key-c2", role: RoleClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.Authorize(tt.peerID, tt.key, tt.role)
+			if tt.ok && err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("Authorize accepted the peer")
+			}
+		})
+	}
+
+	if _, exists := registry.GetRecord("c2"); exists {
+		t.Fatal("strict registry pinned an unknown peer")
+	}
+}
+
+func TestPeerRegistryRequiresFileInStrictMode(t *testing.T) {
+	if _, err := NewPeerRegistry(RegistryModeStrict, "", logrus.New()); err == nil {
+		t.Fatal("strict registry without a file was created")
+	}
+}
+
+func TestPeerRegistryRevocation(t *testing.T) {
+	registry, _ := newTestRegistry(t, RegistryModeTOFU)
+
+	if err := registry.Authorize("c1", "key-1", RoleClient); err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if err := registry.Revoke("c1"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := registry.Authorize("c1", "key-1", RoleClient); err == nil {
+		t.Fatal("revoked peer authenticated")
+	}
+
+	// Revoking an unknown ID keeps it from being pinned later
+	if err := registry.Revoke("c2"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := registry.Authorize("c2", "key-2", RoleClient); err == nil {
+		t.Fatal("revoked unknown peer was pinned")
+	}
+
+	if revoked := registry.RevokedPeers(); len(revoked) != 2 || revoked[0] != "c1" || revoked[1] != "c2" {
+		t.Fatalf("revoked peers %v, want [c1 c2]", revoked)
+	}
+}
+
+func TestPeerRegistryPicksUpFileEdits(t *testing.T) {
+	registry, path := newTestRegistry(t, RegistryModeTOFU, &PeerRecord{PeerID: "c1", PublicKey: "key-1"})
+
+	writeRegistryFile(t, path, &PeerRecord{PeerID: "c1", PublicKey: "key-1", Revoked: true})
+	if revoked := registry.RevokedPeers(); len(revoked) != 1 || revoked[0] != "c1" {
+		t.Fatalf("revoked peers %v after editing the file, want [c1]", revoked)
+	}
+}
+
+func TestPeerRegistryKeepsOperatorEdits(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(registry *PeerRegistry) error
+	}{
+		{
+			name:   "revoke",
+			change: func(registry *PeerRegistry) error { return registry.Revoke("c2") },
+		},
+		{
+			name: "provision",
+			change: func(registry *PeerRegistry) error {
+				return registry.Provision(&PeerRecord{PeerID: "c2", PublicKey: "key-2"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, path := newTestRegistry(t, RegistryModeTOFU, &PeerRecord{PeerID: "c1", PublicKey: "key-1"})
+
+			// The operator provisions exit-1 while the SuperNode runs
+			writeRegistryFile(t, path,
+				&PeerRecord{PeerID: "c1", PublicKey: "key-1"},
+				&PeerRecord{PeerID: "exit-1", PublicKey: "key-exit"},
+			)
+			if err := tt.change(registry); err != nil {
+				t.Fatalf("change: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			var file peerRegistryFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			ids := map[string]bool{}
+			for _, record := range file.Peers {
+				ids[record.PeerID] = true
+			}
+			if len(ids) != 3 || !ids["c1"] || !ids["c2"] || !ids["exit-1"] {
+				t.Fatalf("registry file holds %v, want c1, c2 and exit-1", ids)
+			}
+		})
+	}
+}
+
+func TestRevokedPeerStreamIsClosed(t *testing.T) {
+	sn := newTestSuperNode()
+	registry, path := newTestRegistry(t, RegistryModeTOFU, &PeerRecord{PeerID: "c1", PublicKey: "key-1"})
+	sn.SetPeerRegistry(registry)
+
+	connectTestPeer(t, sn, "c1", RoleClient)
+	connectTestPeer(t, sn, "c2", RoleClient)
+	c1, _ := sn.streamManager.GetStream("c1")
+	c2, _ := sn.streamManager.GetStream("c2")
+
+	writeRegistryFile(t, path, &PeerRecord{PeerID: "c1", PublicKey: "key-1", Revoked: true})
+	sn.closeRevokedStreams()
+
+	select {
+	case <-c1.Closed():
+	default:
+		t.Fatal("stream of the revoked peer is still open")
+	}
+	select {
+	case <-c2.Closed():
+		t.Fatal("stream of another peer was closed")
+	default:
+	}
+
+	// Revoking through the SuperNode closes the stream right away
+	if err := sn.RevokePeer("c2"); err != nil {
+		t.Fatalf("RevokePeer: %v", err)
+	}
+	select {
+	case <-c2.Closed():
+	default:
+		t.Fatal("stream of the peer revoked through the SuperNode is still open")
+	}
+}
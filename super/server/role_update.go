@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+
+	"github.com/sirupsen/logrus"
+)
+
+// UpdateRole changes the role of a connected peer and returns its previous
+// role. Exit selection sees either the old or the new role, never a mix.
+func (sm *StreamManager) UpdateRole(peerID string, role PeerRole, maxClients int) (PeerRole, error) {
+	sm.streamsMux.Lock()
+	defer sm.streamsMux.Unlock()
+
+	streamInfo, exists := sm.streams[peerID]
+	if !exists || !streamInfo.IsActive {
+		return "", fmt.Errorf("no active stream for peer %s", peerID)
+	}
+
+	streamInfo.mutex.Lock()
+	defer streamInfo.mutex.Unlock()
+
+	previous := streamInfo.Role
+	streamInfo.Role = role
+	streamInfo.MaxClients = maxClients
+
+	sm.logger.WithFields(logrus.Fields{
+		"peer_id":  peerID,
+		"old_role": previous,
+		"new_role": role,
+	}).Info("Peer role updated")
+
+	return previous, nil
+}
+
+// servesExits reports whether peers in a role are offered as exits
+func servesExits(role PeerRole) bool {
+	return role == RoleExit || role == RoleHybrid
+}
+
+// usesExits reports whether peers in a role tunnel their own traffic through an exit
+func usesExits(role PeerRole) bool {
+	return role == RoleClient || role == RoleHybrid
+}
+
+// handleRoleUpdate changes a peer's role on its open stream and acknowledges
+// it. A peer that stops serving as an exit is taken out of exit selection
+// first, then its exit clients are rotated to other exits before the ack.
+func (sn *SuperNode) handleRoleUpdate(peerID string, update *controlProto.RoleUpdate) {
+	ack := &controlProto.RoleUpdateAck{
+		RequestId: update.RequestId,
+	}
+
+	migrated, released, err := sn.updatePeerRole(peerID, PeerRole(update.Role), int(update.MaxClients))
+	if err != nil {
+		sn.logger.WithError(err).WithField("peer_id", peerID).Warn("Role update rejected")
+		ack.Message = err.Error()
+	} else {
+		ack.Success = true
+		ack.Message = fmt.Sprintf("Role changed to %s", update.Role)
+		ack.MigratedClients = int32(migrated)
+		ack.ReleasedClients = int32(released)
+	}
+
+	if streamInfo, exists := sn.streamManager.GetStream(peerID); exists {
+		streamInfo.mutex.RLock()
+		ack.Role = string(streamInfo.Role)
+		streamInfo.mutex.RUnlock()
+	}
+
+	response := &controlProto.ControlMessage{
+		MessageId: fmt.Sprintf("role-update-ack-%d", time.Now().UnixNano()),
+		Timestamp: time.Now().Unix(),
+		Payload: &controlProto.ControlMessage_RoleUpdateAck{
+			RoleUpdateAck: ack,
+		},
+	}
+
+	if err := sn.streamManager.SendMessageToPeer(peerID, response); err != nil {
+		sn.logger.WithError(err).WithField("peer_id", peerID).Error("Failed to acknowledge role update")
+	}
+}
+
+// updatePeerRole applies a role change and migrates exit clients when the
+// peer stops serving as an exit, returning how many were moved and released.
+// A peer that stops using an exit has its own exit session released.
+func (sn *SuperNode) updatePeerRole(peerID string, role PeerRole, maxClients int) (int, int, error) {
+	if role != RoleClient && role != RoleExit && role != RoleHybrid {
+		return 0, 0, fmt.Errorf("invalid role: %s", role)
+	}
+
+	streamInfo, exists := sn.streamManager.GetStream(peerID)
+	if !exists {
+		return 0, 0, fmt.Errorf("no active stream for peer %s", peerID)
+	}
+
+	if err := sn.peerRegistry.Authorize(peerID, streamInfo.PublicKey, role); err != nil {
+		return 0, 0, fmt.Errorf("role %s not allowed: %w", role, err)
+	}
+
+	previous, err := sn.streamManager.UpdateRole(peerID, role, maxClients)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if usesExits(previous) && !usesExits(role) {
+		sn.releaseOwnExitSessions(peerID, "client left the client role")
+	}
+
+	if !servesExits(previous) || servesExits(role) {
+		return 0, 0, nil
+	}
+
+	migrated, released := sn.migrateExitClients(peerID, "exit peer left the exit role")
+	return migrated, released, nil
+}
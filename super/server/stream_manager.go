@@ -3,9 +3,12 @@ package server
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -28,9 +31,38 @@ type StreamInfo struct {
 	Stream        proto.ControlStream_PersistentControlStreamServer
 	LastHeartbeat time.Time
 	PublicKey     string
+	RemoteAddr    string
 	IsActive      bool
+	MaxClients    int // Clients an exit or hybrid peer accepts, 0 if it did not say
 	Stats         *PeerStats
 	mutex         sync.RWMutex
+
+	// Closed when the SuperNode ends the stream, e.g. for a revoked peer
+	closed      chan struct{}
+	closeReason string
+	closeOnce   sync.Once
+}
+
+// Closed returns a channel that is closed once the stream has been told to end
+func (si *StreamInfo) Closed() <-chan struct{} {
+	return si.closed
+}
+
+// CloseReason returns why the stream was told to end
+func (si *StreamInfo) CloseReason() string {
+	si.mutex.RLock()
+	defer si.mutex.RUnlock()
+	return si.closeReason
+}
+
+// close tells the stream's handler to end the stream
+func (si *StreamInfo) close(reason string) {
+	si.closeOnce.Do(func() {
+		si.mutex.Lock()
+		si.closeReason = reason
+		si.mutex.Unlock()
+		close(si.closed)
+	})
 }
 
 // PeerStats holds statistics for a peer
@@ -41,8 +73,22 @@ type PeerStats struct {
 	CommandsFailed     int64
 	LatencyMs         float64
 	ConnectedSince    time.Time
+	LastCommandFailure time.Time
 }
 
+// Command outcomes recorded in the command duration histogram
+const (
+	CommandOutcomeSuccess    = "success"
+	CommandOutcomeFailure    = "failure"
+	CommandOutcomeSendError  = "send_error"
+	CommandOutcomeTimeout    = "timeout"
+	CommandOutcomeStreamLost = "stream_lost"
+)
+
+// commandTrackingTimeout is how long a command sent without a caller waiting
+// on it may go unanswered before it counts as timed out
+const commandTrackingTimeout = 5 * time.Minute
+
 // StreamManager manages all active control streams
 type StreamManager struct {
 	streams    map[string]*StreamInfo // peer_id -> StreamInfo
@@ -50,32 +96,45 @@ type StreamManager struct {
 	logger     *logrus.Logger
 
 	// Metrics
-	activeStreams      int64
-	authFailures       int64
-	commandsProcessed  int64
-	commandsSucceeded  int64
-	commandsFailed     int64
+	activeStreams      int64 // Guarded by streamsMux
+	authFailures       atomic.Int64
+	commandsProcessed  atomic.Int64
+	commandsSucceeded  atomic.Int64
+	commandsFailed     atomic.Int64
+
+	// Commands sent but not yet answered, keyed by command_id
+	pending         *pendingCommands
+	commandDuration *prometheus.HistogramVec
 }
 
 // NewStreamManager creates a new stream manager
 func NewStreamManager(logger *logrus.Logger) *StreamManager {
 	return &StreamManager{
-		streams: make(map[string]*StreamInfo),
-		logger:  logger,
+		streams:      make(map[string]*StreamInfo),
+		logger:       logger,
+		pending:      &pendingCommands{futures: make(map[string]*CommandFuture)},
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: utils.MetricsNamespace,
+			Subsystem: "supernode",
+			Name:      "command_duration_seconds",
+			Help:      "Time from sending a command to a peer until its response, by command type and outcome",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		}, []string{"type", "outcome"}),
 	}
 }
 
 // RegisterStream registers a new peer stream
 func (sm *StreamManager) RegisterStream(peerID string, role PeerRole, region string, 
-	publicKey string, stream proto.ControlStream_PersistentControlStreamServer) (string, error) {
+	publicKey string, remoteAddr string, stream proto.ControlStream_PersistentControlStreamServer) (string, error) {
 	
 	sm.streamsMux.Lock()
 	defer sm.streamsMux.Unlock()
 
 	// Generate session ID
-	sessionID := fmt.Sprintf("%s-%d", peerID, time.Now().Unix())
+	sessionID := fmt.Sprintf("%s-%d", peerID, time.Now().UnixNano())
 
 	// Check if peer already has an active stream
+	replacing := false
 	if existing, exists := sm.streams[peerID]; exists && existing.IsActive {
 		sm.logger.WithFields(logrus.Fields{
 			"peer_id": peerID,
@@ -83,6 +142,10 @@ func (sm *StreamManager) RegisterStream(peerID string, role PeerRole, region str
 		}).Warn("Peer already has active stream, replacing")
 		
 		existing.IsActive = false
+		replacing = true
+
+		// Responses to commands sent on the old stream can no longer arrive
+		sm.abandonCommands(peerID, existing.SessionID)
 	}
 
 	// Create new stream info
@@ -94,14 +157,18 @@ func (sm *StreamManager) RegisterStream(peerID string, role PeerRole, region str
 		Stream:        stream,
 		LastHeartbeat: time.Now(),
 		PublicKey:     publicKey,
+		RemoteAddr:    remoteAddr,
 		IsActive:      true,
 		Stats: &PeerStats{
 			ConnectedSince: time.Now(),
 		},
+		closed: make(chan struct{}),
 	}
 
 	sm.streams[peerID] = streamInfo
-	sm.activeStreams++
+	if !replacing {
+		sm.activeStreams++
+	}
 
 	sm.logger.WithFields(logrus.Fields{
 		"peer_id":    peerID,
@@ -113,21 +180,44 @@ func (sm *StreamManager) RegisterStream(peerID string, role PeerRole, region str
 	return sessionID, nil
 }
 
-// UnregisterStream removes a peer stream
-func (sm *StreamManager) UnregisterStream(peerID string) {
+// UnregisterStream removes a peer stream and reports whether it was removed.
+// The session ID guards against a replaced stream removing the stream that
+// superseded it.
+func (sm *StreamManager) UnregisterStream(peerID, sessionID string) bool {
 	sm.streamsMux.Lock()
 	defer sm.streamsMux.Unlock()
 
-	if streamInfo, exists := sm.streams[peerID]; exists {
+	streamInfo, exists := sm.streams[peerID]
+	if exists && streamInfo.SessionID == sessionID {
 		streamInfo.IsActive = false
 		delete(sm.streams, peerID)
 		sm.activeStreams--
+		sm.abandonCommands(peerID, sessionID)
 
 		sm.logger.WithFields(logrus.Fields{
 			"peer_id": peerID,
 			"role":    streamInfo.Role,
 		}).Info("Unregistered peer stream")
+		return true
+	}
+	return false
+}
+
+// CloseStream ends a peer's stream from our side and reports whether the
+// peer had one. The stream's handler returns and the peer sees it close.
+func (sm *StreamManager) CloseStream(peerID, reason string) bool {
+	streamInfo, exists := sm.GetStream(peerID)
+	if !exists {
+		return false
 	}
+
+	sm.logger.WithFields(logrus.Fields{
+		"peer_id": peerID,
+		"reason":  reason,
+	}).Warn("Closing peer stream")
+
+	streamInfo.close(reason)
+	return true
 }
 
 // GetStream gets stream info for a peer
@@ -170,8 +260,23 @@ func (sm *StreamManager) GetStreamsByRole(role PeerRole) []*StreamInfo {
 	return filtered
 }
 
-// SendCommandToPeer sends a command to a specific peer
+// SendCommandToPeer sends a command to a specific peer without waiting for its response
 func (sm *StreamManager) SendCommandToPeer(peerID string, command *proto.Command) error {
+	if _, err := sm.SendCommand(peerID, command, commandTrackingTimeout); err != nil {
+		return err
+	}
+
+	sm.logger.WithFields(logrus.Fields{
+		"peer_id":    peerID,
+		"command_id": command.CommandId,
+		"command_type": command.Type,
+	}).Info("Sent command to peer")
+
+	return nil
+}
+
+// SendMessageToPeer sends an arbitrary control message to a specific peer
+func (sm *StreamManager) SendMessageToPeer(peerID string, message *proto.ControlMessage) error {
 	streamInfo, exists := sm.GetStream(peerID)
 	if !exists {
 		return fmt.Errorf("no active stream for peer %s", peerID)
@@ -180,28 +285,11 @@ func (sm *StreamManager) SendCommandToPeer(peerID string, command *proto.Command
 	streamInfo.mutex.Lock()
 	defer streamInfo.mutex.Unlock()
 
-	message := &proto.ControlMessage{
-		MessageId: fmt.Sprintf("cmd-%d", time.Now().UnixNano()),
-		Timestamp: time.Now().Unix(),
-		Payload: &proto.ControlMessage_Command{
-			Command: command,
-		},
-	}
-
 	if err := streamInfo.Stream.Send(message); err != nil {
-		sm.commandsFailed++
-		return fmt.Errorf("failed to send command to peer %s: %w", peerID, err)
+		return fmt.Errorf("failed to send message to peer %s: %w", peerID, err)
 	}
 
 	streamInfo.Stats.MessagesSent++
-	sm.commandsProcessed++
-
-	sm.logger.WithFields(logrus.Fields{
-		"peer_id":    peerID,
-		"command_id": command.CommandId,
-		"command_type": command.Type,
-	}).Info("Sent command to peer")
-
 	return nil
 }
 
@@ -217,24 +305,54 @@ func (sm *StreamManager) UpdateHeartbeat(peerID string, latencyMs float64) {
 	}
 }
 
-// UpdateCommandResult updates command execution statistics
-func (sm *StreamManager) UpdateCommandResult(peerID string, success bool) {
+// UpdateCommandResult resolves the command's future and updates execution statistics
+func (sm *StreamManager) UpdateCommandResult(peerID string, resp *proto.CommandResponse) {
+	if !sm.resolveCommand(peerID, resp) {
+		sm.logger.WithFields(logrus.Fields{
+			"peer_id":    peerID,
+			"command_id": resp.CommandId,
+		}).Debug("Response for a command that is not in flight")
+	}
+
 	if streamInfo, exists := sm.GetStream(peerID); exists {
 		streamInfo.mutex.Lock()
 		defer streamInfo.mutex.Unlock()
 		
 		streamInfo.Stats.CommandsExecuted++
-		if success {
-			sm.commandsSucceeded++
+		if resp.Success {
+			sm.commandsSucceeded.Add(1)
 		} else {
 			streamInfo.Stats.CommandsFailed++
-			sm.commandsFailed++
+			streamInfo.Stats.LastCommandFailure = time.Now()
+			sm.commandsFailed.Add(1)
 		}
 	}
 }
 
-// CheckStaleStreams removes streams that haven't sent heartbeat recently
-func (sm *StreamManager) CheckStaleStreams(timeout time.Duration) {
+// recordCommandFailure notes a command to a peer that was never answered
+func (sm *StreamManager) recordCommandFailure(peerID string) {
+	if streamInfo, exists := sm.GetStream(peerID); exists {
+		streamInfo.mutex.Lock()
+		defer streamInfo.mutex.Unlock()
+
+		streamInfo.Stats.CommandsFailed++
+		streamInfo.Stats.LastCommandFailure = time.Now()
+	}
+}
+
+// SetMaxClients records the client capacity a peer advertised
+func (sm *StreamManager) SetMaxClients(peerID string, maxClients int) {
+	if streamInfo, exists := sm.GetStream(peerID); exists {
+		streamInfo.mutex.Lock()
+		defer streamInfo.mutex.Unlock()
+
+		streamInfo.MaxClients = maxClients
+	}
+}
+
+// CheckStaleStreams removes streams that haven't sent heartbeat recently and
+// returns the IDs of their peers
+func (sm *StreamManager) CheckStaleStreams(timeout time.Duration) []string {
 	sm.streamsMux.Lock()
 	defer sm.streamsMux.Unlock()
 
@@ -253,7 +371,9 @@ func (sm *StreamManager) CheckStaleStreams(timeout time.Duration) {
 		streamInfo.IsActive = false
 		delete(sm.streams, peerID)
 		sm.activeStreams--
+		sm.abandonCommands(peerID, streamInfo.SessionID)
 	}
+	return staleStreams
 }
 
 // GetMetrics returns current metrics
@@ -263,14 +383,14 @@ func (sm *StreamManager) GetMetrics() map[string]interface{} {
 
 	return map[string]interface{}{
 		"active_streams_total":      sm.activeStreams,
-		"stream_auth_failures_total": sm.authFailures,
-		"commands_processed_total":  sm.commandsProcessed,
-		"commands_succeeded_total":  sm.commandsSucceeded,
-		"commands_failed_total":     sm.commandsFailed,
+		"stream_auth_failures_total": sm.authFailures.Load(),
+		"commands_processed_total":  sm.commandsProcessed.Load(),
+		"commands_succeeded_total":  sm.commandsSucceeded.Load(),
+		"commands_failed_total":     sm.commandsFailed.Load(),
 	}
 }
 
 // IncrementAuthFailures increments auth failure counter
 func (sm *StreamManager) IncrementAuthFailures() {
-	sm.authFailures++
+	sm.authFailures.Add(1)
 }
\ No newline at end of file
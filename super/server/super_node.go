@@ -8,15 +8,20 @@ import (
 	"io"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	baseclient "myDvpn/base/client"
 	"myDvpn/base/proto"
 	controlProto "myDvpn/clientPeer/proto"
+	"myDvpn/super/dataplane"
 	"myDvpn/utils"
 
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -29,54 +34,121 @@ type SuperNode struct {
 	region        string
 	listenAddr    string
 	streamManager *StreamManager
-	baseNodeAddr  string
-	baseClient    proto.BaseNodeClient
+	baseNodeAddrs []string // BaseNode cluster members, tried in order
+	baseClient    *baseclient.FailoverClient
 	logger        *logrus.Logger
 	server        *grpc.Server
+	creds         *utils.TLSCredentials
+
+	// Set over TLS: calls from other SuperNodes must present a client certificate naming them
+	requireSNCert bool
+
+	// Connections to remote SuperNodes, keyed by address
+	remoteConns    map[string]*grpc.ClientConn
+	remoteConnsMux sync.Mutex
 
 	// WireGuard interface for relay
 	relayInterface string
-	relayPort     int
+	relayPort      int
+	relayManager   *dataplane.RelayManager
+	relayDataplane *dataplane.WireGuardDataplane
+
+	// Outstanding auth challenges
+	authNonces *NonceStore
+
+	// Peer ID to key bindings
+	peerRegistry *PeerRegistry
+
+	// Operator API, served on its own listener when adminAddr is set
+	adminAddr   string
+	adminToken  string
+	adminServer *grpc.Server
+
+	// Set while an operator drains the node
+	draining atomic.Bool
+
+	// Exit sessions awaiting client confirmation, and rollbacks sent to exits
+	exitSessions  *exitSessions
+	exitTeardowns atomic.Uint64
+
+	// Strategy choosing among our exit peers
+	exitSelector ExitSelector
+
+	// Capacity reported to the BaseNode, and the last relay traffic reading
+	maxPeers               int
+	relayBandwidthCapacity int64
+	relaySample            relayTrafficSample
+	relaySampleMux         sync.Mutex
 }
 
 // NewSuperNode creates a new SuperNode
-func NewSuperNode(id, region, listenAddr, baseNodeAddr string, logger *logrus.Logger) *SuperNode {
+func NewSuperNode(id, region, listenAddr string, baseNodeAddrs []string, creds *utils.TLSCredentials, logger *logrus.Logger) *SuperNode {
+	// In-memory trust on first use until a registry is configured
+	defaultRegistry, _ := NewPeerRegistry(RegistryModeTOFU, "", logger)
+
 	return &SuperNode{
 		id:             id,
 		region:         region,
 		listenAddr:     listenAddr,
 		streamManager:  NewStreamManager(logger),
-		baseNodeAddr:   baseNodeAddr,
+		baseNodeAddrs:  baseNodeAddrs,
 		logger:         logger,
+		creds:          creds,
+		requireSNCert:  !creds.IsInsecure(),
 		relayInterface: fmt.Sprintf("wg-relay-%s", id),
-		relayPort:     51820 + len(id)%1000, // Simple port allocation
+		relayPort:      51820 + len(id)%1000, // Simple port allocation
+		authNonces:     NewNonceStore(authChallengeTTL),
+		peerRegistry:   defaultRegistry,
+		remoteConns:    make(map[string]*grpc.ClientConn),
+		exitSessions:   newExitSessions(),
+		exitSelector:   &leastClientsSelector{},
+		maxPeers:       defaultMaxPeers,
 	}
 }
 
 // Start starts the SuperNode server
 func (sn *SuperNode) Start() error {
+	serverCreds, err := sn.creds.ServerOption()
+	if err != nil {
+		return fmt.Errorf("failed to configure server credentials: %w", err)
+	}
+
 	// Connect to BaseNode
-	conn, err := grpc.Dial(sn.baseNodeAddr, grpc.WithInsecure())
+	client, err := baseclient.NewFailoverClient(sn.baseNodeAddrs, sn.creds, sn.logger)
 	if err != nil {
 		return fmt.Errorf("failed to connect to BaseNode: %w", err)
 	}
-	sn.baseClient = proto.NewBaseNodeClient(conn)
+	sn.baseClient = client
 
 	// Register with BaseNode
 	if err := sn.registerWithBaseNode(); err != nil {
 		return fmt.Errorf("failed to register with BaseNode: %w", err)
 	}
 
+	// Bring up the relay interface
+	if sn.relayDataplane != nil {
+		if err := sn.relayDataplane.Initialize(); err != nil {
+			return fmt.Errorf("failed to initialize relay interface: %w", err)
+		}
+	}
+
 	// Start gRPC server
 	listener, err := net.Listen("tcp", sn.listenAddr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", sn.listenAddr, err)
 	}
 
-	sn.server = grpc.NewServer()
+	sn.server = grpc.NewServer(serverCreds)
 	controlProto.RegisterControlStreamServer(sn.server, sn)
 	controlProto.RegisterSuperNodeServer(sn.server, sn)
 
+	if sn.adminAddr != "" {
+		if err := sn.startAdmin(); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
 	sn.logger.WithFields(logrus.Fields{
 		"id":     sn.id,
 		"region": sn.region,
@@ -86,60 +158,170 @@ func (sn *SuperNode) Start() error {
 	// Start background tasks
 	go sn.heartbeatLoop()
 	go sn.staleStreamChecker()
+	go sn.registryWatcher()
 
 	return sn.server.Serve(listener)
 }
 
 // Stop stops the SuperNode server
 func (sn *SuperNode) Stop() {
+	if sn.adminServer != nil {
+		sn.adminServer.Stop()
+	}
+
 	if sn.server != nil {
 		sn.server.GracefulStop()
 	}
+
+	sn.closeRemoteConns()
+
+	if sn.baseClient != nil {
+		sn.baseClient.Close()
+	}
+
+	if sn.relayManager != nil {
+		if err := sn.relayManager.Cleanup(); err != nil {
+			sn.logger.WithError(err).Warn("Failed to clean up relay rules")
+		}
+	}
+
+	if sn.relayDataplane != nil {
+		if err := sn.relayDataplane.Cleanup(); err != nil {
+			sn.logger.WithError(err).Warn("Failed to clean up relay interface")
+		}
+	}
+}
+
+// SetPeerRegistry replaces the registry used to authorize peers
+func (sn *SuperNode) SetPeerRegistry(registry *PeerRegistry) {
+	sn.peerRegistry = registry
+}
+
+// RevokePeer revokes a peer and asks it to disconnect if it is connected
+func (sn *SuperNode) RevokePeer(peerID string) error {
+	if err := sn.peerRegistry.Revoke(peerID); err != nil {
+		return fmt.Errorf("failed to revoke peer: %w", err)
+	}
+
+	if _, connected := sn.streamManager.GetStream(peerID); connected {
+		if err := sn.disconnectPeer(peerID, "peer revoked"); err != nil {
+			sn.logger.WithError(err).WithField("peer_id", peerID).Warn("Failed to disconnect revoked peer")
+		}
+	}
+
+	return nil
+}
+
+// closeRevokedStreams ends the streams of connected peers that have been
+// revoked, e.g. by an operator editing the registry file
+func (sn *SuperNode) closeRevokedStreams() {
+	for _, peerID := range sn.peerRegistry.RevokedPeers() {
+		sn.streamManager.CloseStream(peerID, "peer revoked")
+	}
+}
+
+// registryWatcher picks up revocations made in the registry file
+func (sn *SuperNode) registryWatcher() {
+	ticker := time.NewTicker(registryCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sn.closeRevokedStreams()
+	}
+}
+
+// SetExitSelector sets the strategy used to choose among local exit peers
+func (sn *SuperNode) SetExitSelector(selector ExitSelector) {
+	sn.exitSelector = selector
+}
+
+// SetRelayManager sets the manager used to install relay forwarding rules
+func (sn *SuperNode) SetRelayManager(relayManager *dataplane.RelayManager) {
+	sn.relayManager = relayManager
+}
+
+// SetRelayDataplane sets the WireGuard interface relayed clients connect to.
+// It is brought up by Start and torn down by Stop.
+func (sn *SuperNode) SetRelayDataplane(relayDataplane *dataplane.WireGuardDataplane) {
+	sn.relayDataplane = relayDataplane
 }
 
 // PersistentControlStream handles the persistent control stream
 func (sn *SuperNode) PersistentControlStream(stream controlProto.ControlStream_PersistentControlStreamServer) error {
-	var peerID string
+	var peerID, sessionID string
 	authenticated := false
 
 	sn.logger.Info("New control stream connected")
 
+	// A draining node sends new peers elsewhere
+	if sn.IsDraining() {
+		return status.Errorf(codes.Unavailable, "SuperNode %s is draining", sn.id)
+	}
+	if sn.maxPeers > 0 && len(sn.streamManager.GetActiveStreams()) >= sn.maxPeers {
+		return status.Errorf(codes.Unavailable, "SuperNode %s is at capacity", sn.id)
+	}
+
 	defer func() {
-		if authenticated && peerID != "" {
-			sn.streamManager.UnregisterStream(peerID)
+		if authenticated && peerID != "" && sn.streamManager.UnregisterStream(peerID, sessionID) {
+			sn.peerStreamClosed(peerID)
 		}
 	}()
 
+	// Challenge the peer before it may authenticate
+	nonce, err := sn.sendAuthChallenge(stream)
+	if err != nil {
+		sn.logger.WithError(err).Error("Failed to send auth challenge")
+		return status.Errorf(codes.Internal, "failed to send auth challenge")
+	}
+
+	// Receive in the background so that we can also end the stream ourselves
+	messages, recvErr := receiveMessages(stream)
+	var closed <-chan struct{}
+	var streamInfo *StreamInfo
+
 	for {
-		msg, err := stream.Recv()
-		if err == io.EOF {
-			sn.logger.WithField("peer_id", peerID).Info("Control stream closed by client")
-			return nil
-		}
-		if err != nil {
+		var msg *controlProto.ControlMessage
+		select {
+		case msg = <-messages:
+		case err := <-recvErr:
+			if err == io.EOF {
+				sn.logger.WithField("peer_id", peerID).Info("Control stream closed by client")
+				return nil
+			}
 			sn.logger.WithFields(logrus.Fields{
 				"peer_id": peerID,
 				"error":   err,
 			}).Error("Error receiving message")
 			return err
+		case <-closed:
+			return status.Errorf(codes.PermissionDenied, "stream closed by SuperNode: %s", streamInfo.CloseReason())
 		}
 
 		switch payload := msg.Payload.(type) {
 		case *controlProto.ControlMessage_AuthRequest:
+			if authenticated {
+				return status.Errorf(codes.FailedPrecondition, "already authenticated")
+			}
 			var err error
-			peerID, _, err = sn.handleAuthRequest(payload.AuthRequest, stream)
+			peerID, sessionID, err = sn.handleAuthRequest(payload.AuthRequest, nonce, stream)
 			if err != nil {
 				sn.logger.WithError(err).Error("Authentication failed")
 				sn.streamManager.IncrementAuthFailures()
 				return status.Errorf(codes.Unauthenticated, "authentication failed: %v", err)
 			}
 			authenticated = true
+			sn.peerReconnected(peerID)
+
+			if info, exists := sn.streamManager.GetStream(peerID); exists && info.SessionID == sessionID {
+				streamInfo = info
+				closed = info.Closed()
+			}
 
 		case *controlProto.ControlMessage_PingRequest:
 			if !authenticated {
 				return status.Errorf(codes.Unauthenticated, "not authenticated")
 			}
-			if err := sn.handlePingRequest(payload.PingRequest, stream); err != nil {
+			if err := sn.handlePingRequest(peerID, payload.PingRequest); err != nil {
 				sn.logger.WithError(err).Error("Failed to handle ping")
 			}
 
@@ -153,34 +335,141 @@ func (sn *SuperNode) PersistentControlStream(stream controlProto.ControlStream_P
 			if !authenticated {
 				return status.Errorf(codes.Unauthenticated, "not authenticated")
 			}
-			if err := sn.handleInfoRequest(payload.InfoRequest, stream); err != nil {
+			if err := sn.handleInfoRequest(peerID, payload.InfoRequest); err != nil {
 				sn.logger.WithError(err).Error("Failed to handle info request")
 			}
 
+		case *controlProto.ControlMessage_ExitRequest:
+			if !authenticated {
+				return status.Errorf(codes.Unauthenticated, "not authenticated")
+			}
+			// Allocation waits on the exit peer, so don't block this stream
+			go sn.handleExitRequest(peerID, payload.ExitRequest)
+
+		case *controlProto.ControlMessage_ExitConfirm:
+			if !authenticated {
+				return status.Errorf(codes.Unauthenticated, "not authenticated")
+			}
+			go sn.handleExitConfirm(peerID, payload.ExitConfirm)
+
+		case *controlProto.ControlMessage_RoleUpdate:
+			if !authenticated {
+				return status.Errorf(codes.Unauthenticated, "not authenticated")
+			}
+			// Migrating exit clients waits on command responses, some arriving on this stream
+			go sn.handleRoleUpdate(peerID, payload.RoleUpdate)
+
+		case *controlProto.ControlMessage_ExitResume:
+			if !authenticated {
+				return status.Errorf(codes.Unauthenticated, "not authenticated")
+			}
+			// Claiming the session calls the client's previous SuperNode
+			go sn.handleExitResume(peerID, payload.ExitResume)
+
 		default:
 			sn.logger.WithField("peer_id", peerID).Warn("Unknown message type received")
 		}
 	}
 }
 
-// handleAuthRequest handles authentication requests
-func (sn *SuperNode) handleAuthRequest(req *controlProto.AuthRequest, stream controlProto.ControlStream_PersistentControlStreamServer) (string, string, error) {
+// receiveMessages reads a stream in the background until it ends or fails
+func receiveMessages(stream controlProto.ControlStream_PersistentControlStreamServer) (<-chan *controlProto.ControlMessage, <-chan error) {
+	messages := make(chan *controlProto.ControlMessage)
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case messages <- msg:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	return messages, errs
+}
+
+// sendAuthChallenge issues a fresh nonce and sends it to the peer
+func (sn *SuperNode) sendAuthChallenge(stream controlProto.ControlStream_PersistentControlStreamServer) (string, error) {
+	nonce, expiresAt, err := sn.authNonces.Issue()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := &controlProto.ControlMessage{
+		MessageId: fmt.Sprintf("auth-challenge-%d", time.Now().UnixNano()),
+		Timestamp: time.Now().Unix(),
+		Payload: &controlProto.ControlMessage_AuthChallenge{
+			AuthChallenge: &controlProto.AuthChallenge{
+				Nonce:     nonce,
+				ExpiresAt: expiresAt.Unix(),
+			},
+		},
+	}
+
+	if err := stream.Send(challenge); err != nil {
+		return "", fmt.Errorf("failed to send auth challenge: %w", err)
+	}
+
+	return nonce, nil
+}
+
+// handleAuthRequest handles authentication requests against the nonce issued on this stream
+func (sn *SuperNode) handleAuthRequest(req *controlProto.AuthRequest, nonce string, stream controlProto.ControlStream_PersistentControlStreamServer) (string, string, error) {
 	// Validate role
 	role := PeerRole(req.Role)
 	if role != RoleClient && role != RoleExit && role != RoleHybrid {
 		return "", "", fmt.Errorf("invalid role: %s", req.Role)
 	}
 
+	// The peer must answer this stream's challenge, and only once
+	if req.Nonce != nonce {
+		return "", "", fmt.Errorf("nonce does not match the issued challenge")
+	}
+	if err := sn.authNonces.Redeem(req.Nonce); err != nil {
+		return "", "", err
+	}
+
+	skew := time.Since(time.Unix(req.Timestamp, 0))
+	if skew > authClockSkew || skew < -authClockSkew {
+		return "", "", fmt.Errorf("auth timestamp outside allowed skew: %s", skew.Round(time.Second))
+	}
+
+	// Bind the signature to this TLS connection
+	binding, err := utils.ChannelBinding(stream.Context())
+	if err != nil {
+		return "", "", err
+	}
+
 	// Verify signature
-	if err := sn.verifyAuthSignature(req); err != nil {
+	if err := sn.verifyAuthSignature(req, binding); err != nil {
 		return "", "", fmt.Errorf("signature verification failed: %w", err)
 	}
 
+	// The key must match the one pinned or provisioned for this peer ID
+	if err := sn.peerRegistry.Authorize(req.PeerId, req.PubkeyB64, role); err != nil {
+		return "", "", fmt.Errorf("peer not authorized: %w", err)
+	}
+
+	// Remember where the peer connects from so exit endpoints can be resolved
+	remoteAddr := ""
+	if p, ok := peer.FromContext(stream.Context()); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+
 	// Register stream
-	sessionID, err := sn.streamManager.RegisterStream(req.PeerId, role, req.Region, req.PubkeyB64, stream)
+	sessionID, err := sn.streamManager.RegisterStream(req.PeerId, role, req.Region, req.PubkeyB64, remoteAddr, stream)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to register stream: %w", err)
 	}
+	sn.streamManager.SetMaxClients(req.PeerId, int(req.MaxClients))
 
 	// Send auth response
 	response := &controlProto.ControlMessage{
@@ -195,7 +484,8 @@ func (sn *SuperNode) handleAuthRequest(req *controlProto.AuthRequest, stream con
 		},
 	}
 
-	if err := stream.Send(response); err != nil {
+	// The stream is registered, so commands may already be sent on it
+	if err := sn.streamManager.SendMessageToPeer(req.PeerId, response); err != nil {
 		return "", "", fmt.Errorf("failed to send auth response: %w", err)
 	}
 
@@ -210,10 +500,9 @@ func (sn *SuperNode) handleAuthRequest(req *controlProto.AuthRequest, stream con
 }
 
 // verifyAuthSignature verifies the authentication signature
-func (sn *SuperNode) verifyAuthSignature(req *controlProto.AuthRequest) error {
+func (sn *SuperNode) verifyAuthSignature(req *controlProto.AuthRequest, channelBinding []byte) error {
 	// Reconstruct the signed message
-	message := fmt.Sprintf("%s||%s||%s||%s", req.PeerId, req.Role, req.Region, req.Nonce)
-	messageBytes := []byte(message)
+	messageBytes := utils.AuthSignaturePayload(req.PeerId, req.Role, req.Region, req.Nonce, req.Timestamp, channelBinding)
 
 	// Decode public key and signature
 	pubKeyBytes, err := base64.StdEncoding.DecodeString(req.PubkeyB64)
@@ -236,12 +525,12 @@ func (sn *SuperNode) verifyAuthSignature(req *controlProto.AuthRequest) error {
 }
 
 // handlePingRequest handles ping requests
-func (sn *SuperNode) handlePingRequest(req *controlProto.PingRequest, stream controlProto.ControlStream_PersistentControlStreamServer) error {
+func (sn *SuperNode) handlePingRequest(peerID string, req *controlProto.PingRequest) error {
 	now := time.Now()
 	latencyMs := float64(now.UnixMilli() - req.Timestamp)
 
 	// Update heartbeat
-	sn.streamManager.UpdateHeartbeat(req.PeerId, latencyMs)
+	sn.streamManager.UpdateHeartbeat(peerID, latencyMs)
 
 	// Send pong response
 	response := &controlProto.ControlMessage{
@@ -251,17 +540,18 @@ func (sn *SuperNode) handlePingRequest(req *controlProto.PingRequest, stream con
 			PongResponse: &controlProto.PongResponse{
 				Timestamp:         now.UnixMilli(),
 				OriginalTimestamp: req.Timestamp,
-				PeerId:           req.PeerId,
+				PeerId:            req.PeerId,
 			},
 		},
 	}
 
-	return stream.Send(response)
+	// Sends go through the stream manager so they serialize with commands
+	return sn.streamManager.SendMessageToPeer(peerID, response)
 }
 
 // handleCommandResponse handles command responses from peers
 func (sn *SuperNode) handleCommandResponse(peerID string, resp *controlProto.CommandResponse) {
-	sn.streamManager.UpdateCommandResult(peerID, resp.Success)
+	sn.streamManager.UpdateCommandResult(peerID, resp)
 
 	sn.logger.WithFields(logrus.Fields{
 		"peer_id":    peerID,
@@ -272,7 +562,7 @@ func (sn *SuperNode) handleCommandResponse(peerID string, resp *controlProto.Com
 }
 
 // handleInfoRequest handles info requests
-func (sn *SuperNode) handleInfoRequest(req *controlProto.InfoRequest, stream controlProto.ControlStream_PersistentControlStreamServer) error {
+func (sn *SuperNode) handleInfoRequest(peerID string, req *controlProto.InfoRequest) error {
 	info := make(map[string]string)
 
 	// Provide requested information
@@ -300,63 +590,55 @@ func (sn *SuperNode) handleInfoRequest(req *controlProto.InfoRequest, stream con
 		},
 	}
 
-	return stream.Send(response)
+	// Sends go through the stream manager so they serialize with commands
+	return sn.streamManager.SendMessageToPeer(peerID, response)
 }
 
 // RequestExitPeer handles requests for exit peers from other SuperNodes
 func (sn *SuperNode) RequestExitPeer(ctx context.Context, req *controlProto.RequestExitPeerRequest) (*controlProto.RequestExitPeerResponse, error) {
-	// Find available exit peers (including hybrid peers)
-	exitPeers := sn.streamManager.GetStreamsByRole(RoleExit)
-	hybridPeers := sn.streamManager.GetStreamsByRole(RoleHybrid)
-	
-	// Combine exit and hybrid peers
-	allExitPeers := append(exitPeers, hybridPeers...)
-	
-	if len(allExitPeers) == 0 {
+	if req.ClientId == "" || req.ClientPubkey == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "client ID and public key are required")
+	}
+
+	if err := sn.authenticateSuperNode(ctx, req.RequestingSupernodeId); err != nil {
+		return nil, err
+	}
+
+	if req.Region != "" && req.Region != sn.region {
 		return &controlProto.RequestExitPeerResponse{
 			Success: false,
-			Message: "No exit peers available",
+			Message: fmt.Sprintf("region %s is not served by SuperNode %s", req.Region, sn.id),
 		}, nil
 	}
 
-	// Select the first available exit peer (simple selection)
-	selectedPeer := allExitPeers[0]
-
-	// Generate session ID for this connection
-	sessionID := fmt.Sprintf("%s-%s-%d", req.ClientId, selectedPeer.PeerID, time.Now().Unix())
-
-	// Send SETUP_EXIT command to the exit peer
-	setupCommand := &controlProto.Command{
-		CommandId: fmt.Sprintf("setup-exit-%d", time.Now().UnixNano()),
-		Type:      controlProto.CommandType_SETUP_EXIT,
-		Payload: map[string]string{
-			"client_id":   req.ClientId,
-			"session_id":  sessionID,
-			"allowed_ips": "0.0.0.0/0", // Allow all traffic
-		},
-	}
+	sn.logger.WithFields(logrus.Fields{
+		"client_id":            req.ClientId,
+		"requesting_supernode": req.RequestingSupernodeId,
+	}).Info("Exit peer requested by remote SuperNode")
 
-	if err := sn.streamManager.SendCommandToPeer(selectedPeer.PeerID, setupCommand); err != nil {
+	allocation, err := sn.allocateLocalExit(ctx, req.ClientId, req.ClientPubkey, req.ExcludePeerIds)
+	if err != nil {
 		return &controlProto.RequestExitPeerResponse{
 			Success: false,
-			Message: fmt.Sprintf("Failed to setup exit peer: %v", err),
-		}, status.Errorf(codes.Internal, "failed to setup exit peer: %v", err)
+			Message: err.Error(),
+		}, nil
 	}
 
-	// Return exit peer info
-	exitPeerInfo := &controlProto.ExitPeerInfo{
-		PeerId:                   selectedPeer.PeerID,
-		PublicKey:               selectedPeer.PublicKey,
-		Endpoint:                fmt.Sprintf("%s:%d", sn.getPublicIP(), sn.relayPort),
-		AllowedIps:              []string{"0.0.0.0/0"},
-		SupportsDirectConnection: false, // We'll use relay for now
-	}
+	// The requesting SuperNode forwards its client's confirmation through ConfirmExitPeer
+	sn.trackExitSession(&exitSession{
+		SessionID:  allocation.SessionID,
+		ClientID:   req.ClientId,
+		ExitPeerID: allocation.ExitPeer.PeerId,
+		Requester:  req.RequestingSupernodeId,
+	}, remoteExitConfirmTimeout)
 
 	return &controlProto.RequestExitPeerResponse{
-		Success:   true,
-		Message:   "Exit peer allocated successfully",
-		ExitPeer:  exitPeerInfo,
-		SessionId: sessionID,
+		Success:      true,
+		Message:      "Exit peer allocated successfully",
+		ExitPeer:     allocation.ExitPeer,
+		SessionId:    allocation.SessionID,
+		AllocatedIp:  allocation.AllocatedIP,
+		AllocatedIp6: allocation.AllocatedIP6,
 	}, nil
 }
 
@@ -367,13 +649,15 @@ func (sn *SuperNode) registerWithBaseNode() error {
 		return fmt.Errorf("invalid listen address: %w", err)
 	}
 
+	currentLoad, maxCapacity, load := sn.loadReport()
 	req := &proto.RegisterSuperNodeRequest{
-		Region:       sn.region,
-		SupernodeId:  sn.id,
-		IpAddress:    ip,
-		Port:         int32(port),
-		CurrentLoad:  0,
-		MaxCapacity:  1000,
+		Region:      sn.region,
+		SupernodeId: sn.id,
+		IpAddress:   ip,
+		Port:        int32(port),
+		CurrentLoad: currentLoad,
+		MaxCapacity: maxCapacity,
+		Load:        load,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -404,13 +688,15 @@ func (sn *SuperNode) heartbeatLoop() {
 	}
 }
 
-// staleStreamChecker removes stale streams
+// staleStreamChecker removes stale streams and releases their peers' exit sessions
 func (sn *SuperNode) staleStreamChecker() {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		sn.streamManager.CheckStaleStreams(2 * time.Minute)
+		for _, peerID := range sn.streamManager.CheckStaleStreams(2 * time.Minute) {
+			go sn.releasePeerSessions(peerID, "stream went stale")
+		}
 	}
 }
 
@@ -422,4 +708,4 @@ func (sn *SuperNode) getPublicIP() string {
 		return parts[0]
 	}
 	return "127.0.0.1" // Fallback for testing
-}
\ No newline at end of file
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authenticateSuperNode checks that a SuperNode-to-SuperNode RPC comes from
+// the SuperNode it claims to be from. Over TLS the caller's verified client
+// certificate must name the SuperNode ID as its common name or a DNS name.
+// Plaintext deployments cannot tell SuperNodes apart and take the claim.
+func (sn *SuperNode) authenticateSuperNode(ctx context.Context, supernodeID string) error {
+	if supernodeID == "" {
+		return status.Errorf(codes.InvalidArgument, "requesting SuperNode ID is required")
+	}
+
+	if !sn.requireSNCert {
+		return nil
+	}
+
+	var chains [][]*x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			chains = tlsInfo.State.VerifiedChains
+		}
+	}
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		sn.logger.WithField("supernode_id", supernodeID).Warn("Rejected SuperNode RPC without a verified client certificate")
+		return status.Errorf(codes.Unauthenticated, "SuperNode RPCs require a verified client certificate")
+	}
+
+	if !certificateNames(chains[0][0], supernodeID) {
+		sn.logger.WithFields(logrus.Fields{
+			"supernode_id": supernodeID,
+			"subject":      chains[0][0].Subject.CommonName,
+		}).Warn("Rejected SuperNode RPC with another node's client certificate")
+		return status.Errorf(codes.PermissionDenied, "client certificate does not belong to SuperNode %s", supernodeID)
+	}
+	return nil
+}
+
+// certificateNames reports whether a certificate names id as its common name or a DNS name
+func certificateNames(cert *x509.Certificate, id string) bool {
+	if cert.Subject.CommonName == id {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if name == id {
+			return true
+		}
+	}
+	return false
+}
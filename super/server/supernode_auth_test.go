@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	controlProto "myDvpn/clientPeer/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// superNodeContext returns the context of an RPC over TLS whose verified
+// client certificate has commonName and dnsNames; no certificate when both are empty
+func superNodeContext(commonName string, dnsNames ...string) context.Context {
+	var state tls.ConnectionState
+	if commonName != "" || len(dnsNames) > 0 {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}, DNSNames: dnsNames}
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+// newTLSTestSuperNode creates a SuperNode that authenticates other SuperNodes by certificate
+func newTLSTestSuperNode() *SuperNode {
+	sn := newTestSuperNode()
+	sn.requireSNCert = true
+	return sn
+}
+
+func TestAuthenticateSuperNode(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     bool
+		ctx     context.Context
+		claimed string
+		code    codes.Code
+	}{
+		{name: "plaintext takes the claim", ctx: context.Background(), claimed: "sn-2", code: codes.OK},
+		{name: "certificate common name", tls: true, ctx: superNodeContext("sn-2"), claimed: "sn-2", code: codes.OK},
+		{name: "certificate DNS name", tls: true, ctx: superNodeContext("node", "sn-2.example.com", "sn-2"), claimed: "sn-2", code: codes.OK},
+		{name: "another SuperNode's certificate", tls: true, ctx: superNodeContext("sn-3", "sn-3.example.com"), claimed: "sn-2", code: codes.PermissionDenied},
+		{name: "no client certificate", tls: true, ctx: superNodeContext(""), claimed: "sn-2", code: codes.Unauthenticated},
+		{name: "no TLS", tls: true, ctx: context.Background(), claimed: "sn-2", code: codes.Unauthenticated},
+		{name: "no claimed ID", ctx: context.Background(), code: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sn := newTestSuperNode()
+			sn.requireSNCert = tt.tls
+			expectCode(t, sn.authenticateSuperNode(tt.ctx, tt.claimed), tt.code)
+		})
+	}
+}
+
+func TestConfirmExitPeerChecksSessionOwner(t *testing.T) {
+	sn := newTLSTestSuperNode()
+	connectTestPeer(t, sn, "exit-1", RoleExit)
+	sn.trackExitSession(&exitSession{SessionID: "s1", ClientID: "c1", ExitPeerID: "exit-1", Requester: "sn-2"}, time.Minute)
+
+	release := func(requester string) *controlProto.ConfirmExitPeerRequest {
+		return &controlProto.ConfirmExitPeerRequest{SessionId: "s1", RequestingSupernodeId: requester, Message: "client gave up"}
+	}
+
+	// sn-3 cannot pass itself off as the session's owner
+	_, err := sn.ConfirmExitPeer(superNodeContext("sn-3"), release("sn-2"))
+	expectCode(t, err, codes.PermissionDenied)
+
+	// nor release a session it did not request under its own name
+	resp, err := sn.ConfirmExitPeer(superNodeContext("sn-3"), release("sn-3"))
+	if err != nil || resp.Success {
+		t.Fatalf("ConfirmExitPeer from another SuperNode returned %v, %v; want the session unknown", resp, err)
+	}
+	if n := sn.exitSessions.count(); n != 1 {
+		t.Fatalf("%d pending sessions, want s1 kept", n)
+	}
+
+	resp, err = sn.ConfirmExitPeer(superNodeContext("sn-2"), release("sn-2"))
+	if err != nil || !resp.Success {
+		t.Fatalf("ConfirmExitPeer from the owner returned %v, %v", resp, err)
+	}
+	if n := sn.exitSessions.count(); n != 0 {
+		t.Fatalf("%d pending sessions after the owner released s1, want 0", n)
+	}
+}
+
+func TestRequestExitPeerAuthenticatesCaller(t *testing.T) {
+	sn := newTLSTestSuperNode()
+	connectTestPeer(t, sn, "exit-1", RoleExit)
+
+	_, err := sn.RequestExitPeer(superNodeContext("sn-3"), &controlProto.RequestExitPeerRequest{
+		ClientId:              "c1",
+		ClientPubkey:          "key-c1",
+		RequestingSupernodeId: "sn-2",
+	})
+	expectCode(t, err, codes.PermissionDenied)
+
+	if n := sn.exitSessions.count(); n != 0 {
+		t.Fatalf("%d sessions set up for a forged request, want 0", n)
+	}
+}
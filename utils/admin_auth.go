@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// adminTokenEnv supplies the admin token when no token file is given
+	adminTokenEnv = "MYDVPN_ADMIN_TOKEN"
+
+	// adminAuthHeader carries "Bearer <token>" on admin calls
+	adminAuthHeader = "authorization"
+
+	// minAdminTokenLength rejects tokens too short to resist guessing
+	minAdminTokenLength = 16
+)
+
+// ReadAdminToken reads the admin token from a file, or from MYDVPN_ADMIN_TOKEN when path is empty
+func ReadAdminToken(path string) (string, error) {
+	token := os.Getenv(adminTokenEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read admin token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("no admin token configured (set a token file or $%s)", adminTokenEnv)
+	}
+	if len(token) < minAdminTokenLength {
+		return "", fmt.Errorf("admin token must be at least %d characters", minAdminTokenLength)
+	}
+
+	return token, nil
+}
+
+// AdminTokenServerOptions returns interceptors rejecting calls that do not carry the admin token
+func AdminTokenServerOptions(token string) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkAdminToken(ctx, token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkAdminToken(ss.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// checkAdminToken compares the presented bearer token in constant time
+func checkAdminToken(ctx context.Context, token string) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Errorf(codes.Unauthenticated, "missing admin token")
+	}
+
+	for _, value := range md.Get(adminAuthHeader) {
+		presented, found := strings.CutPrefix(value, "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.Unauthenticated, "invalid admin token")
+}
+
+// adminTokenCredentials attaches the admin token to every call
+type adminTokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (c *adminTokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{adminAuthHeader: "Bearer " + c.token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (c *adminTokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// AdminTokenDialOption returns a dial option presenting the admin token. The
+// token is only sent over plaintext when the credentials are insecure.
+func (tc *TLSCredentials) AdminTokenDialOption(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(&adminTokenCredentials{
+		token:      token,
+		requireTLS: !tc.IsInsecure(),
+	})
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// channelBindingLabel is the TLS exporter label used to bind auth signatures to a connection
+const channelBindingLabel = "EXPORTER-mydvpn-auth"
+
+// AuthSignaturePayload builds the message a peer signs to answer an auth challenge
+func AuthSignaturePayload(peerID, role, region, nonce string, timestamp int64, channelBinding []byte) []byte {
+	return []byte(fmt.Sprintf("%s||%s||%s||%s||%d||%s",
+		peerID, role, region, nonce, timestamp, base64.StdEncoding.EncodeToString(channelBinding)))
+}
+
+// ChannelBinding returns keying material exported from the TLS connection carrying ctx.
+// Both ends of a connection derive the same value, so a signature over it cannot be
+// replayed on another connection. It returns nil for plaintext connections.
+func ChannelBinding(ctx context.Context) ([]byte, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return nil, nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, nil
+	}
+
+	binding, err := tlsInfo.State.ExportKeyingMaterial(channelBindingLabel, nil, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export TLS keying material: %w", err)
+	}
+	return binding, nil
+}
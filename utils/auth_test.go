@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// tlsPair completes a TLS handshake over an in-memory connection and
+// returns a context carrying each side's connection state, as gRPC does
+func tlsPair(t *testing.T, cert tls.Certificate, roots *x509.CertPool) (client, server context.Context) {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+
+	tlsServer := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	tlsClient := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "server.test"})
+
+	errs := make(chan error, 1)
+	go func() { errs <- tlsServer.Handshake() }()
+	if err := tlsClient.Handshake(); err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+
+	withState := func(state tls.ConnectionState) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	}
+	return withState(tlsClient.ConnectionState()), withState(tlsServer.ConnectionState())
+}
+
+func TestChannelBinding(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile := ca.issue("server", "server.test")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	client, server := tlsPair(t, cert, roots)
+	clientBinding, err := ChannelBinding(client)
+	if err != nil {
+		t.Fatalf("ChannelBinding: %v", err)
+	}
+	serverBinding, err := ChannelBinding(server)
+	if err != nil {
+		t.Fatalf("ChannelBinding: %v", err)
+	}
+	if len(clientBinding) == 0 || !bytes.Equal(clientBinding, serverBinding) {
+		t.Fatalf("client binding %x and server binding %x, want the same non-empty value", clientBinding, serverBinding)
+	}
+
+	// Another connection between the same peers binds to another value
+	otherClient, _ := tlsPair(t, cert, roots)
+	otherBinding, err := ChannelBinding(otherClient)
+	if err != nil {
+		t.Fatalf("ChannelBinding: %v", err)
+	}
+	if bytes.Equal(otherBinding, clientBinding) {
+		t.Fatal("two connections exported the same channel binding")
+	}
+
+	// Plaintext connections have nothing to bind to
+	if binding, err := ChannelBinding(context.Background()); err != nil || binding != nil {
+		t.Fatalf("plaintext binding %x, %v; want none", binding, err)
+	}
+}
+
+func TestAuthSignaturePayloadCoversEveryField(t *testing.T) {
+	base := AuthSignaturePayload("p1", "client", "r1", "n1", 100, []byte("binding"))
+
+	variants := map[string][]byte{
+		"peer ID":         AuthSignaturePayload("p2", "client", "r1", "n1", 100, []byte("binding")),
+		"role":            AuthSignaturePayload("p1", "exit", "r1", "n1", 100, []byte("binding")),
+		"region":          AuthSignaturePayload("p1", "client", "r2", "n1", 100, []byte("binding")),
+		"nonce":           AuthSignaturePayload("p1", "client", "r1", "n2", 100, []byte("binding")),
+		"timestamp":       AuthSignaturePayload("p1", "client", "r1", "n1", 101, []byte("binding")),
+		"channel binding": AuthSignaturePayload("p1", "client", "r1", "n1", 100, []byte("other")),
+		"no binding":      AuthSignaturePayload("p1", "client", "r1", "n1", 100, nil),
+	}
+	for field, payload := range variants {
+		if bytes.Equal(payload, base) {
+			t.Errorf("payload does not change with the %s", field)
+		}
+	}
+}
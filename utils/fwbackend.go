@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FirewallRuleSet groups the rules installed for one relay session or exit interface.
+// A rule set is applied and removed as a unit.
+type FirewallRuleSet struct {
+	ID         string
+	Masquerade []MasqueradeRule
+	Forward    []ForwardRule
+	DNAT       []DNATRule
+	Routing    []RoutingRule
+}
+
+// HasIPv6NAT reports whether the rule set masquerades IPv6 traffic
+func (rs *FirewallRuleSet) HasIPv6NAT() bool {
+	for _, rule := range rs.Masquerade {
+		if strings.Contains(rule.Source, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+// MasqueradeRule masquerades traffic leaving through an interface
+type MasqueradeRule struct {
+	Source       string // Optional source CIDR
+	OutInterface string
+}
+
+// ForwardRule accepts, or with Drop set drops, forwarded traffic matching
+// every non-empty field. A rule with an IPv6 address only matches IPv6.
+type ForwardRule struct {
+	InInterface string
+	Source      string // CIDR
+	Destination string // CIDR or IP
+	Protocol    string // "tcp" or "udp"
+	DestPort    int
+	Drop        bool
+}
+
+// DNATRule redirects incoming traffic on a local port to another host
+type DNATRule struct {
+	Protocol  string // "tcp" or "udp"
+	DestPort  int
+	ToAddress string
+	ToPort    int
+}
+
+// Firewall abstracts the packet filter used for relay forwarding and exit NAT,
+// along with the policy routing rules that go with them
+type Firewall interface {
+	// EnableForwarding turns on IP forwarding on the host
+	EnableForwarding() error
+
+	// EnableIPv6Forwarding turns on IPv6 forwarding on the host
+	EnableIPv6Forwarding() error
+
+	// Apply installs a rule set; it fails if the ID is already in use
+	Apply(ruleSet *FirewallRuleSet) error
+
+	// Remove uninstalls a previously applied rule set
+	Remove(id string) error
+
+	// Flush removes every rule installed by this firewall
+	Flush() error
+}
+
+// Firewall names accepted by NewFirewall
+const (
+	FirewallIptables = "iptables"
+	FirewallNftables = "nftables"
+	FirewallMemory   = "memory"
+)
+
+// NewFirewall creates the named firewall backend
+func NewFirewall(kind string, logger *logrus.Logger) (Firewall, error) {
+	switch kind {
+	case FirewallIptables, "":
+		return NewIptablesFirewall(logger), nil
+	case FirewallNftables:
+		return NewNftablesFirewall(logger)
+	case FirewallMemory:
+		return NewMemoryFirewall(), nil
+	default:
+		return nil, fmt.Errorf("unknown firewall %q (want iptables, nftables or memory)", kind)
+	}
+}
+
+// ExitNATRuleSet builds the rules an exit needs to forward and masquerade its
+// clients' traffic. With an IPv6 client pool their IPv6 traffic is forwarded
+// with NAT66; without one it is dropped so it cannot leave unmasqueraded.
+func ExitNATRuleSet(id, wgInterface, clientCIDR, clientCIDR6, externalInterface string) *FirewallRuleSet {
+	ruleSet := &FirewallRuleSet{
+		ID: id,
+		Masquerade: []MasqueradeRule{
+			{Source: clientCIDR, OutInterface: externalInterface},
+		},
+	}
+
+	if clientCIDR6 != "" {
+		ruleSet.Masquerade = append(ruleSet.Masquerade, MasqueradeRule{Source: clientCIDR6, OutInterface: externalInterface})
+		ruleSet.Forward = append(ruleSet.Forward, ForwardRule{InInterface: wgInterface, Source: clientCIDR6})
+	} else {
+		ruleSet.Forward = append(ruleSet.Forward, ForwardRule{InInterface: wgInterface, Source: "::/0", Drop: true})
+	}
+
+	ruleSet.Forward = append(ruleSet.Forward, ForwardRule{InInterface: wgInterface})
+	return ruleSet
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// IptablesFirewall applies rule sets by running iptables or ip6tables once per rule
+type IptablesFirewall struct {
+	logger   *logrus.Logger
+	ruleSets map[string][][]string // id -> rule specs without the -A/-D action
+	routing  map[string][]RoutingRule
+	mutex    sync.Mutex
+}
+
+// NewIptablesFirewall creates an iptables firewall
+func NewIptablesFirewall(logger *logrus.Logger) *IptablesFirewall {
+	return &IptablesFirewall{
+		logger:   logger,
+		ruleSets: make(map[string][][]string),
+		routing:  make(map[string][]RoutingRule),
+	}
+}
+
+// EnableForwarding enables IP forwarding on the system
+func (fw *IptablesFirewall) EnableForwarding() error {
+	return EnableIPForwarding()
+}
+
+// EnableIPv6Forwarding enables IPv6 forwarding on the system
+func (fw *IptablesFirewall) EnableIPv6Forwarding() error {
+	return EnableIPv6Forwarding()
+}
+
+// Apply appends each rule in turn, removing the ones already added if any rule fails
+func (fw *IptablesFirewall) Apply(ruleSet *FirewallRuleSet) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if _, exists := fw.ruleSets[ruleSet.ID]; exists {
+		return fmt.Errorf("rule set %s already applied", ruleSet.ID)
+	}
+
+	specs := iptablesSpecs(ruleSet)
+	for i, spec := range specs {
+		if err := runIptables("-A", spec); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if rbErr := runIptables("-D", specs[j]); rbErr != nil {
+					fw.logger.WithError(rbErr).WithField("rule_set", ruleSet.ID).Warn("Failed to roll back iptables rule")
+				}
+			}
+			return fmt.Errorf("failed to apply rule set %s: %w", ruleSet.ID, err)
+		}
+	}
+
+	if err := applyRoutingRules(ruleSet.ID, ruleSet.Routing); err != nil {
+		for j := len(specs) - 1; j >= 0; j-- {
+			if rbErr := runIptables("-D", specs[j]); rbErr != nil {
+				fw.logger.WithError(rbErr).WithField("rule_set", ruleSet.ID).Warn("Failed to roll back iptables rule")
+			}
+		}
+		return err
+	}
+
+	fw.ruleSets[ruleSet.ID] = specs
+	fw.routing[ruleSet.ID] = ruleSet.Routing
+	return nil
+}
+
+// Remove deletes the rules of a rule set in reverse order
+func (fw *IptablesFirewall) Remove(id string) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	return fw.removeUnsafe(id)
+}
+
+// Flush removes every rule set applied through this firewall
+func (fw *IptablesFirewall) Flush() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	var firstErr error
+	for id := range fw.ruleSets {
+		if err := fw.removeUnsafe(id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// removeUnsafe removes a rule set without locking
+func (fw *IptablesFirewall) removeUnsafe(id string) error {
+	specs, exists := fw.ruleSets[id]
+	if !exists {
+		return fmt.Errorf("no rule set %s", id)
+	}
+
+	firstErr := removeRoutingRules(id, fw.routing[id])
+	for i := len(specs) - 1; i >= 0; i-- {
+		if err := runIptables("-D", specs[i]); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove rule set %s: %w", id, err)
+		}
+	}
+
+	delete(fw.ruleSets, id)
+	delete(fw.routing, id)
+	return firstErr
+}
+
+// iptablesSpecs converts a rule set into iptables rule specifications.
+// Each spec is {command, table, chain, match...}; the action is inserted when
+// run. Rules with an IPv6 address go to ip6tables, all others to iptables.
+func iptablesSpecs(ruleSet *FirewallRuleSet) [][]string {
+	comment := []string{"-m", "comment", "--comment", "mydvpn:" + ruleSet.ID}
+	var specs [][]string
+
+	for _, rule := range ruleSet.Masquerade {
+		spec := []string{iptablesCommand(rule.Source), "nat", "POSTROUTING"}
+		if rule.Source != "" {
+			spec = append(spec, "-s", rule.Source)
+		}
+		spec = append(spec, "-o", rule.OutInterface)
+		spec = append(spec, comment...)
+		specs = append(specs, append(spec, "-j", "MASQUERADE"))
+	}
+
+	for _, rule := range ruleSet.Forward {
+		spec := []string{iptablesCommand(rule.Source, rule.Destination), "filter", "FORWARD"}
+		if rule.InInterface != "" {
+			spec = append(spec, "-i", rule.InInterface)
+		}
+		if rule.Source != "" {
+			spec = append(spec, "-s", rule.Source)
+		}
+		if rule.Destination != "" {
+			spec = append(spec, "-d", rule.Destination)
+		}
+		if rule.Protocol != "" {
+			spec = append(spec, "-p", rule.Protocol)
+			if rule.DestPort > 0 {
+				spec = append(spec, "--dport", strconv.Itoa(rule.DestPort))
+			}
+		}
+		spec = append(spec, comment...)
+		target := "ACCEPT"
+		if rule.Drop {
+			target = "DROP"
+		}
+		specs = append(specs, append(spec, "-j", target))
+	}
+
+	for _, rule := range ruleSet.DNAT {
+		spec := []string{iptablesCommand(rule.ToAddress), "nat", "PREROUTING", "-p", rule.Protocol, "--dport", strconv.Itoa(rule.DestPort)}
+		spec = append(spec, comment...)
+		specs = append(specs, append(spec, "-j", "DNAT", "--to-destination", net.JoinHostPort(rule.ToAddress, strconv.Itoa(rule.ToPort))))
+	}
+
+	return specs
+}
+
+// iptablesCommand returns ip6tables if any of the addresses is IPv6, iptables otherwise
+func iptablesCommand(addrs ...string) string {
+	for _, addr := range addrs {
+		if strings.Contains(addr, ":") {
+			return "ip6tables"
+		}
+	}
+	return "iptables"
+}
+
+// runIptables runs iptables or ip6tables with the given action (-A or -D) and rule spec
+func runIptables(action string, spec []string) error {
+	args := append([]string{"-t", spec[1], action, spec[2]}, spec[3:]...)
+	cmd := exec.Command(spec[0], args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %v: %w: %s", spec[0], args, err, output)
+	}
+	return nil
+}
+
+// Ensure the iptables firewall satisfies the firewall interface
+var _ Firewall = (*IptablesFirewall)(nil)
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryFirewall records rule sets without touching the host; useful for unprivileged tests
+type MemoryFirewall struct {
+	forwardingEnabled     bool
+	ipv6ForwardingEnabled bool
+	ruleSets              map[string]*FirewallRuleSet
+	mutex                 sync.RWMutex
+}
+
+// NewMemoryFirewall creates an empty in-memory firewall
+func NewMemoryFirewall() *MemoryFirewall {
+	return &MemoryFirewall{
+		ruleSets: make(map[string]*FirewallRuleSet),
+	}
+}
+
+// EnableForwarding records that forwarding was requested
+func (fw *MemoryFirewall) EnableForwarding() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	fw.forwardingEnabled = true
+	return nil
+}
+
+// EnableIPv6Forwarding records that IPv6 forwarding was requested
+func (fw *MemoryFirewall) EnableIPv6Forwarding() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	fw.ipv6ForwardingEnabled = true
+	return nil
+}
+
+// Apply records a rule set
+func (fw *MemoryFirewall) Apply(ruleSet *FirewallRuleSet) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if _, exists := fw.ruleSets[ruleSet.ID]; exists {
+		return fmt.Errorf("rule set %s already applied", ruleSet.ID)
+	}
+
+	fw.ruleSets[ruleSet.ID] = ruleSet
+	return nil
+}
+
+// Remove forgets a rule set
+func (fw *MemoryFirewall) Remove(id string) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if _, exists := fw.ruleSets[id]; !exists {
+		return fmt.Errorf("no rule set %s", id)
+	}
+
+	delete(fw.ruleSets, id)
+	return nil
+}
+
+// Flush forgets every rule set
+func (fw *MemoryFirewall) Flush() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	fw.ruleSets = make(map[string]*FirewallRuleSet)
+	return nil
+}
+
+// ForwardingEnabled reports whether EnableForwarding was called
+func (fw *MemoryFirewall) ForwardingEnabled() bool {
+	fw.mutex.RLock()
+	defer fw.mutex.RUnlock()
+	return fw.forwardingEnabled
+}
+
+// IPv6ForwardingEnabled reports whether EnableIPv6Forwarding was called
+func (fw *MemoryFirewall) IPv6ForwardingEnabled() bool {
+	fw.mutex.RLock()
+	defer fw.mutex.RUnlock()
+	return fw.ipv6ForwardingEnabled
+}
+
+// RuleSetIDs returns the IDs of all applied rule sets, sorted
+func (fw *MemoryFirewall) RuleSetIDs() []string {
+	fw.mutex.RLock()
+	defer fw.mutex.RUnlock()
+
+	var ids []string
+	for id := range fw.ruleSets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// RuleSet returns an applied rule set
+func (fw *MemoryFirewall) RuleSet(id string) (*FirewallRuleSet, bool) {
+	fw.mutex.RLock()
+	defer fw.mutex.RUnlock()
+
+	ruleSet, exists := fw.ruleSets[id]
+	return ruleSet, exists
+}
+
+// Ensure the in-memory firewall satisfies the firewall interface
+var _ Firewall = (*MemoryFirewall)(nil)
@@ -0,0 +1,427 @@
+//go:build linux
+
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// nftablesTableName is the dedicated table that holds every myDvpn rule
+const nftablesTableName = "mydvpn"
+
+// NftablesFirewall owns a dedicated inet table and applies each rule set as one netlink transaction
+type NftablesFirewall struct {
+	logger      *logrus.Logger
+	table       *nftables.Table
+	postrouting *nftables.Chain
+	prerouting  *nftables.Chain
+	forward     *nftables.Chain
+	ruleSets    map[string]bool
+	routing     map[string][]RoutingRule
+	mutex       sync.Mutex
+}
+
+// NewNftablesFirewall creates the mydvpn table, discarding any rules left behind by a previous crash
+func NewNftablesFirewall(logger *logrus.Logger) (*NftablesFirewall, error) {
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: nftablesTableName}
+	accept := nftables.ChainPolicyAccept
+
+	fw := &NftablesFirewall{
+		logger: logger,
+		table:  table,
+		postrouting: &nftables.Chain{
+			Name:     "postrouting",
+			Table:    table,
+			Type:     nftables.ChainTypeNAT,
+			Hooknum:  nftables.ChainHookPostrouting,
+			Priority: nftables.ChainPriorityNATSource,
+		},
+		prerouting: &nftables.Chain{
+			Name:     "prerouting",
+			Table:    table,
+			Type:     nftables.ChainTypeNAT,
+			Hooknum:  nftables.ChainHookPrerouting,
+			Priority: nftables.ChainPriorityNATDest,
+		},
+		forward: &nftables.Chain{
+			Name:     "forward",
+			Table:    table,
+			Type:     nftables.ChainTypeFilter,
+			Hooknum:  nftables.ChainHookForward,
+			Priority: nftables.ChainPriorityFilter,
+			Policy:   &accept,
+		},
+		ruleSets: make(map[string]bool),
+		routing:  make(map[string][]RoutingRule),
+	}
+
+	conn, err := nftables.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nftables connection: %w", err)
+	}
+
+	tables, err := conn.ListTablesOfFamily(nftables.TableFamilyINet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nftables tables: %w", err)
+	}
+
+	for _, existing := range tables {
+		if existing.Name == nftablesTableName {
+			logger.Warn("Removing stale mydvpn nftables table")
+			conn.DelTable(table)
+		}
+	}
+
+	fw.addTable(conn)
+	if err := conn.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to create nftables table %s: %w", nftablesTableName, err)
+	}
+
+	return fw, nil
+}
+
+// EnableForwarding enables IP forwarding on the system
+func (fw *NftablesFirewall) EnableForwarding() error {
+	return EnableIPForwarding()
+}
+
+// EnableIPv6Forwarding enables IPv6 forwarding on the system
+func (fw *NftablesFirewall) EnableIPv6Forwarding() error {
+	return EnableIPv6Forwarding()
+}
+
+// Apply installs every rule of a rule set in a single atomic transaction
+func (fw *NftablesFirewall) Apply(ruleSet *FirewallRuleSet) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fw.ruleSets[ruleSet.ID] {
+		return fmt.Errorf("rule set %s already applied", ruleSet.ID)
+	}
+
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("failed to open nftables connection: %w", err)
+	}
+
+	// The table may have been flushed away; adding it again is a no-op otherwise
+	fw.addTable(conn)
+
+	tag := userdata.AppendString(nil, userdata.TypeComment, nftablesTag(ruleSet.ID))
+
+	for _, rule := range ruleSet.Masquerade {
+		exprs, err := masqueradeExprs(rule)
+		if err != nil {
+			return fmt.Errorf("invalid masquerade rule in %s: %w", ruleSet.ID, err)
+		}
+		conn.AddRule(&nftables.Rule{Table: fw.table, Chain: fw.postrouting, Exprs: exprs, UserData: tag})
+	}
+
+	for _, rule := range ruleSet.Forward {
+		exprs, err := forwardExprs(rule)
+		if err != nil {
+			return fmt.Errorf("invalid forward rule in %s: %w", ruleSet.ID, err)
+		}
+		conn.AddRule(&nftables.Rule{Table: fw.table, Chain: fw.forward, Exprs: exprs, UserData: tag})
+	}
+
+	for _, rule := range ruleSet.DNAT {
+		exprs, err := dnatExprs(rule)
+		if err != nil {
+			return fmt.Errorf("invalid DNAT rule in %s: %w", ruleSet.ID, err)
+		}
+		conn.AddRule(&nftables.Rule{Table: fw.table, Chain: fw.prerouting, Exprs: exprs, UserData: tag})
+	}
+
+	// Routing rules are not part of the nftables transaction, so they go in
+	// first and are taken out again if the transaction fails
+	if err := applyRoutingRules(ruleSet.ID, ruleSet.Routing); err != nil {
+		return err
+	}
+
+	if err := conn.Flush(); err != nil {
+		if rbErr := removeRoutingRules(ruleSet.ID, ruleSet.Routing); rbErr != nil {
+			fw.logger.WithError(rbErr).WithField("rule_set", ruleSet.ID).Warn("Failed to roll back routing rules")
+		}
+		return fmt.Errorf("failed to apply rule set %s: %w", ruleSet.ID, err)
+	}
+
+	fw.ruleSets[ruleSet.ID] = true
+	fw.routing[ruleSet.ID] = ruleSet.Routing
+	return nil
+}
+
+// Remove deletes every rule tagged with the rule set ID in a single transaction
+func (fw *NftablesFirewall) Remove(id string) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if !fw.ruleSets[id] {
+		return fmt.Errorf("no rule set %s", id)
+	}
+
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("failed to open nftables connection: %w", err)
+	}
+
+	tag := nftablesTag(id)
+	for _, chain := range []*nftables.Chain{fw.postrouting, fw.prerouting, fw.forward} {
+		rules, err := conn.GetRules(fw.table, chain)
+		if err != nil {
+			return fmt.Errorf("failed to list rules in chain %s: %w", chain.Name, err)
+		}
+
+		for _, rule := range rules {
+			if comment, ok := userdata.GetString(rule.UserData, userdata.TypeComment); ok && comment == tag {
+				if err := conn.DelRule(&nftables.Rule{Table: fw.table, Chain: chain, Handle: rule.Handle}); err != nil {
+					return fmt.Errorf("failed to queue rule deletion: %w", err)
+				}
+			}
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("failed to remove rule set %s: %w", id, err)
+	}
+
+	err = removeRoutingRules(id, fw.routing[id])
+	delete(fw.ruleSets, id)
+	delete(fw.routing, id)
+	return err
+}
+
+// Flush deletes the whole mydvpn table
+func (fw *NftablesFirewall) Flush() error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("failed to open nftables connection: %w", err)
+	}
+
+	conn.DelTable(fw.table)
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("failed to delete nftables table %s: %w", nftablesTableName, err)
+	}
+
+	var firstErr error
+	for id, rules := range fw.routing {
+		if err := removeRoutingRules(id, rules); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	fw.ruleSets = make(map[string]bool)
+	fw.routing = make(map[string][]RoutingRule)
+	return firstErr
+}
+
+// addTable queues creation of the table and its base chains
+func (fw *NftablesFirewall) addTable(conn *nftables.Conn) {
+	conn.AddTable(fw.table)
+	conn.AddChain(fw.postrouting)
+	conn.AddChain(fw.prerouting)
+	conn.AddChain(fw.forward)
+}
+
+// nftablesTag is the rule comment used to find a rule set's rules
+func nftablesTag(id string) string {
+	return "mydvpn:" + id
+}
+
+// masqueradeExprs builds "[ip saddr X] oifname Y masquerade"
+func masqueradeExprs(rule MasqueradeRule) ([]expr.Any, error) {
+	var exprs []expr.Any
+
+	if rule.Source != "" {
+		match, err := addressMatch(rule.Source, true)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, match...)
+	}
+
+	exprs = append(exprs, interfaceMatch(expr.MetaKeyOIFNAME, rule.OutInterface)...)
+	return append(exprs, &expr.Masq{}), nil
+}
+
+// forwardExprs builds "[iifname] [saddr] [daddr] [proto [dport]] accept|drop"
+func forwardExprs(rule ForwardRule) ([]expr.Any, error) {
+	var exprs []expr.Any
+
+	if rule.InInterface != "" {
+		exprs = append(exprs, interfaceMatch(expr.MetaKeyIIFNAME, rule.InInterface)...)
+	}
+
+	if rule.Source != "" {
+		match, err := addressMatch(rule.Source, true)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, match...)
+	}
+
+	if rule.Destination != "" {
+		match, err := addressMatch(rule.Destination, false)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, match...)
+	}
+
+	if rule.Protocol != "" {
+		match, err := portMatch(rule.Protocol, rule.DestPort)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, match...)
+	}
+
+	verdict := expr.VerdictAccept
+	if rule.Drop {
+		verdict = expr.VerdictDrop
+	}
+	return append(exprs, &expr.Verdict{Kind: verdict}), nil
+}
+
+// dnatExprs builds "meta l4proto P th dport N dnat to A:P"
+func dnatExprs(rule DNATRule) ([]expr.Any, error) {
+	addr, err := netip.ParseAddr(rule.ToAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNAT address %q: %w", rule.ToAddress, err)
+	}
+
+	match, err := portMatch(rule.Protocol, rule.DestPort)
+	if err != nil {
+		return nil, err
+	}
+
+	family := uint32(unix.NFPROTO_IPV4)
+	if addr.Is6() && !addr.Is4In6() {
+		family = unix.NFPROTO_IPV6
+	}
+
+	exprs := append(familyMatch(byte(family)), match...)
+	return append(exprs,
+		&expr.Immediate{Register: 1, Data: addr.Unmap().AsSlice()},
+		&expr.Immediate{Register: 2, Data: bigEndian16(uint16(rule.ToPort))},
+		&expr.NAT{
+			Type:        expr.NATTypeDestNAT,
+			Family:      family,
+			RegAddrMin:  1,
+			RegProtoMin: 2,
+			Specified:   true,
+		},
+	), nil
+}
+
+// interfaceMatch compares an interface name meta key
+func interfaceMatch(key expr.MetaKey, name string) []expr.Any {
+	ifname := make([]byte, unix.IFNAMSIZ)
+	copy(ifname, name)
+
+	return []expr.Any{
+		&expr.Meta{Key: key, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifname},
+	}
+}
+
+// familyMatch restricts an inet rule to IPv4 or IPv6
+func familyMatch(family byte) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{family}},
+	}
+}
+
+// addressMatch compares the source or destination address against a CIDR or single IP
+func addressMatch(value string, source bool) ([]expr.Any, error) {
+	var prefix netip.Prefix
+	var err error
+	if strings.Contains(value, "/") {
+		prefix, err = netip.ParsePrefix(value)
+	} else {
+		var addr netip.Addr
+		addr, err = netip.ParseAddr(value)
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", value, err)
+	}
+	prefix = prefix.Masked()
+
+	family := byte(unix.NFPROTO_IPV4)
+	offset := uint32(12) // IPv4 saddr
+	if !source {
+		offset = 16 // IPv4 daddr
+	}
+	if prefix.Addr().Is6() {
+		family = unix.NFPROTO_IPV6
+		offset = 8 // IPv6 saddr
+		if !source {
+			offset = 24 // IPv6 daddr
+		}
+	}
+
+	length := uint32(prefix.Addr().BitLen() / 8)
+	mask := make([]byte, length)
+	for i := 0; i < prefix.Bits(); i++ {
+		mask[i/8] |= 0x80 >> (i % 8)
+	}
+
+	exprs := append(familyMatch(family),
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: length},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: length, Mask: mask, Xor: make([]byte, length)},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: prefix.Addr().AsSlice()},
+	)
+	return exprs, nil
+}
+
+// portMatch compares the layer 4 protocol and, if set, the destination port
+func portMatch(protocol string, port int) ([]expr.Any, error) {
+	var proto byte
+	switch protocol {
+	case "udp":
+		proto = unix.IPPROTO_UDP
+	case "tcp":
+		proto = unix.IPPROTO_TCP
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+	}
+
+	if port > 0 {
+		exprs = append(exprs,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: bigEndian16(uint16(port))},
+		)
+	}
+
+	return exprs, nil
+}
+
+// bigEndian16 encodes a port in network byte order
+func bigEndian16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// Ensure the nftables firewall satisfies the firewall interface
+var _ Firewall = (*NftablesFirewall)(nil)
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NewNftablesFirewall is only available on Linux
+func NewNftablesFirewall(logger *logrus.Logger) (Firewall, error) {
+	return nil, fmt.Errorf("nftables firewall is only supported on Linux")
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// AddressFamily is the IP version a routing rule applies to
+type AddressFamily int
+
+const (
+	FamilyIPv4 AddressFamily = iota
+	FamilyIPv6
+)
+
+// RoutingRule is a policy routing rule ("ip rule") that picks the routing
+// table for traffic matching every non-empty field. IPv4 and IPv6 keep
+// separate rule lists, so a rule only applies to its own family.
+type RoutingRule struct {
+	Family      AddressFamily
+	Priority    int // Lower runs first; zero lets the kernel choose
+	InInterface string
+	Source      string // CIDR of the rule's family
+	Table       string // "main" or a table number
+}
+
+// exitRoutingPriority runs ahead of the rules wg-quick and similar tools add
+// (32763 and up) to send all traffic into a client tunnel
+const exitRoutingPriority = 32000
+
+// ExitRoutingRules route traffic arriving from an exit's clients with the
+// main table, ahead of any rule that sends the host's own traffic into a
+// client tunnel, so a peer that is both client and exit sends its exit
+// clients' traffic straight out instead of through its own client tunnel.
+// The IPv6 rule is only added when the rule set NATs IPv6.
+func ExitRoutingRules(ruleSet *FirewallRuleSet, wgInterface string) []RoutingRule {
+	rules := []RoutingRule{{
+		Family:      FamilyIPv4,
+		Priority:    exitRoutingPriority,
+		InInterface: wgInterface,
+		Table:       "main",
+	}}
+	if ruleSet.HasIPv6NAT() {
+		rules = append(rules, RoutingRule{
+			Family:      FamilyIPv6,
+			Priority:    exitRoutingPriority,
+			InInterface: wgInterface,
+			Table:       "main",
+		})
+	}
+	return rules
+}
+
+// applyRoutingRules adds every routing rule in turn, removing the ones already
+// added if any rule fails
+func applyRoutingRules(id string, rules []RoutingRule) error {
+	for i, rule := range rules {
+		if err := runIPRule("add", rule); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				runIPRule("del", rules[j])
+			}
+			return fmt.Errorf("failed to apply routing rules of %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// removeRoutingRules deletes routing rules in reverse order
+func removeRoutingRules(id string, rules []RoutingRule) error {
+	var firstErr error
+	for i := len(rules) - 1; i >= 0; i-- {
+		if err := runIPRule("del", rules[i]); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove routing rules of %s: %w", id, err)
+		}
+	}
+	return firstErr
+}
+
+// runIPRule runs "ip rule", or "ip -6 rule" for an IPv6 rule, with the given
+// action (add or del)
+func runIPRule(action string, rule RoutingRule) error {
+	args := ipRuleArgs(action, rule)
+	cmd := exec.Command("ip", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ip %v: %w: %s", args, err, output)
+	}
+	return nil
+}
+
+// ipRuleArgs returns the arguments to ip for a rule
+func ipRuleArgs(action string, rule RoutingRule) []string {
+	var args []string
+	if rule.Family == FamilyIPv6 || strings.Contains(rule.Source, ":") {
+		args = append(args, "-6")
+	}
+	args = append(args, "rule", action)
+	if rule.Priority > 0 {
+		args = append(args, "priority", strconv.Itoa(rule.Priority))
+	}
+	if rule.Source != "" {
+		args = append(args, "from", rule.Source)
+	}
+	if rule.InInterface != "" {
+		args = append(args, "iif", rule.InInterface)
+	}
+	return append(args, "lookup", rule.Table)
+}
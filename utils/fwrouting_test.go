@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExitRoutingRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		clientCIDR6 string
+		want        [][]string
+	}{
+		{
+			name: "IPv4 only",
+			want: [][]string{
+				{"rule", "add", "priority", "32000", "iif", "wg-exit", "lookup", "main"},
+			},
+		},
+		{
+			name:        "IPv6 NAT",
+			clientCIDR6: ExitPoolIPv6,
+			want: [][]string{
+				{"rule", "add", "priority", "32000", "iif", "wg-exit", "lookup", "main"},
+				{"-6", "rule", "add", "priority", "32000", "iif", "wg-exit", "lookup", "main"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleSet := ExitNATRuleSet("exit-wg-exit", "wg-exit", ExitPoolIPv4, tt.clientCIDR6, "eth0")
+			rules := ExitRoutingRules(ruleSet, "wg-exit")
+
+			if len(rules) != len(tt.want) {
+				t.Fatalf("%d routing rules, want %d", len(rules), len(tt.want))
+			}
+			for i, rule := range rules {
+				if args := ipRuleArgs("add", rule); !slices.Equal(args, tt.want[i]) {
+					t.Errorf("rule %d: ip %v, want ip %v", i, args, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIPRuleArgsFollowSourceFamily(t *testing.T) {
+	rule := RoutingRule{Source: ExitPoolIPv6, Table: "100"}
+	want := []string{"-6", "rule", "del", "from", ExitPoolIPv6, "lookup", "100"}
+	if args := ipRuleArgs("del", rule); !slices.Equal(args, want) {
+		t.Fatalf("ip %v, want ip %v", args, want)
+	}
+}
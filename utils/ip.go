@@ -3,55 +3,61 @@ package utils
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"os/exec"
 	"strconv"
 	"strings"
 )
 
-// AllocateClientIP allocates an IP address for a client in the given CIDR range
-func AllocateClientIP(cidr string, usedIPs map[string]bool) (string, error) {
-	_, ipNet, err := net.ParseCIDR(cidr)
-	if err != nil {
-		return "", fmt.Errorf("invalid CIDR: %w", err)
-	}
+// Tunnel address pools. Every exit NATs its clients, so all exits share the
+// exit pools. Unified peers, which can run a client tunnel and an exit side by
+// side, serve their exit clients from the hybrid pools instead, so the
+// address and gateway of their own tunnel to a dedicated exit never fall
+// into the pool they serve. The IPv6 pools are /64s of a unique local (ULA)
+// prefix.
+const (
+	RelayPoolIPv4      = "10.8.0.0/24"
+	RelayPoolIPv6      = "fd4d:7976:706e:8::/64"
+	ExitPoolIPv4       = "10.9.0.0/24"
+	ExitPoolIPv6       = "fd4d:7976:706e:9::/64"
+	HybridExitPoolIPv4 = "10.10.0.0/24"
+	HybridExitPoolIPv6 = "fd4d:7976:706e:a::/64"
+)
 
-	// Start from the second IP in the range (first is usually gateway)
-	ip := ipNet.IP
-	for ip := ip.Mask(ipNet.Mask); ipNet.Contains(ip); incIP(ip) {
-		// Skip network and broadcast addresses
-		if ip.Equal(ipNet.IP) || ip.Equal(getBroadcast(ipNet)) {
-			continue
-		}
+// FullTunnelAllowedIPs returns the allowed IPs that send all IPv4 and IPv6
+// traffic into a tunnel. Clients route IPv6 to the exit even when it has no
+// IPv6, so that it is dropped there rather than leaking outside the tunnel.
+func FullTunnelAllowedIPs() []string {
+	return []string{"0.0.0.0/0", "::/0"}
+}
 
-		ipStr := ip.String()
-		if !usedIPs[ipStr] {
-			return ipStr, nil
-		}
+// PoolGateway returns the first host address of a pool with the pool's prefix
+// length, the address an interface serving the pool is given
+func PoolGateway(cidr string) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", fmt.Errorf("invalid CIDR: %w", err)
 	}
-
-	return "", fmt.Errorf("no available IP addresses in CIDR %s", cidr)
+	return netip.PrefixFrom(prefix.Masked().Addr().Next(), prefix.Bits()).String(), nil
 }
 
-// incIP increments an IP address
-func incIP(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
-		}
+// HostPrefix returns a single address as a /32 or /128 prefix
+func HostPrefix(ip string) string {
+	if strings.Contains(ip, ":") {
+		return ip + "/128"
 	}
+	return ip + "/32"
 }
 
-// getBroadcast gets the broadcast address for a network
-func getBroadcast(ipNet *net.IPNet) net.IP {
-	ip := make(net.IP, len(ipNet.IP))
-	copy(ip, ipNet.IP)
-	
-	for i := 0; i < len(ip); i++ {
-		ip[i] |= ^ipNet.Mask[i]
+// TunnelAddresses returns the host prefixes of a tunnel's IPv4 and optional IPv6 address
+func TunnelAddresses(ip, ip6 string) []string {
+	var addrs []string
+	for _, addr := range []string{ip, ip6} {
+		if addr != "" {
+			addrs = append(addrs, HostPrefix(addr))
+		}
 	}
-	
-	return ip
+	return addrs
 }
 
 // ValidateIP validates an IP address string
@@ -125,9 +131,12 @@ func EnableIPForwarding() error {
 	return cmd.Run()
 }
 
-// AddNATRule adds a NAT rule for the specified interfaces
-func AddNATRule(internalInterface, externalInterface string) error {
-	cmd := exec.Command("iptables", "-t", "nat", "-A", "POSTROUTING", 
-		"-o", externalInterface, "-j", "MASQUERADE")
-	return cmd.Run()
-}
\ No newline at end of file
+// EnableIPv6Forwarding enables IPv6 forwarding on the system. It fails on
+// hosts with IPv6 disabled.
+func EnableIPv6Forwarding() error {
+	cmd := exec.Command("sysctl", "-w", "net.ipv6.conf.all.forwarding=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to enable IPv6 forwarding: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
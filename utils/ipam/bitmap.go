@@ -0,0 +1,80 @@
+package ipam
+
+import "math/bits"
+
+// bitmap tracks which addresses of a pool are taken. A second level marks
+// the words that are completely full, so finding a free address looks at
+// one summary word per 4096 addresses and one word of the bitmap: constant
+// time for pools up to maxPoolSize.
+type bitmap struct {
+	words []uint64 // Bit set: address taken
+	full  []uint64 // Bit set: word of words is full
+	size  int
+	free  int
+}
+
+// newBitmap creates a bitmap of size free addresses
+func newBitmap(size int) *bitmap {
+	words := (size + 63) / 64
+	b := &bitmap{
+		words: make([]uint64, words),
+		full:  make([]uint64, (words+63)/64),
+		size:  size,
+		free:  size,
+	}
+
+	// Bits past the end of the pool are never handed out
+	if tail := size % 64; tail != 0 {
+		b.words[words-1] = ^uint64(0) << tail
+	}
+	return b
+}
+
+// isSet reports whether an address is taken
+func (b *bitmap) isSet(i int) bool {
+	return b.words[i/64]&(1<<(i%64)) != 0
+}
+
+// set marks an address as taken
+func (b *bitmap) set(i int) {
+	w := i / 64
+	if b.words[w]&(1<<(i%64)) != 0 {
+		return
+	}
+	b.words[w] |= 1 << (i % 64)
+	b.free--
+	if b.words[w] == ^uint64(0) {
+		b.full[w/64] |= 1 << (w % 64)
+	}
+}
+
+// clear marks an address as free
+func (b *bitmap) clear(i int) {
+	w := i / 64
+	if b.words[w]&(1<<(i%64)) == 0 {
+		return
+	}
+	b.words[w] &^= 1 << (i % 64)
+	b.free++
+	b.full[w/64] &^= 1 << (w % 64)
+}
+
+// next takes the lowest free address and returns it, or -1 if there is none
+func (b *bitmap) next() int {
+	if b.free == 0 {
+		return -1
+	}
+	for s, summary := range b.full {
+		if summary == ^uint64(0) {
+			continue
+		}
+		w := s*64 + bits.TrailingZeros64(^summary)
+		if w >= len(b.words) {
+			break
+		}
+		i := w*64 + bits.TrailingZeros64(^b.words[w])
+		b.set(i)
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,116 @@
+package ipam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// leaseFile is the on-disk form of a pool's leases
+type leaseFile struct {
+	CIDR   string  `json:"cidr"`
+	Leases []Lease `json:"leases"`
+}
+
+// DefaultDir returns <user config dir>/mydvpn/leases/<id>, where a node keeps
+// its lease files unless configured otherwise
+func DefaultDir(id string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "mydvpn", "leases", id)
+}
+
+// Load restores the leases saved at path and saves every later change there.
+// The clients that held leases before a restart are gone with the tunnel, so
+// their leases come back as released: each client gets its old address back
+// if it returns within the hold time. Leases outside the pool are skipped.
+func (p *Pool) Load(path string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create lease directory: %w", err)
+	}
+	p.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read leases: %w", err)
+	}
+
+	var saved leaseFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to decode leases: %w", err)
+	}
+
+	now := time.Now()
+	for _, lease := range saved.Leases {
+		offset, ok := p.offset(lease.IP)
+		if !ok || p.addresses.isSet(offset) {
+			continue
+		}
+		if _, exists := p.leases[lease.Key]; exists {
+			continue
+		}
+		if lease.Expires.IsZero() {
+			lease.Expires = now.Add(p.holdTime)
+		}
+		if !now.Before(lease.Expires) {
+			continue
+		}
+
+		restored := lease
+		p.leases[lease.Key] = &restored
+		p.byOffset[offset] = &restored
+		p.addresses.set(offset)
+	}
+
+	return p.save()
+}
+
+// save writes every lease to the lease file, replacing it atomically
+func (p *Pool) save() error {
+	if p.path == "" {
+		return nil
+	}
+
+	saved := leaseFile{CIDR: p.prefix.String(), Leases: make([]Lease, 0, len(p.leases))}
+	for _, lease := range p.leases {
+		saved.Leases = append(saved.Leases, *lease)
+	}
+	sort.Slice(saved.Leases, func(i, j int) bool { return saved.Leases[i].Key < saved.Leases[j].Key })
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode leases: %w", err)
+	}
+
+	tmp, err := os.OpenFile(p.path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create lease file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write leases: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync leases: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write leases: %w", err)
+	}
+	if err := os.Rename(p.path+".tmp", p.path); err != nil {
+		return fmt.Errorf("failed to install lease file: %w", err)
+	}
+	return nil
+}
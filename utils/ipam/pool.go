@@ -0,0 +1,286 @@
+// Package ipam hands out tunnel addresses from a pool as leases keyed by the
+// client they belong to. A released lease keeps its address for a while so a
+// client that comes back, or a peer that restarts, gets the same address again.
+package ipam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// maxPoolSize caps the addresses a pool hands out; larger prefixes (such
+	// as an IPv6 /64) use their first maxPoolSize addresses
+	maxPoolSize = 1 << 16
+
+	// DefaultHoldTime is how long a released lease keeps its address for the
+	// client that held it
+	DefaultHoldTime = time.Hour
+
+	// sweepInterval is how often expired leases are looked for
+	sweepInterval = time.Minute
+)
+
+// Lease is an address held by a client. Expires is zero while the client
+// holds it and set once it is released.
+type Lease struct {
+	Key     string    `json:"key"`
+	IP      string    `json:"ip"`
+	Expires time.Time `json:"expires"`
+}
+
+// Pool allocates the addresses of one prefix. The network address and the
+// first host address (the gateway) are never handed out, nor is the IPv4
+// broadcast address, nor any address reserved with Reserve.
+type Pool struct {
+	prefix    netip.Prefix
+	base      netip.Addr
+	addresses *bitmap
+	leases    map[string]*Lease
+	byOffset  map[int]*Lease
+	reserved  map[int]bool
+	holdTime  time.Duration
+	lastSweep time.Time
+	path      string // Lease file; leases are kept in memory only when empty
+	mutex     sync.Mutex
+}
+
+// NewPool creates a pool for a CIDR
+func NewPool(cidr string) (*Pool, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	size := maxPoolSize
+	if hostBits < 16 {
+		size = 1 << hostBits
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("CIDR %s is too small for an address pool", cidr)
+	}
+
+	p := &Pool{
+		prefix:    prefix,
+		base:      prefix.Addr(),
+		addresses: newBitmap(size),
+		leases:    make(map[string]*Lease),
+		byOffset:  make(map[int]*Lease),
+		reserved:  make(map[int]bool),
+		holdTime:  DefaultHoldTime,
+		lastSweep: time.Now(),
+	}
+
+	p.addresses.set(0) // Network
+	p.addresses.set(1) // Gateway
+	if prefix.Addr().Is4() && hostBits <= 16 {
+		p.addresses.set(size - 1) // Broadcast
+	}
+
+	return p, nil
+}
+
+// SetHoldTime sets how long a released lease keeps its address
+func (p *Pool) SetHoldTime(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.holdTime = d
+}
+
+// Allocate returns the address leased to key, giving it a new lease if it has
+// none. A key whose lease was released but has not expired gets the same
+// address back. When the pool is full, the released lease closest to
+// expiring is taken over.
+func (p *Pool) Allocate(key string) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	p.sweepIfDue(now)
+
+	if lease, exists := p.leases[key]; exists {
+		if lease.Expires.IsZero() {
+			return lease.IP, nil
+		}
+		lease.Expires = time.Time{}
+		if err := p.save(); err != nil {
+			lease.Expires = now.Add(p.holdTime)
+			return "", err
+		}
+		return lease.IP, nil
+	}
+
+	offset := p.addresses.next()
+	if offset < 0 {
+		p.sweep(now)
+		offset = p.addresses.next()
+	}
+	if offset < 0 {
+		offset = p.reclaim()
+	}
+	if offset < 0 {
+		return "", fmt.Errorf("no available IP addresses in CIDR %s", p.prefix)
+	}
+
+	lease := &Lease{Key: key, IP: p.addr(offset).String()}
+	p.leases[key] = lease
+	p.byOffset[offset] = lease
+
+	if err := p.save(); err != nil {
+		p.drop(lease)
+		return "", err
+	}
+	return lease.IP, nil
+}
+
+// Release ends the lease of key. Its address stays reserved for key until
+// the hold time has passed.
+func (p *Pool) Release(key string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	lease, exists := p.leases[key]
+	if !exists || !lease.Expires.IsZero() {
+		return nil
+	}
+
+	now := time.Now()
+	lease.Expires = now.Add(p.holdTime)
+	p.sweepIfDue(now)
+	return p.save()
+}
+
+// Reserve keeps an address from being handed out until Unreserve, and
+// reports whether it was newly reserved. An address outside the pool, or one
+// the pool never hands out, needs no reservation. A released lease on the
+// address is given up; an address still held by a client cannot be reserved.
+func (p *Pool) Reserve(ip string) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	offset, ok := p.offset(ip)
+	if !ok || p.reserved[offset] {
+		return false, nil
+	}
+
+	if lease, leased := p.byOffset[offset]; leased {
+		if lease.Expires.IsZero() {
+			return false, fmt.Errorf("address %s is leased to %s", ip, lease.Key)
+		}
+		p.drop(lease)
+		if err := p.save(); err != nil {
+			return false, err
+		}
+	} else if p.addresses.isSet(offset) {
+		return false, nil // Network, gateway or broadcast address
+	}
+
+	p.addresses.set(offset)
+	p.reserved[offset] = true
+	return true, nil
+}
+
+// Unreserve makes an address reserved with Reserve available again
+func (p *Pool) Unreserve(ip string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	offset, ok := p.offset(ip)
+	if !ok || !p.reserved[offset] {
+		return
+	}
+	delete(p.reserved, offset)
+	p.addresses.clear(offset)
+}
+
+// sweepIfDue drops expired leases at most once per sweepInterval
+func (p *Pool) sweepIfDue(now time.Time) {
+	if now.Sub(p.lastSweep) < sweepInterval {
+		return
+	}
+	p.sweep(now)
+}
+
+// sweep drops every expired lease, freeing its address
+func (p *Pool) sweep(now time.Time) {
+	p.lastSweep = now
+
+	swept := false
+	for _, lease := range p.leases {
+		if !lease.Expires.IsZero() && !now.Before(lease.Expires) {
+			p.drop(lease)
+			swept = true
+		}
+	}
+	if swept {
+		// Expired leases are dropped again on load if this save fails
+		_ = p.save()
+	}
+}
+
+// reclaim takes the address of the released lease closest to expiring,
+// returning its offset or -1 if every lease is held
+func (p *Pool) reclaim() int {
+	var oldest *Lease
+	for _, lease := range p.leases {
+		if lease.Expires.IsZero() {
+			continue
+		}
+		if oldest == nil || lease.Expires.Before(oldest.Expires) {
+			oldest = lease
+		}
+	}
+	if oldest == nil {
+		return -1
+	}
+
+	offset, _ := p.offset(oldest.IP)
+	p.drop(oldest)
+	p.addresses.set(offset)
+	return offset
+}
+
+// drop removes a lease and frees its address
+func (p *Pool) drop(lease *Lease) {
+	delete(p.leases, lease.Key)
+	if offset, ok := p.offset(lease.IP); ok && p.byOffset[offset] == lease {
+		delete(p.byOffset, offset)
+		p.addresses.clear(offset)
+	}
+}
+
+// addr returns the address at an offset into the pool
+func (p *Pool) addr(offset int) netip.Addr {
+	b := p.base.As16()
+	low := binary.BigEndian.Uint64(b[8:]) + uint64(offset)
+	binary.BigEndian.PutUint64(b[8:], low)
+
+	addr := netip.AddrFrom16(b)
+	if p.base.Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// offset returns the offset of an address into the pool
+func (p *Pool) offset(ip string) (int, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !p.prefix.Contains(addr) {
+		return 0, false
+	}
+
+	a, b := addr.As16(), p.base.As16()
+	if binary.BigEndian.Uint64(a[:8]) != binary.BigEndian.Uint64(b[:8]) {
+		return 0, false
+	}
+	diff := binary.BigEndian.Uint64(a[8:]) - binary.BigEndian.Uint64(b[8:])
+	if diff >= uint64(p.addresses.size) {
+		return 0, false
+	}
+	return int(diff), true
+}
@@ -0,0 +1,310 @@
+package ipam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mustPool creates a pool or fails the test
+func mustPool(t *testing.T, cidr string) *Pool {
+	t.Helper()
+
+	pool, err := NewPool(cidr)
+	if err != nil {
+		t.Fatalf("NewPool(%s): %v", cidr, err)
+	}
+	return pool
+}
+
+// mustAllocate allocates an address for key or fails the test
+func mustAllocate(t *testing.T, pool *Pool, key string) string {
+	t.Helper()
+
+	ip, err := pool.Allocate(key)
+	if err != nil {
+		t.Fatalf("Allocate(%s): %v", key, err)
+	}
+	return ip
+}
+
+func TestBitmap(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "partial word", size: 8},
+		{name: "one word", size: 64},
+		{name: "partial summary", size: 1000},
+		{name: "full pool", size: maxPoolSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBitmap(tt.size)
+
+			for want := range tt.size {
+				if got := b.next(); got != want {
+					t.Fatalf("next = %d, want %d", got, want)
+				}
+			}
+			if got := b.next(); got != -1 {
+				t.Fatalf("next on a full bitmap = %d, want -1", got)
+			}
+
+			// A freed address is the next one handed out, whichever word it is in
+			for _, i := range []int{tt.size - 1, tt.size / 2, 0} {
+				b.clear(i)
+				if got := b.next(); got != i {
+					t.Fatalf("next after clear(%d) = %d", i, got)
+				}
+			}
+			if b.free != 0 {
+				t.Fatalf("%d free, want 0", b.free)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		cidr   string
+		first  string
+		second string
+		usable int
+	}{
+		{cidr: "10.9.0.0/29", first: "10.9.0.2", second: "10.9.0.3", usable: 5},
+		{cidr: "10.9.0.0/24", first: "10.9.0.2", second: "10.9.0.3", usable: 253},
+		{cidr: "10.9.0.0/16", first: "10.9.0.2", second: "10.9.0.3", usable: 1<<16 - 3},
+		{cidr: "fd4d:7976:706e:9::/120", first: "fd4d:7976:706e:9::2", second: "fd4d:7976:706e:9::3", usable: 254},
+		{cidr: "fd4d:7976:706e:9::/64", first: "fd4d:7976:706e:9::2", second: "fd4d:7976:706e:9::3", usable: maxPoolSize - 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			pool := mustPool(t, tt.cidr)
+
+			if ip := mustAllocate(t, pool, "c0"); ip != tt.first {
+				t.Fatalf("first address %s, want %s", ip, tt.first)
+			}
+			if ip := mustAllocate(t, pool, "c1"); ip != tt.second {
+				t.Fatalf("second address %s, want %s", ip, tt.second)
+			}
+			if ip := mustAllocate(t, pool, "c0"); ip != tt.first {
+				t.Fatalf("c0 allocated again got %s, want its lease %s", ip, tt.first)
+			}
+
+			seen := map[string]bool{tt.first: true, tt.second: true}
+			for i := 2; i < tt.usable; i++ {
+				ip := mustAllocate(t, pool, fmt.Sprintf("c%d", i))
+				if seen[ip] {
+					t.Fatalf("address %s handed out twice", ip)
+				}
+				seen[ip] = true
+			}
+
+			if ip, err := pool.Allocate("overflow"); err == nil {
+				t.Fatalf("full pool handed out %s", ip)
+			}
+		})
+	}
+}
+
+func TestStickyReissue(t *testing.T) {
+	pool := mustPool(t, "10.9.0.0/24")
+
+	ipA := mustAllocate(t, pool, "a")
+	mustAllocate(t, pool, "b")
+	if err := pool.Release("a"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	// A released address stays reserved for its client
+	if ip := mustAllocate(t, pool, "c"); ip == ipA {
+		t.Fatalf("released address %s was given to another client", ipA)
+	}
+	if ip := mustAllocate(t, pool, "a"); ip != ipA {
+		t.Fatalf("returning client got %s, want %s", ip, ipA)
+	}
+
+	// Its lease is held again, so a second release starts a new hold
+	if lease := pool.leases["a"]; !lease.Expires.IsZero() {
+		t.Fatalf("lease of returning client expires at %v, want held", lease.Expires)
+	}
+}
+
+func TestSweepDropsExpiredLeases(t *testing.T) {
+	pool := mustPool(t, "10.9.0.0/24")
+	pool.SetHoldTime(time.Millisecond)
+
+	ipA := mustAllocate(t, pool, "a")
+	mustAllocate(t, pool, "b")
+	if err := pool.Release("a"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Make the next allocation sweep first
+	pool.lastSweep = time.Now().Add(-sweepInterval)
+	if ip := mustAllocate(t, pool, "c"); ip != ipA {
+		t.Fatalf("next client got %s, want the swept address %s", ip, ipA)
+	}
+
+	if _, exists := pool.leases["a"]; exists {
+		t.Fatal("expired lease was not swept")
+	}
+	if _, exists := pool.leases["b"]; !exists {
+		t.Fatal("held lease was swept")
+	}
+}
+
+func TestReclaimTakesOldestReleasedLease(t *testing.T) {
+	pool := mustPool(t, "10.9.0.0/29")
+
+	ips := map[string]string{}
+	for _, key := range []string{"c1", "c2", "c3", "c4", "c5"} {
+		ips[key] = mustAllocate(t, pool, key)
+	}
+	for _, key := range []string{"c2", "c4"} {
+		if err := pool.Release(key); err != nil {
+			t.Fatalf("Release(%s): %v", key, err)
+		}
+	}
+
+	if ip := mustAllocate(t, pool, "c6"); ip != ips["c2"] {
+		t.Fatalf("full pool handed out %s, want the oldest released address %s", ip, ips["c2"])
+	}
+	if ip := mustAllocate(t, pool, "c4"); ip != ips["c4"] {
+		t.Fatalf("c4 got %s, want its reserved address %s", ip, ips["c4"])
+	}
+	if ip, err := pool.Allocate("c7"); err == nil {
+		t.Fatalf("pool with every lease held handed out %s", ip)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidr    string
+		clients int
+	}{
+		{name: "IPv4 /24", cidr: "10.9.0.0/24", clients: 10},
+		{name: "IPv4 /16", cidr: "10.9.0.0/16", clients: 20000},
+		{name: "IPv6 /64", cidr: "fd4d:7976:706e:9::/64", clients: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "leases", "pool.json")
+
+			// Every change rewrites the lease file, so fill the pool
+			// before it has one
+			pool := mustPool(t, tt.cidr)
+			ips := map[string]string{}
+			for i := range tt.clients {
+				key := fmt.Sprintf("c%d", i)
+				ips[key] = mustAllocate(t, pool, key)
+			}
+			if err := pool.Load(path); err != nil {
+				t.Fatalf("Load of missing file: %v", err)
+			}
+			if err := pool.Release("c1"); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+
+			// Reload into a fresh pool, as after a restart
+			reloaded := mustPool(t, tt.cidr)
+			if err := reloaded.Load(path); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if len(reloaded.leases) != tt.clients {
+				t.Fatalf("%d leases after reload, want %d", len(reloaded.leases), tt.clients)
+			}
+			for key, lease := range reloaded.leases {
+				if lease.Expires.IsZero() {
+					t.Fatalf("lease of %s restored as held, want released", key)
+				}
+				if lease.IP != ips[key] {
+					t.Fatalf("lease of %s restored with %s, want %s", key, lease.IP, ips[key])
+				}
+			}
+
+			// A new client never gets an address reserved for a returning one
+			fresh := mustAllocate(t, reloaded, "new")
+			for key, ip := range ips {
+				if ip == fresh {
+					t.Fatalf("new client got %s, reserved for %s", fresh, key)
+				}
+			}
+			for _, key := range []string{"c0", "c1", fmt.Sprintf("c%d", tt.clients-1)} {
+				if ip := mustAllocate(t, reloaded, key); ip != ips[key] {
+					t.Fatalf("%s got %s after reload, want %s", key, ip, ips[key])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSkipsUnusableLeases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.json")
+	expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	data := `{"cidr": "10.9.0.0/24", "leases": [
+		{"key": "held", "ip": "10.9.0.5", "expires": "0001-01-01T00:00:00Z"},
+		{"key": "expired", "ip": "10.9.0.6", "expires": "` + expired + `"},
+		{"key": "gateway", "ip": "10.9.0.1", "expires": "0001-01-01T00:00:00Z"},
+		{"key": "outside", "ip": "10.8.0.7", "expires": "0001-01-01T00:00:00Z"},
+		{"key": "duplicate", "ip": "10.9.0.5", "expires": "0001-01-01T00:00:00Z"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	pool := mustPool(t, "10.9.0.0/24")
+	if err := pool.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(pool.leases) != 1 || pool.leases["held"] == nil {
+		t.Fatalf("restored leases %v, want only held", pool.leases)
+	}
+}
+
+func TestLoadRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := mustPool(t, "10.9.0.0/24").Load(path); err == nil {
+		t.Fatal("Load accepted a corrupt lease file")
+	}
+}
+
+func TestReserveKeepsAddressFromClients(t *testing.T) {
+	pool, err := NewPool("10.10.0.0/29")
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+
+	if newly, err := pool.Reserve("10.10.0.2"); err != nil || !newly {
+		t.Fatalf("Reserve = %v, %v; want newly reserved", newly, err)
+	}
+	for _, ip := range []string{"10.10.0.1", "10.9.0.2", "10.10.0.2"} {
+		if newly, err := pool.Reserve(ip); err != nil || newly {
+			t.Fatalf("Reserve(%s) = %v, %v; want nothing to reserve", ip, newly, err)
+		}
+	}
+
+	if ip, _ := pool.Allocate("c1"); ip != "10.10.0.3" {
+		t.Fatalf("Allocate = %s, want 10.10.0.3", ip)
+	}
+	if _, err := pool.Reserve("10.10.0.3"); err == nil {
+		t.Fatal("reserved an address leased to a client")
+	}
+
+	pool.Unreserve("10.10.0.2")
+	if ip, _ := pool.Allocate("c2"); ip != "10.10.0.2" {
+		t.Fatalf("Allocate after Unreserve = %s, want 10.10.0.2", ip)
+	}
+}
@@ -0,0 +1,390 @@
+package utils
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// WireGuard key names held in a keystore
+const (
+	WireGuardKeyClient = "client" // Client tunnel interface
+	WireGuardKeyExit   = "exit"   // Exit interface
+)
+
+const (
+	keystoreVersion = 1
+
+	// keystorePassphraseEnv supplies the passphrase when no passphrase file is given
+	keystorePassphraseEnv = "MYDVPN_KEYSTORE_PASSPHRASE"
+
+	// scrypt parameters for passphrase-encrypted keystores
+	keystoreScryptN = 1 << 15
+	keystoreScryptR = 8
+	keystoreScryptP = 1
+)
+
+// Keystore holds a peer's long-lived identity: the Ed25519 key used to
+// authenticate to SuperNodes and the WireGuard keys of its interfaces
+type Keystore struct {
+	Identity      *KeyPair
+	WireGuardKeys map[string]wgtypes.Key
+}
+
+// keystoreKeys is the plaintext key material as stored on disk
+type keystoreKeys struct {
+	Identity  string            `json:"identity"`  // Base64 Ed25519 private key
+	WireGuard map[string]string `json:"wireguard"` // Name -> base64 WireGuard private key
+}
+
+// keystoreEncryption describes how an encrypted keystore was sealed
+type keystoreEncryption struct {
+	KDF   string `json:"kdf"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Salt  string `json:"salt"`
+	Nonce string `json:"nonce"`
+}
+
+// keystoreFile is the on-disk keystore format
+type keystoreFile struct {
+	Version    int                 `json:"version"`
+	Keys       *keystoreKeys       `json:"keys,omitempty"`
+	Encryption *keystoreEncryption `json:"encryption,omitempty"`
+	Ciphertext string              `json:"ciphertext,omitempty"`
+}
+
+// NewKeystore generates a fresh identity key and client and exit WireGuard keys
+func NewKeystore() (*Keystore, error) {
+	identity, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{
+		Identity:      identity,
+		WireGuardKeys: make(map[string]wgtypes.Key),
+	}
+
+	for _, name := range []string{WireGuardKeyClient, WireGuardKeyExit} {
+		key, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		ks.WireGuardKeys[name] = key
+	}
+
+	return ks, nil
+}
+
+// WireGuardKey returns the named WireGuard private key
+func (ks *Keystore) WireGuardKey(name string) (wgtypes.Key, error) {
+	key, exists := ks.WireGuardKeys[name]
+	if !exists {
+		return wgtypes.Key{}, fmt.Errorf("keystore has no %s WireGuard key", name)
+	}
+	return key, nil
+}
+
+// Save writes the keystore with 0600 permissions, encrypting it if passphrase is not empty
+func (ks *Keystore) Save(path, passphrase string) error {
+	keys := &keystoreKeys{
+		Identity:  base64.StdEncoding.EncodeToString(ks.Identity.PrivateKey),
+		WireGuard: make(map[string]string),
+	}
+	for name, key := range ks.WireGuardKeys {
+		keys.WireGuard[name] = key.String()
+	}
+
+	file := &keystoreFile{Version: keystoreVersion}
+	if passphrase == "" {
+		file.Keys = keys
+	} else {
+		plaintext, err := json.Marshal(keys)
+		if err != nil {
+			return fmt.Errorf("failed to encode keys: %w", err)
+		}
+		if err := sealKeystore(file, plaintext, passphrase); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode keystore: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create keystore directory: %w", err)
+	}
+
+	// Write to a temporary file and rename so a crash never leaves a truncated keystore
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create keystore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set keystore permissions: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to install keystore: %w", err)
+	}
+	return nil
+}
+
+// LoadKeystore reads a keystore, decrypting it with passphrase if it is encrypted
+func LoadKeystore(path, passphrase string) (*Keystore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("keystore %s is accessible by other users (mode %04o); run chmod 600", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keystore %s: %w", path, err)
+	}
+	if file.Version != keystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", file.Version)
+	}
+
+	keys := file.Keys
+	if file.Encryption != nil {
+		if passphrase == "" {
+			return nil, fmt.Errorf("keystore %s is encrypted; a passphrase is required", path)
+		}
+
+		plaintext, err := openKeystore(&file, passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = &keystoreKeys{}
+		if err := json.Unmarshal(plaintext, keys); err != nil {
+			return nil, fmt.Errorf("failed to parse decrypted keystore: %w", err)
+		}
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("keystore %s holds no keys", path)
+	}
+
+	return decodeKeystoreKeys(keys)
+}
+
+// LoadOrCreateKeystore loads the keystore at path, creating one with fresh keys if it does not exist
+func LoadOrCreateKeystore(path, passphrase string, logger *logrus.Logger) (*Keystore, error) {
+	ks, err := LoadKeystore(path, passphrase)
+	if err == nil {
+		return ks, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	ks, err = NewKeystore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Save(path, passphrase); err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"path":      path,
+		"encrypted": passphrase != "",
+	}).Info("Created new keystore")
+
+	return ks, nil
+}
+
+// decodeKeystoreKeys converts stored key strings into keys
+func decodeKeystoreKeys(keys *keystoreKeys) (*Keystore, error) {
+	raw, err := base64.StdEncoding.DecodeString(keys.Identity)
+	if err != nil || len(raw) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("keystore has an invalid identity key")
+	}
+
+	privateKey := ed25519.PrivateKey(raw)
+	ks := &Keystore{
+		Identity: &KeyPair{
+			PublicKey:  privateKey.Public().(ed25519.PublicKey),
+			PrivateKey: privateKey,
+		},
+		WireGuardKeys: make(map[string]wgtypes.Key),
+	}
+
+	for name, encoded := range keys.WireGuard {
+		key, err := wgtypes.ParseKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("keystore has an invalid %s WireGuard key: %w", name, err)
+		}
+		ks.WireGuardKeys[name] = key
+	}
+
+	return ks, nil
+}
+
+// sealKeystore encrypts the key material with a key derived from passphrase
+func sealKeystore(file *keystoreFile, plaintext []byte, passphrase string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	enc := &keystoreEncryption{
+		KDF:  "scrypt",
+		N:    keystoreScryptN,
+		R:    keystoreScryptR,
+		P:    keystoreScryptP,
+		Salt: base64.StdEncoding.EncodeToString(salt),
+	}
+
+	aead, err := keystoreAEAD(enc, salt, passphrase)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	enc.Nonce = base64.StdEncoding.EncodeToString(nonce)
+
+	file.Encryption = enc
+	file.Ciphertext = base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plaintext, nil))
+	return nil
+}
+
+// openKeystore decrypts the key material of an encrypted keystore
+func openKeystore(file *keystoreFile, passphrase string) ([]byte, error) {
+	enc := file.Encryption
+	if enc.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported keystore KDF %q", enc.KDF)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore salt: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(enc.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(file.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore ciphertext: %w", err)
+	}
+
+	aead, err := keystoreAEAD(enc, salt, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid keystore nonce length")
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore (wrong passphrase?)")
+	}
+	return plaintext, nil
+}
+
+// keystoreAEAD derives the keystore cipher from the passphrase
+func keystoreAEAD(enc *keystoreEncryption, salt []byte, passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, enc.N, enc.R, enc.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive keystore key: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keystore cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// KeystoreOptions locates a keystore and its passphrase
+type KeystoreOptions struct {
+	Path           string // Keystore file; DefaultKeystorePath(id) when empty
+	PassphraseFile string // File holding the passphrase; MYDVPN_KEYSTORE_PASSPHRASE is used when empty
+}
+
+// RegisterKeystoreFlags registers the keystore command line flags shared by every binary
+func RegisterKeystoreFlags(fs *flag.FlagSet) *KeystoreOptions {
+	opts := &KeystoreOptions{}
+	fs.StringVar(&opts.Path, "keystore", "", "Keystore file (default <config dir>/mydvpn/<id>.key)")
+	fs.StringVar(&opts.PassphraseFile, "keystore-passphrase-file", "", "File containing the keystore passphrase (default $"+keystorePassphraseEnv+")")
+	return opts
+}
+
+// ResolvePath returns the keystore path for a node ID
+func (o *KeystoreOptions) ResolvePath(id string) string {
+	if o.Path != "" {
+		return o.Path
+	}
+	return DefaultKeystorePath(id)
+}
+
+// Passphrase reads the passphrase from the passphrase file or the environment; empty means unencrypted
+func (o *KeystoreOptions) Passphrase() (string, error) {
+	if o.PassphraseFile == "" {
+		return os.Getenv(keystorePassphraseEnv), nil
+	}
+
+	data, err := os.ReadFile(o.PassphraseFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read keystore passphrase: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Load loads the keystore for a node ID, creating it on first start
+func (o *KeystoreOptions) Load(id string, logger *logrus.Logger) (*Keystore, error) {
+	passphrase, err := o.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	return LoadOrCreateKeystore(o.ResolvePath(id), passphrase, logger)
+}
+
+// DefaultKeystorePath returns <user config dir>/mydvpn/<id>.key
+func DefaultKeystorePath(id string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "mydvpn", id+".key")
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// RunKeystoreCommand runs the keygen and show-pubkey subcommands shared by every binary.
+// It reports handled=false when args do not start with one of them.
+func RunKeystoreCommand(args []string, defaultID string, stdout io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "keygen":
+		return true, runKeygen(args[1:], defaultID, stdout)
+	case "show-pubkey":
+		return true, runShowPubkey(args[1:], defaultID, stdout)
+	default:
+		return false, nil
+	}
+}
+
+// runKeygen creates a new keystore, refusing to overwrite an existing one unless forced
+func runKeygen(args []string, defaultID string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	id := fs.String("id", defaultID, "Node ID the keystore belongs to")
+	force := fs.Bool("force", false, "Overwrite an existing keystore")
+	opts := RegisterKeystoreFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := opts.ResolvePath(*id)
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("keystore %s already exists (use -force to replace it)", path)
+	}
+
+	passphrase, err := opts.Passphrase()
+	if err != nil {
+		return err
+	}
+
+	ks, err := NewKeystore()
+	if err != nil {
+		return err
+	}
+	if err := ks.Save(path, passphrase); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Wrote keystore %s (encrypted: %v)\n", path, passphrase != "")
+	printPublicKeys(ks, stdout)
+	return nil
+}
+
+// runShowPubkey prints the public halves of the keys in a keystore
+func runShowPubkey(args []string, defaultID string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("show-pubkey", flag.ContinueOnError)
+	id := fs.String("id", defaultID, "Node ID the keystore belongs to")
+	opts := RegisterKeystoreFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	passphrase, err := opts.Passphrase()
+	if err != nil {
+		return err
+	}
+
+	ks, err := LoadKeystore(opts.ResolvePath(*id), passphrase)
+	if err != nil {
+		return err
+	}
+
+	printPublicKeys(ks, stdout)
+	return nil
+}
+
+// printPublicKeys writes the identity and WireGuard public keys
+func printPublicKeys(ks *Keystore, stdout io.Writer) {
+	fmt.Fprintf(stdout, "%-11s%s\n", "identity:", PublicKeyToBase64(ks.Identity.PublicKey))
+
+	var names []string
+	for name := range ks.WireGuardKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(stdout, "%-11s%s\n", "wg-"+name+":", ks.WireGuardKeys[name].PublicKey().String())
+	}
+}
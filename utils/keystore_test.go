@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// expectSameKeys fails the test unless both keystores hold the same keys
+func expectSameKeys(t *testing.T, got, want *Keystore) {
+	t.Helper()
+
+	if !bytes.Equal(got.Identity.PrivateKey, want.Identity.PrivateKey) {
+		t.Fatal("identity key changed")
+	}
+	if !bytes.Equal(got.Identity.PublicKey, want.Identity.PublicKey) {
+		t.Fatal("identity public key does not match the private key")
+	}
+	if len(got.WireGuardKeys) != len(want.WireGuardKeys) {
+		t.Fatalf("%d WireGuard keys, want %d", len(got.WireGuardKeys), len(want.WireGuardKeys))
+	}
+	for name, key := range want.WireGuardKeys {
+		if got.WireGuardKeys[name] != key {
+			t.Fatalf("%s WireGuard key changed", name)
+		}
+	}
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		passphrase string
+	}{
+		{name: "plaintext"},
+		{name: "encrypted", passphrase: "correct horse battery staple"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys", "peer.key")
+
+			ks, err := NewKeystore()
+			if err != nil {
+				t.Fatalf("NewKeystore: %v", err)
+			}
+			if err := ks.Save(path, tt.passphrase); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Fatalf("keystore mode %04o, want 0600", perm)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			identity := base64.StdEncoding.EncodeToString(ks.Identity.PrivateKey)
+			if inClear := strings.Contains(string(data), identity); inClear != (tt.passphrase == "") {
+				t.Fatalf("identity key stored in the clear: %v, want %v", inClear, tt.passphrase == "")
+			}
+
+			loaded, err := LoadKeystore(path, tt.passphrase)
+			if err != nil {
+				t.Fatalf("LoadKeystore: %v", err)
+			}
+			expectSameKeys(t, loaded, ks)
+		})
+	}
+}
+
+func TestLoadKeystoreRejectsWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peer.key")
+
+	ks, err := NewKeystore()
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if err := ks.Save(path, "right"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if _, err := LoadKeystore(path, "wrong"); err == nil {
+		t.Fatal("keystore opened with the wrong passphrase")
+	}
+	if _, err := LoadKeystore(path, ""); err == nil {
+		t.Fatal("encrypted keystore opened without a passphrase")
+	}
+}
+
+func TestLoadKeystoreRejectsLoosePermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peer.key")
+
+	ks, err := NewKeystore()
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if err := ks.Save(path, ""); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+
+	if _, err := LoadKeystore(path, ""); err == nil {
+		t.Fatal("keystore readable by other users was loaded")
+	}
+}
+
+func TestLoadOrCreateKeystoreKeepsIdentity(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	path := filepath.Join(t.TempDir(), "peer.key")
+
+	created, err := LoadOrCreateKeystore(path, "secret", logger)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKeystore: %v", err)
+	}
+	for _, name := range []string{WireGuardKeyClient, WireGuardKeyExit} {
+		if _, err := created.WireGuardKey(name); err != nil {
+			t.Fatalf("created keystore: %v", err)
+		}
+	}
+
+	// A restart finds the same keys
+	reloaded, err := LoadOrCreateKeystore(path, "secret", logger)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKeystore: %v", err)
+	}
+	expectSameKeys(t, reloaded, created)
+
+	// A wrong passphrase never replaces the keystore with fresh keys
+	if _, err := LoadOrCreateKeystore(path, "other", logger); err == nil {
+		t.Fatal("keystore opened with the wrong passphrase")
+	}
+	if reloaded, err = LoadKeystore(path, "secret"); err != nil {
+		t.Fatalf("LoadKeystore: %v", err)
+	}
+	expectSameKeys(t, reloaded, created)
+}
+
+func TestKeystorePassphrase(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(file, []byte("from file\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv(keystorePassphraseEnv, "from env")
+
+	if got, err := (&KeystoreOptions{PassphraseFile: file}).Passphrase(); err != nil || got != "from file" {
+		t.Fatalf("passphrase file gave %q, %v; want %q", got, err, "from file")
+	}
+	if got, err := (&KeystoreOptions{}).Passphrase(); err != nil || got != "from env" {
+		t.Fatalf("environment gave %q, %v; want %q", got, err, "from env")
+	}
+	if _, err := (&KeystoreOptions{PassphraseFile: file + ".missing"}).Passphrase(); err == nil {
+		t.Fatal("missing passphrase file was accepted")
+	}
+}
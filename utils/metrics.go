@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// MetricsNamespace prefixes every metric exported by myDvpn daemons
+const MetricsNamespace = "mydvpn"
+
+// MetricsOptions configures the Prometheus endpoint
+type MetricsOptions struct {
+	Addr string // Listen address for /metrics; disabled when empty
+}
+
+// RegisterMetricsFlags registers the metrics command line flags shared by every binary
+func RegisterMetricsFlags(fs *flag.FlagSet) *MetricsOptions {
+	opts := &MetricsOptions{}
+	fs.StringVar(&opts.Addr, "metrics-addr", "", "Serve Prometheus metrics on this address (e.g. :9100); disabled when empty")
+	return opts
+}
+
+// Enabled reports whether a metrics address was configured
+func (mo *MetricsOptions) Enabled() bool {
+	return mo.Addr != ""
+}
+
+// NewMetricsRegistry creates a registry preloaded with Go runtime and process metrics
+func NewMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Serve exposes the registry on /metrics in the background
+func (mo *MetricsOptions) Serve(registry *prometheus.Registry, logger *logrus.Logger) (*http.Server, error) {
+	listener, err := net.Listen("tcp", mo.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics on %s: %w", mo.Addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.WithError(err).Error("Metrics server failed")
+		}
+	}()
+
+	logger.WithField("addr", listener.Addr().String()).Info("Serving Prometheus metrics")
+	return server, nil
+}
+
+// WireGuardCollector reports per-peer traffic counters read from WireGuard
+// interfaces at scrape time
+type WireGuardCollector struct {
+	backend    WireGuardBackend
+	interfaces func() []string
+
+	receiveBytes  *prometheus.Desc
+	transmitBytes *prometheus.Desc
+	lastHandshake *prometheus.Desc
+	peers         *prometheus.Desc
+}
+
+// NewWireGuardCollector creates a collector for the interfaces returned by interfaces
+func NewWireGuardCollector(backend WireGuardBackend, interfaces func() []string) *WireGuardCollector {
+	return &WireGuardCollector{
+		backend:    backend,
+		interfaces: interfaces,
+		receiveBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(MetricsNamespace, "wireguard", "peer_receive_bytes_total"),
+			"Bytes received from a WireGuard peer",
+			[]string{"interface", "public_key"}, nil,
+		),
+		transmitBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(MetricsNamespace, "wireguard", "peer_transmit_bytes_total"),
+			"Bytes sent to a WireGuard peer",
+			[]string{"interface", "public_key"}, nil,
+		),
+		lastHandshake: prometheus.NewDesc(
+			prometheus.BuildFQName(MetricsNamespace, "wireguard", "peer_last_handshake_seconds"),
+			"Unix time of the last handshake with a WireGuard peer (0 if none)",
+			[]string{"interface", "public_key"}, nil,
+		),
+		peers: prometheus.NewDesc(
+			prometheus.BuildFQName(MetricsNamespace, "wireguard", "peers"),
+			"Number of peers configured on a WireGuard interface",
+			[]string{"interface"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (wc *WireGuardCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wc.receiveBytes
+	ch <- wc.transmitBytes
+	ch <- wc.lastHandshake
+	ch <- wc.peers
+}
+
+// Collect implements prometheus.Collector
+func (wc *WireGuardCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, iface := range wc.interfaces() {
+		device, err := wc.backend.GetDevice(iface)
+		if err != nil {
+			continue // Interface not up (yet)
+		}
+
+		ch <- prometheus.MustNewConstMetric(wc.peers, prometheus.GaugeValue, float64(len(device.Peers)), iface)
+
+		for _, peer := range device.Peers {
+			key := peer.PublicKey.String()
+
+			handshake := 0.0
+			if !peer.LastHandshakeTime.IsZero() {
+				handshake = float64(peer.LastHandshakeTime.Unix())
+			}
+
+			ch <- prometheus.MustNewConstMetric(wc.receiveBytes, prometheus.CounterValue, float64(peer.ReceiveBytes), iface, key)
+			ch <- prometheus.MustNewConstMetric(wc.transmitBytes, prometheus.CounterValue, float64(peer.TransmitBytes), iface, key)
+			ch <- prometheus.MustNewConstMetric(wc.lastHandshake, prometheus.GaugeValue, handshake, iface, key)
+		}
+	}
+}
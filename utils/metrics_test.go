@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// gatherValues gathers a registry and returns each sample of a metric family
+// by its label values joined with ","
+func gatherValues(t *testing.T, gatherer prometheus.Gatherer, name string) map[string]float64 {
+	t.Helper()
+
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var labels []string
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetValue())
+			}
+			value := metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+			values[strings.Join(labels, ",")] = value
+		}
+	}
+	return values
+}
+
+func TestWireGuardCollector(t *testing.T) {
+	wg := NewMemoryWireGuardBackend()
+	if err := wg.CreateInterface("wg-test"); err != nil {
+		t.Fatalf("CreateInterface: %v", err)
+	}
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey: %v", err)
+	}
+	peerKey := key.PublicKey().String()
+	if err := wg.AddPeer("wg-test", PeerConfig{PublicKey: peerKey, AllowedIPs: []string{"10.9.0.2/32"}}); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	registry := NewMetricsRegistry()
+	if err := registry.Register(NewWireGuardCollector(wg, func() []string { return []string{"wg-test", "wg-down"} })); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	// Interfaces that are not up are skipped
+	if peers := gatherValues(t, registry, "mydvpn_wireguard_peers"); len(peers) != 1 || peers["wg-test"] != 1 {
+		t.Fatalf("peers metric %v, want one peer on wg-test", peers)
+	}
+	for _, name := range []string{
+		"mydvpn_wireguard_peer_receive_bytes_total",
+		"mydvpn_wireguard_peer_transmit_bytes_total",
+		"mydvpn_wireguard_peer_last_handshake_seconds",
+	} {
+		values := gatherValues(t, registry, name)
+		if _, exists := values["wg-test,"+peerKey]; !exists || len(values) != 1 {
+			t.Errorf("%s reported %v, want one sample for the peer", name, values)
+		}
+	}
+}
+
+func TestMetricsServe(t *testing.T) {
+	registry := NewMetricsRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Namespace: MetricsNamespace, Name: "test_total", Help: "Test counter"})
+	registry.MustRegister(counter)
+	counter.Inc()
+
+	if err := registry.Register(counter); err == nil {
+		t.Fatal("registering a collector twice succeeded")
+	}
+
+	// Serve does not report the port it got, so pick a free one first
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	server, err := (&MetricsOptions{Addr: addr}).Serve(registry, testTLSLogger())
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	defer server.Close()
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	for _, want := range []string{"mydvpn_test_total 1", "go_goroutines", "process_cpu_seconds_total"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics does not report %s", want)
+		}
+	}
+}
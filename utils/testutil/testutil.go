@@ -0,0 +1,124 @@
+// Package testutil holds fixtures shared by the tests of the peer packages
+package testutil
+
+import (
+	"io"
+	"testing"
+
+	"myDvpn/clientPeer/proto"
+	"myDvpn/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Logger returns a logger that discards its output
+func Logger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// Keystore returns a keystore with fresh keys
+func Keystore(t *testing.T) *utils.Keystore {
+	t.Helper()
+
+	keystore, err := utils.NewKeystore()
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	return keystore
+}
+
+// PublicKey returns the public half of a fresh WireGuard key
+func PublicKey(t *testing.T) string {
+	t.Helper()
+
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey: %v", err)
+	}
+	return key.PublicKey().String()
+}
+
+// SetupExitCommand builds the SETUP_EXIT a SuperNode sends for a client session
+func SetupExitCommand(commandID, clientID, clientPubKey, sessionID string) *proto.Command {
+	return &proto.Command{
+		CommandId: commandID,
+		Type:      proto.CommandType_SETUP_EXIT,
+		Payload: map[string]string{
+			"client_id":     clientID,
+			"client_pubkey": clientPubKey,
+			"session_id":    sessionID,
+		},
+	}
+}
+
+// TeardownExitCommand builds the TEARDOWN_EXIT undoing SetupExitCommand
+func TeardownExitCommand(commandID, clientID, sessionID string) *proto.Command {
+	return &proto.Command{
+		CommandId: commandID,
+		Type:      proto.CommandType_TEARDOWN_EXIT,
+		Payload: map[string]string{
+			"client_id":  clientID,
+			"session_id": sessionID,
+		},
+	}
+}
+
+// ExpectClientPeer fails the test unless clientPubKey is the only peer on
+// the interface, allowed exactly its tunnel addresses ip and ip6
+func ExpectClientPeer(t *testing.T, wg *utils.MemoryWireGuardBackend, iface, clientPubKey, ip, ip6 string) {
+	t.Helper()
+
+	device, err := wg.GetDevice(iface)
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	if len(device.Peers) != 1 || device.Peers[0].PublicKey.String() != clientPubKey {
+		t.Fatalf("peers on %s %v, want only %s", iface, device.Peers, clientPubKey)
+	}
+
+	var allowed []string
+	for _, ipNet := range device.Peers[0].AllowedIPs {
+		allowed = append(allowed, ipNet.String())
+	}
+	if len(allowed) != 2 || allowed[0] != ip+"/32" || allowed[1] != ip6+"/128" {
+		t.Fatalf("peer allowed IPs %v, want [%s/32 %s/128]", allowed, ip, ip6)
+	}
+}
+
+// ExpectNoPeers fails the test if the interface has any peer
+func ExpectNoPeers(t *testing.T, wg *utils.MemoryWireGuardBackend, iface string) {
+	t.Helper()
+
+	device, err := wg.GetDevice(iface)
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	if len(device.Peers) != 0 {
+		t.Fatalf("%d peers on %s, want 0", len(device.Peers), iface)
+	}
+}
+
+// ExpectMetrics gathers a registry and fails the test if its collectors are
+// inconsistent or any of names was not reported
+func ExpectMetrics(t *testing.T, gatherer prometheus.Gatherer, names ...string) {
+	t.Helper()
+
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	gathered := make(map[string]bool)
+	for _, family := range families {
+		gathered[family.GetName()] = true
+	}
+	for _, name := range names {
+		if !gathered[name] {
+			t.Errorf("metric %s was not reported", name)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client certificate policies accepted by TLSOptions.ClientAuth
+const (
+	ClientAuthNone    = "none"    // Do not ask for a client certificate
+	ClientAuthRequest = "request" // Verify a client certificate if one is presented
+	ClientAuthRequire = "require" // Reject clients without a valid certificate
+)
+
+// TLSOptions configures transport security for gRPC servers and clients
+type TLSOptions struct {
+	CertFile   string // Certificate presented to peers (server cert, or client cert when dialing)
+	KeyFile    string
+	CAFile     string // CA bundle used to verify the remote side; system roots when empty on clients
+	ClientAuth string // Client certificate policy for servers
+	ServerName string // Overrides the name checked against the server certificate
+	Insecure   bool   // Use plaintext; must be requested explicitly
+}
+
+// RegisterTLSFlags registers the TLS command line flags shared by every binary
+func RegisterTLSFlags(fs *flag.FlagSet) *TLSOptions {
+	opts := &TLSOptions{}
+	fs.StringVar(&opts.CertFile, "tls-cert", "", "TLS certificate file (PEM)")
+	fs.StringVar(&opts.KeyFile, "tls-key", "", "TLS private key file (PEM)")
+	fs.StringVar(&opts.CAFile, "tls-ca", "", "CA bundle used to verify the remote side (PEM)")
+	fs.StringVar(&opts.ClientAuth, "tls-client-auth", ClientAuthNone, "Client certificate policy for servers (none, request, require)")
+	fs.StringVar(&opts.ServerName, "tls-server-name", "", "Override the server name verified when dialing")
+	fs.BoolVar(&opts.Insecure, "insecure", false, "Disable TLS and use plaintext gRPC")
+	return opts
+}
+
+// TLSCredentials builds gRPC transport credentials from TLSOptions.
+// Certificate, key and CA files are re-read when they change on disk, so
+// rotated certificates take effect on the next handshake without a restart.
+type TLSCredentials struct {
+	opts   TLSOptions
+	logger *logrus.Logger
+
+	cert      *tls.Certificate
+	certStamp string
+	caPool    *x509.CertPool
+	caStamp   string
+	mutex     sync.Mutex
+}
+
+// NewTLSCredentials validates the options and loads the initial certificate and CA bundle
+func NewTLSCredentials(opts *TLSOptions, logger *logrus.Logger) (*TLSCredentials, error) {
+	tc := &TLSCredentials{
+		opts:   *opts,
+		logger: logger,
+	}
+
+	if tc.opts.Insecure {
+		logger.Warn("TLS disabled; gRPC traffic is sent in plaintext")
+		return tc, nil
+	}
+
+	if (tc.opts.CertFile == "") != (tc.opts.KeyFile == "") {
+		return nil, fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+
+	switch tc.opts.ClientAuth {
+	case "", ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		if tc.opts.CAFile == "" {
+			return nil, fmt.Errorf("client certificate verification requires -tls-ca")
+		}
+	default:
+		return nil, fmt.Errorf("unknown client auth policy %q (want none, request or require)", tc.opts.ClientAuth)
+	}
+
+	if err := tc.reload(); err != nil {
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+// InsecureCredentials returns credentials for plaintext gRPC, for tests and in-process wiring
+func InsecureCredentials() *TLSCredentials {
+	return &TLSCredentials{opts: TLSOptions{Insecure: true}}
+}
+
+// IsInsecure reports whether TLS is disabled
+func (tc *TLSCredentials) IsInsecure() bool {
+	return tc.opts.Insecure
+}
+
+// VerifiesClientCerts reports whether servers verify the client certificates presented to them
+func (tc *TLSCredentials) VerifiesClientCerts() bool {
+	return !tc.opts.Insecure && (tc.opts.ClientAuth == ClientAuthRequest || tc.opts.ClientAuth == ClientAuthRequire)
+}
+
+// ServerOption returns the grpc.ServerOption carrying the server credentials
+func (tc *TLSCredentials) ServerOption() (grpc.ServerOption, error) {
+	if tc.opts.Insecure {
+		return grpc.Creds(insecure.NewCredentials()), nil
+	}
+
+	if tc.opts.CertFile == "" {
+		return nil, fmt.Errorf("serving TLS requires -tls-cert and -tls-key (or -insecure)")
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: tc.serverConfig,
+	}
+	return grpc.Creds(credentials.NewTLS(config)), nil
+}
+
+// DialOption returns the grpc.DialOption carrying the client credentials
+func (tc *TLSCredentials) DialOption() grpc.DialOption {
+	if tc.opts.Insecure {
+		return grpc.WithTransportCredentials(insecure.NewCredentials())
+	}
+
+	config := &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		ServerName:           tc.opts.ServerName,
+		GetClientCertificate: tc.clientCertificate,
+	}
+
+	// A custom CA bundle is verified by hand so that it can be reloaded;
+	// otherwise the standard verification against the system roots applies.
+	if tc.opts.CAFile != "" {
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = tc.verifyServer
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
+
+// serverConfig returns the per-handshake server configuration
+func (tc *TLSCredentials) serverConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	tc.maybeReload()
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*tc.cert},
+		ClientCAs:    tc.caPool,
+	}
+
+	switch tc.opts.ClientAuth {
+	case ClientAuthRequest:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		config.ClientAuth = tls.NoClientCert
+	}
+
+	return config, nil
+}
+
+// clientCertificate returns the certificate presented when a server asks for one
+func (tc *TLSCredentials) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	tc.maybeReload()
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	if tc.cert == nil {
+		// No certificate configured; the server decides whether that is acceptable
+		return &tls.Certificate{}, nil
+	}
+	return tc.cert, nil
+}
+
+// verifyServer verifies the server certificate chain and name against the configured CA bundle
+func (tc *TLSCredentials) verifyServer(cs tls.ConnectionState) error {
+	tc.maybeReload()
+
+	tc.mutex.Lock()
+	pool := tc.caPool
+	tc.mutex.Unlock()
+
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify server certificate: %w", err)
+	}
+	return nil
+}
+
+// maybeReload reloads the files if they changed, keeping the old material on failure
+func (tc *TLSCredentials) maybeReload() {
+	if err := tc.reload(); err != nil {
+		tc.logger.WithError(err).Warn("Failed to reload TLS files, keeping previous ones")
+	}
+}
+
+// reload re-reads the certificate, key and CA bundle whose modification stamps changed
+func (tc *TLSCredentials) reload() error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	if tc.opts.CertFile != "" {
+		stamp, err := fileStamp(tc.opts.CertFile, tc.opts.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		if stamp != tc.certStamp {
+			cert, err := tls.LoadX509KeyPair(tc.opts.CertFile, tc.opts.KeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to load TLS key pair: %w", err)
+			}
+
+			if tc.cert != nil {
+				tc.logger.WithField("cert", tc.opts.CertFile).Info("Reloaded TLS certificate")
+			}
+			tc.cert = &cert
+			tc.certStamp = stamp
+		}
+	}
+
+	if tc.opts.CAFile != "" {
+		stamp, err := fileStamp(tc.opts.CAFile)
+		if err != nil {
+			return err
+		}
+
+		if stamp != tc.caStamp {
+			pem, err := os.ReadFile(tc.opts.CAFile)
+			if err != nil {
+				return fmt.Errorf("failed to read CA bundle: %w", err)
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in CA bundle %s", tc.opts.CAFile)
+			}
+
+			if tc.caPool != nil {
+				tc.logger.WithField("ca", tc.opts.CAFile).Info("Reloaded TLS CA bundle")
+			}
+			tc.caPool = pool
+			tc.caStamp = stamp
+		}
+	}
+
+	return nil
+}
+
+// fileStamp summarizes the size and modification time of files to detect changes
+func fileStamp(paths ...string) (string, error) {
+	stamp := ""
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		stamp += fmt.Sprintf("%s:%d:%s;", path, info.Size(), info.ModTime().Format(time.RFC3339Nano))
+	}
+	return stamp, nil
+}
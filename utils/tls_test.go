@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testCA issues test certificates into a directory
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+// newTestCA creates a self-signed CA and writes its certificate to <name>.pem
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+
+	ca := &testCA{t: t, dir: dir, cert: cert, key: key, file: filepath.Join(dir, name+".pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate for name and its key to <file>.pem and <file>.key
+func (ca *testCA) issue(file, name string) (certFile, keyFile string) {
+	ca.t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatalf("GenerateKey: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		ca.t.Fatalf("serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		ca.t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+
+	certFile = filepath.Join(ca.dir, file+".pem")
+	keyFile = filepath.Join(ca.dir, file+".key")
+	writePEM(ca.t, certFile, "CERTIFICATE", der)
+	writePEM(ca.t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+// writePEM writes one PEM block, moving the modification time forward so
+// that a rewrite is always noticed
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		later := info.ModTime().Add(time.Second)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+}
+
+// testTLSLogger returns a logger that discards its output
+func testTLSLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// mustCredentials builds credentials or fails the test
+func mustCredentials(t *testing.T, opts TLSOptions) *TLSCredentials {
+	t.Helper()
+
+	tc, err := NewTLSCredentials(&opts, testTLSLogger())
+	if err != nil {
+		t.Fatalf("NewTLSCredentials: %v", err)
+	}
+	return tc
+}
+
+// serveHealth starts a gRPC server with the health service on a loopback port
+func serveHealth(t *testing.T, tc *TLSCredentials) string {
+	t.Helper()
+
+	option, err := tc.ServerOption()
+	if err != nil {
+		t.Fatalf("ServerOption: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	server := grpc.NewServer(option)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+// checkHealth calls the health service once and returns the error
+func checkHealth(t *testing.T, addr string, tc *TLSCredentials) error {
+	t.Helper()
+
+	conn, err := grpc.Dial(addr, tc.DialOption())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestNewTLSCredentialsValidatesOptions(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile := ca.issue("server", "server.test")
+
+	tests := []struct {
+		name string
+		opts TLSOptions
+	}{
+		{name: "cert without key", opts: TLSOptions{CertFile: certFile}},
+		{name: "key without cert", opts: TLSOptions{KeyFile: keyFile}},
+		{name: "client auth without CA", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}},
+		{name: "unknown client auth", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile, CAFile: ca.file, ClientAuth: "sometimes"}},
+		{name: "missing CA file", opts: TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "CA file without certificates", opts: TLSOptions{CAFile: keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTLSCredentials(&tt.opts, testTLSLogger()); err == nil {
+				t.Fatal("invalid options were accepted")
+			}
+		})
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	otherCA := newTestCA(t, dir, "other-ca")
+	serverCert, serverKey := ca.issue("server", "server.test")
+	clientCert, clientKey := ca.issue("client", "client.test")
+	foreignCert, foreignKey := otherCA.issue("foreign", "client.test")
+
+	addr := serveHealth(t, mustCredentials(t, TLSOptions{
+		CertFile:   serverCert,
+		KeyFile:    serverKey,
+		CAFile:     ca.file,
+		ClientAuth: ClientAuthRequire,
+	}))
+
+	tests := []struct {
+		name string
+		opts TLSOptions
+		ok   bool
+	}{
+		{
+			name: "client certificate from the CA",
+			opts: TLSOptions{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.file, ServerName: "server.test"},
+			ok:   true,
+		},
+		{
+			name: "no client certificate",
+			opts: TLSOptions{CAFile: ca.file, ServerName: "server.test"},
+		},
+		{
+			name: "client certificate from another CA",
+			opts: TLSOptions{CertFile: foreignCert, KeyFile: foreignKey, CAFile: ca.file, ServerName: "server.test"},
+		},
+		{
+			name: "server name not in the certificate",
+			opts: TLSOptions{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.file, ServerName: "other.test"},
+		},
+		{
+			name: "server certificate from another CA",
+			opts: TLSOptions{CertFile: clientCert, KeyFile: clientKey, CAFile: otherCA.file, ServerName: "server.test"},
+		},
+		{
+			name: "plaintext client",
+			opts: TLSOptions{Insecure: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHealth(t, addr, mustCredentials(t, tt.opts))
+			if tt.ok && err != nil {
+				t.Fatalf("Check failed: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("Check succeeded, want the handshake to fail")
+			}
+		})
+	}
+}
+
+func TestRequestedClientCertificateIsOptional(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	serverCert, serverKey := ca.issue("server", "server.test")
+
+	addr := serveHealth(t, mustCredentials(t, TLSOptions{
+		CertFile:   serverCert,
+		KeyFile:    serverKey,
+		CAFile:     ca.file,
+		ClientAuth: ClientAuthRequest,
+	}))
+
+	if err := checkHealth(t, addr, mustCredentials(t, TLSOptions{CAFile: ca.file, ServerName: "server.test"})); err != nil {
+		t.Fatalf("Check without a client certificate failed: %v", err)
+	}
+}
+
+func TestReloadPicksUpRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile := ca.issue("server", "server.test")
+
+	tc := mustCredentials(t, TLSOptions{CertFile: certFile, KeyFile: keyFile, CAFile: ca.file})
+	initial, err := tc.clientCertificate(nil)
+	if err != nil {
+		t.Fatalf("clientCertificate: %v", err)
+	}
+
+	// The certificate is re-read once the files change
+	ca.issue("server", "rotated.test")
+	rotated, err := tc.clientCertificate(nil)
+	if err != nil {
+		t.Fatalf("clientCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(rotated.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if leaf.Subject.CommonName != "rotated.test" {
+		t.Fatalf("certificate for %s after rotation, want rotated.test", leaf.Subject.CommonName)
+	}
+	if string(rotated.Certificate[0]) == string(initial.Certificate[0]) {
+		t.Fatal("certificate was not reloaded")
+	}
+
+	// A broken rewrite keeps the previous certificate
+	writePEM(t, certFile, "CERTIFICATE", []byte("not a certificate"))
+	kept, err := tc.clientCertificate(nil)
+	if err != nil {
+		t.Fatalf("clientCertificate: %v", err)
+	}
+	if string(kept.Certificate[0]) != string(rotated.Certificate[0]) {
+		t.Fatal("broken certificate file replaced the loaded certificate")
+	}
+
+	// A rotated CA bundle is used for the next verification
+	newCA := newTestCA(t, dir, "ca")
+	serverCert, _ := newCA.issue("server", "server.test")
+	if err := tc.verifyServer(connectionState(t, serverCert, "server.test")); err != nil {
+		t.Fatalf("certificate from the rotated CA was rejected: %v", err)
+	}
+	oldServerCert, _ := ca.issue("old-server", "server.test")
+	if err := tc.verifyServer(connectionState(t, oldServerCert, "server.test")); err == nil {
+		t.Fatal("certificate from the replaced CA was still accepted")
+	}
+}
+
+// connectionState returns the state of a handshake with the certificate in certFile
+func connectionState(t *testing.T, certFile, serverName string) tls.ConnectionState {
+	t.Helper()
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return tls.ConnectionState{ServerName: serverName, PeerCertificates: []*x509.Certificate{cert}}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// WireGuardBackend abstracts the WireGuard interface operations used by peers and SuperNodes
+type WireGuardBackend interface {
+	// Close releases any resources held by the backend
+	Close() error
+
+	// CreateInterface creates a WireGuard interface and brings it up
+	CreateInterface(interfaceName string) error
+
+	// InterfaceExists checks if a WireGuard interface exists
+	InterfaceExists(interfaceName string) bool
+
+	// DeleteInterface deletes a WireGuard interface
+	DeleteInterface(interfaceName string) error
+
+	// SetInterfacePrivateKey sets the private key for an interface
+	SetInterfacePrivateKey(interfaceName string, privateKey wgtypes.Key) error
+
+	// SetInterfaceListenPort sets the listen port for an interface
+	SetInterfaceListenPort(interfaceName string, port int) error
+
+	// AddPeer adds a peer to a WireGuard interface
+	AddPeer(interfaceName string, peerConfig PeerConfig) error
+
+	// RemovePeer removes a peer from a WireGuard interface
+	RemovePeer(interfaceName, publicKey string) error
+
+	// GetDevice gets device information
+	GetDevice(interfaceName string) (*wgtypes.Device, error)
+
+	// SetInterfaceIP adds an IP address to an interface
+	SetInterfaceIP(interfaceName, ipCIDR string) error
+
+	// RemoveInterfaceIP removes an IP address from an interface
+	RemoveInterfaceIP(interfaceName, ipCIDR string) error
+}
+
+// Ensure the kernel manager satisfies the backend interface
+var _ WireGuardBackend = (*WireGuardManager)(nil)
+
+// Backend names accepted by NewWireGuardBackend
+const (
+	BackendKernel    = "kernel"
+	BackendUserspace = "userspace"
+	BackendChannel   = "channel"
+	BackendMemory    = "memory"
+)
+
+// NewWireGuardBackend creates the named WireGuard backend
+func NewWireGuardBackend(kind string, logger *logrus.Logger) (WireGuardBackend, error) {
+	switch kind {
+	case BackendKernel, "":
+		return NewWireGuardManager()
+	case BackendUserspace:
+		return NewUserspaceWireGuardBackend(UserspaceTUN, logger)
+	case BackendChannel:
+		return NewUserspaceWireGuardBackend(UserspaceChannel, logger)
+	case BackendMemory:
+		return NewMemoryWireGuardBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown WireGuard backend %q (want kernel, userspace, channel or memory)", kind)
+	}
+}
@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// MemoryWireGuardBackend is an in-memory WireGuardBackend that records devices and peers.
+// It needs no privileges, so whole-cluster tests can share one instance. Peers added
+// with an endpoint report a handshake straight away, as a reachable peer would.
+type MemoryWireGuardBackend struct {
+	devices map[string]*memoryDevice
+	mutex   sync.RWMutex
+}
+
+// memoryDevice is the recorded state of one interface
+type memoryDevice struct {
+	privateKey wgtypes.Key
+	listenPort int
+	addresses  map[string]bool
+	peers      map[string]*memoryPeer // public key -> peer
+}
+
+// memoryPeer is the recorded state of one peer
+type memoryPeer struct {
+	publicKey     wgtypes.Key
+	endpoint      *net.UDPAddr
+	allowedIPs    []net.IPNet
+	keepalive     time.Duration
+	lastHandshake time.Time
+}
+
+// NewMemoryWireGuardBackend creates an empty in-memory backend
+func NewMemoryWireGuardBackend() *MemoryWireGuardBackend {
+	return &MemoryWireGuardBackend{
+		devices: make(map[string]*memoryDevice),
+	}
+}
+
+// Close is a no-op; recorded state survives so tests can inspect it afterwards
+func (mb *MemoryWireGuardBackend) Close() error {
+	return nil
+}
+
+// CreateInterface records a new interface
+func (mb *MemoryWireGuardBackend) CreateInterface(interfaceName string) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	if _, exists := mb.devices[interfaceName]; exists {
+		return nil // Interface already exists, no error
+	}
+
+	mb.devices[interfaceName] = &memoryDevice{
+		addresses: make(map[string]bool),
+		peers:     make(map[string]*memoryPeer),
+	}
+	return nil
+}
+
+// InterfaceExists checks if an interface has been created
+func (mb *MemoryWireGuardBackend) InterfaceExists(interfaceName string) bool {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+
+	_, exists := mb.devices[interfaceName]
+	return exists
+}
+
+// DeleteInterface forgets an interface and all of its peers
+func (mb *MemoryWireGuardBackend) DeleteInterface(interfaceName string) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	if _, exists := mb.devices[interfaceName]; !exists {
+		return fmt.Errorf("failed to delete interface %s: no such device", interfaceName)
+	}
+
+	delete(mb.devices, interfaceName)
+	return nil
+}
+
+// SetInterfacePrivateKey records the private key for an interface
+func (mb *MemoryWireGuardBackend) SetInterfacePrivateKey(interfaceName string, privateKey wgtypes.Key) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	device, err := mb.device(interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to set private key for %s: %w", interfaceName, err)
+	}
+
+	device.privateKey = privateKey
+	return nil
+}
+
+// SetInterfaceListenPort records the listen port for an interface
+func (mb *MemoryWireGuardBackend) SetInterfaceListenPort(interfaceName string, port int) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	device, err := mb.device(interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to set listen port for %s: %w", interfaceName, err)
+	}
+
+	device.listenPort = port
+	return nil
+}
+
+// AddPeer records a peer, replacing any existing peer with the same public key
+func (mb *MemoryWireGuardBackend) AddPeer(interfaceName string, peerConfig PeerConfig) error {
+	publicKey, err := wgtypes.ParseKey(peerConfig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	var endpoint *net.UDPAddr
+	if peerConfig.Endpoint != "" {
+		endpoint, err = net.ResolveUDPAddr("udp", peerConfig.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint: %w", err)
+		}
+	}
+
+	allowedIPs := make([]net.IPNet, len(peerConfig.AllowedIPs))
+	for i, ipStr := range peerConfig.AllowedIPs {
+		_, ipNet, err := net.ParseCIDR(ipStr)
+		if err != nil {
+			return fmt.Errorf("invalid allowed IP %s: %w", ipStr, err)
+		}
+		allowedIPs[i] = *ipNet
+	}
+
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	device, err := mb.device(interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to add peer to %s: %w", interfaceName, err)
+	}
+
+	peer := &memoryPeer{
+		publicKey:  publicKey,
+		endpoint:   endpoint,
+		allowedIPs: allowedIPs,
+		keepalive:  peerConfig.PersistentKeepalive,
+	}
+	if existing, exists := device.peers[publicKey.String()]; exists {
+		peer.lastHandshake = existing.lastHandshake
+	}
+	if endpoint != nil && peer.lastHandshake.IsZero() {
+		peer.lastHandshake = time.Now()
+	}
+
+	device.peers[publicKey.String()] = peer
+	return nil
+}
+
+// RemovePeer forgets a peer
+func (mb *MemoryWireGuardBackend) RemovePeer(interfaceName, publicKey string) error {
+	pubKey, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	device, err := mb.device(interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to remove peer from %s: %w", interfaceName, err)
+	}
+
+	delete(device.peers, pubKey.String())
+	return nil
+}
+
+// GetDevice returns a snapshot of the recorded interface state
+func (mb *MemoryWireGuardBackend) GetDevice(interfaceName string) (*wgtypes.Device, error) {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+
+	device, err := mb.device(interfaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device %s: %w", interfaceName, err)
+	}
+
+	result := &wgtypes.Device{
+		Name:       interfaceName,
+		Type:       wgtypes.Userspace,
+		PrivateKey: device.privateKey,
+		ListenPort: device.listenPort,
+	}
+	if device.privateKey != (wgtypes.Key{}) {
+		result.PublicKey = device.privateKey.PublicKey()
+	}
+
+	for _, peer := range device.peers {
+		result.Peers = append(result.Peers, wgtypes.Peer{
+			PublicKey:                   peer.publicKey,
+			Endpoint:                    peer.endpoint,
+			AllowedIPs:                  append([]net.IPNet(nil), peer.allowedIPs...),
+			PersistentKeepaliveInterval: peer.keepalive,
+			LastHandshakeTime:           peer.lastHandshake,
+		})
+	}
+	sort.Slice(result.Peers, func(i, j int) bool {
+		return result.Peers[i].PublicKey.String() < result.Peers[j].PublicKey.String()
+	})
+
+	return result, nil
+}
+
+// SetInterfaceIP records an address on an interface
+func (mb *MemoryWireGuardBackend) SetInterfaceIP(interfaceName, ipCIDR string) error {
+	if _, _, err := net.ParseCIDR(ipCIDR); err != nil {
+		return fmt.Errorf("failed to set IP %s for interface %s: %w", ipCIDR, interfaceName, err)
+	}
+
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	device, err := mb.device(interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to set IP %s for interface %s: %w", ipCIDR, interfaceName, err)
+	}
+
+	// Mirror the kernel, which refuses duplicate addresses
+	if device.addresses[ipCIDR] {
+		return fmt.Errorf("failed to set IP %s for interface %s: address already assigned", ipCIDR, interfaceName)
+	}
+
+	device.addresses[ipCIDR] = true
+	return nil
+}
+
+// RemoveInterfaceIP forgets an address on an interface
+func (mb *MemoryWireGuardBackend) RemoveInterfaceIP(interfaceName, ipCIDR string) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	device, err := mb.device(interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to remove IP %s from interface %s: %w", ipCIDR, interfaceName, err)
+	}
+
+	if !device.addresses[ipCIDR] {
+		return fmt.Errorf("failed to remove IP %s from interface %s: address not assigned", ipCIDR, interfaceName)
+	}
+
+	delete(device.addresses, ipCIDR)
+	return nil
+}
+
+// InterfaceIPs returns the addresses recorded on an interface, sorted
+func (mb *MemoryWireGuardBackend) InterfaceIPs(interfaceName string) []string {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+
+	device, exists := mb.devices[interfaceName]
+	if !exists {
+		return nil
+	}
+
+	var addresses []string
+	for address := range device.addresses {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// Interfaces returns the names of all recorded interfaces, sorted
+func (mb *MemoryWireGuardBackend) Interfaces() []string {
+	mb.mutex.RLock()
+	defer mb.mutex.RUnlock()
+
+	var names []string
+	for name := range mb.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// device looks up an interface; callers must hold the mutex
+func (mb *MemoryWireGuardBackend) device(interfaceName string) (*memoryDevice, error) {
+	device, exists := mb.devices[interfaceName]
+	if !exists {
+		return nil, fmt.Errorf("no such device")
+	}
+	return device, nil
+}
+
+// Ensure the in-memory backend satisfies the backend interface
+var _ WireGuardBackend = (*MemoryWireGuardBackend)(nil)
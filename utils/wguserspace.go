@@ -0,0 +1,445 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/tuntest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// UserspaceMode selects the packet device behind a userspace WireGuard interface
+type UserspaceMode string
+
+const (
+	// UserspaceTUN runs wireguard-go over a real TUN device (needs CAP_NET_ADMIN, not the kernel module)
+	UserspaceTUN UserspaceMode = "tun"
+	// UserspaceChannel runs wireguard-go over an in-process channel TUN (needs no privileges)
+	UserspaceChannel UserspaceMode = "channel"
+)
+
+// UserspaceWireGuardBackend runs wireguard-go in-process instead of using the kernel module
+type UserspaceWireGuardBackend struct {
+	mode    UserspaceMode
+	logger  *logrus.Logger
+	devices map[string]*userspaceDevice
+	mutex   sync.RWMutex
+}
+
+// userspaceDevice is one wireguard-go device and its packet source
+type userspaceDevice struct {
+	device    *device.Device
+	tunDevice tun.Device
+	channel   *tuntest.ChannelTUN // Only set in channel mode
+	addresses map[string]bool     // Only used in channel mode
+}
+
+// NewUserspaceWireGuardBackend creates a wireguard-go backend in the given mode
+func NewUserspaceWireGuardBackend(mode UserspaceMode, logger *logrus.Logger) (*UserspaceWireGuardBackend, error) {
+	if mode != UserspaceTUN && mode != UserspaceChannel {
+		return nil, fmt.Errorf("unknown userspace mode: %s", mode)
+	}
+
+	return &UserspaceWireGuardBackend{
+		mode:    mode,
+		logger:  logger,
+		devices: make(map[string]*userspaceDevice),
+	}, nil
+}
+
+// Close shuts down every device created by this backend
+func (ub *UserspaceWireGuardBackend) Close() error {
+	ub.mutex.Lock()
+	defer ub.mutex.Unlock()
+
+	for name, dev := range ub.devices {
+		dev.device.Close()
+		delete(ub.devices, name)
+	}
+	return nil
+}
+
+// CreateInterface creates a wireguard-go device and brings it up
+func (ub *UserspaceWireGuardBackend) CreateInterface(interfaceName string) error {
+	ub.mutex.Lock()
+	defer ub.mutex.Unlock()
+
+	if _, exists := ub.devices[interfaceName]; exists {
+		return nil // Interface already exists, no error
+	}
+
+	dev := &userspaceDevice{
+		addresses: make(map[string]bool),
+	}
+
+	switch ub.mode {
+	case UserspaceTUN:
+		tunDevice, err := tun.CreateTUN(interfaceName, device.DefaultMTU)
+		if err != nil {
+			return fmt.Errorf("failed to create TUN device %s: %w", interfaceName, err)
+		}
+		dev.tunDevice = tunDevice
+	case UserspaceChannel:
+		dev.channel = tuntest.NewChannelTUN()
+		dev.tunDevice = dev.channel.TUN()
+	}
+
+	dev.device = device.NewDevice(dev.tunDevice, conn.NewDefaultBind(), ub.deviceLogger(interfaceName))
+
+	if err := dev.device.Up(); err != nil {
+		dev.device.Close()
+		return fmt.Errorf("failed to bring up interface %s: %w", interfaceName, err)
+	}
+
+	if ub.mode == UserspaceTUN {
+		cmd := exec.Command("ip", "link", "set", interfaceName, "up")
+		if err := cmd.Run(); err != nil {
+			dev.device.Close()
+			return fmt.Errorf("failed to bring up interface %s: %w", interfaceName, err)
+		}
+	}
+
+	ub.devices[interfaceName] = dev
+	return nil
+}
+
+// InterfaceExists checks if a device has been created
+func (ub *UserspaceWireGuardBackend) InterfaceExists(interfaceName string) bool {
+	ub.mutex.RLock()
+	defer ub.mutex.RUnlock()
+
+	_, exists := ub.devices[interfaceName]
+	return exists
+}
+
+// DeleteInterface closes a device; closing the TUN removes the kernel link too
+func (ub *UserspaceWireGuardBackend) DeleteInterface(interfaceName string) error {
+	ub.mutex.Lock()
+	defer ub.mutex.Unlock()
+
+	dev, exists := ub.devices[interfaceName]
+	if !exists {
+		return fmt.Errorf("failed to delete interface %s: no such device", interfaceName)
+	}
+
+	dev.device.Close()
+	delete(ub.devices, interfaceName)
+	return nil
+}
+
+// SetInterfacePrivateKey sets the private key for an interface
+func (ub *UserspaceWireGuardBackend) SetInterfacePrivateKey(interfaceName string, privateKey wgtypes.Key) error {
+	config := fmt.Sprintf("private_key=%s\n", hex.EncodeToString(privateKey[:]))
+	if err := ub.ipcSet(interfaceName, config); err != nil {
+		return fmt.Errorf("failed to set private key for %s: %w", interfaceName, err)
+	}
+	return nil
+}
+
+// SetInterfaceListenPort sets the listen port for an interface
+func (ub *UserspaceWireGuardBackend) SetInterfaceListenPort(interfaceName string, port int) error {
+	config := fmt.Sprintf("listen_port=%d\n", port)
+	if err := ub.ipcSet(interfaceName, config); err != nil {
+		return fmt.Errorf("failed to set listen port for %s: %w", interfaceName, err)
+	}
+	return nil
+}
+
+// AddPeer adds a peer to an interface, replacing its allowed IPs if it already exists
+func (ub *UserspaceWireGuardBackend) AddPeer(interfaceName string, peerConfig PeerConfig) error {
+	publicKey, err := wgtypes.ParseKey(peerConfig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	var config strings.Builder
+	config.WriteString(fmt.Sprintf("public_key=%s\n", hex.EncodeToString(publicKey[:])))
+
+	if peerConfig.Endpoint != "" {
+		endpoint, err := net.ResolveUDPAddr("udp", peerConfig.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid endpoint: %w", err)
+		}
+		config.WriteString(fmt.Sprintf("endpoint=%s\n", endpoint.String()))
+	}
+
+	if peerConfig.PersistentKeepalive > 0 {
+		config.WriteString(fmt.Sprintf("persistent_keepalive_interval=%d\n", int(peerConfig.PersistentKeepalive.Seconds())))
+	}
+
+	config.WriteString("replace_allowed_ips=true\n")
+	for _, ipStr := range peerConfig.AllowedIPs {
+		_, ipNet, err := net.ParseCIDR(ipStr)
+		if err != nil {
+			return fmt.Errorf("invalid allowed IP %s: %w", ipStr, err)
+		}
+		config.WriteString(fmt.Sprintf("allowed_ip=%s\n", ipNet.String()))
+	}
+
+	if err := ub.ipcSet(interfaceName, config.String()); err != nil {
+		return fmt.Errorf("failed to add peer to %s: %w", interfaceName, err)
+	}
+	return nil
+}
+
+// RemovePeer removes a peer from an interface
+func (ub *UserspaceWireGuardBackend) RemovePeer(interfaceName, publicKey string) error {
+	pubKey, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	config := fmt.Sprintf("public_key=%s\nremove=true\n", hex.EncodeToString(pubKey[:]))
+	if err := ub.ipcSet(interfaceName, config); err != nil {
+		return fmt.Errorf("failed to remove peer from %s: %w", interfaceName, err)
+	}
+	return nil
+}
+
+// GetDevice reads the device state over the UAPI protocol
+func (ub *UserspaceWireGuardBackend) GetDevice(interfaceName string) (*wgtypes.Device, error) {
+	ub.mutex.RLock()
+	dev, exists := ub.devices[interfaceName]
+	ub.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("failed to get device %s: no such device", interfaceName)
+	}
+
+	uapi, err := dev.device.IpcGet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device %s: %w", interfaceName, err)
+	}
+
+	result, err := parseUAPIDevice(uapi)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device %s: %w", interfaceName, err)
+	}
+
+	result.Name = interfaceName
+	return result, nil
+}
+
+// SetInterfaceIP adds an address to the TUN link, or records it in channel mode
+func (ub *UserspaceWireGuardBackend) SetInterfaceIP(interfaceName, ipCIDR string) error {
+	if ub.mode == UserspaceTUN {
+		cmd := exec.Command("ip", "addr", "add", ipCIDR, "dev", interfaceName)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to set IP %s for interface %s: %w", ipCIDR, interfaceName, err)
+		}
+		return nil
+	}
+
+	if _, _, err := net.ParseCIDR(ipCIDR); err != nil {
+		return fmt.Errorf("failed to set IP %s for interface %s: %w", ipCIDR, interfaceName, err)
+	}
+
+	ub.mutex.Lock()
+	defer ub.mutex.Unlock()
+
+	dev, exists := ub.devices[interfaceName]
+	if !exists {
+		return fmt.Errorf("failed to set IP %s for interface %s: no such device", ipCIDR, interfaceName)
+	}
+
+	if dev.addresses[ipCIDR] {
+		return fmt.Errorf("failed to set IP %s for interface %s: address already assigned", ipCIDR, interfaceName)
+	}
+
+	dev.addresses[ipCIDR] = true
+	return nil
+}
+
+// RemoveInterfaceIP removes an address from the TUN link, or forgets it in channel mode
+func (ub *UserspaceWireGuardBackend) RemoveInterfaceIP(interfaceName, ipCIDR string) error {
+	if ub.mode == UserspaceTUN {
+		cmd := exec.Command("ip", "addr", "del", ipCIDR, "dev", interfaceName)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to remove IP %s from interface %s: %w", ipCIDR, interfaceName, err)
+		}
+		return nil
+	}
+
+	ub.mutex.Lock()
+	defer ub.mutex.Unlock()
+
+	dev, exists := ub.devices[interfaceName]
+	if !exists || !dev.addresses[ipCIDR] {
+		return fmt.Errorf("failed to remove IP %s from interface %s: address not assigned", ipCIDR, interfaceName)
+	}
+
+	delete(dev.addresses, ipCIDR)
+	return nil
+}
+
+// ChannelTUN returns the in-process packet device of a channel-mode interface.
+// Tests use its Inbound and Outbound channels to push packets through the tunnel.
+func (ub *UserspaceWireGuardBackend) ChannelTUN(interfaceName string) (*tuntest.ChannelTUN, error) {
+	ub.mutex.RLock()
+	defer ub.mutex.RUnlock()
+
+	dev, exists := ub.devices[interfaceName]
+	if !exists {
+		return nil, fmt.Errorf("no such device: %s", interfaceName)
+	}
+	if dev.channel == nil {
+		return nil, fmt.Errorf("interface %s is not in channel mode", interfaceName)
+	}
+	return dev.channel, nil
+}
+
+// ipcSet applies a UAPI "set" operation to a device
+func (ub *UserspaceWireGuardBackend) ipcSet(interfaceName, config string) error {
+	ub.mutex.RLock()
+	dev, exists := ub.devices[interfaceName]
+	ub.mutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("no such device")
+	}
+
+	return dev.device.IpcSet(config)
+}
+
+// deviceLogger routes wireguard-go logs through logrus
+func (ub *UserspaceWireGuardBackend) deviceLogger(interfaceName string) *device.Logger {
+	entry := ub.logger.WithField("interface", interfaceName)
+	return &device.Logger{
+		Verbosef: entry.Debugf,
+		Errorf:   entry.Errorf,
+	}
+}
+
+// parseUAPIDevice converts a UAPI "get" response into a wgtypes.Device
+func parseUAPIDevice(uapi string) (*wgtypes.Device, error) {
+	result := &wgtypes.Device{Type: wgtypes.Userspace}
+	var peer *wgtypes.Peer
+	var handshakeSec, handshakeNsec int64
+
+	flushPeer := func() {
+		if peer != nil {
+			if handshakeSec != 0 || handshakeNsec != 0 {
+				peer.LastHandshakeTime = time.Unix(handshakeSec, handshakeNsec)
+			}
+			result.Peers = append(result.Peers, *peer)
+		}
+		peer = nil
+		handshakeSec, handshakeNsec = 0, 0
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(uapi))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+
+		switch key {
+		case "private_key":
+			k, err := parseHexKey(value)
+			if err != nil {
+				return nil, err
+			}
+			result.PrivateKey = k
+			result.PublicKey = k.PublicKey()
+		case "listen_port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid listen_port: %w", err)
+			}
+			result.ListenPort = port
+		case "fwmark":
+			mark, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fwmark: %w", err)
+			}
+			result.FirewallMark = mark
+		case "public_key":
+			flushPeer()
+			k, err := parseHexKey(value)
+			if err != nil {
+				return nil, err
+			}
+			peer = &wgtypes.Peer{PublicKey: k}
+		case "errno":
+			if value != "0" {
+				return nil, fmt.Errorf("device returned errno %s", value)
+			}
+		default:
+			if peer == nil {
+				continue
+			}
+			if err := parseUAPIPeerLine(peer, key, value, &handshakeSec, &handshakeNsec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	flushPeer()
+
+	return result, scanner.Err()
+}
+
+// parseUAPIPeerLine applies a single peer attribute from a UAPI "get" response
+func parseUAPIPeerLine(peer *wgtypes.Peer, key, value string, handshakeSec, handshakeNsec *int64) error {
+	var err error
+
+	switch key {
+	case "preshared_key":
+		peer.PresharedKey, err = parseHexKey(value)
+	case "protocol_version":
+		peer.ProtocolVersion, err = strconv.Atoi(value)
+	case "endpoint":
+		peer.Endpoint, err = net.ResolveUDPAddr("udp", value)
+	case "last_handshake_time_sec":
+		*handshakeSec, err = strconv.ParseInt(value, 10, 64)
+	case "last_handshake_time_nsec":
+		*handshakeNsec, err = strconv.ParseInt(value, 10, 64)
+	case "tx_bytes":
+		peer.TransmitBytes, err = strconv.ParseInt(value, 10, 64)
+	case "rx_bytes":
+		peer.ReceiveBytes, err = strconv.ParseInt(value, 10, 64)
+	case "persistent_keepalive_interval":
+		var seconds int
+		seconds, err = strconv.Atoi(value)
+		peer.PersistentKeepaliveInterval = time.Duration(seconds) * time.Second
+	case "allowed_ip":
+		var ipNet *net.IPNet
+		_, ipNet, err = net.ParseCIDR(value)
+		if err == nil {
+			peer.AllowedIPs = append(peer.AllowedIPs, *ipNet)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+// parseHexKey parses a hex-encoded UAPI key
+func parseHexKey(value string) (wgtypes.Key, error) {
+	raw, err := hex.DecodeString(value)
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("invalid key encoding: %w", err)
+	}
+	return wgtypes.NewKey(raw)
+}
+
+// Ensure the userspace backend satisfies the backend interface
+var _ WireGuardBackend = (*UserspaceWireGuardBackend)(nil)
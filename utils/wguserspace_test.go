@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestUserspaceBackendPeers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	backend, err := NewUserspaceWireGuardBackend(UserspaceChannel, logger)
+	if err != nil {
+		t.Fatalf("NewUserspaceWireGuardBackend: %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+
+	const iface = "wg-test"
+	if err := backend.CreateInterface(iface); err != nil {
+		t.Fatalf("CreateInterface: %v", err)
+	}
+	if !backend.InterfaceExists(iface) {
+		t.Fatal("interface does not exist after CreateInterface")
+	}
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey: %v", err)
+	}
+	if err := backend.SetInterfacePrivateKey(iface, privateKey); err != nil {
+		t.Fatalf("SetInterfacePrivateKey: %v", err)
+	}
+	if err := backend.SetInterfaceListenPort(iface, 0); err != nil {
+		t.Fatalf("SetInterfaceListenPort: %v", err)
+	}
+
+	peerKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("GeneratePrivateKey: %v", err)
+	}
+	peerConfig := PeerConfig{
+		PublicKey:           peerKey.PublicKey().String(),
+		Endpoint:            "127.0.0.1:51999",
+		AllowedIPs:          []string{"10.9.0.2/32", "fd4d:7976:706e:9::2/128"},
+		PersistentKeepalive: 25 * time.Second,
+	}
+	if err := backend.AddPeer(iface, peerConfig); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	device, err := backend.GetDevice(iface)
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	if device.Name != iface {
+		t.Fatalf("device name %q, want %q", device.Name, iface)
+	}
+	if device.PublicKey != privateKey.PublicKey() {
+		t.Fatalf("device public key %s, want %s", device.PublicKey, privateKey.PublicKey())
+	}
+	if len(device.Peers) != 1 {
+		t.Fatalf("%d peers, want 1", len(device.Peers))
+	}
+
+	peer := device.Peers[0]
+	if peer.PublicKey != peerKey.PublicKey() {
+		t.Fatalf("peer public key %s, want %s", peer.PublicKey, peerKey.PublicKey())
+	}
+	if peer.Endpoint == nil || peer.Endpoint.String() != peerConfig.Endpoint {
+		t.Fatalf("peer endpoint %v, want %s", peer.Endpoint, peerConfig.Endpoint)
+	}
+	if peer.PersistentKeepaliveInterval != peerConfig.PersistentKeepalive {
+		t.Fatalf("peer keepalive %v, want %v", peer.PersistentKeepaliveInterval, peerConfig.PersistentKeepalive)
+	}
+	allowed := make(map[string]bool)
+	for _, ipNet := range peer.AllowedIPs {
+		allowed[ipNet.String()] = true
+	}
+	for _, want := range peerConfig.AllowedIPs {
+		if !allowed[want] {
+			t.Fatalf("peer allowed IPs %v, want %v", peer.AllowedIPs, peerConfig.AllowedIPs)
+		}
+	}
+	if len(allowed) != len(peerConfig.AllowedIPs) {
+		t.Fatalf("peer allowed IPs %v, want %v", peer.AllowedIPs, peerConfig.AllowedIPs)
+	}
+
+	if err := backend.RemovePeer(iface, peerConfig.PublicKey); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+
+	device, err = backend.GetDevice(iface)
+	if err != nil {
+		t.Fatalf("GetDevice: %v", err)
+	}
+	if len(device.Peers) != 0 {
+		t.Fatalf("%d peers after RemovePeer, want 0", len(device.Peers))
+	}
+
+	if err := backend.DeleteInterface(iface); err != nil {
+		t.Fatalf("DeleteInterface: %v", err)
+	}
+	if _, err := backend.GetDevice(iface); err == nil {
+		t.Fatal("GetDevice succeeded after DeleteInterface")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"os/exec"
 	"strings"
+	"time"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -45,9 +46,7 @@ func (wm *WireGuardManager) CreateInterface(interfaceName string) error {
 	// Use ip command to create the interface
 	cmd := exec.Command("ip", "link", "add", interfaceName, "type", "wireguard")
 	if err := cmd.Run(); err != nil {
-		// If we can't create interface due to permissions, log but don't fail
-		// This allows development/testing without root
-		// return fmt.Errorf("failed to create interface %s (try running with sudo): %w", interfaceName, err)
+		return fmt.Errorf("failed to create interface %s (needs root and the wireguard kernel module; see -wg-backend): %w", interfaceName, err)
 	}
 
 	// Bring the interface up
@@ -100,7 +99,7 @@ func (wm *WireGuardManager) SetInterfaceListenPort(interfaceName string, port in
 	return nil
 }
 
-// AddPeer adds a peer to a WireGuard interface
+// AddPeer adds a peer to a WireGuard interface, replacing its allowed IPs if it already exists
 func (wm *WireGuardManager) AddPeer(interfaceName string, peerConfig PeerConfig) error {
 	publicKey, err := wgtypes.ParseKey(peerConfig.PublicKey)
 	if err != nil {
@@ -125,9 +124,13 @@ func (wm *WireGuardManager) AddPeer(interfaceName string, peerConfig PeerConfig)
 	}
 
 	peer := wgtypes.PeerConfig{
-		PublicKey:  publicKey,
-		Endpoint:   endpoint,
-		AllowedIPs: allowedIPs,
+		PublicKey:         publicKey,
+		Endpoint:          endpoint,
+		ReplaceAllowedIPs: true,
+		AllowedIPs:        allowedIPs,
+	}
+	if peerConfig.PersistentKeepalive > 0 {
+		peer.PersistentKeepaliveInterval = &peerConfig.PersistentKeepalive
 	}
 
 	config := wgtypes.Config{
@@ -182,11 +185,24 @@ func (wm *WireGuardManager) SetInterfaceIP(interfaceName, ipCIDR string) error {
 	return nil
 }
 
+// RemoveInterfaceIP removes an IP address from an interface
+func (wm *WireGuardManager) RemoveInterfaceIP(interfaceName, ipCIDR string) error {
+	cmd := exec.Command("ip", "addr", "del", ipCIDR, "dev", interfaceName)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to remove IP %s from interface %s: %w", ipCIDR, interfaceName, err)
+	}
+	return nil
+}
+
 // PeerConfig represents a peer configuration
 type PeerConfig struct {
 	PublicKey  string
 	Endpoint   string
 	AllowedIPs []string
+
+	// PersistentKeepalive makes the peer send keepalives, and so handshake,
+	// even when no traffic is routed to it; zero leaves keepalives off
+	PersistentKeepalive time.Duration
 }
 
 // GenerateKey generates a new WireGuard private key